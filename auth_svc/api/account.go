@@ -0,0 +1,141 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/token"
+	"auth/util"
+	"auth/worker"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+)
+
+var (
+	errUserDisabled  = errors.New("user is disabled")
+	errWrongPassword = errors.New("current password is wrong")
+)
+
+// currentUser returns the user of the access token of the request. It
+// answers with an error when it returns false.
+func (server *Server) currentUser(ctx *gin.Context) (db.User, bool) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// The user was deleted after the token was issued.
+			ctx.JSON(http.StatusUnauthorized, errorResponse(token.ErrRevokedToken))
+			return db.User{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.User{}, false
+	}
+	return user, true
+}
+
+func (server *Server) getCurrentUser(ctx *gin.Context) {
+	user, ok := server.currentUser(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type updateCurrentUserRequest struct {
+	FullName *string `json:"full_name" binding:"omitempty,max=100"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+}
+
+// updateCurrentUser updates the profile of the user. A new email is not
+// set here: a link to verify it is mailed to it, and it replaces the
+// current email once the link is opened.
+func (server *Server) updateCurrentUser(ctx *gin.Context) {
+	var req updateCurrentUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, ok := server.currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	if req.FullName != nil {
+		var err error
+		user, err = server.store.UpdateUser(ctx, db.UpdateUserParams{
+			Username: user.Username,
+			FullName: sql.NullString{String: *req.FullName, Valid: true},
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	if req.Email != nil && *req.Email != user.Email {
+		err := server.distributor.DistributeTaskSendVerifyEmail(ctx,
+			&worker.PayloadSendVerifyEmail{Username: user.Username, Email: *req.Email},
+			asynq.MaxRetry(10),
+			asynq.Queue(worker.QueueCritical),
+		)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// changePassword sets a new password for the user, who must know the
+// current one. Wrong passwords count as failed logins. All the tokens
+// issued to the user so far are revoked, and it answers like a login with
+// a new one.
+func (server *Server) changePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	user, ok := server.currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	if !server.checkLoginAllowed(ctx, user.Username) {
+		return
+	}
+	if err := util.CheckPassword(req.CurrentPassword, user.HashedPassword); err != nil {
+		server.loginFailed(ctx, user.Username, errWrongPassword)
+		return
+	}
+
+	hashedPassword, ok := server.hashNewPassword(ctx, user.TenantID, req.NewPassword)
+	if !ok {
+		return
+	}
+	user, err := server.store.UpdateUser(ctx, db.UpdateUserParams{
+		Username:          user.Username,
+		HashedPassword:    sql.NullString{String: hashedPassword, Valid: true},
+		PasswordChangedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if err := server.denylist.RevokeUser(ctx, user.Username, server.config.AccessTokenDuration); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.issueAccessToken(ctx, user)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// newAccountTest returns a test server and a function that sends requests
+// to it, as the user of accessToken unless it is empty.
+func newAccountTest(t *testing.T, mailer mail.Sender) (*Server, func(method, path, accessToken, body string, status int) map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, mailer)
+	send := func(method, path, accessToken, body string, status int) map[string]interface{} {
+		req := httptest.NewRequest(method, "http://localhost:6061"+path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := validate(t, router, server.router, req, body, status)
+		var rsp map[string]interface{}
+		if w.Body.Len() > 0 {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		}
+		return rsp
+	}
+	return server, send
+}
+
+// adminRequest sends a request to the admin handler of server.
+func adminRequest(t *testing.T, server *Server, method, path, body string, status int) map[string]interface{} {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(w, req)
+	require.Equal(t, status, w.Code, w.Body.String())
+
+	var rsp map[string]interface{}
+	if w.Body.Len() > 0 && w.Body.Bytes()[0] == '{' {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	}
+	return rsp
+}
+
+func TestCurrentUser(t *testing.T) {
+	mailer := &mail.MemorySender{}
+	server, send := newAccountTest(t, mailer)
+
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com"}`, http.StatusOK)
+	accessToken := send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusOK)["access_token"].(string)
+
+	send(http.MethodGet, "/users/me", "", "", http.StatusUnauthorized)
+	user := send(http.MethodGet, "/users/me", accessToken, "", http.StatusOK)
+	require.Equal(t, "john", user["username"])
+	require.Equal(t, "", user["full_name"])
+	require.Nil(t, user["student_id"])
+
+	user = send(http.MethodPatch, "/users/me", accessToken, `{"full_name":"John Doe"}`, http.StatusOK)
+	require.Equal(t, "John Doe", user["full_name"])
+
+	// A new email replaces the current one once it is verified.
+	user = send(http.MethodPatch, "/users/me", accessToken, `{"email":"johnny@example.com"}`, http.StatusOK)
+	require.Equal(t, "john@example.com", user["email"])
+	verify := lastToken(t, mailer, "johnny@example.com")
+	send(http.MethodPost, "/users/verify_email", "", `{"token":"`+verify+`"}`, http.StatusOK)
+	user = send(http.MethodGet, "/users/me", accessToken, "", http.StatusOK)
+	require.Equal(t, "johnny@example.com", user["email"])
+	require.Equal(t, true, user["is_email_verified"])
+	require.Equal(t, "John Doe", server.store.(*stubStore).users["john"].FullName)
+}
+
+func TestChangePassword(t *testing.T) {
+	_, send := newAccountTest(t, &mail.MemorySender{})
+
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com"}`, http.StatusOK)
+	login := send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusOK)
+	accessToken := login["access_token"].(string)
+	otherToken := send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusOK)["access_token"].(string)
+
+	send(http.MethodPost, "/users/me/password", accessToken, `{"current_password":"wrong","new_password":"secret2"}`, http.StatusUnauthorized)
+
+	// The tokens issued before are revoked, the new one is not.
+	rsp := send(http.MethodPost, "/users/me/password", accessToken, `{"current_password":"secret","new_password":"secret2"}`, http.StatusOK)
+	send(http.MethodGet, "/users/me", accessToken, "", http.StatusUnauthorized)
+	send(http.MethodGet, "/users/me", otherToken, "", http.StatusUnauthorized)
+	send(http.MethodGet, "/users/me", rsp["access_token"].(string), "", http.StatusOK)
+
+	send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusUnauthorized)
+	send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret2"}`, http.StatusOK)
+}
+
+func TestAdminUsers(t *testing.T) {
+	server, send := newAccountTest(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+
+	for _, username := range []string{"john", "jane", "bob"} {
+		send(http.MethodPost, "/users", "", `{"username":"`+username+`","password":"secret","email":"`+username+`@example.com"}`, http.StatusOK)
+	}
+	login := func(username string, status int) string {
+		rsp := send(http.MethodPost, "/users/login", "", `{"username":"`+username+`","password":"secret"}`, status)
+		accessToken, _ := rsp["access_token"].(string)
+		return accessToken
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users?limit=2&offset=1", nil)
+	w := httptest.NewRecorder()
+	server.AdminHandler().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 2)
+	require.Equal(t, "jane", users[0]["username"])
+	require.Equal(t, "john", users[1]["username"])
+	adminRequest(t, server, http.MethodGet, "/admin/users?limit=1000", "", http.StatusBadRequest)
+
+	// A disabled user can not log in, and their tokens are revoked.
+	accessToken := login("john", http.StatusOK)
+	user := adminRequest(t, server, http.MethodPost, "/admin/users/john/disable", "", http.StatusOK)
+	require.Equal(t, true, user["is_disabled"])
+	send(http.MethodGet, "/users/me", accessToken, "", http.StatusUnauthorized)
+	login("john", http.StatusForbidden)
+	adminRequest(t, server, http.MethodPost, "/admin/users/john/enable", "", http.StatusOK)
+	login("john", http.StatusOK)
+	adminRequest(t, server, http.MethodPost, "/admin/users/alice/disable", "", http.StatusNotFound)
+
+	// The tokens of a user linked to a student carry the student ID.
+	user = adminRequest(t, server, http.MethodPut, "/admin/users/john/student", `{"student_id":7}`, http.StatusOK)
+	require.Equal(t, float64(7), user["student_id"])
+	adminRequest(t, server, http.MethodPut, "/admin/users/jane/student", `{"student_id":7}`, http.StatusConflict)
+	adminRequest(t, server, http.MethodPut, "/admin/users/jane/student", `{"student_id":0}`, http.StatusBadRequest)
+	payload, err := server.tokenMaker.VerifyToken(login("john", http.StatusOK))
+	require.NoError(t, err)
+	require.Equal(t, int64(7), payload.StudentID)
+	require.Equal(t, float64(7), send(http.MethodGet, "/users/me", login("john", http.StatusOK), "", http.StatusOK)["student_id"])
+
+	user = adminRequest(t, server, http.MethodDelete, "/admin/users/john/student", "", http.StatusOK)
+	require.Nil(t, user["student_id"])
+	payload, err = server.tokenMaker.VerifyToken(login("john", http.StatusOK))
+	require.NoError(t, err)
+	require.Zero(t, payload.StudentID)
+
+	// A deleted user is gone with their tokens.
+	accessToken = login("bob", http.StatusOK)
+	adminRequest(t, server, http.MethodDelete, "/admin/users/bob", "", http.StatusNoContent)
+	adminRequest(t, server, http.MethodDelete, "/admin/users/bob", "", http.StatusNotFound)
+	send(http.MethodGet, "/users/me", accessToken, "", http.StatusUnauthorized)
+	login("bob", http.StatusUnauthorized)
+
+	var actions []string
+	for _, record := range store.auditLog {
+		actions = append(actions, record.Action)
+	}
+	require.Equal(t, []string{"disable", "enable", "link_student", "unlink_student", "delete"}, actions)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	db "auth/db/sqlc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type listUsersRequest struct {
+	Limit  int32 `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int32 `form:"offset" binding:"omitempty,min=0"`
+	// TenantID only lists the users of a tenant when it is set.
+	TenantID int64 `form:"tenant_id" binding:"omitempty,min=1"`
+}
+
+const defaultUsersLimit = 20
+
+// listUsers lists the users by username, of every tenant unless one is
+// asked for.
+func (server *Server) listUsers(ctx *gin.Context) {
+	var req listUsersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultUsersLimit
+	}
+
+	users, err := server.store.ListUsers(ctx, db.ListUsersParams{
+		TenantID:  sql.NullInt64{Int64: req.TenantID, Valid: req.TenantID != 0},
+		RowLimit:  req.Limit,
+		RowOffset: req.Offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := []userResponse{}
+	for _, user := range users {
+		rsp = append(rsp, newUserResponse(user))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// disableUser stops a user from logging in and revokes the tokens issued
+// to them so far.
+func (server *Server) disableUser(ctx *gin.Context) {
+	server.setUserDisabled(ctx, true)
+}
+
+func (server *Server) enableUser(ctx *gin.Context) {
+	server.setUserDisabled(ctx, false)
+}
+
+func (server *Server) setUserDisabled(ctx *gin.Context, disabled bool) {
+	username := ctx.Param("username")
+	user, err := server.store.UpdateUser(ctx, db.UpdateUserParams{
+		Username:   username,
+		IsDisabled: sql.NullBool{Bool: disabled, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	action := "enable"
+	if disabled {
+		action = "disable"
+		if err := server.denylist.RevokeUser(ctx, username, server.config.AccessTokenDuration); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+	rsp := newUserResponse(user)
+	server.audit(ctx, auditActorAdmin, action, auditEntityUser, username, rsp)
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// deleteUser deletes a user with their tokens, identities and recovery
+// codes, and revokes the access tokens issued to them.
+func (server *Server) deleteUser(ctx *gin.Context) {
+	username := ctx.Param("username")
+	n, err := server.store.DeleteUser(ctx, username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if n == 0 {
+		ctx.JSON(http.StatusNotFound, errorResponse(sql.ErrNoRows))
+		return
+	}
+
+	if err := server.denylist.RevokeUser(ctx, username, server.config.AccessTokenDuration); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.audit(ctx, auditActorAdmin, "delete", auditEntityUser, username, nil)
+	ctx.Status(http.StatusNoContent)
+}
+
+type setUserStudentRequest struct {
+	StudentID int64 `json:"student_id" binding:"required,min=1"`
+}
+
+// setUserStudent links a user to their student of students_svc. The tokens
+// issued from then on carry the student ID.
+func (server *Server) setUserStudent(ctx *gin.Context) {
+	var req setUserStudentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	server.updateUserStudent(ctx, sql.NullInt64{Int64: req.StudentID, Valid: true})
+}
+
+func (server *Server) unlinkUserStudent(ctx *gin.Context) {
+	server.updateUserStudent(ctx, sql.NullInt64{})
+}
+
+func (server *Server) updateUserStudent(ctx *gin.Context, studentID sql.NullInt64) {
+	username := ctx.Param("username")
+	user, err := server.store.SetUserStudentID(ctx, db.SetUserStudentIDParams{
+		Username:  username,
+		StudentID: studentID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		// A student is linked to a single user.
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusConflict, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	action := "link_student"
+	if !studentID.Valid {
+		action = "unlink_student"
+	}
+	rsp := newUserResponse(user)
+	server.audit(ctx, auditActorAdmin, action, auditEntityUser, username, rsp)
+	ctx.JSON(http.StatusOK, rsp)
+}
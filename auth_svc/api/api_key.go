@@ -0,0 +1,304 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/logging"
+	"auth/token"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log/level"
+)
+
+var (
+	errInvalidAPIKey  = errors.New("API key is invalid, expired or revoked")
+	errAPIKeyNotFound = errors.New("API key not found")
+)
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresAt is not set for keys that do not expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// validate checks that the key only grants the allowed scopes, and does
+// not expire in the past.
+func (req createAPIKeyRequest) validate(allowed []string) error {
+	for _, scope := range req.Scopes {
+		if _, ok := oauthScopes[scope]; !ok {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		if !contains(allowed, scope) {
+			return fmt.Errorf("scope %q is not granted to the owner", scope)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+type apiKeyResponse struct {
+	ID int64 `json:"id"`
+	// Key is only returned when the key is created.
+	Key        string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	Username   string     `json:"username,omitempty"`
+	ClientID   string     `json:"client_id,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAPIKeyResponse(key db.ApiKey) apiKeyResponse {
+	rsp := apiKeyResponse{
+		ID:        key.ID,
+		Prefix:    key.Prefix,
+		Name:      key.Name,
+		Username:  key.Username.String,
+		ClientID:  key.ClientID.String,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if key.ExpiresAt.Valid {
+		rsp.ExpiresAt = &key.ExpiresAt.Time
+	}
+	if key.LastUsedAt.Valid {
+		rsp.LastUsedAt = &key.LastUsedAt.Time
+	}
+	if key.RevokedAt.Valid {
+		rsp.RevokedAt = &key.RevokedAt.Time
+	}
+	return rsp
+}
+
+func newAPIKeysResponse(keys []db.ApiKey) []apiKeyResponse {
+	rsp := []apiKeyResponse{}
+	for _, key := range keys {
+		rsp = append(rsp, newAPIKeyResponse(key))
+	}
+	return rsp
+}
+
+// createAPIKey creates a key of the user of the access token. The key
+// grants some of the scopes of the token.
+func (server *Server) createAPIKey(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	server.issueAPIKey(ctx, payload.Username, db.CreateAPIKeyParams{
+		Username: sql.NullString{String: payload.Username, Valid: true},
+	}, payload.Scopes)
+}
+
+func (server *Server) listAPIKeys(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	keys, err := server.store.ListUserAPIKeys(ctx, sql.NullString{String: payload.Username, Valid: true})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newAPIKeysResponse(keys))
+}
+
+// revokeAPIKey revokes a key of the user of the access token.
+func (server *Server) revokeAPIKey(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	server.revokeKey(ctx, payload.Username, sql.NullString{String: payload.Username, Valid: true})
+}
+
+// createServiceAPIKey creates a key of a service account, an OAuth2 client
+// allowed the client_credentials grant. The key grants some of the scopes
+// of the client.
+func (server *Server) createServiceAPIKey(ctx *gin.Context) {
+	client, err := server.store.GetOAuthClient(ctx, ctx.Param("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errors.New("OAuth client not found")))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !contains(client.GrantTypes, grantTypeClientCredentials) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("the client is not allowed the client_credentials grant")))
+		return
+	}
+	server.issueAPIKey(ctx, auditActorAdmin, db.CreateAPIKeyParams{
+		ClientID: sql.NullString{String: client.ID, Valid: true},
+	}, client.Scopes)
+}
+
+func (server *Server) listAllAPIKeys(ctx *gin.Context) {
+	keys, err := server.store.ListAPIKeys(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newAPIKeysResponse(keys))
+}
+
+// revokeAnyAPIKey revokes a key of any user or service account.
+func (server *Server) revokeAnyAPIKey(ctx *gin.Context) {
+	server.revokeKey(ctx, auditActorAdmin, sql.NullString{})
+}
+
+// issueAPIKey creates a key for the owner set in arg. The key itself is
+// only returned here; its hash is stored in its place.
+func (server *Server) issueAPIKey(ctx *gin.Context, actor string, arg db.CreateAPIKeyParams, allowedScopes []string) {
+	var req createAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := req.validate(allowedScopes); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	key, prefix, err := util.RandomAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	arg.Prefix = prefix
+	arg.KeyHash = util.HashToken(key)
+	arg.Name = req.Name
+	arg.Scopes = req.Scopes
+	if req.ExpiresAt != nil {
+		arg.ExpiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	apiKey, err := server.store.CreateAPIKey(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := newAPIKeyResponse(apiKey)
+	server.audit(ctx, actor, "create", auditEntityAPIKey, strconv.FormatInt(apiKey.ID, 10), rsp)
+	rsp.Key = key
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type apiKeyURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// revokeKey revokes the key of the request, when it belongs to username or
+// username is null.
+func (server *Server) revokeKey(ctx *gin.Context, actor string, username sql.NullString) {
+	var uri apiKeyURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	key, err := server.store.RevokeAPIKey(ctx, db.RevokeAPIKeyParams{ID: uri.ID, Username: username})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errAPIKeyNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := newAPIKeyResponse(key)
+	server.audit(ctx, actor, "revoke", auditEntityAPIKey, strconv.FormatInt(key.ID, 10), rsp)
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type verifyAPIKeyRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// apiKeyVerification is what a key grants, in the terms of the access
+// token payload.
+type apiKeyVerification struct {
+	KeyID     int64      `json:"key_id"`
+	Username  string     `json:"username,omitempty"`
+	StudentID int64      `json:"student_id,omitempty"`
+	TenantID  int64      `json:"tenant_id"`
+	ClientID  string     `json:"client_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// verifyAPIKey tells the other services whether a key is valid, and what
+// it grants. The key is the credential, so the request is not
+// authenticated otherwise. The last use of the key is recorded.
+func (server *Server) verifyAPIKey(ctx *gin.Context) {
+	var req verifyAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !strings.HasPrefix(req.Key, util.APIKeyPrefix) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidAPIKey))
+		return
+	}
+
+	key, err := server.store.GetAPIKeyByHash(ctx, util.HashToken(req.Key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidAPIKey))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if key.RevokedAt.Valid || (key.ExpiresAt.Valid && !key.ExpiresAt.Time.After(time.Now())) {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidAPIKey))
+		return
+	}
+
+	rsp := apiKeyVerification{
+		KeyID:    key.ID,
+		Username: key.Username.String,
+		ClientID: key.ClientID.String,
+		Scopes:   key.Scopes,
+	}
+	if key.ExpiresAt.Valid {
+		rsp.ExpiresAt = &key.ExpiresAt.Time
+	}
+	// The keys of disabled users are refused, and tokens carry the student
+	// the user is linked to at the time. Keys grant access to the tenant of
+	// their owner.
+	if key.Username.Valid {
+		user, err := server.store.GetUser(ctx, key.Username.String)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		if user.IsDisabled {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidAPIKey))
+			return
+		}
+		rsp.StudentID = user.StudentID.Int64
+		rsp.TenantID = user.TenantID
+	} else {
+		client, err := server.store.GetOAuthClient(ctx, key.ClientID.String)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		rsp.TenantID = client.TenantID
+	}
+
+	if err := server.store.TouchAPIKey(ctx, key.ID); err != nil {
+		logger := logging.WithContext(ctx.Request.Context(), server.logger)
+		level.Warn(logger).Log("msg", "cannot record API key use", "key_id", key.ID, "err", err)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
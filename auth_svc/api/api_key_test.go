@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	server, send := newAccountTest(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+
+	for _, username := range []string{"john", "jane"} {
+		send(http.MethodPost, "/users", "", `{"username":"`+username+`","password":"secret","email":"`+username+`@example.com"}`, http.StatusOK)
+	}
+	login := func(username string) string {
+		return send(http.MethodPost, "/users/login", "", `{"username":"`+username+`","password":"secret"}`, http.StatusOK)["access_token"].(string)
+	}
+	johnToken, janeToken := login("john"), login("jane")
+	adminRequest(t, server, http.MethodPut, "/admin/users/john/student", `{"student_id":7}`, http.StatusOK)
+
+	send(http.MethodPost, "/api_keys", "", `{"name":"sync","scopes":["students:read"]}`, http.StatusUnauthorized)
+	send(http.MethodPost, "/api_keys", johnToken, `{"name":"sync","scopes":["grades:read"]}`, http.StatusBadRequest)
+	send(http.MethodPost, "/api_keys", johnToken, `{"name":"sync","scopes":["students:write"]}`, http.StatusBadRequest)
+	send(http.MethodPost, "/api_keys", johnToken, `{"name":"sync","scopes":["students:read"],"expires_at":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest)
+
+	// The key is only shown once, and only its hash is stored.
+	created := send(http.MethodPost, "/api_keys", johnToken, `{"name":"sync","scopes":["students:read","courses:read"]}`, http.StatusOK)
+	key := created["key"].(string)
+	require.True(t, strings.HasPrefix(key, created["prefix"].(string)+"_"), key)
+	require.True(t, strings.HasPrefix(key, "lms_"), key)
+	require.NotContains(t, store.apiKeys[0].KeyHash, key)
+
+	verify := func(key string, status int) map[string]interface{} {
+		return send(http.MethodPost, "/api_keys/verify", "", `{"key":"`+key+`"}`, status)
+	}
+	rsp := verify(key, http.StatusOK)
+	require.Equal(t, "john", rsp["username"])
+	require.Equal(t, float64(7), rsp["student_id"])
+	require.Equal(t, []interface{}{"students:read", "courses:read"}, rsp["scopes"])
+	require.True(t, store.apiKeys[0].LastUsedAt.Valid)
+	verify("lms_unknown_key", http.StatusUnauthorized)
+	verify("not-an-api-key", http.StatusUnauthorized)
+
+	// Users only see and revoke their own keys.
+	list := func(accessToken string) []map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:6061/api_keys", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := validate(t, newSpecRouter(t), server.router, req, "", http.StatusOK)
+		var keys []map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+		return keys
+	}
+	keys := list(johnToken)
+	require.Len(t, keys, 1)
+	require.Nil(t, keys[0]["key"])
+	require.NotNil(t, keys[0]["last_used_at"])
+	require.Empty(t, list(janeToken))
+	send(http.MethodDelete, "/api_keys/1", janeToken, "", http.StatusNotFound)
+
+	// The keys of disabled users are refused.
+	adminRequest(t, server, http.MethodPost, "/admin/users/john/disable", "", http.StatusOK)
+	verify(key, http.StatusUnauthorized)
+	adminRequest(t, server, http.MethodPost, "/admin/users/john/enable", "", http.StatusOK)
+	johnToken = login("john")
+
+	// Expired and revoked keys are refused.
+	store.apiKeys[0].ExpiresAt = sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	verify(key, http.StatusUnauthorized)
+	store.apiKeys[0].ExpiresAt = sql.NullTime{}
+	verify(key, http.StatusOK)
+	rsp = send(http.MethodDelete, "/api_keys/1", johnToken, "", http.StatusOK)
+	require.NotNil(t, rsp["revoked_at"])
+	verify(key, http.StatusUnauthorized)
+	send(http.MethodDelete, "/api_keys/1", johnToken, "", http.StatusNotFound)
+
+	// Service accounts are OAuth2 clients allowed the client_credentials
+	// grant, and their keys grant some of the scopes of the client.
+	admin := server.AdminHandler()
+	client := registerOAuthClient(t, admin, `{"name":"nightly-sync","grant_types":["client_credentials"],"scopes":["students:read"]}`)
+	app := registerOAuthClient(t, admin, `{"name":"app","grant_types":["authorization_code"],"redirect_uris":["https://app.example.com/callback"],"scopes":["students:read"]}`)
+	path := "/admin/oauth/clients/" + client["client_id"].(string) + "/api_keys"
+	adminRequest(t, server, http.MethodPost, path, `{"name":"sync","scopes":["students:write"]}`, http.StatusBadRequest)
+	adminRequest(t, server, http.MethodPost, "/admin/oauth/clients/"+app["client_id"].(string)+"/api_keys", `{"name":"sync","scopes":["students:read"]}`, http.StatusBadRequest)
+	adminRequest(t, server, http.MethodPost, "/admin/oauth/clients/unknown/api_keys", `{"name":"sync","scopes":["students:read"]}`, http.StatusNotFound)
+	created = adminRequest(t, server, http.MethodPost, path, `{"name":"sync","scopes":["students:read"]}`, http.StatusOK)
+	rsp = verify(created["key"].(string), http.StatusOK)
+	require.Nil(t, rsp["username"])
+	require.Equal(t, client["client_id"], rsp["client_id"])
+
+	// Admins see and revoke all the keys.
+	req := httptest.NewRequest(http.MethodGet, "/admin/api_keys", nil)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 2)
+	adminRequest(t, server, http.MethodDelete, "/admin/api_keys/2", "", http.StatusOK)
+	adminRequest(t, server, http.MethodDelete, "/admin/api_keys/x", "", http.StatusBadRequest)
+	verify(created["key"].(string), http.StatusUnauthorized)
+
+	var actions []string
+	for _, record := range store.auditLog {
+		if record.Entity == auditEntityAPIKey {
+			actions = append(actions, record.Actor+" "+record.Action)
+		}
+	}
+	require.Equal(t, []string{"john create", "john revoke", "admin create", "admin revoke"}, actions)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+
+	db "auth/db/sqlc"
+	"auth/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	auditActorSystem       = "system"
+	auditActorAdmin        = "admin"
+	auditEntityUser        = "user"
+	auditEntityIP          = "ip"
+	auditEntityToken       = "token"
+	auditEntityOAuthClient = "oauth_client"
+	auditEntityAPIKey      = "api_key"
+	auditEntityTenant      = "tenant"
+)
+
+// audit stores a single audit entry. The change has already been made at
+// this point, so a failure is logged rather than returned.
+func (server *Server) audit(ctx *gin.Context, actor string, action string, entity string, entityID string, after interface{}) {
+	err := func() error {
+		afterJSON, err := json.Marshal(after)
+		if err != nil {
+			return err
+		}
+		_, err = server.store.CreateAuditRecord(ctx, db.CreateAuditRecordParams{
+			Actor:    actor,
+			Action:   action,
+			Entity:   entity,
+			EntityID: entityID,
+			Before:   json.RawMessage("null"),
+			After:    afterJSON,
+			Diff:     json.RawMessage("{}"),
+		})
+		return err
+	}()
+	if err != nil {
+		logger := logging.WithContext(ctx.Request.Context(), server.logger)
+		level.Error(logger).Log("msg", "cannot write audit record", "action", action, "entity", entity, "id", entityID, "err", err)
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPISpec is the OpenAPI 3 spec of the HTTP API. The sdk clients are
+// generated from it.
+//
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+// swaggerUI renders the spec served at /openapi.yaml.
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@4.18.3/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@4.18.3/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.yaml", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+func serveOpenAPISpec(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/yaml", OpenAPISpec)
+}
+
+func serveSwaggerUI(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log/level"
+)
+
+// freeLoginAttempts is the number of failed logins of a username before
+// the next attempts are delayed.
+const freeLoginAttempts = 3
+
+var (
+	// errInvalidCredentials is the answer to an unknown username as well as
+	// a wrong password, so that the users are not revealed.
+	errInvalidCredentials = errors.New("invalid username or password")
+	errTooManyAttempts    = errors.New("too many failed login attempts, try again later")
+)
+
+// loginKey names the counter of failed logins of a username or an address.
+type loginKey struct {
+	entity string
+	id     string
+}
+
+func userLoginKey(username string) loginKey {
+	return loginKey{entity: auditEntityUser, id: username}
+}
+
+func ipLoginKey(ip string) loginKey {
+	return loginKey{entity: auditEntityIP, id: ip}
+}
+
+func (k loginKey) String() string {
+	return k.entity + ":" + k.id
+}
+
+// checkLoginAllowed answers 429 and returns false while the username or the
+// client address is locked out.
+func (server *Server) checkLoginAllowed(ctx *gin.Context, username string) bool {
+	failures, err := server.store.GetLoginFailures(ctx, []string{
+		userLoginKey(username).String(),
+		ipLoginKey(ctx.ClientIP()).String(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return false
+	}
+
+	var lockedUntil time.Time
+	for _, failure := range failures {
+		if failure.LockedUntil.After(lockedUntil) {
+			lockedUntil = failure.LockedUntil
+		}
+	}
+	wait := time.Until(lockedUntil)
+	if wait <= 0 {
+		return true
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, errorResponse(errTooManyAttempts))
+	return false
+}
+
+// loginFailed counts a failed login against the username and the client
+// address, delays or locks out the next attempts, and answers with cause.
+func (server *Server) loginFailed(ctx *gin.Context, username string, cause error) {
+	limits := []struct {
+		key  loginKey
+		free int32
+		max  int32
+	}{
+		{key: userLoginKey(username), free: freeLoginAttempts, max: server.config.LoginMaxFailures},
+		// Many users can share an address, so it is only locked out.
+		{key: ipLoginKey(ctx.ClientIP()), free: server.config.LoginIPMaxFailures, max: server.config.LoginIPMaxFailures},
+	}
+	for _, limit := range limits {
+		failure, err := server.store.RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+			Key:         limit.key.String(),
+			ResetBefore: time.Now().Add(-server.config.LoginFailureWindow),
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+
+		delay := server.loginDelay(failure.Failures, limit.free, limit.max)
+		if delay == 0 {
+			continue
+		}
+		lockedUntil := time.Now().Add(delay)
+		err = server.store.LockLogin(ctx, db.LockLoginParams{
+			Key:         limit.key.String(),
+			LockedUntil: lockedUntil,
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		if failure.Failures >= limit.max {
+			server.lockedOut(ctx, limit.key, failure.Failures, lockedUntil)
+		}
+	}
+
+	ctx.JSON(http.StatusUnauthorized, errorResponse(cause))
+}
+
+// loginDelay returns how long the next login is refused after the given
+// number of failures. The delay doubles with every failure past free, and
+// reaches the lockout duration at max.
+func (server *Server) loginDelay(failures, free, max int32) time.Duration {
+	lockout := server.config.LoginLockoutDuration
+	if failures >= max {
+		return lockout
+	}
+	if failures <= free {
+		return 0
+	}
+	delay := server.config.LoginBaseDelay
+	for n := free + 1; n < failures && delay < lockout; n++ {
+		delay *= 2
+	}
+	if delay > lockout {
+		return lockout
+	}
+	return delay
+}
+
+// lockedOut logs a lockout and writes it to the audit trail.
+func (server *Server) lockedOut(ctx *gin.Context, key loginKey, failures int32, lockedUntil time.Time) {
+	logger := logging.WithContext(ctx.Request.Context(), server.logger)
+	level.Warn(logger).Log("msg", "login locked out", "entity", key.entity, "id", key.id, "failures", failures, "locked_until", lockedUntil)
+	server.audit(ctx, auditActorSystem, "lockout", key.entity, key.id, gin.H{
+		"failures":     failures,
+		"locked_until": lockedUntil,
+	})
+}
+
+// resetLoginFailures forgets the failed logins of a username after a
+// successful login. The failures of the address are kept.
+func (server *Server) resetLoginFailures(ctx *gin.Context, username string) error {
+	return server.store.DeleteLoginFailures(ctx, userLoginKey(username).String())
+}
+
+// unlockUser clears the failed logins of a username.
+func (server *Server) unlockUser(ctx *gin.Context) {
+	username := ctx.Param("username")
+	if _, err := server.store.GetUser(ctx, username); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.unlock(ctx, userLoginKey(username))
+}
+
+// unlockIP clears the failed logins of a client address.
+func (server *Server) unlockIP(ctx *gin.Context) {
+	ip := net.ParseIP(ctx.Param("ip"))
+	if ip == nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("invalid IP address")))
+		return
+	}
+	server.unlock(ctx, ipLoginKey(ip.String()))
+}
+
+func (server *Server) unlock(ctx *gin.Context, key loginKey) {
+	if err := server.store.DeleteLoginFailures(ctx, key.String()); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.audit(ctx, auditActorAdmin, "unlock", key.entity, key.id, nil)
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+	admin := server.AdminHandler()
+
+	login := func(body string, status int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:6061/users/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return validate(t, router, server.router, req, body, status)
+	}
+	unlock := func(path string, status int) {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		require.Equal(t, status, w.Code, w.Body.String())
+	}
+	requireError := func(w *httptest.ResponseRecorder, err error) {
+		var rsp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		require.Equal(t, err.Error(), rsp["error"])
+	}
+	credentials := `{"username":"admin","password":"secret"}`
+	wrongPassword := `{"username":"admin","password":"wrong"}`
+	unknownUser := `{"username":"jane","password":"secret"}`
+
+	user := `{"username":"admin","password":"secret","email":"admin@example.com"}`
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:6061/users", strings.NewReader(user))
+	req.Header.Set("Content-Type", "application/json")
+	validate(t, router, server.router, req, user, http.StatusOK)
+
+	// An unknown username and a wrong password get the same answer.
+	requireError(login(unknownUser, http.StatusUnauthorized), errInvalidCredentials)
+	requireError(login(wrongPassword, http.StatusUnauthorized), errInvalidCredentials)
+
+	// The user is locked out at the fifth failure, even with the right
+	// password.
+	for i := 0; i < 4; i++ {
+		login(wrongPassword, http.StatusUnauthorized)
+	}
+	w := login(credentials, http.StatusTooManyRequests)
+	requireError(w, errTooManyAttempts)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, time.Hour.Seconds(), retryAfter, 5)
+
+	require.Len(t, store.auditLog, 1)
+	require.Equal(t, "system", store.auditLog[0].Actor)
+	require.Equal(t, "lockout", store.auditLog[0].Action)
+	require.Equal(t, "user", store.auditLog[0].Entity)
+	require.Equal(t, "admin", store.auditLog[0].EntityID)
+
+	unlock("/admin/users/jane/unlock", http.StatusNotFound)
+	unlock("/admin/users/admin/unlock", http.StatusNoContent)
+	require.Equal(t, "unlock", store.auditLog[1].Action)
+	login(credentials, http.StatusOK)
+
+	// The address is locked out at its eighth failure, for every user.
+	login(unknownUser, http.StatusUnauthorized)
+	login(unknownUser, http.StatusUnauthorized)
+	login(credentials, http.StatusTooManyRequests)
+	require.Equal(t, "ip", store.auditLog[2].Entity)
+	require.Equal(t, "192.0.2.1", store.auditLog[2].EntityID)
+
+	unlock("/admin/ips/not-an-ip/unlock", http.StatusBadRequest)
+	unlock("/admin/ips/192.0.2.1/unlock", http.StatusNoContent)
+	login(credentials, http.StatusOK)
+}
+
+func TestLoginDelay(t *testing.T) {
+	server := &Server{}
+	server.config.LoginBaseDelay = time.Second
+	server.config.LoginLockoutDuration = 15 * time.Minute
+
+	testCases := []struct {
+		failures int32
+		delay    time.Duration
+	}{
+		{failures: 1, delay: 0},
+		{failures: 3, delay: 0},
+		{failures: 4, delay: time.Second},
+		{failures: 5, delay: 2 * time.Second},
+		{failures: 9, delay: 32 * time.Second},
+		{failures: 10, delay: 15 * time.Minute},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.delay, server.loginDelay(tc.failures, freeLoginAttempts, 10), "failures %d", tc.failures)
+	}
+	require.Equal(t, 15*time.Minute, server.loginDelay(40, freeLoginAttempts, 100))
+}
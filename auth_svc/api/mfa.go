@@ -0,0 +1,272 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"net/http"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/token"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// totpIssuer is shown with the account in authenticator apps.
+	totpIssuer        = "LMS"
+	recoveryCodeCount = 10
+	qrCodeSize        = 256
+)
+
+var (
+	errMFAEnabled     = errors.New("MFA is already enabled")
+	errMFANotEnrolled = errors.New("TOTP enrollment has not been started")
+	errInvalidMFACode = errors.New("MFA code is invalid")
+)
+
+type mfaChallengeResponse struct {
+	MFAToken          string    `json:"mfa_token"`
+	MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+// startMFAChallenge answers the first step of the login of a user with MFA
+// with a short-lived token for the second step, POST /users/login/mfa.
+func (server *Server) startMFAChallenge(ctx *gin.Context, user db.User) {
+	if user.IsDisabled {
+		ctx.JSON(http.StatusForbidden, errorResponse(errUserDisabled))
+		return
+	}
+	secret, err := util.RandomToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	challenge, err := server.store.CreateUserToken(ctx, db.CreateUserTokenParams{
+		Username:  user.Username,
+		Purpose:   db.TokenPurposeMFAChallenge,
+		TokenHash: util.HashToken(secret),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(server.config.MFAChallengeDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, mfaChallengeResponse{
+		MFAToken:          secret,
+		MFATokenExpiresAt: challenge.ExpiresAt,
+	})
+}
+
+type loginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code is a TOTP code or a recovery code.
+	Code string `json:"code" binding:"required"`
+}
+
+// loginMFA is the second step of the login of a user with MFA. The MFA
+// token can be used once: a wrong code requires logging in again.
+func (server *Server) loginMFA(ctx *gin.Context) {
+	var req loginMFARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	challenge, err := server.store.UseUserToken(ctx, db.UseUserTokenParams{
+		TokenHash: util.HashToken(req.MFAToken),
+		Purpose:   db.TokenPurposeMFAChallenge,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidToken))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if !server.checkLoginAllowed(ctx, challenge.Username) {
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, challenge.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ok, err := server.checkMFACode(ctx, user, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !ok {
+		server.loginFailed(ctx, user.Username, errInvalidMFACode)
+		return
+	}
+	server.issueAccessToken(ctx, user)
+}
+
+// checkMFACode reports whether code is a valid TOTP code of the user, or an
+// unused recovery code, which is then used up.
+func (server *Server) checkMFACode(ctx *gin.Context, user db.User, code string) (bool, error) {
+	secret, err := util.Decrypt(server.config.MFAEncryptionKey, user.TotpSecret)
+	if err != nil {
+		return false, err
+	}
+	if totp.Validate(code, secret) {
+		return true, nil
+	}
+
+	_, err = server.store.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		Username: user.Username,
+		CodeHash: util.HashRecoveryCode(user.Username, code),
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type enrollTOTPResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	// QRCode is the provisioning URI as a PNG data URI.
+	QRCode string `json:"qr_code"`
+}
+
+// enrollTOTP starts the TOTP enrollment of the authenticated user with a new
+// secret. MFA is enabled once a code is verified with verifyTOTP.
+func (server *Server) enrollTOTP(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.IsMfaEnabled {
+		ctx.JSON(http.StatusConflict, errorResponse(errMFAEnabled))
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: user.Username})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	encrypted, err := util.Encrypt(server.config.MFAEncryptionKey, key.Secret())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.UpdateUser(ctx, db.UpdateUserParams{
+		Username:   user.Username,
+		TotpSecret: sql.NullString{String: encrypted, Valid: true},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	img, err := key.Image(qrCodeSize, qrCodeSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollTOTPResponse{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes()),
+	})
+}
+
+type verifyTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type verifyTOTPResponse struct {
+	// RecoveryCodes are shown once; only their hashes are stored.
+	RecoveryCodes []string     `json:"recovery_codes"`
+	User          userResponse `json:"user"`
+}
+
+// verifyTOTP enables MFA for the authenticated user when the code matches
+// the secret of the enrollment, and returns new recovery codes.
+func (server *Server) verifyTOTP(ctx *gin.Context) {
+	var req verifyTOTPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	user, err := server.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if user.IsMfaEnabled {
+		ctx.JSON(http.StatusConflict, errorResponse(errMFAEnabled))
+		return
+	}
+	if user.TotpSecret == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errMFANotEnrolled))
+		return
+	}
+
+	secret, err := util.Decrypt(server.config.MFAEncryptionKey, user.TotpSecret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if !totp.Validate(req.Code, secret) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidMFACode))
+		return
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = util.RandomRecoveryCode(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		hashes[i] = util.HashRecoveryCode(user.Username, codes[i])
+	}
+
+	result, err := server.store.EnableMFATx(ctx, db.EnableMFATxParams{
+		Username:           user.Username,
+		RecoveryCodeHashes: hashes,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, verifyTOTPResponse{
+		RecoveryCodes: codes,
+		User:          newUserResponse(result.User),
+	})
+}
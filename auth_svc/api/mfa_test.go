@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFA(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, &mail.MemorySender{})
+
+	post := func(path, accessToken, body string, status int) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:6061"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := validate(t, router, server.router, req, body, status)
+		var rsp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		return rsp
+	}
+	credentials := `{"username":"admin","password":"secret"}`
+
+	post("/users", "", `{"username":"admin","password":"secret","email":"admin@example.com"}`, http.StatusOK)
+	accessToken := post("/users/login", "", credentials, http.StatusOK)["access_token"].(string)
+
+	post("/users/mfa/totp", "", "", http.StatusUnauthorized)
+	post("/users/mfa/totp/verify", accessToken, `{"code":"123456"}`, http.StatusBadRequest)
+	enrollment := post("/users/mfa/totp", accessToken, "", http.StatusOK)
+	secret := enrollment["secret"].(string)
+	require.True(t, strings.HasPrefix(enrollment["provisioning_uri"].(string), "otpauth://totp/LMS:admin?"))
+	require.True(t, strings.HasPrefix(enrollment["qr_code"].(string), "data:image/png;base64,"))
+
+	// MFA is enabled only once a code is verified.
+	post("/users/login", "", credentials, http.StatusOK)
+	code, err := totp.GenerateCode(secret, time.Now().Add(-5*time.Minute))
+	require.NoError(t, err)
+	post("/users/mfa/totp/verify", accessToken, `{"code":"`+code+`"}`, http.StatusBadRequest)
+	code, err = totp.GenerateCode(secret, time.Now())
+	require.NoError(t, err)
+	verified := post("/users/mfa/totp/verify", accessToken, `{"code":"`+code+`"}`, http.StatusOK)
+	recoveryCodes := verified["recovery_codes"].([]interface{})
+	require.Len(t, recoveryCodes, recoveryCodeCount)
+	require.Equal(t, true, verified["user"].(map[string]interface{})["is_mfa_enabled"])
+	post("/users/mfa/totp", accessToken, "", http.StatusConflict)
+
+	// A wrong code uses up the MFA token.
+	challenge := post("/users/login", "", credentials, http.StatusAccepted)
+	require.Nil(t, challenge["access_token"])
+	mfaToken := challenge["mfa_token"].(string)
+	post("/users/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"000000"}`, http.StatusUnauthorized)
+	post("/users/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`, http.StatusUnauthorized)
+
+	mfaToken = post("/users/login", "", credentials, http.StatusAccepted)["mfa_token"].(string)
+	rsp := post("/users/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"`+code+`"}`, http.StatusOK)
+	require.NotEmpty(t, rsp["access_token"])
+
+	// Recovery codes work once, in any case and without the dash.
+	recoveryCode := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0].(string), "-", ""))
+	mfaToken = post("/users/login", "", credentials, http.StatusAccepted)["mfa_token"].(string)
+	post("/users/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"`+recoveryCode+`"}`, http.StatusOK)
+	mfaToken = post("/users/login", "", credentials, http.StatusAccepted)["mfa_token"].(string)
+	post("/users/login/mfa", "", `{"mfa_token":"`+mfaToken+`","code":"`+recoveryCode+`"}`, http.StatusUnauthorized)
+}
@@ -5,10 +5,21 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"auth/logging"
 	"auth/token"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+var (
+	errClientToken = errors.New("tokens of OAuth2 clients can not be used here")
+	// errTenantlessToken refuses the tokens issued before there were tenants,
+	// whose tenant is unknown.
+	errTenantlessToken = errors.New("the token has no tenant, log in again")
 )
 
 const (
@@ -18,7 +29,7 @@ const (
 )
 
 // AuthMiddleware creates a gin middleware for authorization
-func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+func authMiddleware(tokenMaker token.Maker, denylist token.Denylist) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -48,8 +59,57 @@ func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
 			return
 		}
+		revoked, err := denylist.IsRevoked(ctx, payload)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		if revoked {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrRevokedToken))
+			return
+		}
+		if payload.TenantID == 0 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errTenantlessToken))
+			return
+		}
+		// The tokens of OAuth2 clients are for the LMS APIs, not for managing
+		// the account.
+		if payload.ClientID != "" {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorResponse(errClientToken))
+			return
+		}
 
 		ctx.Set(authorizationPayloadKey, payload)
 		ctx.Next()
 	}
 }
+
+// loggerMiddleware tags the request with a request ID and logs a line per
+// request, with the request and trace IDs. It must run after otelgin so
+// that the span is in the request context.
+func loggerMiddleware(logger log.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(logging.RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = logging.NewRequestID()
+		}
+		ctx.Header(logging.RequestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), id))
+
+		begin := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		l := level.Info(logging.WithContext(ctx.Request.Context(), logger))
+		if status >= http.StatusInternalServerError {
+			l = level.Error(logging.WithContext(ctx.Request.Context(), logger))
+		}
+		l.Log(
+			"method", ctx.Request.Method,
+			"route", ctx.FullPath(),
+			"status", status,
+			"took", time.Since(begin),
+			"err", ctx.Errors.ByType(gin.ErrorTypePrivate).String(),
+		)
+	}
+}
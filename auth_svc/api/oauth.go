@@ -0,0 +1,453 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/token"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeClientCredentials = "client_credentials"
+	tokenTypeBearer            = "Bearer"
+)
+
+// oauthScopes are the scopes a client can be granted, with the description
+// shown when a user is asked for consent.
+var oauthScopes = map[string]string{
+	"profile":        "Read your username and email",
+	"students:read":  "Read students and their enrollments",
+	"students:write": "Create, update and delete students",
+	"courses:read":   "Read courses and their enrollments",
+	"courses:write":  "Create, update and delete courses",
+}
+
+// The error codes of RFC 6749.
+const (
+	oauthInvalidRequest          = "invalid_request"
+	oauthInvalidClient           = "invalid_client"
+	oauthInvalidGrant            = "invalid_grant"
+	oauthInvalidScope            = "invalid_scope"
+	oauthUnauthorizedClient      = "unauthorized_client"
+	oauthUnsupportedGrantType    = "unsupported_grant_type"
+	oauthUnsupportedResponseType = "unsupported_response_type"
+	oauthAccessDenied            = "access_denied"
+)
+
+type oauthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// oauthError answers with an error of RFC 6749.
+func oauthError(ctx *gin.Context, status int, code string, description string) {
+	if code == oauthInvalidClient {
+		ctx.Header("WWW-Authenticate", `Basic realm="auth_svc"`)
+	}
+	ctx.JSON(status, oauthErrorResponse{Error: code, Description: description})
+}
+
+// parseScopes splits a scope parameter. An empty one stands for all the
+// scopes of the client.
+func parseScopes(client db.OauthClient, scope string) ([]string, bool) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return client.Scopes, true
+	}
+	for _, s := range scopes {
+		if !contains(client.Scopes, s) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateClient returns the client of a request, authenticated with
+// HTTP Basic or the client_id and client_secret form fields. Public
+// clients have no secret. It answers invalid_client when it returns false.
+func (server *Server) authenticateClient(ctx *gin.Context) (db.OauthClient, bool) {
+	id, secret, ok := ctx.Request.BasicAuth()
+	if ok {
+		// The credentials are form-encoded in the header.
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = ctx.PostForm("client_id"), ctx.PostForm("client_secret")
+	}
+	if id == "" {
+		oauthError(ctx, http.StatusUnauthorized, oauthInvalidClient, "client authentication is required")
+		return db.OauthClient{}, false
+	}
+
+	client, err := server.store.GetOAuthClient(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			oauthError(ctx, http.StatusUnauthorized, oauthInvalidClient, "unknown client")
+			return db.OauthClient{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.OauthClient{}, false
+	}
+	var secretHash string
+	if secret != "" {
+		secretHash = util.HashToken(secret)
+	}
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+		oauthError(ctx, http.StatusUnauthorized, oauthInvalidClient, "invalid client credentials")
+		return db.OauthClient{}, false
+	}
+	return client, true
+}
+
+type authorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// authorization is a checked authorization request.
+type authorization struct {
+	client      db.OauthClient
+	redirectURI string
+	scopes      []string
+}
+
+// checkAuthorization checks an authorization request. It answers with an
+// error when it returns false.
+func (server *Server) checkAuthorization(ctx *gin.Context, req authorizeRequest) (authorization, bool) {
+	client, err := server.store.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidRequest, "unknown client")
+			return authorization{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return authorization{}, false
+	}
+
+	// Clients only serve the users of their own tenant.
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if client.TenantID != payload.TenantID {
+		oauthError(ctx, http.StatusBadRequest, oauthUnauthorizedClient, "the client belongs to another tenant")
+		return authorization{}, false
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !contains(client.RedirectUris, redirectURI) {
+		oauthError(ctx, http.StatusBadRequest, oauthInvalidRequest, "redirect_uri is not registered for the client")
+		return authorization{}, false
+	}
+	if req.ResponseType != "code" {
+		oauthError(ctx, http.StatusBadRequest, oauthUnsupportedResponseType, "response_type must be code")
+		return authorization{}, false
+	}
+	if !contains(client.GrantTypes, grantTypeAuthorizationCode) {
+		oauthError(ctx, http.StatusBadRequest, oauthUnauthorizedClient, "the client may not use the authorization code grant")
+		return authorization{}, false
+	}
+	scopes, ok := parseScopes(client, req.Scope)
+	if !ok {
+		oauthError(ctx, http.StatusBadRequest, oauthInvalidScope, "the client may not request the scope")
+		return authorization{}, false
+	}
+	// The user can only grant the client the scopes of their own token.
+	for _, scope := range scopes {
+		if !payload.HasScope(scope) {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidScope, "the user may not grant the scope")
+			return authorization{}, false
+		}
+	}
+	// Public clients can not keep a secret, so they must use PKCE.
+	if req.CodeChallenge == "" && client.SecretHash == "" {
+		oauthError(ctx, http.StatusBadRequest, oauthInvalidRequest, "code_challenge is required for public clients")
+		return authorization{}, false
+	}
+	if req.CodeChallenge != "" && req.CodeChallengeMethod != "S256" {
+		oauthError(ctx, http.StatusBadRequest, oauthInvalidRequest, "code_challenge_method must be S256")
+		return authorization{}, false
+	}
+
+	return authorization{client: client, redirectURI: redirectURI, scopes: scopes}, true
+}
+
+type oauthScope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type authorizeInfoResponse struct {
+	ClientID   string       `json:"client_id"`
+	ClientName string       `json:"client_name"`
+	Scopes     []oauthScope `json:"scopes"`
+}
+
+// authorizeInfo checks an authorization request and describes it, for the
+// consent screen.
+func (server *Server) authorizeInfo(ctx *gin.Context) {
+	var req authorizeRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	auth, ok := server.checkAuthorization(ctx, req)
+	if !ok {
+		return
+	}
+
+	rsp := authorizeInfoResponse{ClientID: auth.client.ID, ClientName: auth.client.Name}
+	for _, scope := range auth.scopes {
+		rsp.Scopes = append(rsp.Scopes, oauthScope{Name: scope, Description: oauthScopes[scope]})
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type authorizeConsentRequest struct {
+	authorizeRequest
+	Approved bool `json:"approved"`
+}
+
+type authorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// authorize records the consent of the authenticated user to an
+// authorization request. It answers with the redirect to the client,
+// carrying the authorization code or the access_denied error.
+func (server *Server) authorize(ctx *gin.Context) {
+	var req authorizeConsentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	auth, ok := server.checkAuthorization(ctx, req.authorizeRequest)
+	if !ok {
+		return
+	}
+
+	query := url.Values{}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	if !req.Approved {
+		query.Set("error", oauthAccessDenied)
+		ctx.JSON(http.StatusOK, authorizeResponse{RedirectURI: withQuery(auth.redirectURI, query)})
+		return
+	}
+
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	code, err := util.RandomToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	_, err = server.store.CreateOAuthCode(ctx, db.CreateOAuthCodeParams{
+		CodeHash:      util.HashToken(code),
+		ClientID:      auth.client.ID,
+		Username:      payload.Username,
+		RedirectUri:   auth.redirectURI,
+		Scopes:        auth.scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(server.config.OAuthCodeDuration),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	query.Set("code", code)
+	ctx.JSON(http.StatusOK, authorizeResponse{RedirectURI: withQuery(auth.redirectURI, query)})
+}
+
+// withQuery adds query to the query of a URI.
+func withQuery(uri string, query url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthToken issues access tokens to clients with the client_credentials
+// and authorization_code grants.
+func (server *Server) oauthToken(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	client, ok := server.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	grantType := ctx.PostForm("grant_type")
+	if grantType != grantTypeClientCredentials && grantType != grantTypeAuthorizationCode {
+		oauthError(ctx, http.StatusBadRequest, oauthUnsupportedGrantType, "")
+		return
+	}
+	if !contains(client.GrantTypes, grantType) {
+		oauthError(ctx, http.StatusBadRequest, oauthUnauthorizedClient, "the client may not use the grant type")
+		return
+	}
+
+	var username string
+	var studentID int64
+	var scopes []string
+	tenantID := client.TenantID
+	switch grantType {
+	case grantTypeClientCredentials:
+		if client.SecretHash == "" {
+			oauthError(ctx, http.StatusBadRequest, oauthUnauthorizedClient, "public clients may not use the client credentials grant")
+			return
+		}
+		if scopes, ok = parseScopes(client, ctx.PostForm("scope")); !ok {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidScope, "the client may not request the scope")
+			return
+		}
+
+	case grantTypeAuthorizationCode:
+		code, err := server.store.UseOAuthCode(ctx, util.HashToken(ctx.PostForm("code")))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				oauthError(ctx, http.StatusBadRequest, oauthInvalidGrant, "the code is invalid or expired")
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectUri != ctx.PostForm("redirect_uri") {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidGrant, "the code was issued to another client or redirect_uri")
+			return
+		}
+		if code.CodeChallenge != "" && pkceChallenge(ctx.PostForm("code_verifier")) != code.CodeChallenge {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidGrant, "code_verifier does not match the code_challenge")
+			return
+		}
+		user, err := server.store.GetUser(ctx, code.Username)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				oauthError(ctx, http.StatusBadRequest, oauthInvalidGrant, "the user no longer exists")
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		if user.IsDisabled {
+			oauthError(ctx, http.StatusBadRequest, oauthInvalidGrant, errUserDisabled.Error())
+			return
+		}
+		username, studentID, tenantID, scopes = user.Username, user.StudentID.Int64, user.TenantID, code.Scopes
+	}
+
+	accessToken, payload, err := server.tokenMaker.CreateScopedToken(username, studentID, tenantID, client.ID, scopes, server.config.AccessTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   int64(time.Until(payload.ExpiredAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// introspectionResponse is the answer of RFC 7662. Only Active is set for
+// tokens that are not active.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TenantID  int64  `json:"tenant_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// introspectToken tells a confidential client whether a token is active,
+// and what it grants.
+func (server *Server) introspectToken(ctx *gin.Context) {
+	client, ok := server.authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	if client.SecretHash == "" {
+		oauthError(ctx, http.StatusUnauthorized, oauthInvalidClient, "public clients may not introspect tokens")
+		return
+	}
+	if ctx.PostForm("token") == "" {
+		oauthError(ctx, http.StatusBadRequest, oauthInvalidRequest, "token is required")
+		return
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(ctx.PostForm("token"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	revoked, err := server.denylist.IsRevoked(ctx, payload)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	// The tokens issued before there were tenants are not valid for any
+	// tenant.
+	if revoked || payload.TenantID == 0 {
+		ctx.JSON(http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+
+	sub := payload.Username
+	if sub == "" {
+		sub = payload.ClientID
+	}
+	ctx.JSON(http.StatusOK, introspectionResponse{
+		Active:    true,
+		Scope:     strings.Join(payload.Scopes, " "),
+		ClientID:  payload.ClientID,
+		Username:  payload.Username,
+		TenantID:  payload.TenantID,
+		TokenType: tokenTypeBearer,
+		Exp:       payload.ExpiredAt.Unix(),
+		Iat:       payload.IssuedAt.Unix(),
+		Sub:       sub,
+		Jti:       payload.ID.String(),
+	})
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types" binding:"required,min=1"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	// Public clients, such as apps running on a device, have no secret.
+	Public bool `json:"public"`
+	// TenantID is the school the client serves, the default tenant when it
+	// is not set.
+	TenantID int64 `json:"tenant_id" binding:"omitempty,min=1"`
+}
+
+type oauthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	TenantID     int64     `json:"tenant_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClientResponse(client db.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		GrantTypes:   client.GrantTypes,
+		Scopes:       client.Scopes,
+		Public:       client.SecretHash == "",
+		TenantID:     client.TenantID,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func (req createOAuthClientRequest) validate() error {
+	for _, grantType := range req.GrantTypes {
+		if grantType != grantTypeAuthorizationCode && grantType != grantTypeClientCredentials {
+			return fmt.Errorf("unsupported grant type %q", grantType)
+		}
+		if grantType == grantTypeClientCredentials && req.Public {
+			return errors.New("public clients can not use the client_credentials grant")
+		}
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := oauthScopes[scope]; !ok {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if contains(req.GrantTypes, grantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return errors.New("the authorization_code grant requires a redirect URI")
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+	return nil
+}
+
+// createOAuthClient registers a client. Its secret is only returned here.
+func (server *Server) createOAuthClient(ctx *gin.Context) {
+	var req createOAuthClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	var secret, secretHash string
+	if !req.Public {
+		var err error
+		if secret, err = util.RandomToken(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		secretHash = util.HashToken(secret)
+	}
+	redirectURIs := req.RedirectURIs
+	if redirectURIs == nil {
+		redirectURIs = []string{}
+	}
+	if req.TenantID == 0 {
+		req.TenantID = defaultTenantID
+	}
+	if _, err := server.store.GetTenant(ctx, req.TenantID); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errTenantNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	client, err := server.store.CreateOAuthClient(ctx, db.CreateOAuthClientParams{
+		ID:           uuid.NewString(),
+		SecretHash:   secretHash,
+		Name:         req.Name,
+		RedirectUris: redirectURIs,
+		GrantTypes:   req.GrantTypes,
+		Scopes:       req.Scopes,
+		TenantID:     req.TenantID,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := newOAuthClientResponse(client)
+	server.audit(ctx, auditActorAdmin, "create", auditEntityOAuthClient, client.ID, rsp)
+	rsp.ClientSecret = secret
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) listOAuthClients(ctx *gin.Context) {
+	clients, err := server.store.ListOAuthClients(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := []oauthClientResponse{}
+	for _, client := range clients {
+		rsp = append(rsp, newOAuthClientResponse(client))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// deleteOAuthClient removes a client. The tokens issued to it stay valid
+// until they expire.
+func (server *Server) deleteOAuthClient(ctx *gin.Context) {
+	id := ctx.Param("id")
+	n, err := server.store.DeleteOAuthClient(ctx, id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if n == 0 {
+		ctx.JSON(http.StatusNotFound, errorResponse(errors.New("OAuth client not found")))
+		return
+	}
+	server.audit(ctx, auditActorAdmin, "delete", auditEntityOAuthClient, id, nil)
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth/mail"
+
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// registerOAuthClient registers a client on the admin handler and returns
+// the response, which has the secret of the client.
+func registerOAuthClient(t *testing.T, admin http.Handler, body string) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodPost, "/admin/oauth/clients", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var rsp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	return rsp
+}
+
+// postForm sends a form to the server, authenticated as client with HTTP
+// Basic unless client is nil.
+func postForm(t *testing.T, router routers.Router, server *Server, client map[string]interface{}, path string, form url.Values, status int) map[string]interface{} {
+	body := form.Encode()
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:6061"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client != nil {
+		secret, _ := client["client_secret"].(string)
+		req.SetBasicAuth(client["client_id"].(string), secret)
+	}
+	w := validate(t, router, server.router, req, body, status)
+
+	var rsp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	return rsp
+}
+
+// introspectToken introspects accessToken as client.
+func introspectToken(t *testing.T, router routers.Router, server *Server, client map[string]interface{}, accessToken string) map[string]interface{} {
+	return postForm(t, router, server, client, "/oauth/introspect", url.Values{"token": {accessToken}}, http.StatusOK)
+}
+
+func TestOAuthClients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := newTestServer(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+	admin := server.AdminHandler()
+
+	request := func(method, path, body string, status int) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		require.Equal(t, status, w.Code, w.Body.String())
+	}
+
+	request(http.MethodPost, "/admin/oauth/clients", `{"name":"app","grant_types":["password"],"scopes":["profile"]}`, http.StatusBadRequest)
+	request(http.MethodPost, "/admin/oauth/clients", `{"name":"app","grant_types":["client_credentials"],"scopes":["admin"]}`, http.StatusBadRequest)
+	request(http.MethodPost, "/admin/oauth/clients", `{"name":"app","grant_types":["client_credentials"],"scopes":["profile"],"public":true}`, http.StatusBadRequest)
+	request(http.MethodPost, "/admin/oauth/clients", `{"name":"app","grant_types":["authorization_code"],"scopes":["profile"]}`, http.StatusBadRequest)
+	request(http.MethodPost, "/admin/oauth/clients", `{"name":"app","redirect_uris":["/callback"],"grant_types":["authorization_code"],"scopes":["profile"]}`, http.StatusBadRequest)
+
+	// Only the hash of the secret is stored, and public clients have none.
+	client := registerOAuthClient(t, admin, `{"name":"app","grant_types":["client_credentials"],"scopes":["profile"]}`)
+	require.NotEmpty(t, client["client_secret"])
+	require.Equal(t, false, client["public"])
+	require.NotEqual(t, client["client_secret"], store.oauthClients[client["client_id"].(string)].SecretHash)
+	public := registerOAuthClient(t, admin, `{"name":"app","redirect_uris":["myapp://callback"],"grant_types":["authorization_code"],"scopes":["profile"],"public":true}`)
+	require.Nil(t, public["client_secret"])
+	require.Equal(t, true, public["public"])
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/oauth/clients", nil)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var clients []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &clients))
+	require.Len(t, clients, 2)
+	for _, c := range clients {
+		require.Nil(t, c["client_secret"])
+	}
+
+	request(http.MethodDelete, "/admin/oauth/clients/"+client["client_id"].(string), "", http.StatusNoContent)
+	request(http.MethodDelete, "/admin/oauth/clients/"+client["client_id"].(string), "", http.StatusNotFound)
+	require.Len(t, store.oauthClients, 1)
+	require.Len(t, store.auditLog, 3)
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, &mail.MemorySender{})
+	admin := server.AdminHandler()
+
+	client := registerOAuthClient(t, admin, `{"name":"reports","grant_types":["client_credentials"],"scopes":["students:read","courses:read"]}`)
+	other := registerOAuthClient(t, admin, `{"name":"other","grant_types":["authorization_code"],"redirect_uris":["https://other.example.com/callback"],"scopes":["profile"]}`)
+	grant := url.Values{"grant_type": {"client_credentials"}}
+
+	// An empty scope stands for all the scopes of the client.
+	rsp := postForm(t, router, server, client, "/oauth/token", grant, http.StatusOK)
+	require.Equal(t, "Bearer", rsp["token_type"])
+	require.Equal(t, "students:read courses:read", rsp["scope"])
+	rsp = postForm(t, router, server, client, "/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"courses:read"}}, http.StatusOK)
+	require.Equal(t, "courses:read", rsp["scope"])
+	accessToken := rsp["access_token"].(string)
+
+	rsp = postForm(t, router, server, client, "/oauth/token", url.Values{"grant_type": {"client_credentials"}, "scope": {"courses:write"}}, http.StatusBadRequest)
+	require.Equal(t, oauthInvalidScope, rsp["error"])
+	rsp = postForm(t, router, server, client, "/oauth/token", url.Values{"grant_type": {"password"}}, http.StatusBadRequest)
+	require.Equal(t, oauthUnsupportedGrantType, rsp["error"])
+	rsp = postForm(t, router, server, other, "/oauth/token", grant, http.StatusBadRequest)
+	require.Equal(t, oauthUnauthorizedClient, rsp["error"])
+
+	// The client authenticates with HTTP Basic or the form.
+	rsp = postForm(t, router, server, nil, "/oauth/token", grant, http.StatusUnauthorized)
+	require.Equal(t, oauthInvalidClient, rsp["error"])
+	rsp = postForm(t, router, server, map[string]interface{}{"client_id": client["client_id"], "client_secret": "wrong"}, "/oauth/token", grant, http.StatusUnauthorized)
+	require.Equal(t, oauthInvalidClient, rsp["error"])
+	postForm(t, router, server, nil, "/oauth/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {client["client_id"].(string)},
+		"client_secret": {client["client_secret"].(string)},
+	}, http.StatusOK)
+
+	rsp = introspectToken(t, router, server, client, accessToken)
+	require.Equal(t, true, rsp["active"])
+	require.Equal(t, "courses:read", rsp["scope"])
+	require.Equal(t, client["client_id"], rsp["client_id"])
+	require.Equal(t, client["client_id"], rsp["sub"])
+	require.Nil(t, rsp["username"])
+	rsp = introspectToken(t, router, server, client, "invalid")
+	require.Equal(t, map[string]interface{}{"active": false}, rsp)
+
+	// The tokens of clients can not manage users.
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:6061/users/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	validate(t, router, server.router, req, "", http.StatusForbidden)
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, &mail.MemorySender{})
+	admin := server.AdminHandler()
+
+	const redirectURI = "myapp://callback"
+	client := registerOAuthClient(t, admin, `{"name":"My App","redirect_uris":["`+redirectURI+`"],"grant_types":["authorization_code"],"scopes":["profile","courses:read","courses:write"],"public":true}`)
+	clientID := client["client_id"].(string)
+	resourceServer := registerOAuthClient(t, admin, `{"name":"courses","grant_types":["client_credentials"],"scopes":["profile"]}`)
+
+	body := `{"username":"john","password":"secret","email":"john@example.com"}`
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:6061/users", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	validate(t, router, server.router, req, body, http.StatusOK)
+	body = `{"username":"john","password":"secret"}`
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:6061/users/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := validate(t, router, server.router, req, body, http.StatusOK)
+	var login map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	userToken := login["access_token"].(string)
+
+	verifier := strings.Repeat("v", 43)
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"scope":                 {"courses:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	authorizeInfo := func(query url.Values, accessToken string, status int) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:6061/oauth/authorize?"+query.Encode(), nil)
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := validate(t, router, server.router, req, "", status)
+		var rsp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		return rsp
+	}
+	// authorize answers the authorization request and returns the query of
+	// the redirect to the client.
+	authorize := func(query url.Values, approved bool) url.Values {
+		consent := map[string]interface{}{"approved": approved}
+		for k := range query {
+			consent[k] = query.Get(k)
+		}
+		data, err := json.Marshal(consent)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:6061/oauth/authorize", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		w := validate(t, router, server.router, req, string(data), http.StatusOK)
+
+		var rsp authorizeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		redirect, err := url.Parse(rsp.RedirectURI)
+		require.NoError(t, err)
+		require.Equal(t, redirectURI, redirect.Scheme+"://"+redirect.Host+redirect.Path)
+		return redirect.Query()
+	}
+	exchange := func(code, verifier string, status int) map[string]interface{} {
+		return postForm(t, router, server, client, "/oauth/token", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		}, status)
+	}
+
+	authorizeInfo(query, "", http.StatusUnauthorized)
+	// The tokens issued before there were tenants are refused, rather than
+	// taken for the tokens of any tenant.
+	tenantless, _, err := server.tokenMaker.CreateToken("john", 0, 0, []string{"profile", "courses:read"}, time.Minute)
+	require.NoError(t, err)
+	authorizeInfo(query, tenantless, http.StatusUnauthorized)
+	require.Equal(t, false, introspectToken(t, router, server, resourceServer, tenantless)["active"])
+	rsp := authorizeInfo(query, userToken, http.StatusOK)
+	require.Equal(t, "My App", rsp["client_name"])
+	require.Equal(t, []interface{}{map[string]interface{}{"name": "courses:read", "description": oauthScopes["courses:read"]}}, rsp["scopes"])
+
+	invalid := url.Values{}
+	for k, v := range query {
+		invalid[k] = v
+	}
+	invalid.Set("redirect_uri", "https://evil.example.com/callback")
+	require.Equal(t, oauthInvalidRequest, authorizeInfo(invalid, userToken, http.StatusBadRequest)["error"])
+	invalid.Del("redirect_uri")
+	invalid.Set("scope", "students:read")
+	require.Equal(t, oauthInvalidScope, authorizeInfo(invalid, userToken, http.StatusBadRequest)["error"])
+	// The user can not grant the scopes their own token lacks.
+	invalid.Set("scope", "courses:write")
+	rsp = authorizeInfo(invalid, userToken, http.StatusBadRequest)
+	require.Equal(t, oauthInvalidScope, rsp["error"])
+	require.Equal(t, "the user may not grant the scope", rsp["error_description"])
+	invalid.Set("scope", "courses:read")
+	invalid.Del("code_challenge")
+	invalid.Del("code_challenge_method")
+	require.Equal(t, oauthInvalidRequest, authorizeInfo(invalid, userToken, http.StatusBadRequest)["error"])
+
+	redirect := authorize(query, false)
+	require.Equal(t, oauthAccessDenied, redirect.Get("error"))
+	require.Equal(t, "xyz", redirect.Get("state"))
+
+	// The code is exchanged once, with the PKCE code verifier.
+	redirect = authorize(query, true)
+	require.Equal(t, "xyz", redirect.Get("state"))
+	require.Equal(t, oauthInvalidGrant, exchange(redirect.Get("code"), strings.Repeat("x", 43), http.StatusBadRequest)["error"])
+	code := authorize(query, true).Get("code")
+	rsp = exchange(code, verifier, http.StatusOK)
+	require.Equal(t, "courses:read", rsp["scope"])
+	require.Equal(t, oauthInvalidGrant, exchange(code, verifier, http.StatusBadRequest)["error"])
+
+	rsp = introspectToken(t, router, server, resourceServer, rsp["access_token"].(string))
+	require.Equal(t, true, rsp["active"])
+	require.Equal(t, "john", rsp["username"])
+	require.Equal(t, "john", rsp["sub"])
+	require.Equal(t, clientID, rsp["client_id"])
+
+	// Public clients can not introspect tokens.
+	rsp = postForm(t, router, server, client, "/oauth/introspect", url.Values{"token": {userToken}}, http.StatusUnauthorized)
+	require.Equal(t, oauthInvalidClient, rsp["error"])
+}
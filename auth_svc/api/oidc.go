@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/logging"
+	"auth/util"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log/level"
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/users/oidc"
+	oidcTimeout     = 10 * time.Second
+	// maxUsernameLength and maxUsernameAttempts bound the usernames tried
+	// for a new user: "john", "john2", "john3" and so on.
+	maxUsernameLength   = 32
+	maxUsernameAttempts = 100
+)
+
+var (
+	errOIDCNotConfigured = errors.New("OIDC login is not configured")
+	errInvalidOIDCState  = errors.New("OIDC state is invalid or expired")
+	errMissingIDToken    = errors.New("OIDC token response has no ID token")
+	errInvalidNonce      = errors.New("OIDC ID token has an invalid nonce")
+	errOIDCOtherTenant   = errors.New("the account of the provider belongs to a user of another tenant")
+)
+
+// oidcClient logs users in with an OpenID Connect provider. The provider is
+// discovered on the first login, so that auth_svc starts while it is down.
+type oidcClient struct {
+	config     util.Config
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDCClient(config util.Config) *oidcClient {
+	return &oidcClient{config: config, httpClient: &http.Client{Timeout: oidcTimeout}}
+}
+
+// context returns ctx with the HTTP client used for the provider.
+func (c *oidcClient) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, c.httpClient)
+}
+
+func (c *oidcClient) discover() (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider == nil {
+		// The keys of the provider are fetched later with this context, so
+		// it must outlive the request.
+		provider, err := oidc.NewProvider(c.context(context.Background()), c.config.OIDCIssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("cannot discover OIDC provider: %w", err)
+		}
+		c.provider = provider
+	}
+	return c.provider, nil
+}
+
+func (c *oidcClient) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.config.OIDCClientID,
+		ClientSecret: c.config.OIDCClientSecret,
+		RedirectURL:  c.config.OIDCRedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+}
+
+// secureCookie reports whether the state cookie is only sent over HTTPS.
+func (c *oidcClient) secureCookie() bool {
+	return strings.HasPrefix(c.config.OIDCRedirectURL, "https://")
+}
+
+// pkceChallenge returns the S256 code challenge of a PKCE code verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type loginOIDCRequest struct {
+	// Tenant is the slug of the school the user logs in to, the default
+	// tenant when it is empty.
+	Tenant string `form:"tenant"`
+}
+
+// loginOIDC starts a login with the OpenID Connect provider: it redirects
+// to the provider, which redirects back to oidcCallback.
+func (server *Server) loginOIDC(ctx *gin.Context) {
+	if server.oidc == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errOIDCNotConfigured))
+		return
+	}
+	var req loginOIDCRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	tenant, ok := server.slugTenant(ctx, req.Tenant)
+	if !ok {
+		return
+	}
+	provider, err := server.oidc.discover()
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, errorResponse(err))
+		return
+	}
+
+	var state, verifier, nonce string
+	for _, s := range []*string{&state, &verifier, &nonce} {
+		if *s, err = util.RandomToken(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+	}
+	_, err = server.store.CreateOIDCState(ctx, db.CreateOIDCStateParams{
+		StateHash:    util.HashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(server.config.OIDCStateDuration),
+		TenantID:     tenant.ID,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	// The cookie ties the state to the browser that started the login.
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, state, int(server.config.OIDCStateDuration.Seconds()), oidcCookiePath, "", server.oidc.secureCookie(), true)
+
+	url := server.oidc.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	ctx.Redirect(http.StatusFound, url)
+}
+
+type oidcCallbackRequest struct {
+	State            string `form:"state" binding:"required"`
+	Code             string `form:"code"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// oidcClaims are the claims of the ID token mapped to the local user.
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// oidcCallback completes a login with the OpenID Connect provider. It
+// answers like POST /users/login.
+func (server *Server) oidcCallback(ctx *gin.Context) {
+	if server.oidc == nil {
+		ctx.JSON(http.StatusNotFound, errorResponse(errOIDCNotConfigured))
+		return
+	}
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	cookie, _ := ctx.Cookie(oidcStateCookie)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", server.oidc.secureCookie(), true)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(req.State)) != 1 {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidOIDCState))
+		return
+	}
+	state, err := server.store.UseOIDCState(ctx, util.HashToken(req.State))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidOIDCState))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if req.Error != "" {
+		err := fmt.Errorf("OIDC provider refused the login: %s %s", req.Error, req.ErrorDescription)
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	if req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errors.New("code is required")))
+		return
+	}
+
+	provider, err := server.oidc.discover()
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, errorResponse(err))
+		return
+	}
+	oidcCtx := server.oidc.context(ctx.Request.Context())
+	token, err := server.oidc.oauth2Config(provider).Exchange(oidcCtx, req.Code,
+		oauth2.SetAuthURLParam("code_verifier", state.CodeVerifier),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errMissingIDToken))
+		return
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: server.config.OIDCClientID}).Verify(oidcCtx, rawIDToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(state.Nonce)) != 1 {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(errInvalidNonce))
+		return
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		return
+	}
+
+	tenant, err := server.store.GetTenant(ctx, state.TenantID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	user, err := server.oidcUser(ctx, tenant, idToken.Issuer, idToken.Subject, claims)
+	if err != nil {
+		if err == errSignUpNotAllowed || err == errOIDCOtherTenant {
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if user.IsMfaEnabled {
+		server.startMFAChallenge(ctx, user)
+		return
+	}
+	server.issueAccessToken(ctx, user)
+}
+
+// oidcUser returns the local user of an account of the provider, who must
+// belong to the tenant the login was started for. On the first login the
+// account is linked to the user with the same verified email, or else a new
+// user is created, if the tenant allows signing up.
+func (server *Server) oidcUser(ctx *gin.Context, tenant db.Tenant, issuer, subject string, claims oidcClaims) (db.User, error) {
+	identity, err := server.store.GetUserIdentity(ctx, db.GetUserIdentityParams{Issuer: issuer, Subject: subject})
+	if err == nil {
+		user, err := server.store.GetUser(ctx, identity.Username)
+		if err == nil && user.TenantID != tenant.ID {
+			return db.User{}, errOIDCOtherTenant
+		}
+		return user, err
+	}
+	if err != sql.ErrNoRows {
+		return db.User{}, err
+	}
+
+	// An email the provider has not verified is not used.
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	if email != "" {
+		user, err := server.store.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil && user.IsEmailVerified && user.TenantID != tenant.ID:
+			return db.User{}, errOIDCOtherTenant
+		case err == nil && user.IsEmailVerified:
+			_, err = server.store.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+				Issuer:   issuer,
+				Subject:  subject,
+				Username: user.Username,
+				Email:    email,
+			})
+			return user, err
+		case err == nil:
+			// The email belongs to a user who has not verified it.
+			email = ""
+		case err != sql.ErrNoRows:
+			return db.User{}, err
+		}
+	}
+
+	if !tenant.AllowSignUp {
+		return db.User{}, errSignUpNotAllowed
+	}
+	// The password is random: the user logs in with the provider, or
+	// resets it.
+	password, err := util.RandomToken()
+	if err != nil {
+		return db.User{}, err
+	}
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	base := oidcUsername(claims)
+	for i := 1; i <= maxUsernameAttempts; i++ {
+		username := base
+		if i > 1 {
+			username += strconv.Itoa(i)
+		}
+		result, err := server.store.CreateOIDCUserTx(ctx, db.CreateOIDCUserTxParams{
+			CreateUserParams: db.CreateUserParams{
+				Username:       username,
+				HashedPassword: hashedPassword,
+				Email:          email,
+				TenantID:       tenant.ID,
+			},
+			Issuer:          issuer,
+			Subject:         subject,
+			IsEmailVerified: email != "",
+		})
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == "users_pkey" {
+			continue
+		}
+		if err != nil {
+			return db.User{}, err
+		}
+		logger := logging.WithContext(ctx.Request.Context(), server.logger)
+		level.Info(logger).Log("msg", "user provisioned from OIDC", "username", username, "issuer", issuer)
+		return result.User, nil
+	}
+	return db.User{}, fmt.Errorf("no free username for %q", base)
+}
+
+// oidcUsername derives a username from the preferred username or the email
+// of the claims, keeping the letters and digits only.
+func oidcUsername(claims oidcClaims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if b.Len() == maxUsernameLength {
+			break
+		}
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCProvider is an OpenID Connect provider that logs in the account
+// of its claims without asking, and checks the PKCE code verifier.
+type mockOIDCProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	claims map[string]interface{}
+	codes  map[string]url.Values
+}
+
+func newMockOIDCProvider(t *testing.T, clientID string) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &mockOIDCProvider{t: t, key: key, clientID: clientID, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// login sets the claims of the account logged in next.
+func (p *mockOIDCProvider) login(claims map[string]interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+func (p *mockOIDCProvider) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	require.NoError(p.t, json.NewEncoder(w).Encode(v))
+}
+
+func (p *mockOIDCProvider) discovery(w http.ResponseWriter, _ *http.Request) {
+	p.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *mockOIDCProvider) keys(w http.ResponseWriter, _ *http.Request) {
+	p.writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &p.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+	}})
+}
+
+func (p *mockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	require.Equal(p.t, p.clientID, query.Get("client_id"))
+	require.Equal(p.t, "code", query.Get("response_type"))
+	require.Equal(p.t, "S256", query.Get("code_challenge_method"))
+
+	p.mu.Lock()
+	code := "code" + query.Get("state")
+	p.codes[code] = query
+	p.mu.Unlock()
+
+	redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(p.t, r.ParseForm())
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	authorization, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	if !ok || pkceChallenge(r.PostForm.Get("code_verifier")) != authorization.Get("code_challenge") {
+		p.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"aud":   p.clientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authorization.Get("nonce"),
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: p.key, KeyID: "test"},
+	}, nil)
+	require.NoError(p.t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(p.t, err)
+	jws, err := signer.Sign(payload)
+	require.NoError(p.t, err)
+	idToken, err := jws.CompactSerialize()
+	require.NoError(p.t, err)
+
+	p.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+
+	server := newTestServer(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+	get := func(path string, cookies []*http.Cookie, status int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:6061"+path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return validate(t, router, server.router, req, "", status)
+	}
+	get("/users/oidc/login", nil, http.StatusNotFound)
+
+	provider := newMockOIDCProvider(t, "lms")
+	server.config.OIDCIssuerURL = provider.server.URL
+	server.config.OIDCClientID = "lms"
+	server.config.OIDCClientSecret = "secret"
+	server.config.OIDCRedirectURL = "http://localhost:6061/users/oidc/callback"
+	server.config.OIDCStateDuration = time.Minute
+	server.oidc = newOIDCClient(server.config)
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	// startTenant logs in to the tenant with the provider and returns the
+	// path of the callback and the state cookie.
+	startTenant := func(tenant string, claims map[string]interface{}) (string, []*http.Cookie) {
+		provider.login(claims)
+		path := "/users/oidc/login"
+		if tenant != "" {
+			path += "?tenant=" + tenant
+		}
+		w := get(path, nil, http.StatusFound)
+		rsp, err := noRedirect.Get(w.Header().Get("Location"))
+		require.NoError(t, err)
+		rsp.Body.Close()
+		require.Equal(t, http.StatusFound, rsp.StatusCode)
+		callback, err := url.Parse(rsp.Header.Get("Location"))
+		require.NoError(t, err)
+		return callback.RequestURI(), w.Result().Cookies()
+	}
+	start := func(claims map[string]interface{}) (string, []*http.Cookie) {
+		return startTenant("", claims)
+	}
+	loginTenant := func(tenant string, claims map[string]interface{}) map[string]interface{} {
+		callback, cookies := startTenant(tenant, claims)
+		w := get(callback, cookies, http.StatusOK)
+		var rsp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		require.NotEmpty(t, rsp["access_token"])
+		return rsp["user"].(map[string]interface{})
+	}
+	login := func(claims map[string]interface{}) map[string]interface{} {
+		return loginTenant("", claims)
+	}
+	john := map[string]interface{}{"sub": "1", "preferred_username": "john.doe", "email": "john@example.com", "email_verified": true}
+
+	// The user is provisioned on the first login only.
+	user := login(john)
+	require.Equal(t, "johndoe", user["username"])
+	require.Equal(t, "john@example.com", user["email"])
+	require.Equal(t, true, user["is_email_verified"])
+	require.Equal(t, "johndoe", login(john)["username"])
+	require.Len(t, store.users, 1)
+
+	// A taken username gets a number, an unverified email is left out.
+	user = login(map[string]interface{}{"sub": "2", "preferred_username": "johndoe", "email": "other@example.com"})
+	require.Equal(t, "johndoe2", user["username"])
+	require.Equal(t, "", user["email"])
+
+	// A user with the same verified email is linked.
+	store.users["jane"] = db.User{Username: "jane", Email: "jane@example.com", IsEmailVerified: true, TenantID: defaultTenantID}
+	user = login(map[string]interface{}{"sub": "3", "preferred_username": "jsmith", "email": "jane@example.com", "email_verified": true})
+	require.Equal(t, "jane", user["username"])
+	require.Len(t, store.users, 3)
+
+	// The user logs in to the tenant of the login, which must allow signing
+	// up for a user to be created.
+	store.tenants = append(store.tenants,
+		db.Tenant{ID: 2, Slug: "north", Name: "North", AllowSignUp: true},
+		db.Tenant{ID: 3, Slug: "south", Name: "South"},
+	)
+	get("/users/oidc/login?tenant=unknown", nil, http.StatusBadRequest)
+	user = loginTenant("north", map[string]interface{}{"sub": "4", "preferred_username": "ann", "email": "ann@example.com", "email_verified": true})
+	require.Equal(t, "ann", user["username"])
+	require.Equal(t, float64(2), user["tenant_id"])
+	callback, cookies := startTenant("south", map[string]interface{}{"sub": "5", "preferred_username": "bob"})
+	get(callback, cookies, http.StatusForbidden)
+	store.users["bob"] = db.User{Username: "bob", Email: "bob@example.com", IsEmailVerified: true, TenantID: 3}
+	user = loginTenant("south", map[string]interface{}{"sub": "5", "preferred_username": "bob", "email": "bob@example.com", "email_verified": true})
+	require.Equal(t, "bob", user["username"])
+	// Neither the account of a user nor their email log in to another tenant.
+	callback, cookies = startTenant("north", john)
+	get(callback, cookies, http.StatusForbidden)
+	callback, cookies = startTenant("north", map[string]interface{}{"sub": "6", "email": "jane@example.com", "email_verified": true})
+	get(callback, cookies, http.StatusForbidden)
+
+	// The state is bound to the browser by its cookie and can be used once.
+	callback, cookies = start(john)
+	get(callback, nil, http.StatusBadRequest)
+	callback, cookies = start(john)
+	get(callback, cookies, http.StatusOK)
+	get(callback, cookies, http.StatusBadRequest)
+
+	// The code is exchanged with the PKCE code verifier.
+	callback, cookies = start(john)
+	for _, state := range store.oidcStates {
+		state.CodeVerifier = strings.Repeat("x", 43)
+		store.oidcStates[state.StateHash] = state
+	}
+	get(callback, cookies, http.StatusUnauthorized)
+}
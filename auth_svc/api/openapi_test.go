@@ -0,0 +1,676 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/health"
+	"auth/mail"
+	"auth/token"
+	"auth/util"
+	"auth/worker"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// stubStore keeps the users, their tokens and identities, the failed logins,
+// the OAuth clients, the API keys, the tenants and the audit trail in
+// memory. The other queries are not implemented.
+type stubStore struct {
+	db.Store
+	users         map[string]db.User
+	tokens        map[string]db.UserToken
+	recoveryCodes map[string]bool
+	loginFailures map[string]db.LoginFailure
+	auditLog      []db.AuditLog
+	identities    map[string]db.UserIdentity
+	oidcStates    map[string]db.OidcState
+	oauthClients  map[string]db.OauthClient
+	oauthCodes    map[string]db.OauthCode
+	apiKeys       []db.ApiKey
+	tenants       []db.Tenant
+}
+
+func newStubStore() *stubStore {
+	return &stubStore{
+		users:         map[string]db.User{},
+		tokens:        map[string]db.UserToken{},
+		recoveryCodes: map[string]bool{},
+		loginFailures: map[string]db.LoginFailure{},
+		identities:    map[string]db.UserIdentity{},
+		oidcStates:    map[string]db.OidcState{},
+		oauthClients:  map[string]db.OauthClient{},
+		oauthCodes:    map[string]db.OauthCode{},
+		tenants: []db.Tenant{
+			{ID: defaultTenantID, Slug: "default", Name: "Default", AllowSignUp: true, CreatedAt: time.Now()},
+		},
+	}
+}
+
+func (s *stubStore) CreateUser(_ context.Context, arg db.CreateUserParams) (db.User, error) {
+	if _, ok := s.users[arg.Username]; ok {
+		return db.User{}, &pq.Error{Code: "23505", Constraint: "users_pkey"}
+	}
+	user := db.User{Username: arg.Username, HashedPassword: arg.HashedPassword, Email: arg.Email, TenantID: arg.TenantID, CreatedAt: time.Now()}
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *stubStore) CreateUserTx(ctx context.Context, arg db.CreateUserTxParams) (db.CreateUserTxResult, error) {
+	user, err := s.CreateUser(ctx, arg.CreateUserParams)
+	if err != nil {
+		return db.CreateUserTxResult{}, err
+	}
+	if err := arg.AfterCreate(user); err != nil {
+		delete(s.users, user.Username)
+		return db.CreateUserTxResult{}, err
+	}
+	return db.CreateUserTxResult{User: user}, nil
+}
+
+func (s *stubStore) GetUser(_ context.Context, username string) (db.User, error) {
+	user, ok := s.users[username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *stubStore) GetUserByEmail(_ context.Context, email string) (db.User, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return db.User{}, sql.ErrNoRows
+}
+
+func (s *stubStore) CreateUserToken(_ context.Context, arg db.CreateUserTokenParams) (db.UserToken, error) {
+	token := db.UserToken{
+		ID:        int64(len(s.tokens) + 1),
+		Username:  arg.Username,
+		Purpose:   arg.Purpose,
+		TokenHash: arg.TokenHash,
+		Email:     arg.Email,
+		CreatedAt: time.Now(),
+		ExpiresAt: arg.ExpiresAt,
+	}
+	s.tokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (s *stubStore) UseUserToken(_ context.Context, arg db.UseUserTokenParams) (db.UserToken, error) {
+	return s.useToken(arg.TokenHash, arg.Purpose)
+}
+
+func (s *stubStore) UpdateUser(_ context.Context, arg db.UpdateUserParams) (db.User, error) {
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	if arg.HashedPassword.Valid {
+		user.HashedPassword = arg.HashedPassword.String
+	}
+	if arg.PasswordChangedAt.Valid {
+		user.PasswordChangedAt = arg.PasswordChangedAt.Time
+	}
+	if arg.TotpSecret.Valid {
+		user.TotpSecret = arg.TotpSecret.String
+	}
+	if arg.IsMfaEnabled.Valid {
+		user.IsMfaEnabled = arg.IsMfaEnabled.Bool
+	}
+	if arg.FullName.Valid {
+		user.FullName = arg.FullName.String
+	}
+	if arg.IsDisabled.Valid {
+		user.IsDisabled = arg.IsDisabled.Bool
+	}
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *stubStore) ListUsers(_ context.Context, arg db.ListUsersParams) ([]db.User, error) {
+	var usernames []string
+	for username, user := range s.users {
+		if !arg.TenantID.Valid || user.TenantID == arg.TenantID.Int64 {
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+	users := []db.User{}
+	for i := int(arg.RowOffset); i < len(usernames) && len(users) < int(arg.RowLimit); i++ {
+		users = append(users, s.users[usernames[i]])
+	}
+	return users, nil
+}
+
+func (s *stubStore) SetUserStudentID(_ context.Context, arg db.SetUserStudentIDParams) (db.User, error) {
+	user, ok := s.users[arg.Username]
+	if !ok {
+		return db.User{}, sql.ErrNoRows
+	}
+	for _, other := range s.users {
+		if arg.StudentID.Valid && other.StudentID == arg.StudentID && other.Username != arg.Username {
+			return db.User{}, &pq.Error{Code: "23505", Constraint: "users_student_id_key"}
+		}
+	}
+	user.StudentID = arg.StudentID
+	s.users[user.Username] = user
+	return user, nil
+}
+
+func (s *stubStore) DeleteUser(_ context.Context, username string) (int64, error) {
+	if _, ok := s.users[username]; !ok {
+		return 0, nil
+	}
+	delete(s.users, username)
+	return 1, nil
+}
+
+func (s *stubStore) EnableMFATx(ctx context.Context, arg db.EnableMFATxParams) (db.EnableMFATxResult, error) {
+	user, err := s.UpdateUser(ctx, db.UpdateUserParams{Username: arg.Username, IsMfaEnabled: sql.NullBool{Bool: true, Valid: true}})
+	if err != nil {
+		return db.EnableMFATxResult{}, err
+	}
+	for _, hash := range arg.RecoveryCodeHashes {
+		s.recoveryCodes[arg.Username+" "+hash] = true
+	}
+	return db.EnableMFATxResult{User: user}, nil
+}
+
+func (s *stubStore) UseRecoveryCode(_ context.Context, arg db.UseRecoveryCodeParams) (db.RecoveryCode, error) {
+	key := arg.Username + " " + arg.CodeHash
+	if !s.recoveryCodes[key] {
+		return db.RecoveryCode{}, sql.ErrNoRows
+	}
+	s.recoveryCodes[key] = false
+	return db.RecoveryCode{Username: arg.Username, CodeHash: arg.CodeHash, IsUsed: true}, nil
+}
+
+func (s *stubStore) GetLoginFailures(_ context.Context, keys []string) ([]db.LoginFailure, error) {
+	var failures []db.LoginFailure
+	for _, key := range keys {
+		if failure, ok := s.loginFailures[key]; ok {
+			failures = append(failures, failure)
+		}
+	}
+	return failures, nil
+}
+
+func (s *stubStore) RecordLoginFailure(_ context.Context, arg db.RecordLoginFailureParams) (db.LoginFailure, error) {
+	failure, ok := s.loginFailures[arg.Key]
+	if !ok || failure.LastFailedAt.Before(arg.ResetBefore) {
+		failure = db.LoginFailure{Key: arg.Key, LockedUntil: failure.LockedUntil}
+	}
+	failure.Failures++
+	failure.LastFailedAt = time.Now()
+	s.loginFailures[arg.Key] = failure
+	return failure, nil
+}
+
+func (s *stubStore) LockLogin(_ context.Context, arg db.LockLoginParams) error {
+	failure := s.loginFailures[arg.Key]
+	failure.LockedUntil = arg.LockedUntil
+	s.loginFailures[arg.Key] = failure
+	return nil
+}
+
+func (s *stubStore) DeleteLoginFailures(_ context.Context, key string) error {
+	delete(s.loginFailures, key)
+	return nil
+}
+
+func (s *stubStore) CreateAuditRecord(_ context.Context, arg db.CreateAuditRecordParams) (db.AuditLog, error) {
+	record := db.AuditLog{
+		ID:        int64(len(s.auditLog) + 1),
+		Actor:     arg.Actor,
+		Action:    arg.Action,
+		Entity:    arg.Entity,
+		EntityID:  arg.EntityID,
+		Before:    arg.Before,
+		After:     arg.After,
+		Diff:      arg.Diff,
+		CreatedAt: time.Now(),
+	}
+	s.auditLog = append(s.auditLog, record)
+	return record, nil
+}
+
+func (s *stubStore) CreateOIDCState(_ context.Context, arg db.CreateOIDCStateParams) (db.OidcState, error) {
+	state := db.OidcState{
+		StateHash:    arg.StateHash,
+		CodeVerifier: arg.CodeVerifier,
+		Nonce:        arg.Nonce,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    arg.ExpiresAt,
+		TenantID:     arg.TenantID,
+	}
+	s.oidcStates[state.StateHash] = state
+	return state, nil
+}
+
+func (s *stubStore) UseOIDCState(_ context.Context, stateHash string) (db.OidcState, error) {
+	state, ok := s.oidcStates[stateHash]
+	delete(s.oidcStates, stateHash)
+	if !ok || time.Now().After(state.ExpiresAt) {
+		return db.OidcState{}, sql.ErrNoRows
+	}
+	return state, nil
+}
+
+func (s *stubStore) GetUserIdentity(_ context.Context, arg db.GetUserIdentityParams) (db.UserIdentity, error) {
+	identity, ok := s.identities[arg.Issuer+" "+arg.Subject]
+	if !ok {
+		return db.UserIdentity{}, sql.ErrNoRows
+	}
+	return identity, nil
+}
+
+func (s *stubStore) CreateUserIdentity(_ context.Context, arg db.CreateUserIdentityParams) (db.UserIdentity, error) {
+	identity := db.UserIdentity{
+		Issuer:    arg.Issuer,
+		Subject:   arg.Subject,
+		Username:  arg.Username,
+		Email:     arg.Email,
+		CreatedAt: time.Now(),
+	}
+	s.identities[arg.Issuer+" "+arg.Subject] = identity
+	return identity, nil
+}
+
+func (s *stubStore) CreateOIDCUserTx(ctx context.Context, arg db.CreateOIDCUserTxParams) (db.CreateOIDCUserTxResult, error) {
+	user, err := s.CreateUser(ctx, arg.CreateUserParams)
+	if err != nil {
+		return db.CreateOIDCUserTxResult{}, err
+	}
+	user.IsEmailVerified = arg.IsEmailVerified
+	s.users[user.Username] = user
+	identity, err := s.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Issuer:   arg.Issuer,
+		Subject:  arg.Subject,
+		Username: arg.Username,
+		Email:    arg.Email,
+	})
+	return db.CreateOIDCUserTxResult{User: user, Identity: identity}, err
+}
+
+func (s *stubStore) CreateOAuthClient(_ context.Context, arg db.CreateOAuthClientParams) (db.OauthClient, error) {
+	client := db.OauthClient{
+		ID:           arg.ID,
+		SecretHash:   arg.SecretHash,
+		Name:         arg.Name,
+		RedirectUris: arg.RedirectUris,
+		GrantTypes:   arg.GrantTypes,
+		Scopes:       arg.Scopes,
+		TenantID:     arg.TenantID,
+		CreatedAt:    time.Now(),
+	}
+	s.oauthClients[client.ID] = client
+	return client, nil
+}
+
+func (s *stubStore) GetOAuthClient(_ context.Context, id string) (db.OauthClient, error) {
+	client, ok := s.oauthClients[id]
+	if !ok {
+		return db.OauthClient{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func (s *stubStore) ListOAuthClients(_ context.Context) ([]db.OauthClient, error) {
+	clients := []db.OauthClient{}
+	for _, client := range s.oauthClients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (s *stubStore) DeleteOAuthClient(_ context.Context, id string) (int64, error) {
+	if _, ok := s.oauthClients[id]; !ok {
+		return 0, nil
+	}
+	delete(s.oauthClients, id)
+	return 1, nil
+}
+
+func (s *stubStore) CreateOAuthCode(_ context.Context, arg db.CreateOAuthCodeParams) (db.OauthCode, error) {
+	code := db.OauthCode{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		Username:      arg.Username,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		CreatedAt:     time.Now(),
+		ExpiresAt:     arg.ExpiresAt,
+	}
+	s.oauthCodes[code.CodeHash] = code
+	return code, nil
+}
+
+func (s *stubStore) UseOAuthCode(_ context.Context, codeHash string) (db.OauthCode, error) {
+	code, ok := s.oauthCodes[codeHash]
+	delete(s.oauthCodes, codeHash)
+	if !ok || time.Now().After(code.ExpiresAt) {
+		return db.OauthCode{}, sql.ErrNoRows
+	}
+	return code, nil
+}
+
+func (s *stubStore) CreateAPIKey(_ context.Context, arg db.CreateAPIKeyParams) (db.ApiKey, error) {
+	key := db.ApiKey{
+		ID:        int64(len(s.apiKeys) + 1),
+		Prefix:    arg.Prefix,
+		KeyHash:   arg.KeyHash,
+		Name:      arg.Name,
+		Username:  arg.Username,
+		ClientID:  arg.ClientID,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	s.apiKeys = append(s.apiKeys, key)
+	return key, nil
+}
+
+func (s *stubStore) GetAPIKeyByHash(_ context.Context, keyHash string) (db.ApiKey, error) {
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return db.ApiKey{}, sql.ErrNoRows
+}
+
+func (s *stubStore) ListAPIKeys(_ context.Context) ([]db.ApiKey, error) {
+	return append([]db.ApiKey{}, s.apiKeys...), nil
+}
+
+func (s *stubStore) ListUserAPIKeys(_ context.Context, username sql.NullString) ([]db.ApiKey, error) {
+	var keys []db.ApiKey
+	for _, key := range s.apiKeys {
+		if key.Username == username {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *stubStore) RevokeAPIKey(_ context.Context, arg db.RevokeAPIKeyParams) (db.ApiKey, error) {
+	for i, key := range s.apiKeys {
+		if key.ID == arg.ID && !key.RevokedAt.Valid && (!arg.Username.Valid || key.Username == arg.Username) {
+			s.apiKeys[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return s.apiKeys[i], nil
+		}
+	}
+	return db.ApiKey{}, sql.ErrNoRows
+}
+
+func (s *stubStore) TouchAPIKey(_ context.Context, id int64) error {
+	for i, key := range s.apiKeys {
+		if key.ID == id {
+			s.apiKeys[i].LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *stubStore) CreateTenant(_ context.Context, arg db.CreateTenantParams) (db.Tenant, error) {
+	for _, tenant := range s.tenants {
+		if tenant.Slug == arg.Slug {
+			return db.Tenant{}, &pq.Error{Code: "23505", Constraint: "tenants_slug_key"}
+		}
+	}
+	tenant := db.Tenant{
+		ID:                          int64(len(s.tenants) + 1),
+		Slug:                        arg.Slug,
+		Name:                        arg.Name,
+		AllowSignUp:                 arg.AllowSignUp,
+		PasswordMinLength:           arg.PasswordMinLength,
+		PasswordMinCharacterClasses: arg.PasswordMinCharacterClasses,
+		CreatedAt:                   time.Now(),
+	}
+	s.tenants = append(s.tenants, tenant)
+	return tenant, nil
+}
+
+func (s *stubStore) GetTenant(_ context.Context, id int64) (db.Tenant, error) {
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			return tenant, nil
+		}
+	}
+	return db.Tenant{}, sql.ErrNoRows
+}
+
+func (s *stubStore) GetTenantBySlug(_ context.Context, slug string) (db.Tenant, error) {
+	for _, tenant := range s.tenants {
+		if tenant.Slug == slug {
+			return tenant, nil
+		}
+	}
+	return db.Tenant{}, sql.ErrNoRows
+}
+
+func (s *stubStore) ListTenants(_ context.Context) ([]db.Tenant, error) {
+	return s.tenants, nil
+}
+
+func (s *stubStore) UpdateTenant(_ context.Context, arg db.UpdateTenantParams) (db.Tenant, error) {
+	for i, tenant := range s.tenants {
+		if tenant.ID != arg.ID {
+			continue
+		}
+		if arg.Name.Valid {
+			tenant.Name = arg.Name.String
+		}
+		if arg.AllowSignUp.Valid {
+			tenant.AllowSignUp = arg.AllowSignUp.Bool
+		}
+		if arg.PasswordMinLength.Valid {
+			tenant.PasswordMinLength = arg.PasswordMinLength.Int32
+		}
+		if arg.PasswordMinCharacterClasses.Valid {
+			tenant.PasswordMinCharacterClasses = arg.PasswordMinCharacterClasses.Int32
+		}
+		s.tenants[i] = tenant
+		return tenant, nil
+	}
+	return db.Tenant{}, sql.ErrNoRows
+}
+
+func (s *stubStore) useToken(hash, purpose string) (db.UserToken, error) {
+	token, ok := s.tokens[hash]
+	if !ok || token.Purpose != purpose || token.IsUsed || time.Now().After(token.ExpiresAt) {
+		return db.UserToken{}, sql.ErrNoRows
+	}
+	token.IsUsed = true
+	s.tokens[hash] = token
+	return token, nil
+}
+
+func (s *stubStore) VerifyEmailTx(_ context.Context, arg db.VerifyEmailTxParams) (db.VerifyEmailTxResult, error) {
+	token, err := s.useToken(arg.TokenHash, db.TokenPurposeVerifyEmail)
+	if err != nil {
+		return db.VerifyEmailTxResult{}, err
+	}
+	user := s.users[token.Username]
+	user.Email = token.Email
+	user.IsEmailVerified = true
+	s.users[user.Username] = user
+	return db.VerifyEmailTxResult{User: user}, nil
+}
+
+func (s *stubStore) ResetPasswordTx(_ context.Context, arg db.ResetPasswordTxParams) (db.ResetPasswordTxResult, error) {
+	token, err := s.useToken(arg.TokenHash, db.TokenPurposeResetPassword)
+	if err != nil {
+		return db.ResetPasswordTxResult{}, err
+	}
+	user := s.users[token.Username]
+	hashedPassword, err := arg.HashPassword(user)
+	if err != nil {
+		token.IsUsed = false
+		s.tokens[arg.TokenHash] = token
+		return db.ResetPasswordTxResult{}, err
+	}
+	user.HashedPassword = hashedPassword
+	user.PasswordChangedAt = time.Now()
+	s.users[user.Username] = user
+	return db.ResetPasswordTxResult{User: user}, nil
+}
+
+// TestOpenAPI sends requests that conform to openapi.yaml to the server and
+// checks that the responses conform to it too.
+func TestOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+
+	server := newTestServer(t, &mail.MemorySender{})
+
+	testCases := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{path: "/users", body: `{"username":"john","password":"secret","email":"john@example.com"}`, status: http.StatusOK},
+		{path: "/users/login", body: `{"username":"john","password":"secret"}`, status: http.StatusOK},
+		{path: "/users/login", body: `{"username":"john","password":"wrong"}`, status: http.StatusUnauthorized},
+		{path: "/users/login", body: `{"username":"jane","password":"secret"}`, status: http.StatusUnauthorized},
+		{path: "/users/verify_email", body: `{"token":"invalid"}`, status: http.StatusBadRequest},
+		{path: "/users/forgot_password", body: `{"email":"john@example.com"}`, status: http.StatusAccepted},
+		{path: "/users/forgot_password", body: `{"email":"jane@example.com"}`, status: http.StatusAccepted},
+		{path: "/users/reset_password", body: `{"token":"invalid","password":"secret2"}`, status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:6061"+tc.path, bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			validate(t, router, server.router, req, tc.body, tc.status)
+		})
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost:6061"+path, nil)
+			validate(t, router, server.router, req, "", http.StatusOK)
+		})
+	}
+}
+
+// syncDistributor runs the tasks right away instead of enqueuing them.
+type syncDistributor struct {
+	processor worker.TaskProcessor
+}
+
+func (d syncDistributor) DistributeTaskSendVerifyEmail(ctx context.Context, payload *worker.PayloadSendVerifyEmail, _ ...asynq.Option) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return d.processor.ProcessTaskSendVerifyEmail(ctx, asynq.NewTask(worker.TaskSendVerifyEmail, data))
+}
+
+func (d syncDistributor) DistributeTaskSendResetPasswordEmail(ctx context.Context, payload *worker.PayloadSendResetPasswordEmail, _ ...asynq.Option) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return d.processor.ProcessTaskSendResetPasswordEmail(ctx, asynq.NewTask(worker.TaskSendResetPasswordEmail, data))
+}
+
+func newTestServer(t *testing.T, mailer mail.Sender) *Server {
+	config := util.Config{
+		SecretKey:             "12345678901234567890123456789012",
+		AccessTokenDuration:   time.Minute,
+		UserTokenScopes:       "profile students:read courses:read",
+		EmailLinkBaseURL:      "http://localhost:3001",
+		VerifyEmailDuration:   time.Hour,
+		ResetPasswordDuration: time.Hour,
+		MFAEncryptionKey:      "12345678901234567890123456789012",
+		MFAChallengeDuration:  time.Minute,
+		LoginMaxFailures:      5,
+		LoginIPMaxFailures:    8,
+		LoginLockoutDuration:  time.Hour,
+		LoginFailureWindow:    time.Hour,
+		OAuthCodeDuration:     time.Minute,
+	}
+	store := newStubStore()
+	processor := worker.NewRedisTaskProcessor(asynq.RedisClientOpt{}, store, mailer, config, log.NewNopLogger())
+	server, err := NewServer(config, store, syncDistributor{processor}, token.NewMemoryDenylist(), health.New(), log.NewNopLogger())
+	require.NoError(t, err)
+	return server
+}
+
+func init() {
+	// The form decoder of kin-openapi sets the fields missing from a form to
+	// null, which fails the schema of optional fields.
+	decode := openapi3filter.RegisteredBodyDecoder("application/x-www-form-urlencoded")
+	openapi3filter.RegisterBodyDecoder("application/x-www-form-urlencoded", func(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (interface{}, error) {
+		value, err := decode(body, header, schema, encFn)
+		if obj, ok := value.(map[string]interface{}); ok {
+			for k, v := range obj {
+				if v == nil {
+					delete(obj, k)
+				}
+			}
+		}
+		return value, err
+	})
+}
+
+func newSpecRouter(t *testing.T) routers.Router {
+	spec, err := openapi3.NewLoader().LoadFromData(OpenAPISpec)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(context.Background()))
+	router, err := gorillamux.NewRouter(spec)
+	require.NoError(t, err)
+	return router
+}
+
+// validate checks that req conforms to the spec, serves it and checks that
+// the response has the given status and conforms to the spec. It returns
+// the response.
+func validate(t *testing.T, router routers.Router, handler http.Handler, req *http.Request, body string, status int) *httptest.ResponseRecorder {
+	route, pathParams, err := router.FindRoute(req)
+	require.NoError(t, err)
+	requestInput := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+	}
+	require.NoError(t, openapi3filter.ValidateRequest(context.Background(), requestInput))
+	req.Body = io.NopCloser(bytes.NewBufferString(body))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, status, w.Code, w.Body.String())
+
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestInput,
+		Status:                 w.Code,
+		Header:                 w.Header(),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	responseInput.SetBodyBytes(w.Body.Bytes())
+	require.NoError(t, openapi3filter.ValidateResponse(context.Background(), responseInput))
+	return w
+}
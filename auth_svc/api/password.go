@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	db "auth/db/sqlc"
+	"auth/logging"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log/level"
+)
+
+// newPasswordHash checks a new password of a user of the tenant against
+// the password policy of the tenant and returns its hash. The error wraps
+// util.ErrWeakPassword when the password is refused.
+func (server *Server) newPasswordHash(ctx context.Context, tenantID int64, password string) (string, error) {
+	policy, err := server.tenantPasswordPolicy(ctx, tenantID)
+	if err != nil {
+		return "", err
+	}
+	if err := policy.Validate(password); err != nil {
+		return "", err
+	}
+	return util.HashPassword(password)
+}
+
+// hashNewPassword is newPasswordHash for the handlers. It answers with an
+// error when it returns false.
+func (server *Server) hashNewPassword(ctx *gin.Context, tenantID int64, password string) (string, bool) {
+	hashedPassword, err := server.newPasswordHash(ctx, tenantID, password)
+	if err != nil {
+		passwordError(ctx, err)
+		return "", false
+	}
+	return hashedPassword, true
+}
+
+// passwordError answers with the error of newPasswordHash.
+func passwordError(ctx *gin.Context, err error) {
+	if errors.Is(err, util.ErrWeakPassword) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+}
+
+// rehashPassword replaces the hash of the password of the user when it was
+// computed by an older algorithm or with older parameters. The password was
+// just checked, and the login goes on when the hash can not be replaced.
+func (server *Server) rehashPassword(ctx *gin.Context, user db.User, password string) {
+	if !util.NeedsRehash(user.HashedPassword) {
+		return
+	}
+
+	logger := logging.WithContext(ctx.Request.Context(), server.logger)
+	hashedPassword, err := util.HashPassword(password)
+	if err == nil {
+		_, err = server.store.UpdateUser(ctx, db.UpdateUserParams{
+			Username:       user.Username,
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		})
+	}
+	if err != nil {
+		level.Warn(logger).Log("msg", "cannot rehash password", "username", user.Username, "err", err)
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"auth/mail"
+	"auth/util"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	mailer := &mail.MemorySender{}
+	server, send := newAccountTest(t, mailer)
+	server.passwordPolicy = util.PasswordPolicy{MinLength: 8, MinCharacterClasses: 2}
+
+	rsp := send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com"}`, http.StatusBadRequest)
+	require.Contains(t, rsp["error"], "at least 8 characters")
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"longsecret","email":"john@example.com"}`, http.StatusBadRequest)
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"long-secret","email":"john@example.com"}`, http.StatusOK)
+
+	accessToken := send(http.MethodPost, "/users/login", "", `{"username":"john","password":"long-secret"}`, http.StatusOK)["access_token"].(string)
+	send(http.MethodPost, "/users/me/password", accessToken, `{"current_password":"long-secret","new_password":"short"}`, http.StatusBadRequest)
+
+	send(http.MethodPost, "/users/forgot_password", "", `{"email":"john@example.com"}`, http.StatusAccepted)
+	reset := lastToken(t, mailer, "john@example.com")
+	send(http.MethodPost, "/users/reset_password", "", `{"token":"`+reset+`","password":"longsecret"}`, http.StatusBadRequest)
+	send(http.MethodPost, "/users/reset_password", "", `{"token":"`+reset+`","password":"longsecret2"}`, http.StatusOK)
+}
+
+func TestRehashPassword(t *testing.T) {
+	server, send := newAccountTest(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com"}`, http.StatusOK)
+	require.True(t, strings.HasPrefix(store.users["john"].HashedPassword, "$argon2id$"))
+
+	// The bcrypt hash of an older account is replaced at the first login.
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := store.users["john"]
+	user.HashedPassword = string(bcryptHash)
+	store.users["john"] = user
+
+	send(http.MethodPost, "/users/login", "", `{"username":"john","password":"wrong"}`, http.StatusUnauthorized)
+	require.Equal(t, string(bcryptHash), store.users["john"].HashedPassword)
+
+	send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusOK)
+	hashedPassword := store.users["john"].HashedPassword
+	require.True(t, strings.HasPrefix(hashedPassword, "$argon2id$"), hashedPassword)
+	require.False(t, util.NeedsRehash(hashedPassword))
+	require.Equal(t, user.PasswordChangedAt, store.users["john"].PasswordChangedAt)
+
+	send(http.MethodPost, "/users/login", "", `{"username":"john","password":"secret"}`, http.StatusOK)
+	require.Equal(t, hashedPassword, store.users["john"].HashedPassword)
+}
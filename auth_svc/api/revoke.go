@@ -0,0 +1,64 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"auth/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// logoutUser revokes the access token of the request.
+func (server *Server) logoutUser(ctx *gin.Context) {
+	payload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if err := server.denylist.Revoke(ctx, payload.ID, payload.ExpiredAt); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+type revokeTokenRequest struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// revokeToken revokes a single token by its ID. The expiry of the token is
+// not known, so it stays on the denylist for the longest token duration.
+func (server *Server) revokeToken(ctx *gin.Context) {
+	var req revokeTokenRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	id := uuid.MustParse(req.ID)
+	if err := server.denylist.Revoke(ctx, id, time.Now().Add(server.config.AccessTokenDuration)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.audit(ctx, auditActorAdmin, "revoke", auditEntityToken, id.String(), nil)
+	ctx.Status(http.StatusNoContent)
+}
+
+// revokeUserTokens revokes all the tokens issued to a user until now.
+func (server *Server) revokeUserTokens(ctx *gin.Context) {
+	username := ctx.Param("username")
+	if _, err := server.store.GetUser(ctx, username); err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	if err := server.denylist.RevokeUser(ctx, username, server.config.AccessTokenDuration); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.audit(ctx, auditActorAdmin, "revoke_tokens", auditEntityUser, username, nil)
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	server := newTestServer(t, &mail.MemorySender{})
+	store := server.store.(*stubStore)
+	admin := server.AdminHandler()
+
+	post := func(path, accessToken, body string, status int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:6061"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		return validate(t, router, server.router, req, body, status)
+	}
+	login := func() string {
+		w := post("/users/login", "", `{"username":"admin","password":"secret"}`, http.StatusOK)
+		var rsp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		return rsp["access_token"].(string)
+	}
+	client := registerOAuthClient(t, admin, `{"name":"resource server","grant_types":["client_credentials"],"scopes":["profile"]}`)
+	introspect := func(accessToken string, active bool) map[string]interface{} {
+		rsp := introspectToken(t, router, server, client, accessToken)
+		require.Equal(t, active, rsp["active"])
+		return rsp
+	}
+	revoke := func(path string, status int) {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		require.Equal(t, status, w.Code, w.Body.String())
+	}
+
+	post("/users", "", `{"username":"admin","password":"secret","email":"admin@example.com"}`, http.StatusOK)
+
+	// Logging out revokes only the token of the request.
+	accessToken, otherToken := login(), login()
+	post("/users/logout", accessToken, "", http.StatusNoContent)
+	post("/users/logout", accessToken, "", http.StatusUnauthorized)
+	post("/users/mfa/totp", accessToken, "", http.StatusUnauthorized)
+	introspect(accessToken, false)
+
+	// An admin revokes a token by its ID.
+	id := introspect(otherToken, true)["jti"].(string)
+	revoke("/admin/tokens/not-a-uuid/revoke", http.StatusBadRequest)
+	revoke("/admin/tokens/"+id+"/revoke", http.StatusNoContent)
+	introspect(otherToken, false)
+
+	// Revoking the tokens of a user spares the tokens issued later.
+	accessToken, otherToken = login(), login()
+	revoke("/admin/users/jane/revoke_tokens", http.StatusNotFound)
+	revoke("/admin/users/admin/revoke_tokens", http.StatusNoContent)
+	introspect(accessToken, false)
+	introspect(otherToken, false)
+	introspect(login(), true)
+
+	// The first record is the registration of the client.
+	require.Len(t, store.auditLog, 3)
+	require.Equal(t, "revoke", store.auditLog[1].Action)
+	require.Equal(t, id, store.auditLog[1].EntityID)
+	require.Equal(t, "revoke_tokens", store.auditLog[2].Action)
+	require.Equal(t, "admin", store.auditLog[2].EntityID)
+}
@@ -1,56 +1,212 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	"auth/health"
+	"auth/metrics"
 	"auth/token"
 	"auth/util"
+	"auth/worker"
 
 	db "auth/db/sqlc"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
+// ShutdownTimeout bounds how long the in-flight requests of a server are
+// drained.
+const ShutdownTimeout = 15 * time.Second
+
 // Server serves HTTP requests for our banking service.
 type Server struct {
-	config     util.Config
-	store      db.Store
-	tokenMaker token.Maker
-	router     *gin.Engine
+	config      util.Config
+	store       db.Store
+	tokenMaker  token.Maker
+	distributor worker.TaskDistributor
+	denylist    token.Denylist
+	health      *health.Health
+	logger      log.Logger
+	router      *gin.Engine
+	// oidc is nil when OIDC login is not configured.
+	oidc *oidcClient
+	// dummyPasswordHash is checked for unknown usernames at login.
+	dummyPasswordHash string
+	passwordPolicy    util.PasswordPolicy
+	// userScopes are granted by the tokens of our own apps.
+	userScopes []string
 }
 
 // NewServer creates a new HTTP server and set up routing.
-func NewServer(config util.Config, store db.Store) (*Server, error) {
+func NewServer(config util.Config, store db.Store, distributor worker.TaskDistributor, denylist token.Denylist, checks *health.Health, logger log.Logger) (*Server, error) {
 	tokenMaker, err := token.NewJWTMaker(config.SecretKey)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create token maker: %w", err)
 	}
+	userScopes := strings.Fields(config.UserTokenScopes)
+	for _, scope := range userScopes {
+		if _, ok := oauthScopes[scope]; !ok {
+			return nil, fmt.Errorf("invalid USER_TOKEN_SCOPES: unknown scope %q", scope)
+		}
+	}
+	switch len(config.MFAEncryptionKey) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid MFA encryption key: must be 16, 24 or 32 characters")
+	}
+
+	dummyPassword, err := util.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+	dummyPasswordHash, err := util.HashPassword(dummyPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordPolicy := util.PasswordPolicy{
+		MinLength:           config.PasswordMinLength,
+		MinCharacterClasses: config.PasswordMinClasses,
+	}
+	if config.PasswordBreachedList != "" {
+		passwordPolicy.Breached, err = util.NewBreachedPasswords(config.PasswordBreachedList)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	server := &Server{
-		config:     config,
-		store:      store,
-		tokenMaker: tokenMaker,
+		config:            config,
+		store:             store,
+		tokenMaker:        tokenMaker,
+		distributor:       distributor,
+		denylist:          denylist,
+		health:            checks,
+		logger:            logger,
+		dummyPasswordHash: dummyPasswordHash,
+		passwordPolicy:    passwordPolicy,
+		userScopes:        userScopes,
 	}
 
-	server.setupRouter()
+	if config.OIDCIssuerURL != "" {
+		server.oidc = newOIDCClient(config)
+	}
+
+	if err := server.setupRouter(); err != nil {
+		return nil, err
+	}
 	return server, nil
 }
 
-func (server *Server) setupRouter() {
-	router := gin.Default()
+func (server *Server) setupRouter() error {
+	router := gin.New()
+	// The client address counts failed logins, so it is only read from the
+	// X-Forwarded-For header of the trusted proxies.
+	if err := router.SetTrustedProxies(trustedProxies(server.config.TrustedProxies)); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	router.Use(gin.Recovery(), otelgin.Middleware("auth_svc"), loggerMiddleware(server.logger), metrics.GinMiddleware())
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", gin.WrapF(server.health.Liveness))
+	router.GET("/readyz", gin.WrapF(server.health.Readiness))
+	router.GET("/openapi.yaml", serveOpenAPISpec)
+	router.GET("/docs", serveSwaggerUI)
 
 	router.POST("/users", server.createUser)
 	router.POST("/users/login", server.loginUser)
-	router.POST("/token/validate", server.validateToken)
+	router.POST("/users/login/mfa", server.loginMFA)
+	router.GET("/users/oidc/login", server.loginOIDC)
+	router.GET("/users/oidc/callback", server.oidcCallback)
+	router.POST("/users/verify_email", server.verifyEmail)
+	router.POST("/users/forgot_password", server.forgotPassword)
+	router.POST("/users/reset_password", server.resetPassword)
+	router.POST("/oauth/token", server.oauthToken)
+	router.POST("/oauth/introspect", server.introspectToken)
+	router.POST("/api_keys/verify", server.verifyAPIKey)
 
-	// authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.denylist))
+	authRoutes.GET("/users/me", server.getCurrentUser)
+	authRoutes.PATCH("/users/me", server.updateCurrentUser)
+	authRoutes.POST("/users/me/password", server.changePassword)
+	authRoutes.POST("/users/logout", server.logoutUser)
+	authRoutes.POST("/users/mfa/totp", server.enrollTOTP)
+	authRoutes.POST("/users/mfa/totp/verify", server.verifyTOTP)
+	authRoutes.GET("/oauth/authorize", server.authorizeInfo)
+	authRoutes.POST("/oauth/authorize", server.authorize)
+	authRoutes.POST("/api_keys", server.createAPIKey)
+	authRoutes.GET("/api_keys", server.listAPIKeys)
+	authRoutes.DELETE("/api_keys/:id", server.revokeAPIKey)
 
 	server.router = router
+	return nil
+}
+
+// trustedProxies splits a comma-separated list of addresses or CIDRs.
+func trustedProxies(list string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(list, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
 
-// Start runs the HTTP server on a specific address.
-func (server *Server) Start(address string) error {
-	return server.router.Run(address)
+// AdminHandler serves the admin endpoints, which are not exposed with the
+// public API.
+func (server *Server) AdminHandler() http.Handler {
+	router := gin.New()
+	router.Use(gin.Recovery(), loggerMiddleware(server.logger))
+	router.GET("/admin/users", server.listUsers)
+	router.DELETE("/admin/users/:username", server.deleteUser)
+	router.POST("/admin/users/:username/disable", server.disableUser)
+	router.POST("/admin/users/:username/enable", server.enableUser)
+	router.PUT("/admin/users/:username/student", server.setUserStudent)
+	router.DELETE("/admin/users/:username/student", server.unlinkUserStudent)
+	router.POST("/admin/users/:username/unlock", server.unlockUser)
+	router.POST("/admin/ips/:ip/unlock", server.unlockIP)
+	router.POST("/admin/tokens/:id/revoke", server.revokeToken)
+	router.POST("/admin/users/:username/revoke_tokens", server.revokeUserTokens)
+	router.POST("/admin/oauth/clients", server.createOAuthClient)
+	router.GET("/admin/oauth/clients", server.listOAuthClients)
+	router.DELETE("/admin/oauth/clients/:id", server.deleteOAuthClient)
+	router.POST("/admin/oauth/clients/:id/api_keys", server.createServiceAPIKey)
+	router.GET("/admin/api_keys", server.listAllAPIKeys)
+	router.DELETE("/admin/api_keys/:id", server.revokeAnyAPIKey)
+	router.POST("/admin/tenants", server.createTenant)
+	router.GET("/admin/tenants", server.listTenants)
+	router.GET("/admin/tenants/:id", server.getTenant)
+	router.PATCH("/admin/tenants/:id", server.updateTenant)
+	return router
+}
+
+// Start runs the HTTP server on a specific address until ctx is done, then
+// drains the in-flight requests.
+func (server *Server) Start(ctx context.Context, address string) error {
+	srv := &http.Server{Addr: address, Handler: server.router}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop getting new requests, then drain the in-flight ones.
+	server.health.Drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
 
 func errorResponse(err error) gin.H {
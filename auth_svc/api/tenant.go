@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/util"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// defaultTenantID is the tenant of the users and clients created before
+// there were tenants, and of the users signing up without naming one.
+const defaultTenantID = 1
+
+var (
+	errTenantNotFound   = errors.New("tenant not found")
+	errSignUpNotAllowed = errors.New("the tenant does not allow signing up")
+	errInvalidSlug      = errors.New("slug must be lowercase letters, digits and dashes")
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type tenantResponse struct {
+	ID          int64  `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	AllowSignUp bool   `json:"allow_sign_up"`
+	// The password settings are 0 when the tenant uses the configuration
+	// of the service.
+	PasswordMinLength           int32     `json:"password_min_length"`
+	PasswordMinCharacterClasses int32     `json:"password_min_character_classes"`
+	CreatedAt                   time.Time `json:"created_at"`
+}
+
+func newTenantResponse(tenant db.Tenant) tenantResponse {
+	return tenantResponse{
+		ID:                          tenant.ID,
+		Slug:                        tenant.Slug,
+		Name:                        tenant.Name,
+		AllowSignUp:                 tenant.AllowSignUp,
+		PasswordMinLength:           tenant.PasswordMinLength,
+		PasswordMinCharacterClasses: tenant.PasswordMinCharacterClasses,
+		CreatedAt:                   tenant.CreatedAt,
+	}
+}
+
+type createTenantRequest struct {
+	Slug string `json:"slug" binding:"required,max=50"`
+	Name string `json:"name" binding:"required,max=100"`
+	// AllowSignUp defaults to true.
+	AllowSignUp                 *bool `json:"allow_sign_up"`
+	PasswordMinLength           int32 `json:"password_min_length" binding:"min=0,max=128"`
+	PasswordMinCharacterClasses int32 `json:"password_min_character_classes" binding:"min=0,max=4"`
+}
+
+// createTenant adds a school to the deployment.
+func (server *Server) createTenant(ctx *gin.Context) {
+	var req createTenantRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidSlug))
+		return
+	}
+
+	arg := db.CreateTenantParams{
+		Slug:                        req.Slug,
+		Name:                        req.Name,
+		AllowSignUp:                 true,
+		PasswordMinLength:           req.PasswordMinLength,
+		PasswordMinCharacterClasses: req.PasswordMinCharacterClasses,
+	}
+	if req.AllowSignUp != nil {
+		arg.AllowSignUp = *req.AllowSignUp
+	}
+	tenant, err := server.store.CreateTenant(ctx, arg)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := newTenantResponse(tenant)
+	server.audit(ctx, auditActorAdmin, "create", auditEntityTenant, strconv.FormatInt(tenant.ID, 10), rsp)
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+func (server *Server) listTenants(ctx *gin.Context) {
+	tenants, err := server.store.ListTenants(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := []tenantResponse{}
+	for _, tenant := range tenants {
+		rsp = append(rsp, newTenantResponse(tenant))
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type tenantURI struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+func (server *Server) getTenant(ctx *gin.Context) {
+	var uri tenantURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	tenant, err := server.store.GetTenant(ctx, uri.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errTenantNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newTenantResponse(tenant))
+}
+
+type updateTenantRequest struct {
+	Name                        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	AllowSignUp                 *bool   `json:"allow_sign_up"`
+	PasswordMinLength           *int32  `json:"password_min_length" binding:"omitempty,min=0,max=128"`
+	PasswordMinCharacterClasses *int32  `json:"password_min_character_classes" binding:"omitempty,min=0,max=4"`
+}
+
+// updateTenant changes the settings of a tenant. Its slug can not be
+// changed, since its users sign up with it.
+func (server *Server) updateTenant(ctx *gin.Context) {
+	var uri tenantURI
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	var req updateTenantRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	arg := db.UpdateTenantParams{ID: uri.ID}
+	if req.Name != nil {
+		arg.Name = sql.NullString{String: *req.Name, Valid: true}
+	}
+	if req.AllowSignUp != nil {
+		arg.AllowSignUp = sql.NullBool{Bool: *req.AllowSignUp, Valid: true}
+	}
+	if req.PasswordMinLength != nil {
+		arg.PasswordMinLength = sql.NullInt32{Int32: *req.PasswordMinLength, Valid: true}
+	}
+	if req.PasswordMinCharacterClasses != nil {
+		arg.PasswordMinCharacterClasses = sql.NullInt32{Int32: *req.PasswordMinCharacterClasses, Valid: true}
+	}
+	tenant, err := server.store.UpdateTenant(ctx, arg)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorResponse(errTenantNotFound))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	rsp := newTenantResponse(tenant)
+	server.audit(ctx, auditActorAdmin, "update", auditEntityTenant, strconv.FormatInt(tenant.ID, 10), rsp)
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// tenantPasswordPolicy returns the password policy of the users of a
+// tenant: the policy of the service, with the settings of the tenant.
+func (server *Server) tenantPasswordPolicy(ctx context.Context, tenantID int64) (util.PasswordPolicy, error) {
+	tenant, err := server.store.GetTenant(ctx, tenantID)
+	if err != nil {
+		return util.PasswordPolicy{}, err
+	}
+	policy := server.passwordPolicy
+	if tenant.PasswordMinLength > 0 {
+		policy.MinLength = int(tenant.PasswordMinLength)
+	}
+	if tenant.PasswordMinCharacterClasses > 0 {
+		policy.MinCharacterClasses = int(tenant.PasswordMinCharacterClasses)
+	}
+	return policy, nil
+}
+
+// signUpTenant returns the tenant a user signs up to, given its slug. It
+// answers with an error when it returns false.
+func (server *Server) signUpTenant(ctx *gin.Context, slug string) (db.Tenant, bool) {
+	tenant, ok := server.slugTenant(ctx, slug)
+	if !ok {
+		return db.Tenant{}, false
+	}
+	if !tenant.AllowSignUp {
+		ctx.JSON(http.StatusForbidden, errorResponse(errSignUpNotAllowed))
+		return db.Tenant{}, false
+	}
+	return tenant, true
+}
+
+// slugTenant returns the tenant of a slug, or the default tenant when it is
+// empty. It answers with an error when it returns false.
+func (server *Server) slugTenant(ctx *gin.Context, slug string) (db.Tenant, bool) {
+	var tenant db.Tenant
+	var err error
+	if slug == "" {
+		tenant, err = server.store.GetTenant(ctx, defaultTenantID)
+	} else {
+		tenant, err = server.store.GetTenantBySlug(ctx, slug)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errTenantNotFound))
+			return db.Tenant{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return db.Tenant{}, false
+	}
+	return tenant, true
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth/mail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenants(t *testing.T) {
+	mailer := &mail.MemorySender{}
+	server, send := newAccountTest(t, mailer)
+	server.passwordPolicy.MinLength = 6
+
+	adminRequest(t, server, http.MethodPost, "/admin/tenants", `{"slug":"North School","name":"North"}`, http.StatusBadRequest)
+	tenant := adminRequest(t, server, http.MethodPost, "/admin/tenants", `{"slug":"north","name":"North","password_min_length":10}`, http.StatusOK)
+	require.Equal(t, float64(2), tenant["id"])
+	require.Equal(t, true, tenant["allow_sign_up"])
+	adminRequest(t, server, http.MethodPost, "/admin/tenants", `{"slug":"north","name":"North again"}`, http.StatusForbidden)
+
+	// Users sign up to a tenant, whose password policy applies.
+	send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com","tenant":"south"}`, http.StatusBadRequest)
+	rsp := send(http.MethodPost, "/users", "", `{"username":"john","password":"secret","email":"john@example.com","tenant":"north"}`, http.StatusBadRequest)
+	require.Contains(t, rsp["error"], "at least 10 characters")
+	user := send(http.MethodPost, "/users", "", `{"username":"john","password":"long-secret","email":"john@example.com","tenant":"north"}`, http.StatusOK)
+	require.Equal(t, float64(2), user["tenant_id"])
+	user = send(http.MethodPost, "/users", "", `{"username":"jane","password":"secret","email":"jane@example.com"}`, http.StatusOK)
+	require.Equal(t, float64(defaultTenantID), user["tenant_id"])
+
+	// The access token carries the tenant of the user, and the scopes of
+	// the tokens of the apps.
+	accessToken := send(http.MethodPost, "/users/login", "", `{"username":"john","password":"long-secret"}`, http.StatusOK)["access_token"].(string)
+	payload, err := server.tokenMaker.VerifyToken(accessToken)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), payload.TenantID)
+	require.Equal(t, []string{"profile", "students:read", "courses:read"}, payload.Scopes)
+
+	// A reset password is checked against the policy of the tenant, and the
+	// link can be used again after a refused password.
+	send(http.MethodPost, "/users/forgot_password", "", `{"email":"john@example.com"}`, http.StatusAccepted)
+	reset := lastToken(t, mailer, "john@example.com")
+	send(http.MethodPost, "/users/reset_password", "", `{"token":"`+reset+`","password":"secret-2"}`, http.StatusBadRequest)
+	send(http.MethodPost, "/users/reset_password", "", `{"token":"`+reset+`","password":"longer-secret"}`, http.StatusOK)
+
+	// API keys grant access to the tenant of their owner.
+	accessToken = send(http.MethodPost, "/users/login", "", `{"username":"john","password":"longer-secret"}`, http.StatusOK)["access_token"].(string)
+	key := send(http.MethodPost, "/api_keys", accessToken, `{"name":"sync","scopes":["students:read"]}`, http.StatusOK)
+	rsp = send(http.MethodPost, "/api_keys/verify", "", `{"key":"`+key["key"].(string)+`"}`, http.StatusOK)
+	require.Equal(t, float64(2), rsp["tenant_id"])
+
+	// Clients only serve the users of their tenant.
+	admin := server.AdminHandler()
+	adminRequest(t, server, http.MethodPost, "/admin/oauth/clients", `{"name":"app","grant_types":["client_credentials"],"scopes":["students:read"],"tenant_id":3}`, http.StatusBadRequest)
+	client := registerOAuthClient(t, admin, `{"name":"app","grant_types":["authorization_code"],"redirect_uris":["https://app.example.com/callback"],"scopes":["students:read"]}`)
+	rsp = send(http.MethodGet, "/oauth/authorize?response_type=code&client_id="+client["client_id"].(string)+"&code_challenge=x&code_challenge_method=S256", accessToken, "", http.StatusBadRequest)
+	require.Equal(t, "the client belongs to another tenant", rsp["error_description"])
+
+	// Signing up can be closed, and the users listed per tenant.
+	adminRequest(t, server, http.MethodPatch, "/admin/tenants/2", `{"allow_sign_up":false}`, http.StatusOK)
+	send(http.MethodPost, "/users", "", `{"username":"jim","password":"long-secret","email":"jim@example.com","tenant":"north"}`, http.StatusForbidden)
+	adminRequest(t, server, http.MethodPatch, "/admin/tenants/9", `{"name":"West"}`, http.StatusNotFound)
+	tenant = adminRequest(t, server, http.MethodGet, "/admin/tenants/2", "", http.StatusOK)
+	require.Equal(t, false, tenant["allow_sign_up"])
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users?tenant_id=2", nil)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	require.Equal(t, "john", users[0]["username"])
+
+	var actions []string
+	for _, record := range server.store.(*stubStore).auditLog {
+		if record.Entity == auditEntityTenant {
+			actions = append(actions, record.Action+" "+record.EntityID)
+		}
+	}
+	require.Equal(t, []string{"create 2", "update 2"}, actions)
+}
@@ -2,34 +2,55 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
 	db "auth/db/sqlc"
-	"auth/token"
-
 	"auth/util"
+	"auth/worker"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
 	"github.com/lib/pq"
 )
 
 type createUserRequest struct {
 	Username string `json:"username" binding:"required,alphanum"`
-	Password string `json:"password" binding:"required,min=4"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	// Tenant is the slug of the school of the user, the default tenant when
+	// it is empty.
+	Tenant string `json:"tenant"`
 }
 
 type userResponse struct {
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
+	Username        string    `json:"username"`
+	FullName        string    `json:"full_name"`
+	Email           string    `json:"email"`
+	IsEmailVerified bool      `json:"is_email_verified"`
+	IsMFAEnabled    bool      `json:"is_mfa_enabled"`
+	IsDisabled      bool      `json:"is_disabled"`
+	StudentID       *int64    `json:"student_id,omitempty"`
+	TenantID        int64     `json:"tenant_id"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 func newUserResponse(user db.User) userResponse {
-	return userResponse{
-		Username:  user.Username,
-		CreatedAt: user.CreatedAt,
+	rsp := userResponse{
+		Username:        user.Username,
+		FullName:        user.FullName,
+		Email:           user.Email,
+		IsEmailVerified: user.IsEmailVerified,
+		IsMFAEnabled:    user.IsMfaEnabled,
+		IsDisabled:      user.IsDisabled,
+		TenantID:        user.TenantID,
+		CreatedAt:       user.CreatedAt,
 	}
+	if user.StudentID.Valid {
+		rsp.StudentID = &user.StudentID.Int64
+	}
+	return rsp
 }
 
 func (server *Server) createUser(ctx *gin.Context) {
@@ -39,18 +60,35 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := util.HashPassword(req.Password)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+	tenant, ok := server.signUpTenant(ctx, req.Tenant)
+	if !ok {
+		return
+	}
+	hashedPassword, ok := server.hashNewPassword(ctx, tenant.ID, req.Password)
+	if !ok {
 		return
 	}
 
-	arg := db.CreateUserParams{
-		Username:       req.Username,
-		HashedPassword: hashedPassword,
+	arg := db.CreateUserTxParams{
+		CreateUserParams: db.CreateUserParams{
+			Username:       req.Username,
+			HashedPassword: hashedPassword,
+			Email:          req.Email,
+			TenantID:       tenant.ID,
+		},
+		// The user is not created when the task can not be enqueued. The
+		// delay leaves time for the transaction to commit.
+		AfterCreate: func(user db.User) error {
+			return server.distributor.DistributeTaskSendVerifyEmail(ctx,
+				&worker.PayloadSendVerifyEmail{Username: user.Username},
+				asynq.MaxRetry(10),
+				asynq.ProcessIn(10*time.Second),
+				asynq.Queue(worker.QueueCritical),
+			)
+		},
 	}
 
-	user, err := server.store.CreateUser(ctx, arg)
+	result, err := server.store.CreateUserTx(ctx, arg)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			switch pqErr.Code.Name() {
@@ -63,7 +101,7 @@ func (server *Server) createUser(ctx *gin.Context) {
 		return
 	}
 
-	rsp := newUserResponse(user)
+	rsp := newUserResponse(result.User)
 	ctx.JSON(http.StatusOK, rsp)
 }
 
@@ -85,10 +123,17 @@ func (server *Server) loginUser(ctx *gin.Context) {
 		return
 	}
 
+	if !server.checkLoginAllowed(ctx, req.Username) {
+		return
+	}
+
 	user, err := server.store.GetUser(ctx, req.Username)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, errorResponse(err))
+			// Check against a dummy hash so that an unknown username takes
+			// as long to answer as a wrong password.
+			util.CheckPassword(req.Password, server.dummyPasswordHash)
+			server.loginFailed(ctx, req.Username, errInvalidCredentials)
 			return
 		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
@@ -97,19 +142,36 @@ func (server *Server) loginUser(ctx *gin.Context) {
 
 	err = util.CheckPassword(req.Password, user.HashedPassword)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		server.loginFailed(ctx, req.Username, errInvalidCredentials)
 		return
 	}
+	server.rehashPassword(ctx, user, req.Password)
 
-	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
-		user.Username,
-		server.config.AccessTokenDuration,
-	)
-	if err != nil {
+	if user.IsMfaEnabled {
+		server.startMFAChallenge(ctx, user)
+		return
+	}
+	server.issueAccessToken(ctx, user)
+}
+
+// issueAccessToken answers a successful login with an access token.
+func (server *Server) issueAccessToken(ctx *gin.Context, user db.User) {
+	if user.IsDisabled {
+		ctx.JSON(http.StatusForbidden, errorResponse(errUserDisabled))
+		return
+	}
+	if err := server.resetLoginFailures(ctx, user.Username); err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		user.Username,
+		user.StudentID.Int64,
+		user.TenantID,
+		server.userScopes,
+		server.config.AccessTokenDuration,
+	)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
@@ -123,41 +185,99 @@ func (server *Server) loginUser(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, rsp)
 }
 
-type validateTokenRequest struct {
-	AccessToken string `json:"access_token" binding:"required"`
-	SecretKey   string `json:"secret_key"  binding:"required"`
+var errInvalidToken = errors.New("token is invalid or expired")
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (server *Server) verifyEmail(ctx *gin.Context) {
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	result, err := server.store.VerifyEmailTx(ctx, db.VerifyEmailTxParams{TokenHash: util.HashToken(req.Token)})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidToken))
+			return
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			ctx.JSON(http.StatusForbidden, errorResponse(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(result.User))
 }
-type validateTokenResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
-func (server *Server) validateToken(ctx *gin.Context) {
-	var req validateTokenRequest
+// forgotPassword mails a password reset link. It answers the same whether
+// or not a user has the email, so that it does not reveal the users.
+func (server *Server) forgotPassword(ctx *gin.Context) {
+	var req forgotPasswordRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
 
-	maker, err := token.NewJWTMaker(req.SecretKey)
+	user, err := server.store.GetUserByEmail(ctx, req.Email)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.Status(http.StatusAccepted)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
-	accessPayload, err := maker.VerifyToken(req.AccessToken)
 
+	err = server.distributor.DistributeTaskSendResetPasswordEmail(ctx,
+		&worker.PayloadSendResetPasswordEmail{Username: user.Username},
+		asynq.MaxRetry(3),
+		asynq.Queue(worker.QueueCritical),
+	)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, errorResponse(err))
+		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
 
-	rsp := validateTokenResponse{
-		ID:        accessPayload.ID,
-		Username:  accessPayload.Username,
-		IssuedAt:  accessPayload.IssuedAt,
-		ExpiredAt: accessPayload.ExpiredAt,
+func (server *Server) resetPassword(ctx *gin.Context) {
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
 	}
-	ctx.JSON(http.StatusOK, rsp)
+
+	// The password policy is the one of the tenant of the user, who is only
+	// known from the token.
+	result, err := server.store.ResetPasswordTx(ctx, db.ResetPasswordTxParams{
+		TokenHash: util.HashToken(req.Token),
+		HashPassword: func(user db.User) (string, error) {
+			return server.newPasswordHash(ctx, user.TenantID, req.Password)
+		},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, errorResponse(errInvalidToken))
+			return
+		}
+		passwordError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserResponse(result.User))
 }
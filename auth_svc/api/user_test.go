@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"auth/mail"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+var tokenPattern = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+// lastToken returns the token of the link in the last email to the address.
+func lastToken(t *testing.T, mailer *mail.MemorySender, to string) string {
+	t.Helper()
+	messages := mailer.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To[0] == to {
+			match := tokenPattern.FindStringSubmatch(messages[i].Body)
+			require.NotNil(t, match, messages[i].Body)
+			return match[1]
+		}
+	}
+	t.Fatalf("no email to %s", to)
+	return ""
+}
+
+func TestEmailFlows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSpecRouter(t)
+	mailer := &mail.MemorySender{}
+	server := newTestServer(t, mailer)
+
+	post := func(path, body string, status int) {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:6061"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		validate(t, router, server.router, req, body, status)
+	}
+
+	post("/users", `{"username":"john","password":"secret","email":"john@example.com"}`, http.StatusOK)
+	require.Len(t, mailer.Messages(), 1)
+	require.Equal(t, "Verify your email", mailer.Messages()[0].Subject)
+
+	verify := lastToken(t, mailer, "john@example.com")
+	post("/users/reset_password", `{"token":"`+verify+`","password":"secret2"}`, http.StatusBadRequest)
+	post("/users/verify_email", `{"token":"`+verify+`"}`, http.StatusOK)
+	post("/users/verify_email", `{"token":"`+verify+`"}`, http.StatusBadRequest)
+	user, err := server.store.GetUser(context.Background(), "john")
+	require.NoError(t, err)
+	require.True(t, user.IsEmailVerified)
+
+	post("/users/forgot_password", `{"email":"jane@example.com"}`, http.StatusAccepted)
+	require.Len(t, mailer.Messages(), 1)
+	post("/users/forgot_password", `{"email":"john@example.com"}`, http.StatusAccepted)
+	require.Len(t, mailer.Messages(), 2)
+	require.Equal(t, "Reset your password", mailer.Messages()[1].Subject)
+
+	reset := lastToken(t, mailer, "john@example.com")
+	post("/users/reset_password", `{"token":"`+reset+`","password":"secret2"}`, http.StatusOK)
+	post("/users/reset_password", `{"token":"`+reset+`","password":"secret3"}`, http.StatusBadRequest)
+	post("/users/login", `{"username":"john","password":"secret"}`, http.StatusUnauthorized)
+	post("/users/login", `{"username":"john","password":"secret2"}`, http.StatusOK)
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "user_tokens";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "password_changed_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "is_email_verified";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "email";
@@ -0,0 +1,19 @@
+ALTER TABLE "users" ADD COLUMN "email" varchar NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "is_email_verified" bool NOT NULL DEFAULT false;
+ALTER TABLE "users" ADD COLUMN "password_changed_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z';
+
+-- Users created before emails were required have none.
+CREATE UNIQUE INDEX ON "users" ("email") WHERE "email" <> '';
+
+CREATE TABLE "user_tokens" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL REFERENCES "users" ("username") ON DELETE CASCADE,
+  "purpose" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "email" varchar NOT NULL,
+  "is_used" bool NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL
+);
+
+CREATE INDEX ON "user_tokens" ("username");
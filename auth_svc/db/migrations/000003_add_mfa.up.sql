@@ -0,0 +1,14 @@
+-- The TOTP secret is encrypted with MFA_ENCRYPTION_KEY. It is set on
+-- enrollment and MFA is enabled once a code is verified.
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "is_mfa_enabled" bool NOT NULL DEFAULT false;
+
+CREATE TABLE "recovery_codes" (
+  "id" bigserial PRIMARY KEY,
+  "username" varchar NOT NULL REFERENCES "users" ("username") ON DELETE CASCADE,
+  "code_hash" varchar NOT NULL,
+  "is_used" bool NOT NULL DEFAULT false,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "recovery_codes" ("username", "code_hash");
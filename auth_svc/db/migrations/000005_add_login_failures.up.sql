@@ -0,0 +1,7 @@
+-- Failed logins by key, "user:<username>" or "ip:<address>".
+CREATE TABLE "login_failures" (
+  "key" varchar PRIMARY KEY,
+  "failures" int NOT NULL,
+  "last_failed_at" timestamptz NOT NULL DEFAULT (now()),
+  "locked_until" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z'
+);
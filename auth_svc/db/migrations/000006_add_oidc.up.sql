@@ -0,0 +1,20 @@
+-- Accounts of an OpenID Connect provider linked to local users.
+CREATE TABLE "user_identities" (
+  "issuer" varchar NOT NULL,
+  "subject" varchar NOT NULL,
+  "username" varchar NOT NULL REFERENCES "users" ("username") ON DELETE CASCADE,
+  "email" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("issuer", "subject")
+);
+
+CREATE INDEX ON "user_identities" ("username");
+
+-- Pending OpenID Connect logins, by the hash of their state parameter.
+CREATE TABLE "oidc_states" (
+  "state_hash" varchar PRIMARY KEY,
+  "code_verifier" varchar NOT NULL,
+  "nonce" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL
+);
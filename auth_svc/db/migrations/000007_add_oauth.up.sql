@@ -0,0 +1,23 @@
+-- OAuth2 clients of third-party apps. Public clients have no secret and
+-- must use PKCE.
+CREATE TABLE "oauth_clients" (
+  "id" varchar PRIMARY KEY,
+  "secret_hash" varchar NOT NULL DEFAULT '',
+  "name" varchar NOT NULL,
+  "redirect_uris" varchar[] NOT NULL DEFAULT '{}',
+  "grant_types" varchar[] NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+-- Authorization codes, by their hash. A code is deleted when it is used.
+CREATE TABLE "oauth_codes" (
+  "code_hash" varchar PRIMARY KEY,
+  "client_id" varchar NOT NULL REFERENCES "oauth_clients" ("id") ON DELETE CASCADE,
+  "username" varchar NOT NULL REFERENCES "users" ("username") ON DELETE CASCADE,
+  "redirect_uri" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "code_challenge" varchar NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE "users" ADD COLUMN "full_name" varchar NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "is_disabled" bool NOT NULL DEFAULT false;
+
+-- The student of students_svc the user is, if any.
+ALTER TABLE "users" ADD COLUMN "student_id" bigint UNIQUE;
@@ -0,0 +1,21 @@
+-- API keys of users and of service accounts, the OAuth2 clients acting on
+-- their own behalf. Only the hash of a key is stored; its prefix tells the
+-- keys apart in listings.
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "prefix" varchar UNIQUE NOT NULL,
+  "key_hash" varchar UNIQUE NOT NULL,
+  "name" varchar NOT NULL,
+  "username" varchar REFERENCES "users" ("username") ON DELETE CASCADE,
+  "client_id" varchar REFERENCES "oauth_clients" ("id") ON DELETE CASCADE,
+  "scopes" varchar[] NOT NULL,
+  "expires_at" timestamptz,
+  "last_used_at" timestamptz,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  CHECK (("username" IS NULL) <> ("client_id" IS NULL))
+);
+
+CREATE INDEX ON "api_keys" ("username");
+
+CREATE INDEX ON "api_keys" ("client_id");
@@ -0,0 +1,7 @@
+ALTER TABLE "oidc_states" DROP COLUMN IF EXISTS "tenant_id";
+
+ALTER TABLE "oauth_clients" DROP COLUMN IF EXISTS "tenant_id";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "tenant_id";
+
+DROP TABLE IF EXISTS "tenants";
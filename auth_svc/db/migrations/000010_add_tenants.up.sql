@@ -0,0 +1,31 @@
+-- Tenants are the schools sharing the deployment.
+CREATE TABLE "tenants" (
+  "id" bigserial PRIMARY KEY,
+  "slug" varchar UNIQUE NOT NULL,
+  "name" varchar NOT NULL,
+  "allow_sign_up" bool NOT NULL DEFAULT true,
+  "password_min_length" int NOT NULL DEFAULT 0,
+  "password_min_character_classes" int NOT NULL DEFAULT 0,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "tenants"."password_min_length" IS '0 uses the configuration of the service';
+
+COMMENT ON COLUMN "tenants"."password_min_character_classes" IS '0 uses the configuration of the service';
+
+-- The existing users and clients belong to the default tenant.
+INSERT INTO "tenants" ("id", "slug", "name") VALUES (1, 'default', 'Default');
+
+SELECT setval(pg_get_serial_sequence('tenants', 'id'), 1);
+
+ALTER TABLE "users" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1 REFERENCES "tenants" ("id");
+
+CREATE INDEX ON "users" ("tenant_id");
+
+ALTER TABLE "oauth_clients" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1 REFERENCES "tenants" ("id");
+
+-- A login with the OpenID Connect provider is for the tenant it was started
+-- for. The logins pending without one are dropped.
+DELETE FROM "oidc_states";
+
+ALTER TABLE "oidc_states" ADD COLUMN "tenant_id" bigint NOT NULL REFERENCES "tenants" ("id");
@@ -0,0 +1,42 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  prefix,
+  key_hash,
+  name,
+  username,
+  client_id,
+  scopes,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1 LIMIT 1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+ORDER BY id;
+
+-- name: ListUserAPIKeys :many
+SELECT * FROM api_keys
+WHERE username = $1
+ORDER BY id;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = now()
+WHERE
+  id = sqlc.arg(id)
+  AND revoked_at IS NULL
+  AND (sqlc.narg(username)::varchar IS NULL OR username = sqlc.narg(username))
+RETURNING *;
+
+-- name: TouchAPIKey :exec
+-- The last use is only recorded once a minute.
+UPDATE api_keys
+SET last_used_at = now()
+WHERE
+  id = $1
+  AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');
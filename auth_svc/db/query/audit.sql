@@ -0,0 +1,7 @@
+-- name: CreateAuditRecord :one
+INSERT INTO audit_log (
+  actor, action, entity, entity_id, before, after, diff
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
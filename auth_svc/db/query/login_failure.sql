@@ -0,0 +1,30 @@
+-- name: GetLoginFailures :many
+SELECT * FROM login_failures
+WHERE key = ANY(@keys::varchar[]);
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (
+  key,
+  failures
+) VALUES (
+  @key, 1
+)
+ON CONFLICT (key) DO UPDATE
+SET
+  failures = CASE
+    WHEN login_failures.last_failed_at < @reset_before THEN 1
+    ELSE login_failures.failures + 1
+  END,
+  last_failed_at = now()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET
+  locked_until = @locked_until
+WHERE
+  key = @key;
+
+-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE key = $1;
@@ -0,0 +1,44 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (
+  id,
+  secret_hash,
+  name,
+  redirect_uris,
+  grant_types,
+  scopes,
+  tenant_id
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1 LIMIT 1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+ORDER BY created_at;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1;
+
+-- name: CreateOAuthCode :one
+INSERT INTO oauth_codes (
+  code_hash,
+  client_id,
+  username,
+  redirect_uri,
+  scopes,
+  code_challenge,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING *;
+
+-- name: UseOAuthCode :one
+DELETE FROM oauth_codes
+WHERE
+  code_hash = $1
+  AND expires_at > now()
+RETURNING *;
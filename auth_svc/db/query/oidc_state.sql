@@ -0,0 +1,17 @@
+-- name: CreateOIDCState :one
+INSERT INTO oidc_states (
+  state_hash,
+  code_verifier,
+  nonce,
+  expires_at,
+  tenant_id
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: UseOIDCState :one
+DELETE FROM oidc_states
+WHERE
+  state_hash = $1
+  AND expires_at > now()
+RETURNING *;
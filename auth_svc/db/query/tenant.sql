@@ -0,0 +1,33 @@
+-- name: CreateTenant :one
+INSERT INTO tenants (
+  slug,
+  name,
+  allow_sign_up,
+  password_min_length,
+  password_min_character_classes
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: GetTenant :one
+SELECT * FROM tenants
+WHERE id = $1 LIMIT 1;
+
+-- name: GetTenantBySlug :one
+SELECT * FROM tenants
+WHERE slug = $1 LIMIT 1;
+
+-- name: ListTenants :many
+SELECT * FROM tenants
+ORDER BY id;
+
+-- name: UpdateTenant :one
+UPDATE tenants
+SET
+  name = COALESCE(sqlc.narg(name), name),
+  allow_sign_up = COALESCE(sqlc.narg(allow_sign_up), allow_sign_up),
+  password_min_length = COALESCE(sqlc.narg(password_min_length), password_min_length),
+  password_min_character_classes = COALESCE(sqlc.narg(password_min_character_classes), password_min_character_classes)
+WHERE
+  id = sqlc.arg(id)
+RETURNING *;
@@ -1,9 +1,11 @@
 -- name: CreateUser :one
 INSERT INTO users (
   username,
-  hashed_password
+  hashed_password,
+  email,
+  tenant_id
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4
 ) RETURNING *;
 
 -- name: GetUser :one
@@ -11,10 +13,40 @@ SELECT * FROM users
 WHERE username = $1 
 LIMIT 1;
 
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = $1
+LIMIT 1;
+
 -- name: UpdateUser :one
 UPDATE users
 SET
-  hashed_password = @hashed_password
+  hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+  password_changed_at = COALESCE(sqlc.narg(password_changed_at), password_changed_at),
+  email = COALESCE(sqlc.narg(email), email),
+  is_email_verified = COALESCE(sqlc.narg(is_email_verified), is_email_verified),
+  totp_secret = COALESCE(sqlc.narg(totp_secret), totp_secret),
+  is_mfa_enabled = COALESCE(sqlc.narg(is_mfa_enabled), is_mfa_enabled),
+  full_name = COALESCE(sqlc.narg(full_name), full_name),
+  is_disabled = COALESCE(sqlc.narg(is_disabled), is_disabled)
 WHERE
   username = @username
 RETURNING *;
+
+
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE sqlc.narg(tenant_id)::bigint IS NULL OR tenant_id = sqlc.narg(tenant_id)
+ORDER BY username
+LIMIT sqlc.arg(row_limit)
+OFFSET sqlc.arg(row_offset);
+
+-- name: SetUserStudentID :one
+UPDATE users
+SET student_id = $2
+WHERE username = $1
+RETURNING *;
+
+-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE username = $1;
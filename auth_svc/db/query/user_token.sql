@@ -0,0 +1,21 @@
+-- name: CreateUserToken :one
+INSERT INTO user_tokens (
+  username,
+  purpose,
+  token_hash,
+  email,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: UseUserToken :one
+UPDATE user_tokens
+SET
+  is_used = true
+WHERE
+  token_hash = @token_hash
+  AND purpose = @purpose
+  AND is_used = false
+  AND expires_at > now()
+RETURNING *;
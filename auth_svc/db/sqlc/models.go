@@ -5,11 +5,125 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ApiKey struct {
+	ID         int64
+	Prefix     string
+	KeyHash    string
+	Name       string
+	Username   sql.NullString
+	ClientID   sql.NullString
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+type AuditLog struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    json.RawMessage
+	After     json.RawMessage
+	Diff      json.RawMessage
+	CreatedAt time.Time
+}
+
+type LoginFailure struct {
+	Key          string
+	Failures     int32
+	LastFailedAt time.Time
+	LockedUntil  time.Time
+}
+
+type OauthClient struct {
+	ID           string
+	SecretHash   string
+	Name         string
+	RedirectUris []string
+	GrantTypes   []string
+	Scopes       []string
+	CreatedAt    time.Time
+	TenantID     int64
+}
+
+type OauthCode struct {
+	CodeHash      string
+	ClientID      string
+	Username      string
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+type OidcState struct {
+	StateHash    string
+	CodeVerifier string
+	Nonce        string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	TenantID     int64
+}
+
+type RecoveryCode struct {
+	ID        int64
+	Username  string
+	CodeHash  string
+	IsUsed    bool
+	CreatedAt time.Time
+}
+
+type Tenant struct {
+	ID          int64
+	Slug        string
+	Name        string
+	AllowSignUp bool
+	// 0 uses the configuration of the service
+	PasswordMinLength int32
+	// 0 uses the configuration of the service
+	PasswordMinCharacterClasses int32
+	CreatedAt                   time.Time
+}
+
 type User struct {
-	Username       string
-	HashedPassword string
-	CreatedAt      time.Time
+	Username          string
+	HashedPassword    string
+	CreatedAt         time.Time
+	Email             string
+	IsEmailVerified   bool
+	PasswordChangedAt time.Time
+	TotpSecret        string
+	IsMfaEnabled      bool
+	FullName          string
+	IsDisabled        bool
+	StudentID         sql.NullInt64
+	TenantID          int64
+}
+
+type UserToken struct {
+	ID        int64
+	Username  string
+	Purpose   string
+	TokenHash string
+	Email     string
+	IsUsed    bool
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	Username  string
+	Email     string
+	CreatedAt time.Time
 }
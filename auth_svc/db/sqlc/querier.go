@@ -6,13 +6,49 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 type Querier interface {
-	
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error)
+	CreateAuditRecord(ctx context.Context, arg CreateAuditRecordParams) (AuditLog, error)
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error)
+	CreateOAuthCode(ctx context.Context, arg CreateOAuthCodeParams) (OauthCode, error)
+	CreateOIDCState(ctx context.Context, arg CreateOIDCStateParams) (OidcState, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error)
+	CreateTenant(ctx context.Context, arg CreateTenantParams) (Tenant, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error)
+	CreateUserToken(ctx context.Context, arg CreateUserTokenParams) (UserToken, error)
+	DeleteLoginFailures(ctx context.Context, key string) error
+	DeleteOAuthClient(ctx context.Context, id string) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, username string) error
+	DeleteUser(ctx context.Context, username string) (int64, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (ApiKey, error)
+	GetLoginFailures(ctx context.Context, keys []string) ([]LoginFailure, error)
+	GetOAuthClient(ctx context.Context, id string) (OauthClient, error)
+	GetTenant(ctx context.Context, id int64) (Tenant, error)
+	GetTenantBySlug(ctx context.Context, slug string) (Tenant, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error)
+	ListAPIKeys(ctx context.Context) ([]ApiKey, error)
+	ListOAuthClients(ctx context.Context) ([]OauthClient, error)
+	ListTenants(ctx context.Context) ([]Tenant, error)
+	ListUserAPIKeys(ctx context.Context, username sql.NullString) ([]ApiKey, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	LockLogin(ctx context.Context, arg LockLoginParams) error
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginFailure, error)
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (ApiKey, error)
+	SetUserStudentID(ctx context.Context, arg SetUserStudentIDParams) (User, error)
+	// The last use is only recorded once a minute.
+	TouchAPIKey(ctx context.Context, id int64) error
+	UpdateTenant(ctx context.Context, arg UpdateTenantParams) (Tenant, error)
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UseOAuthCode(ctx context.Context, codeHash string) (OauthCode, error)
+	UseOIDCState(ctx context.Context, stateHash string) (OidcState, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (RecoveryCode, error)
+	UseUserToken(ctx context.Context, arg UseUserTokenParams) (UserToken, error)
 }
 
 var _ Querier = (*Queries)(nil)
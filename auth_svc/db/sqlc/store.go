@@ -4,12 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+
+	"auth/metrics"
+	"auth/tracing"
 )
 
 // Store defines all functions to execute db queries and transactions
 type Store interface {
 	Querier
 	CreateUserTx(ctx context.Context, arg CreateUserTxParams) (CreateUserTxResult, error)
+	VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error)
+	ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (ResetPasswordTxResult, error)
+	EnableMFATx(ctx context.Context, arg EnableMFATxParams) (EnableMFATxResult, error)
+	CreateOIDCUserTx(ctx context.Context, arg CreateOIDCUserTxParams) (CreateOIDCUserTxResult, error)
 }
 
 // SQLStore provides all functions to execute SQL queries and transactions
@@ -18,11 +25,11 @@ type SQLStore struct {
 	*Queries
 }
 
-// NewStore creates a new store
+// NewStore creates a new store. Its queries are traced and instrumented.
 func NewStore(db *sql.DB) Store {
 	return &SQLStore{
 		db:      db,
-		Queries: New(db),
+		Queries: New(metrics.WrapDB(tracing.WrapDB(db))),
 	}
 }
 
@@ -33,7 +40,7 @@ func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) erro
 		return err
 	}
 
-	q := New(tx)
+	q := New(metrics.WrapDB(tracing.WrapDB(tx)))
 	err = fn(q)
 	if err != nil {
 		if rbErr := tx.Rollback(); rbErr != nil {
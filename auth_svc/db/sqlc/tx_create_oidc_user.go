@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+type CreateOIDCUserTxParams struct {
+	CreateUserParams
+	Issuer          string
+	Subject         string
+	IsEmailVerified bool
+}
+
+type CreateOIDCUserTxResult struct {
+	User     User
+	Identity UserIdentity
+}
+
+// CreateOIDCUserTx provisions a user on the first login with an OpenID
+// Connect provider and links it to the account of the provider.
+func (store *SQLStore) CreateOIDCUserTx(ctx context.Context, arg CreateOIDCUserTxParams) (CreateOIDCUserTxResult, error) {
+	var result CreateOIDCUserTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.CreateUser(ctx, arg.CreateUserParams)
+		if err != nil {
+			return err
+		}
+
+		if arg.IsEmailVerified {
+			result.User, err = q.UpdateUser(ctx, UpdateUserParams{
+				Username:        arg.Username,
+				IsEmailVerified: sql.NullBool{Bool: true, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		result.Identity, err = q.CreateUserIdentity(ctx, CreateUserIdentityParams{
+			Issuer:   arg.Issuer,
+			Subject:  arg.Subject,
+			Username: arg.Username,
+			Email:    arg.Email,
+		})
+		return err
+	})
+
+	return result, err
+}
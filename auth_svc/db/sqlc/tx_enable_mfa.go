@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+type EnableMFATxParams struct {
+	Username string
+	// RecoveryCodeHashes replace the recovery codes of the user.
+	RecoveryCodeHashes []string
+}
+
+type EnableMFATxResult struct {
+	User User
+}
+
+// EnableMFATx enables MFA for the user and replaces its recovery codes.
+func (store *SQLStore) EnableMFATx(ctx context.Context, arg EnableMFATxParams) (EnableMFATxResult, error) {
+	var result EnableMFATxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result.User, err = q.UpdateUser(ctx, UpdateUserParams{
+			Username:     arg.Username,
+			IsMfaEnabled: sql.NullBool{Bool: true, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.DeleteRecoveryCodes(ctx, arg.Username); err != nil {
+			return err
+		}
+		for _, hash := range arg.RecoveryCodeHashes {
+			_, err := q.CreateRecoveryCode(ctx, CreateRecoveryCodeParams{Username: arg.Username, CodeHash: hash})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
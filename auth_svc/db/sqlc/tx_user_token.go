@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Purposes of the user tokens.
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeMFAChallenge  = "mfa_challenge"
+)
+
+type VerifyEmailTxParams struct {
+	TokenHash string
+}
+
+type VerifyEmailTxResult struct {
+	User User
+}
+
+// VerifyEmailTx uses a verify_email token and marks the email it was sent
+// to as the verified email of the user. It returns sql.ErrNoRows when the
+// token is unknown, used or expired.
+func (store *SQLStore) VerifyEmailTx(ctx context.Context, arg VerifyEmailTxParams) (VerifyEmailTxResult, error) {
+	var result VerifyEmailTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		token, err := q.UseUserToken(ctx, UseUserTokenParams{
+			TokenHash: arg.TokenHash,
+			Purpose:   TokenPurposeVerifyEmail,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.UpdateUser(ctx, UpdateUserParams{
+			Username:        token.Username,
+			Email:           sql.NullString{String: token.Email, Valid: true},
+			IsEmailVerified: sql.NullBool{Bool: true, Valid: true},
+		})
+		return err
+	})
+
+	return result, err
+}
+
+type ResetPasswordTxParams struct {
+	TokenHash string
+	// HashPassword returns the hash of the new password of the user. The
+	// token is not used when it fails.
+	HashPassword func(user User) (string, error)
+}
+
+type ResetPasswordTxResult struct {
+	User User
+}
+
+// ResetPasswordTx uses a reset_password token and sets the password of the
+// user. It returns sql.ErrNoRows when the token is unknown, used or expired.
+func (store *SQLStore) ResetPasswordTx(ctx context.Context, arg ResetPasswordTxParams) (ResetPasswordTxResult, error) {
+	var result ResetPasswordTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		token, err := q.UseUserToken(ctx, UseUserTokenParams{
+			TokenHash: arg.TokenHash,
+			Purpose:   TokenPurposeResetPassword,
+		})
+		if err != nil {
+			return err
+		}
+		user, err := q.GetUser(ctx, token.Username)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := arg.HashPassword(user)
+		if err != nil {
+			return err
+		}
+
+		result.User, err = q.UpdateUser(ctx, UpdateUserParams{
+			Username:          token.Username,
+			HashedPassword:    sql.NullString{String: hashedPassword, Valid: true},
+			PasswordChangedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		})
+		return err
+	})
+
+	return result, err
+}
@@ -7,31 +7,67 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   username,
-  hashed_password
+  hashed_password,
+  email,
+  tenant_id
 ) VALUES (
-  $1, $2
-) RETURNING username, hashed_password, created_at
+  $1, $2, $3, $4
+) RETURNING username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id
 `
 
 type CreateUserParams struct {
 	Username       string
 	HashedPassword string
+	Email          string
+	TenantID       int64
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Username, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.Username,
+		arg.HashedPassword,
+		arg.Email,
+		arg.TenantID,
+	)
 	var i User
-	err := row.Scan(&i.Username, &i.HashedPassword, &i.CreatedAt)
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordChangedAt,
+		&i.TotpSecret,
+		&i.IsMfaEnabled,
+		&i.FullName,
+		&i.IsDisabled,
+		&i.StudentID,
+		&i.TenantID,
+	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE username = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, username string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, username)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUser = `-- name: GetUser :one
-SELECT username, hashed_password, created_at FROM users
+SELECT username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id FROM users
 WHERE username = $1 
 LIMIT 1
 `
@@ -39,27 +75,185 @@ LIMIT 1
 func (q *Queries) GetUser(ctx context.Context, username string) (User, error) {
 	row := q.db.QueryRowContext(ctx, getUser, username)
 	var i User
-	err := row.Scan(&i.Username, &i.HashedPassword, &i.CreatedAt)
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordChangedAt,
+		&i.TotpSecret,
+		&i.IsMfaEnabled,
+		&i.FullName,
+		&i.IsDisabled,
+		&i.StudentID,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id FROM users
+WHERE email = $1
+LIMIT 1
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordChangedAt,
+		&i.TotpSecret,
+		&i.IsMfaEnabled,
+		&i.FullName,
+		&i.IsDisabled,
+		&i.StudentID,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id FROM users
+WHERE $1::bigint IS NULL OR tenant_id = $1
+ORDER BY username
+LIMIT $2
+OFFSET $3
+`
+
+type ListUsersParams struct {
+	TenantID  sql.NullInt64
+	RowLimit  int32
+	RowOffset int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.TenantID, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.Username,
+			&i.HashedPassword,
+			&i.CreatedAt,
+			&i.Email,
+			&i.IsEmailVerified,
+			&i.PasswordChangedAt,
+			&i.TotpSecret,
+			&i.IsMfaEnabled,
+			&i.FullName,
+			&i.IsDisabled,
+			&i.StudentID,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserStudentID = `-- name: SetUserStudentID :one
+UPDATE users
+SET student_id = $2
+WHERE username = $1
+RETURNING username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id
+`
+
+type SetUserStudentIDParams struct {
+	Username  string
+	StudentID sql.NullInt64
+}
+
+func (q *Queries) SetUserStudentID(ctx context.Context, arg SetUserStudentIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserStudentID, arg.Username, arg.StudentID)
+	var i User
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordChangedAt,
+		&i.TotpSecret,
+		&i.IsMfaEnabled,
+		&i.FullName,
+		&i.IsDisabled,
+		&i.StudentID,
+		&i.TenantID,
+	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET
-  hashed_password = $1
+  hashed_password = COALESCE($1, hashed_password),
+  password_changed_at = COALESCE($2, password_changed_at),
+  email = COALESCE($3, email),
+  is_email_verified = COALESCE($4, is_email_verified),
+  totp_secret = COALESCE($5, totp_secret),
+  is_mfa_enabled = COALESCE($6, is_mfa_enabled),
+  full_name = COALESCE($7, full_name),
+  is_disabled = COALESCE($8, is_disabled)
 WHERE
-  username = $2
-RETURNING username, hashed_password, created_at
+  username = $9
+RETURNING username, hashed_password, created_at, email, is_email_verified, password_changed_at, totp_secret, is_mfa_enabled, full_name, is_disabled, student_id, tenant_id
 `
 
 type UpdateUserParams struct {
-	HashedPassword string
-	Username       string
+	HashedPassword    sql.NullString
+	PasswordChangedAt sql.NullTime
+	Email             sql.NullString
+	IsEmailVerified   sql.NullBool
+	TotpSecret        sql.NullString
+	IsMfaEnabled      sql.NullBool
+	FullName          sql.NullString
+	IsDisabled        sql.NullBool
+	Username          string
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.HashedPassword, arg.Username)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.HashedPassword,
+		arg.PasswordChangedAt,
+		arg.Email,
+		arg.IsEmailVerified,
+		arg.TotpSecret,
+		arg.IsMfaEnabled,
+		arg.FullName,
+		arg.IsDisabled,
+		arg.Username,
+	)
 	var i User
-	err := row.Scan(&i.Username, &i.HashedPassword, &i.CreatedAt)
+	err := row.Scan(
+		&i.Username,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordChangedAt,
+		&i.TotpSecret,
+		&i.IsMfaEnabled,
+		&i.FullName,
+		&i.IsDisabled,
+		&i.StudentID,
+		&i.TenantID,
+	)
 	return i, err
 }
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// DBCheck pings the database.
+func DBCheck(db *sql.DB) Check {
+	return db.PingContext
+}
+
+// MigrationCheck checks that the database schema is at the latest
+// migration found at migrationURL and not dirty.
+func MigrationCheck(db *sql.DB, migrationURL string) (Check, error) {
+	latest, err := latestMigration(migrationURL)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		var (
+			version int64
+			dirty   bool
+		)
+		err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+		if err != nil {
+			return fmt.Errorf("cannot read migration version: %w", err)
+		}
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if uint(version) != latest {
+			return fmt.Errorf("schema is at migration %d, want %d", version, latest)
+		}
+		return nil
+	}, nil
+}
+
+func latestMigration(migrationURL string) (uint, error) {
+	src, err := source.Open(migrationURL)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// WaitFor runs check until it passes, every interval, for at most timeout.
+// It returns the last error when the check never passed.
+func WaitFor(ctx context.Context, check Check, interval, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, CheckTimeout)
+		err := check(attemptCtx)
+		attemptCancel()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
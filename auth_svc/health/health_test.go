@@ -0,0 +1,34 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readiness(t *testing.T, h *Health) int {
+	rec := httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestReadiness(t *testing.T) {
+	h := New()
+	var failing error
+	h.Add("db", func(context.Context) error { return failing })
+	require.Equal(t, http.StatusOK, readiness(t, h))
+
+	failing = errors.New("connection refused")
+	require.Equal(t, http.StatusServiceUnavailable, readiness(t, h))
+	checks, ready := h.Status(context.Background())
+	require.False(t, ready)
+	require.Equal(t, "connection refused", checks["db"])
+
+	failing = nil
+	h.Drain()
+	require.Equal(t, http.StatusServiceUnavailable, readiness(t, h))
+}
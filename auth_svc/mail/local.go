@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileSender writes every email to a .eml file in a directory instead of
+// sending it. It stands in for SMTP in local development.
+type FileSender struct {
+	dir  string
+	from string
+	seq  uint64
+}
+
+// NewFileSender returns a sender that writes to dir, which is created when
+// it does not exist.
+func NewFileSender(dir, from string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+	return &FileSender{dir: dir, from: from}, nil
+}
+
+func (s *FileSender) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	body, err := format(s.from, msg, now)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", now.UTC().Format("20060102T150405"), atomic.AddUint64(&s.seq, 1))
+	return os.WriteFile(filepath.Join(s.dir, name), body, 0o600)
+}
+
+// MemorySender keeps the emails in memory. It is used in tests.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the emails sent so far.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
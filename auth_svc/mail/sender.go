@@ -0,0 +1,45 @@
+// Package mail sends the emails of auth_svc.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("mail: header contains a line break")
+
+// Message is a plain text email.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format returns msg from the given sender as an RFC 5322 message.
+func format(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, v := range append([]string{from, msg.Subject}, msg.To...) {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	msg := Message{To: []string{"john@example.com"}, Subject: "Привет", Body: "line 1\nline 2"}
+	b, err := format("LMS <lms@example.com>", msg, date)
+	require.NoError(t, err)
+
+	s := string(b)
+	require.Contains(t, s, "From: LMS <lms@example.com>\r\n")
+	require.Contains(t, s, "To: john@example.com\r\n")
+	require.Contains(t, s, "Subject: =?utf-8?q?")
+	require.Contains(t, s, "Date: Wed, 01 Mar 2023 12:00:00 +0000\r\n")
+	require.True(t, strings.HasSuffix(s, "\r\n\r\nline 1\r\nline 2"))
+
+	for _, msg := range []Message{
+		{To: []string{"john@example.com\r\nBcc: eve@example.com"}, Subject: "Hi"},
+		{To: []string{"john@example.com"}, Subject: "Hi\r\nBcc: eve@example.com"},
+	} {
+		_, err := format("lms@example.com", msg, date)
+		require.ErrorIs(t, err, ErrInvalidHeader)
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	sender, err := NewFileSender(dir, "lms@example.com")
+	require.NoError(t, err)
+
+	msg := Message{To: []string{"john@example.com"}, Subject: "Hi", Body: "Hello"}
+	require.NoError(t, sender.Send(context.Background(), msg))
+	require.NoError(t, sender.Send(context.Background(), msg))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	b, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	require.Contains(t, string(b), "To: john@example.com\r\n")
+}
+
+func TestMemorySender(t *testing.T) {
+	var sender MemorySender
+	msg := Message{To: []string{"john@example.com"}, Subject: "Hi", Body: "Hello"}
+	require.NoError(t, sender.Send(context.Background(), msg))
+	require.Equal(t, []Message{msg}, sender.Messages())
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPSender sends emails through an SMTP server, authenticating with
+// PLAIN auth.
+type SMTPSender struct {
+	address  string
+	from     mail.Address
+	password string
+}
+
+// NewSMTPSender returns a sender that sends from the named address through
+// the SMTP server at address (host:port).
+func NewSMTPSender(address, name, from, password string) *SMTPSender {
+	return &SMTPSender{
+		address:  address,
+		from:     mail.Address{Name: name, Address: from},
+		password: password,
+	}
+}
+
+// Send sends msg. net/smtp has no contexts, ctx is not used.
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	body, err := format(s.from.String(), msg, time.Now())
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.address)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+	auth := smtp.PlainAuth("", s.from.Address, s.password, host)
+	if err := smtp.SendMail(s.address, auth, s.from.Address, msg.To, body); err != nil {
+		return fmt.Errorf("cannot send email: %w", err)
+	}
+	return nil
+}
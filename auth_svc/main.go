@@ -1,47 +1,178 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"auth/api"
 	db "auth/db/sqlc"
-
+	"auth/health"
+	"auth/logging"
+	"auth/mail"
+	"auth/token"
+	"auth/tracing"
 	"auth/util"
+	"auth/worker"
 
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hibiken/asynq"
 	_ "github.com/lib/pq"
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	config, err := util.LoadConfig(".")
 	if err != nil {
-		log.Fatal().Err(err).Msg("cannot load config")
+		fmt.Fprintln(os.Stderr, "cannot load config:", err)
+		os.Exit(1)
+	}
+
+	logLevel, err := logging.NewLevel(config.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot parse LOG_LEVEL:", err)
+		os.Exit(1)
 	}
+	logger := logging.New(os.Stderr, logLevel)
 
-	if config.Environment == "development" {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	// The deferred cleanups run before the process exits with exitCode.
+	exitCode := 0
+	defer func() { os.Exit(exitCode) }()
+
+	shutdownTracing, err := tracing.Init(context.Background(), "auth_svc", config.TracingExporter, config.TracingOTLPEndpoint)
+	if err != nil {
+		level.Error(logger).Log("msg", "cannot init tracing", "err", err)
+		exitCode = 1
+		return
 	}
+	defer shutdownTracing(context.Background())
 
 	conn, err := sql.Open(config.DBDriver, config.DBSource)
 	if err != nil {
-		log.Fatal().Err(err).Msg("cannot connect to db")
+		level.Error(logger).Log("msg", "cannot connect to db", "err", err)
+		exitCode = 1
+		return
+	}
+	err = health.WaitFor(context.Background(), health.DBCheck(conn), time.Second, 30*time.Second)
+	if err != nil {
+		level.Error(logger).Log("msg", "cannot reach db", "err", err)
+		exitCode = 1
+		return
 	}
 
+	checks := health.New()
+	checks.Add("db", health.DBCheck(conn))
+	migrationCheck, err := health.MigrationCheck(conn, config.MigrationURL)
+	if err != nil {
+		level.Error(logger).Log("msg", "cannot read migrations", "err", err)
+		exitCode = 1
+		return
+	}
+	checks.Add("migrations", migrationCheck)
+
 	store := db.NewStore(conn)
 
-	runGinServer(config, store)
-}
+	mailer, err := newMailer(config)
+	if err != nil {
+		level.Error(logger).Log("msg", "cannot create mailer", "err", err)
+		exitCode = 1
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func runGinServer(config util.Config, store db.Store) {
-	server, err := api.NewServer(config, store)
+	redisOpt := asynq.RedisClientOpt{Addr: config.RedisAddress}
+	distributor := worker.NewRedisTaskDistributor(redisOpt)
+	defer distributor.Close()
+	processor := worker.NewRedisTaskProcessor(redisOpt, store, mailer, config, logger)
+	if err := processor.Start(); err != nil {
+		level.Error(logger).Log("msg", "cannot start task processor", "err", err)
+		exitCode = 1
+		return
+	}
+	defer processor.Shutdown()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: config.RedisAddress})
+	defer redisClient.Close()
+	denylist := token.NewRedisDenylist(redisClient)
+
+	server, err := api.NewServer(config, store, distributor, denylist, checks, logger)
 	if err != nil {
-		log.Fatal().Err(err).Msg("cannot create server")
+		level.Error(logger).Log("msg", "cannot create server", "err", err)
+		exitCode = 1
+		return
+	}
+
+	// A failure of either server stops the other one, and the process.
+	serverCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	adminErrc := make(chan error, 1)
+	go func() {
+		err := runAdminServer(serverCtx, config.AdminServerAddress, server.AdminHandler(), logLevel, logger)
+		if err != nil {
+			cancel()
+		}
+		adminErrc <- err
+	}()
+	if err := runGinServer(serverCtx, config, server, logger); err != nil {
+		level.Error(logger).Log("msg", "server failed", "err", err)
+		exitCode = 1
+	}
+	cancel()
+	if err := <-adminErrc; err != nil {
+		level.Error(logger).Log("msg", "admin server failed", "err", err)
+		exitCode = 1
 	}
+}
 
-	err = server.Start(config.HTTPServerAddress)
+func runGinServer(ctx context.Context, config util.Config, server *api.Server, logger log.Logger) error {
+	level.Info(logger).Log("msg", "start HTTP server", "addr", config.HTTPServerAddress)
+	err := server.Start(ctx, config.HTTPServerAddress)
 	if err != nil {
-		log.Fatal().Err(err).Msg("cannot start server")
+		return fmt.Errorf("cannot start server: %w", err)
+	}
+	level.Info(logger).Log("msg", "server stopped")
+	return nil
+}
+
+// newMailer returns the SMTP sender, or writes the emails to the outbox
+// directory when no SMTP server is configured.
+func newMailer(config util.Config) (mail.Sender, error) {
+	if config.EmailSMTPAddress == "" {
+		return mail.NewFileSender(config.EmailOutboxDir, config.EmailSenderAddress)
+	}
+	return mail.NewSMTPSender(config.EmailSMTPAddress, config.EmailSenderName, config.EmailSenderAddress, config.EmailSenderPassword), nil
+}
+
+// runAdminServer serves the admin endpoints, which are not exposed with the
+// public API, until ctx is done, and then drains them like the API server.
+func runAdminServer(ctx context.Context, address string, admin http.Handler, logLevel *logging.Level, logger log.Logger) error {
+	if address == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/admin/log-level", logging.LevelHandler(logLevel, logger))
+	mux.Handle("/admin/", admin)
+	srv := &http.Server{Addr: address, Handler: mux}
+	errc := make(chan error, 1)
+	level.Info(logger).Log("msg", "start admin server", "addr", address)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("cannot start admin server: %w", err)
+	case <-ctx.Done():
 	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), api.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
@@ -0,0 +1,103 @@
+// Package metrics exports Prometheus metrics of the HTTP server, the
+// database queries and the background tasks.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"auth/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "request_count",
+		Help:      "Number of requests received.",
+	}, []string{"method", "error", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "request_duration_seconds",
+		Help:      "Request duration in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "error", "code"})
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query duration in seconds.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query", "error"})
+)
+
+// GinMiddleware records every request. The method label is the HTTP method
+// and route, e.g. "POST /users/login".
+func GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		begin := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		code := ctx.Writer.Status()
+		lvs := []string{ctx.Request.Method + " " + route, strconv.FormatBool(code >= 400), strconv.Itoa(code)}
+		requestCount.WithLabelValues(lvs...).Inc()
+		requestDuration.WithLabelValues(lvs...).Observe(time.Since(begin).Seconds())
+	}
+}
+
+// WrapDB records the duration of the queries sent through db, labelled by
+// the sqlc query name and whether the query failed.
+func WrapDB(db tracing.DBTX) tracing.DBTX {
+	return &instrumentedDB{db: db}
+}
+
+type instrumentedDB struct {
+	db tracing.DBTX
+}
+
+func observe(query string, begin time.Time, err error) {
+	failed := err != nil && err != sql.ErrNoRows
+	dbDuration.WithLabelValues(tracing.QueryName(query), strconv.FormatBool(failed)).Observe(time.Since(begin).Seconds())
+}
+
+func (d *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	defer func(begin time.Time) {
+		observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.ExecContext(ctx, query, args...)
+}
+
+func (d *instrumentedDB) PrepareContext(ctx context.Context, query string) (stmt *sql.Stmt, err error) {
+	defer func(begin time.Time) {
+		observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.PrepareContext(ctx, query)
+}
+
+func (d *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	defer func(begin time.Time) {
+		observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	begin := time.Now()
+	row := d.db.QueryRowContext(ctx, query, args...)
+	observe(query, begin, row.Err())
+	return row
+}
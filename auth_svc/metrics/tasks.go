@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of a task run.
+const (
+	TaskSucceeded = "success"
+	TaskRetried   = "retry"
+	// TaskArchived tasks failed their last attempt and are kept in the
+	// archive of asynq, its dead letter queue.
+	TaskArchived = "archived"
+)
+
+var (
+	taskCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "task_count",
+		Help:      "Number of background task runs by result.",
+	}, []string{"task", "result"})
+	taskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "task_duration_seconds",
+		Help:      "Background task run duration in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"task"})
+	tasksEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "auth_service",
+		Name:      "task_enqueued_count",
+		Help:      "Number of background tasks enqueued.",
+	}, []string{"task", "error"})
+)
+
+// ObserveTaskRun records how long a run of a task took.
+func ObserveTaskRun(task string, took time.Duration) {
+	taskDuration.WithLabelValues(task).Observe(took.Seconds())
+}
+
+// CountTaskResult records the result of a run of a task.
+func CountTaskResult(task, result string) {
+	taskCount.WithLabelValues(task, result).Inc()
+}
+
+// ObserveTaskEnqueued records that a task was enqueued, or failed to be.
+func ObserveTaskEnqueued(task string, failed bool) {
+	tasksEnqueued.WithLabelValues(task, strconv.FormatBool(failed)).Inc()
+}
@@ -0,0 +1,111 @@
+package token
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist keeps the tokens revoked before they expire. Entries are kept
+// until the revoked tokens would have expired anyway.
+type Denylist interface {
+	// Revoke revokes the token with the given ID, which expires at expiredAt
+	Revoke(ctx context.Context, id uuid.UUID, expiredAt time.Time) error
+
+	// RevokeUser revokes all the tokens of the user issued until now. The
+	// entry is kept for ttl, the longest duration of a token.
+	RevokeUser(ctx context.Context, username string, ttl time.Duration) error
+
+	// IsRevoked reports whether the token of the payload was revoked
+	IsRevoked(ctx context.Context, payload *Payload) (bool, error)
+}
+
+// The keys are shared with the services that verify the tokens.
+func revokedTokenKey(id string) string {
+	return "auth:revoked_token:" + id
+}
+
+func revokedUserKey(username string) string {
+	return "auth:revoked_user:" + username
+}
+
+// RedisDenylist stores the denylist in Redis, so that it is shared between
+// instances and services.
+type RedisDenylist struct {
+	client *redis.Client
+}
+
+// NewRedisDenylist creates a new RedisDenylist
+func NewRedisDenylist(client *redis.Client) *RedisDenylist {
+	return &RedisDenylist{client}
+}
+
+func (d *RedisDenylist) Revoke(ctx context.Context, id uuid.UUID, expiredAt time.Time) error {
+	ttl := time.Until(expiredAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.client.Set(ctx, revokedTokenKey(id.String()), 1, ttl).Err()
+}
+
+func (d *RedisDenylist) RevokeUser(ctx context.Context, username string, ttl time.Duration) error {
+	return d.client.Set(ctx, revokedUserKey(username), time.Now().UnixNano(), ttl).Err()
+}
+
+func (d *RedisDenylist) IsRevoked(ctx context.Context, payload *Payload) (bool, error) {
+	values, err := d.client.MGet(ctx, revokedTokenKey(payload.ID.String()), revokedUserKey(payload.Username)).Result()
+	if err != nil {
+		return false, err
+	}
+	if values[0] != nil {
+		return true, nil
+	}
+	if values[1] == nil {
+		return false, nil
+	}
+	revokedAt, err := strconv.ParseInt(values[1].(string), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return !payload.IssuedAt.After(time.Unix(0, revokedAt)), nil
+}
+
+// MemoryDenylist keeps the denylist in memory, for tests.
+type MemoryDenylist struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]time.Time
+	users  map[string]time.Time
+}
+
+// NewMemoryDenylist creates a new MemoryDenylist
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{tokens: map[uuid.UUID]time.Time{}, users: map[string]time.Time{}}
+}
+
+func (d *MemoryDenylist) Revoke(_ context.Context, id uuid.UUID, expiredAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokens[id] = expiredAt
+	return nil
+}
+
+func (d *MemoryDenylist) RevokeUser(_ context.Context, username string, _ time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users[username] = time.Now()
+	return nil
+}
+
+func (d *MemoryDenylist) IsRevoked(_ context.Context, payload *Payload) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.tokens[payload.ID]; ok {
+		return true, nil
+	}
+	revokedAt, ok := d.users[payload.Username]
+	return ok && !payload.IssuedAt.After(revokedAt), nil
+}
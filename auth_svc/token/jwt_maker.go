@@ -24,12 +24,31 @@ func NewJWTMaker(secretKey string) (Maker, error) {
 }
 
 // CreateToken creates a new token for a specific username and duration
-func (maker *JWTMaker) CreateToken(username string, duration time.Duration) (string, *Payload, error) {
+func (maker *JWTMaker) CreateToken(username string, studentID int64, tenantID int64, scopes []string, duration time.Duration) (string, *Payload, error) {
 	payload, err := NewPayload(username, duration)
 	if err != nil {
 		return "", payload, err
 	}
+	payload.StudentID = studentID
+	payload.TenantID = tenantID
+	payload.Scopes = scopes
+	return maker.sign(payload)
+}
+
+// CreateScopedToken creates a new token for an OAuth2 client
+func (maker *JWTMaker) CreateScopedToken(username string, studentID int64, tenantID int64, clientID string, scopes []string, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	payload.StudentID = studentID
+	payload.TenantID = tenantID
+	payload.ClientID = clientID
+	payload.Scopes = scopes
+	return maker.sign(payload)
+}
 
+func (maker *JWTMaker) sign(payload *Payload) (string, *Payload, error) {
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
 	token, err := jwtToken.SignedString([]byte(maker.secretKey))
 	return token, payload, err
@@ -6,8 +6,14 @@ import (
 
 // Maker is an interface for managing tokens
 type Maker interface {
-	// CreateToken creates a new token for a specific username and duration
-	CreateToken(username string, duration time.Duration) (string, *Payload, error)
+	// CreateToken creates a new token for a specific username and duration,
+	// carrying the student the user is unless studentID is 0, the tenant of
+	// the user and the scopes the token grants
+	CreateToken(username string, studentID int64, tenantID int64, scopes []string, duration time.Duration) (string, *Payload, error)
+
+	// CreateScopedToken creates a new token for an OAuth2 client, on behalf
+	// of a user unless username is empty, that grants the scopes only
+	CreateScopedToken(username string, studentID int64, tenantID int64, clientID string, scopes []string, duration time.Duration) (string, *Payload, error)
 
 	// VerifyToken checks if the token is valid or not
 	VerifyToken(token string) (*Payload, error)
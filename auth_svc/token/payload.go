@@ -7,16 +7,26 @@ import (
 	"github.com/google/uuid"
 )
 
-// Different types of error returned by the VerifyToken function
+// Different types of error returned by the VerifyToken function and the
+// denylist
 var (
 	ErrInvalidToken = errors.New("token is invalid")
 	ErrExpiredToken = errors.New("token has expired")
+	ErrRevokedToken = errors.New("token has been revoked")
 )
 
 // Payload contains the payload data of the token
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	// StudentID is the student of students_svc the user is, if any.
+	StudentID int64 `json:"student_id,omitempty"`
+	// TenantID is the school the user or the client belongs to.
+	TenantID int64 `json:"tenant_id,omitempty"`
+	// ClientID is the OAuth2 client the token was issued to, empty for the
+	// tokens of our own apps, and Scopes what the token was granted.
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
@@ -37,6 +47,17 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 	return payload, nil
 }
 
+// HasScope reports whether the token grants scope. Every token grants its
+// scopes only; the tokens of our own apps carry USER_TOKEN_SCOPES.
+func (payload *Payload) HasScope(scope string) bool {
+	for _, s := range payload.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // Valid checks if the token payload is valid or not
 func (payload *Payload) Valid() error {
 	if time.Now().After(payload.ExpiredAt) {
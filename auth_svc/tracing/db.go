@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DBTX is the interface of the database handle used by the sqlc queries.
+type DBTX interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// WrapDB traces the queries sent through db. Spans are named after the sqlc
+// query, e.g. "db.GetUser".
+func WrapDB(db DBTX) DBTX {
+	return &tracedDB{db: db}
+}
+
+type tracedDB struct {
+	db DBTX
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	res, err := t.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return res, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	stmt, err := t.db.PrepareContext(ctx, query)
+	endQuery(span, err)
+	return stmt, err
+}
+
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	row := t.db.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, "db."+QueryName(query),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(query),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// QueryName returns the name of a sqlc query, which starts with
+// "-- name: <Name> :<command>".
+func QueryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return "query"
+	}
+	fields := strings.Fields(strings.TrimPrefix(query, prefix))
+	if len(fields) == 0 {
+		return "query"
+	}
+	return fields[0]
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "12345678901234567890123456789012"
+
+func TestEncrypt(t *testing.T) {
+	ciphertext, err := Encrypt(testKey, "JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	require.NotContains(t, ciphertext, "JBSWY3DPEHPK3PXP")
+
+	plaintext, err := Decrypt(testKey, ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", plaintext)
+
+	other, err := Encrypt(testKey, "JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, other)
+
+	_, err = Decrypt("abcdefghijklmnopqrstuvwxyz123456", ciphertext)
+	require.ErrorIs(t, err, ErrInvalidCiphertext)
+	_, err = Decrypt(testKey, "not base64!")
+	require.ErrorIs(t, err, ErrInvalidCiphertext)
+	_, err = Encrypt("short", "secret")
+	require.Error(t, err)
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code, err := RandomRecoveryCode()
+	require.NoError(t, err)
+	require.Regexp(t, `^[a-z2-9]{6}-[a-z2-9]{6}$`, code)
+
+	hash := HashRecoveryCode("john", code)
+	require.Equal(t, hash, HashRecoveryCode("john", " "+code[:6]+code[7:]+" "))
+	require.NotEqual(t, hash, HashRecoveryCode("jane", code))
+}
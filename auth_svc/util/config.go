@@ -9,19 +9,46 @@ import (
 // Config stores all configuration of the application.
 // The values are read by viper from a config file or environment variable.
 type Config struct {
-	Environment          string        `mapstructure:"ENVIRONMENT"`
-	DBDriver             string        `mapstructure:"DB_DRIVER"`
-	DBSource             string        `mapstructure:"DB_SOURCE"`
-	MigrationURL         string        `mapstructure:"MIGRATION_URL"`
-	RedisAddress         string        `mapstructure:"REDIS_ADDRESS"`
-	HTTPServerAddress    string        `mapstructure:"HTTP_SERVER_ADDRESS"`
-	GRPCServerAddress    string        `mapstructure:"GRPC_SERVER_ADDRESS"`
-	SecretKey            string        `mapstructure:"SECRET_KEY"`
-	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
-	EmailSenderName      string        `mapstructure:"EMAIL_SENDER_NAME"`
-	EmailSenderAddress   string        `mapstructure:"EMAIL_SENDER_ADDRESS"`
-	EmailSenderPassword  string        `mapstructure:"EMAIL_SENDER_PASSWORD"`
+	Environment           string        `mapstructure:"ENVIRONMENT"`
+	DBDriver              string        `mapstructure:"DB_DRIVER"`
+	DBSource              string        `mapstructure:"DB_SOURCE"`
+	MigrationURL          string        `mapstructure:"MIGRATION_URL"`
+	RedisAddress          string        `mapstructure:"REDIS_ADDRESS"`
+	HTTPServerAddress     string        `mapstructure:"HTTP_SERVER_ADDRESS"`
+	GRPCServerAddress     string        `mapstructure:"GRPC_SERVER_ADDRESS"`
+	SecretKey             string        `mapstructure:"SECRET_KEY"`
+	AccessTokenDuration   time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	UserTokenScopes       string        `mapstructure:"USER_TOKEN_SCOPES"`
+	RefreshTokenDuration  time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	EmailSenderName       string        `mapstructure:"EMAIL_SENDER_NAME"`
+	EmailSenderAddress    string        `mapstructure:"EMAIL_SENDER_ADDRESS"`
+	EmailSenderPassword   string        `mapstructure:"EMAIL_SENDER_PASSWORD"`
+	EmailSMTPAddress      string        `mapstructure:"EMAIL_SMTP_ADDRESS"`
+	EmailOutboxDir        string        `mapstructure:"EMAIL_OUTBOX_DIR"`
+	EmailLinkBaseURL      string        `mapstructure:"EMAIL_LINK_BASE_URL"`
+	VerifyEmailDuration   time.Duration `mapstructure:"VERIFY_EMAIL_DURATION"`
+	ResetPasswordDuration time.Duration `mapstructure:"RESET_PASSWORD_DURATION"`
+	MFAEncryptionKey      string        `mapstructure:"MFA_ENCRYPTION_KEY"`
+	MFAChallengeDuration  time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	LoginMaxFailures      int32         `mapstructure:"LOGIN_MAX_FAILURES"`
+	LoginIPMaxFailures    int32         `mapstructure:"LOGIN_IP_MAX_FAILURES"`
+	LoginBaseDelay        time.Duration `mapstructure:"LOGIN_BASE_DELAY"`
+	LoginLockoutDuration  time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LoginFailureWindow    time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+	TrustedProxies        string        `mapstructure:"TRUSTED_PROXIES"`
+	OIDCIssuerURL         string        `mapstructure:"OIDC_ISSUER_URL"`
+	OIDCClientID          string        `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret      string        `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL       string        `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCStateDuration     time.Duration `mapstructure:"OIDC_STATE_DURATION"`
+	OAuthCodeDuration     time.Duration `mapstructure:"OAUTH_CODE_DURATION"`
+	PasswordMinLength     int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMinClasses    int           `mapstructure:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	PasswordBreachedList  string        `mapstructure:"PASSWORD_BREACHED_LIST"`
+	TracingExporter       string        `mapstructure:"TRACING_EXPORTER"`
+	TracingOTLPEndpoint   string        `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	AdminServerAddress    string        `mapstructure:"ADMIN_SERVER_ADDRESS"`
+	LogLevel              string        `mapstructure:"LOG_LEVEL"`
 }
 
 // LoadConfig reads configuration from file or environment variables.
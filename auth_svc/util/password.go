@@ -1,21 +1,109 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the bcrypt hash of the password
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Argon2Params are the cost parameters of an Argon2id hash. They are stored
+// in the hash string, so they can be raised without breaking the hashes
+// computed before.
+type Argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for Argon2id.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+const argon2Prefix = "$argon2id$"
+
+// HashPassword returns the Argon2id hash of the password in the PHC string
+// format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	p := DefaultArgon2Params
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	return string(hashedPassword), nil
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-// CheckPassword checks if the provided password is correct or not
+// CheckPassword checks if the provided password is correct or not. It
+// accepts Argon2id hashes and the bcrypt hashes of older accounts.
 func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) {
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	}
+
+	p, salt, key, err := decodeArgon2Hash(hashedPassword)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// NeedsRehash reports whether the hash was not computed by HashPassword
+// with the current parameters, and should be replaced the next time the
+// password is known.
+func NeedsRehash(hashedPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) {
+		return true
+	}
+	p, _, _, err := decodeArgon2Hash(hashedPassword)
+	return err != nil || p != DefaultArgon2Params
+}
+
+func decodeArgon2Hash(hashedPassword string) (p Argon2Params, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
 }
@@ -0,0 +1,155 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+)
+
+// ErrWeakPassword is wrapped by the errors of passwords refused by the
+// policy.
+var ErrWeakPassword = errors.New("weak password")
+
+// PasswordPolicy is checked by the new passwords of users. The zero value
+// accepts any password.
+type PasswordPolicy struct {
+	MinLength int
+	// MinCharacterClasses is the number of classes among lowercase letters,
+	// uppercase letters, digits and symbols the password must mix.
+	MinCharacterClasses int
+	// Breached is nil when breached passwords are not checked.
+	Breached *BreachedPasswords
+}
+
+// Validate returns an error describing why the password is refused.
+func (policy PasswordPolicy) Validate(password string) error {
+	if n := len([]rune(password)); n < policy.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters long", ErrWeakPassword, policy.MinLength)
+	}
+	if n := characterClasses(password); n < policy.MinCharacterClasses {
+		return fmt.Errorf("%w: must mix at least %d of lowercase letters, uppercase letters, digits and symbols", ErrWeakPassword, policy.MinCharacterClasses)
+	}
+	if policy.Breached != nil {
+		breached, err := policy.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return fmt.Errorf("%w: it has appeared in a data breach", ErrWeakPassword)
+		}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// BreachedPasswords looks passwords up in a local copy of the Pwned
+// Passwords list: the k-anonymity ranges concatenated into a single file of
+// "SHA1:COUNT" lines ordered by hash, as written by haveibeenpwned-downloader.
+// The file is searched in place, so it is never loaded in memory and the
+// passwords never leave the server.
+type BreachedPasswords struct {
+	path string
+}
+
+// NewBreachedPasswords checks that the list file can be read.
+func NewBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open breached password list: %w", err)
+	}
+	f.Close()
+	return &BreachedPasswords{path: path}, nil
+}
+
+// maxBreachedLineLength bounds the lines of the list, a 40 characters hash
+// followed by a count.
+const maxBreachedLineLength = 64
+
+// Contains reports whether the password is in the list.
+func (b *BreachedPasswords) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot open breached password list: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	// Binary search the offsets for the first line whose hash is not lower
+	// than the target. The line at an offset is the first one starting at
+	// or after it.
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		hash, err := hashAt(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if hash != nil && bytes.Compare(hash, target) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	hash, err := hashAt(f, lo)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash, target), nil
+}
+
+// hashAt returns the uppercase hash of the first line of f starting at or
+// after off, or nil at the end of the file.
+func hashAt(f *os.File, off int64) ([]byte, error) {
+	start := off
+	if off > 0 {
+		// The line starts after the newline preceding or at off.
+		start = off - 1
+	}
+	buf := make([]byte, 2*maxBreachedLineLength)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+	if off > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return nil, nil
+		}
+		buf = buf[i+1:]
+	}
+	if i := bytes.IndexAny(buf, ":\r\n"); i >= 0 {
+		buf = buf[:i]
+	}
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return bytes.ToUpper(buf), nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	hashedPassword, err := HashPassword("secret")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hashedPassword, "$argon2id$v=19$m=19456,t=2,p=1$"), hashedPassword)
+	require.NoError(t, CheckPassword("secret", hashedPassword))
+	require.ErrorIs(t, CheckPassword("wrong", hashedPassword), bcrypt.ErrMismatchedHashAndPassword)
+	require.False(t, NeedsRehash(hashedPassword))
+
+	other, err := HashPassword("secret")
+	require.NoError(t, err)
+	require.NotEqual(t, hashedPassword, other)
+
+	// The parameters of a hash are read from it, and hashes with other
+	// parameters than the current ones are rehashed.
+	params := DefaultArgon2Params
+	DefaultArgon2Params.Memory, DefaultArgon2Params.Iterations = 1024, 1
+	weaker, err := HashPassword("secret")
+	DefaultArgon2Params = params
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(weaker, "$argon2id$v=19$m=1024,t=1,p=1$"), weaker)
+	require.NoError(t, CheckPassword("secret", weaker))
+	require.True(t, NeedsRehash(weaker))
+	require.ErrorIs(t, CheckPassword("secret", "$argon2id$v=19$m=1024$salt$key"), ErrInvalidHash)
+
+	// The bcrypt hashes of older accounts are still accepted.
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, CheckPassword("secret", string(bcryptHash)))
+	require.Error(t, CheckPassword("wrong", string(bcryptHash)))
+	require.True(t, NeedsRehash(string(bcryptHash)))
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	require.NoError(t, PasswordPolicy{}.Validate("a"))
+
+	policy := PasswordPolicy{MinLength: 8, MinCharacterClasses: 3}
+	for password, valid := range map[string]bool{
+		"Sh0rt!":       false,
+		"alllowercase": false,
+		"lower1234567": false,
+		"Lower1234567": true,
+		"lower-case-1": true,
+		"ÉCOLE-école":  true,
+	} {
+		err := policy.Validate(password)
+		if valid {
+			require.NoError(t, err, password)
+		} else {
+			require.ErrorIs(t, err, ErrWeakPassword, password)
+		}
+	}
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	// SHA-1 of "password" and "P@ssw0rd", between unrelated hashes, in the
+	// order of the list.
+	list := strings.Join([]string{
+		"0000000A0E3B9F25FF41DE4B5AC238C2D545C7A8:15",
+		"21BD12DC183F740EE76F27B78EB39C8AD972A757:91234",
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:10434004",
+		"9E0A8C5D8C7C54FD1A4D4E5F4B3A2F1E0D9C8B7A:2",
+		"FFFFFFFF0E3B9F25FF41DE4B5AC238C2D545C7A8:1",
+	}, "\r\n") + "\r\n"
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+
+	breached, err := NewBreachedPasswords(path)
+	require.NoError(t, err)
+	for password, want := range map[string]bool{
+		"password":              true,
+		"P@ssw0rd":              true,
+		"correct horse battery": false,
+		"":                      false,
+	} {
+		got, err := breached.Contains(password)
+		require.NoError(t, err)
+		require.Equal(t, want, got, password)
+	}
+
+	policy := PasswordPolicy{Breached: breached}
+	require.ErrorIs(t, policy.Validate("P@ssw0rd"), ErrWeakPassword)
+	require.NoError(t, policy.Validate("correct horse battery"))
+
+	_, err = NewBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
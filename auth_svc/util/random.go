@@ -0,0 +1,84 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// recoveryCodeAlphabet leaves out the letters that are easily confused
+// with digits.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// RandomToken returns a random URL-safe token with 256 bits of entropy.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hash of the token, which is stored in its
+// place.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix starts every API key, so that leaked keys are easy to find.
+const APIKeyPrefix = "lms_"
+
+// RandomAPIKey returns a random API key such as "lms_1f0c9a2e4b7d_<token>" and
+// its public prefix "lms_1f0c9a2e4b7d", which tells the keys apart without
+// revealing them.
+func RandomAPIKey() (key string, prefix string, err error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret, err := RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(b)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// RandomRecoveryCode returns a random MFA recovery code such as
+// "k7dq2x-mx9pah", with about 59 bits of entropy.
+func RandomRecoveryCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := make([]byte, 0, 13)
+	for i, c := range b {
+		if i == 6 {
+			code = append(code, '-')
+		}
+		// The modulo bias of 256 % 31 is negligible for a one-time code.
+		code = append(code, recoveryCodeAlphabet[int(c)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// NormalizeRecoveryCode returns code as it is hashed, without case, spaces
+// and dashes.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
+
+// HashRecoveryCode returns the hash of a recovery code of the user, which is
+// stored in its place.
+func HashRecoveryCode(username, code string) string {
+	return HashToken(username + ":" + NormalizeRecoveryCode(code))
+}
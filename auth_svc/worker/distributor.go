@@ -0,0 +1,63 @@
+// Package worker runs the background tasks of auth_svc, such as sending
+// emails, on an asynq queue in Redis.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"auth/metrics"
+
+	"github.com/hibiken/asynq"
+)
+
+// Queues in the order of their priority.
+const (
+	QueueCritical = "critical"
+	QueueDefault  = "default"
+)
+
+// Defaults of the tasks, which can be overridden with the options given to
+// the distributor.
+const (
+	defaultMaxRetry = 10
+	defaultTimeout  = time.Minute
+)
+
+// TaskDistributor enqueues tasks for the processor.
+type TaskDistributor interface {
+	DistributeTaskSendVerifyEmail(ctx context.Context, payload *PayloadSendVerifyEmail, opts ...asynq.Option) error
+	DistributeTaskSendResetPasswordEmail(ctx context.Context, payload *PayloadSendResetPasswordEmail, opts ...asynq.Option) error
+}
+
+// RedisTaskDistributor enqueues tasks in Redis.
+type RedisTaskDistributor struct {
+	client *asynq.Client
+}
+
+// NewRedisTaskDistributor returns a distributor to the Redis server of
+// redisOpt.
+func NewRedisTaskDistributor(redisOpt asynq.RedisClientOpt) *RedisTaskDistributor {
+	return &RedisTaskDistributor{client: asynq.NewClient(redisOpt)}
+}
+
+// Close closes the connection to Redis.
+func (d *RedisTaskDistributor) Close() error {
+	return d.client.Close()
+}
+
+func (d *RedisTaskDistributor) enqueue(ctx context.Context, taskType string, payload interface{}, opts []asynq.Option) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task payload: %w", err)
+	}
+	opts = append([]asynq.Option{asynq.MaxRetry(defaultMaxRetry), asynq.Timeout(defaultTimeout)}, opts...)
+	_, err = d.client.EnqueueContext(ctx, asynq.NewTask(taskType, data, opts...))
+	metrics.ObserveTaskEnqueued(taskType, err != nil)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/mail"
+	"auth/metrics"
+	"auth/util"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/hibiken/asynq"
+)
+
+// TaskProcessor runs the enqueued tasks.
+type TaskProcessor interface {
+	Start() error
+	Shutdown()
+	ProcessTaskSendVerifyEmail(ctx context.Context, task *asynq.Task) error
+	ProcessTaskSendResetPasswordEmail(ctx context.Context, task *asynq.Task) error
+}
+
+// RedisTaskProcessor runs the tasks enqueued in Redis. Failed tasks are
+// retried with exponential backoff; after their last retry they are
+// archived, where they can be inspected and run again with the asynq CLI.
+type RedisTaskProcessor struct {
+	server *asynq.Server
+	store  db.Store
+	mailer mail.Sender
+	config util.Config
+	logger log.Logger
+}
+
+// NewRedisTaskProcessor returns a processor of the tasks in the Redis server
+// of redisOpt.
+func NewRedisTaskProcessor(redisOpt asynq.RedisClientOpt, store db.Store, mailer mail.Sender, config util.Config, logger log.Logger) *RedisTaskProcessor {
+	p := &RedisTaskProcessor{
+		store:  store,
+		mailer: mailer,
+		config: config,
+		logger: logger,
+	}
+	p.server = asynq.NewServer(redisOpt, asynq.Config{
+		Queues: map[string]int{
+			QueueCritical: 10,
+			QueueDefault:  5,
+		},
+		ErrorHandler:    asynq.ErrorHandlerFunc(p.handleError),
+		Logger:          asynqLogger{logger},
+		ShutdownTimeout: 10 * time.Second,
+	})
+	return p
+}
+
+// Start starts the workers. It does not block.
+func (p *RedisTaskProcessor) Start() error {
+	mux := asynq.NewServeMux()
+	mux.Use(p.observe)
+	mux.HandleFunc(TaskSendVerifyEmail, p.ProcessTaskSendVerifyEmail)
+	mux.HandleFunc(TaskSendResetPasswordEmail, p.ProcessTaskSendResetPasswordEmail)
+	return p.server.Start(mux)
+}
+
+// Shutdown waits for the running tasks and stops the workers.
+func (p *RedisTaskProcessor) Shutdown() {
+	p.server.Shutdown()
+}
+
+// observe records the runs of the tasks. The results of failed runs are
+// recorded by handleError, which knows whether the task is retried.
+func (p *RedisTaskProcessor) observe(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		begin := time.Now()
+		err := next.ProcessTask(ctx, task)
+		metrics.ObserveTaskRun(task.Type(), time.Since(begin))
+		if err == nil {
+			metrics.CountTaskResult(task.Type(), metrics.TaskSucceeded)
+			level.Debug(p.logger).Log("msg", "task processed", "task", task.Type(), "took", time.Since(begin))
+		}
+		return err
+	})
+}
+
+func (p *RedisTaskProcessor) handleError(ctx context.Context, task *asynq.Task, err error) {
+	id, _ := asynq.GetTaskID(ctx)
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	logger := log.With(p.logger, "task", task.Type(), "task_id", id, "retried", retried, "err", err)
+
+	if retried >= maxRetry || errors.Is(err, asynq.SkipRetry) {
+		metrics.CountTaskResult(task.Type(), metrics.TaskArchived)
+		level.Error(logger).Log("msg", "task failed and is archived")
+		return
+	}
+	metrics.CountTaskResult(task.Type(), metrics.TaskRetried)
+	level.Warn(logger).Log("msg", "task failed and is retried")
+}
+
+// asynqLogger logs the messages of asynq through a go-kit logger.
+type asynqLogger struct {
+	logger log.Logger
+}
+
+func (l asynqLogger) log(lvl func(log.Logger) log.Logger, args ...interface{}) {
+	lvl(log.With(l.logger, "component", "asynq")).Log("msg", fmt.Sprint(args...))
+}
+
+func (l asynqLogger) Debug(args ...interface{}) { l.log(level.Debug, args...) }
+func (l asynqLogger) Info(args ...interface{})  { l.log(level.Info, args...) }
+func (l asynqLogger) Warn(args ...interface{})  { l.log(level.Warn, args...) }
+func (l asynqLogger) Error(args ...interface{}) { l.log(level.Error, args...) }
+
+// Fatal exits, as asynq expects.
+func (l asynqLogger) Fatal(args ...interface{}) {
+	l.log(level.Error, args...)
+	os.Exit(1)
+}
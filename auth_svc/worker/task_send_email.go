@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/mail"
+	"auth/util"
+
+	"github.com/hibiken/asynq"
+)
+
+// Types of the email tasks.
+const (
+	TaskSendVerifyEmail        = "task:send_verify_email"
+	TaskSendResetPasswordEmail = "task:send_reset_password_email"
+)
+
+type PayloadSendVerifyEmail struct {
+	Username string `json:"username"`
+	// Email is the new email of a user changing it. The email of the user
+	// is verified when it is empty.
+	Email string `json:"email,omitempty"`
+}
+
+type PayloadSendResetPasswordEmail struct {
+	Username string `json:"username"`
+}
+
+func (d *RedisTaskDistributor) DistributeTaskSendVerifyEmail(ctx context.Context, payload *PayloadSendVerifyEmail, opts ...asynq.Option) error {
+	return d.enqueue(ctx, TaskSendVerifyEmail, payload, opts)
+}
+
+func (d *RedisTaskDistributor) DistributeTaskSendResetPasswordEmail(ctx context.Context, payload *PayloadSendResetPasswordEmail, opts ...asynq.Option) error {
+	return d.enqueue(ctx, TaskSendResetPasswordEmail, payload, opts)
+}
+
+// ProcessTaskSendVerifyEmail mails a link to verify the email of the user.
+// A user that is not found is retried: the task may run before the
+// transaction that created the user is committed.
+func (p *RedisTaskProcessor) ProcessTaskSendVerifyEmail(ctx context.Context, task *asynq.Task) error {
+	var payload PayloadSendVerifyEmail
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
+	}
+	user, err := p.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if payload.Email != "" {
+		// The email of the user changes once the link is opened.
+		user.Email = payload.Email
+	} else if user.IsEmailVerified {
+		return nil
+	}
+	return p.sendUserToken(ctx, user, db.TokenPurposeVerifyEmail)
+}
+
+// ProcessTaskSendResetPasswordEmail mails a password reset link to the
+// user.
+func (p *RedisTaskProcessor) ProcessTaskSendResetPasswordEmail(ctx context.Context, task *asynq.Task) error {
+	var payload PayloadSendResetPasswordEmail
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
+	}
+	user, err := p.store.GetUser(ctx, payload.Username)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	return p.sendUserToken(ctx, user, db.TokenPurposeResetPassword)
+}
+
+// sendUserToken creates a single-use token for purpose and mails a link
+// with it to the email of the user.
+func (p *RedisTaskProcessor) sendUserToken(ctx context.Context, user db.User, purpose string) error {
+	duration, subject, text := p.config.VerifyEmailDuration, "Verify your email", "verify your email"
+	path := "/verify_email"
+	if purpose == db.TokenPurposeResetPassword {
+		duration, subject, text = p.config.ResetPasswordDuration, "Reset your password", "reset your password"
+		path = "/reset_password"
+	}
+
+	token, err := util.RandomToken()
+	if err != nil {
+		return err
+	}
+	_, err = p.store.CreateUserToken(ctx, db.CreateUserTokenParams{
+		Username:  user.Username,
+		Purpose:   purpose,
+		TokenHash: util.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(duration),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create token: %w", err)
+	}
+
+	link := p.config.EmailLinkBaseURL + path + "?token=" + url.QueryEscape(token)
+	return p.mailer.Send(ctx, mail.Message{
+		To:      []string{user.Email},
+		Subject: subject,
+		Body: fmt.Sprintf("Hello %s,\n\nOpen the link below within %s to %s:\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.Username, duration, text, link),
+	})
+}
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	db "auth/db/sqlc"
+	"auth/mail"
+	"auth/util"
+
+	"github.com/go-kit/log"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/require"
+)
+
+// stubStore has a single user and keeps the tokens in memory.
+type stubStore struct {
+	db.Store
+	user   db.User
+	tokens []db.CreateUserTokenParams
+}
+
+func (s *stubStore) GetUser(_ context.Context, username string) (db.User, error) {
+	if username != s.user.Username {
+		return db.User{}, sql.ErrNoRows
+	}
+	return s.user, nil
+}
+
+func (s *stubStore) CreateUserToken(_ context.Context, arg db.CreateUserTokenParams) (db.UserToken, error) {
+	s.tokens = append(s.tokens, arg)
+	return db.UserToken{Username: arg.Username, Purpose: arg.Purpose, TokenHash: arg.TokenHash}, nil
+}
+
+func newTestProcessor(store db.Store, mailer mail.Sender) *RedisTaskProcessor {
+	config := util.Config{
+		EmailLinkBaseURL:      "http://localhost:3001",
+		VerifyEmailDuration:   24 * time.Hour,
+		ResetPasswordDuration: time.Hour,
+	}
+	return NewRedisTaskProcessor(asynq.RedisClientOpt{}, store, mailer, config, log.NewNopLogger())
+}
+
+func newTask(t *testing.T, taskType string, payload interface{}) *asynq.Task {
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return asynq.NewTask(taskType, data)
+}
+
+func TestProcessTaskSendVerifyEmail(t *testing.T) {
+	store := &stubStore{user: db.User{Username: "john", Email: "john@example.com"}}
+	mailer := &mail.MemorySender{}
+	processor := newTestProcessor(store, mailer)
+	ctx := context.Background()
+
+	err := processor.ProcessTaskSendVerifyEmail(ctx, newTask(t, TaskSendVerifyEmail, PayloadSendVerifyEmail{Username: "john"}))
+	require.NoError(t, err)
+
+	require.Len(t, store.tokens, 1)
+	token := store.tokens[0]
+	require.Equal(t, db.TokenPurposeVerifyEmail, token.Purpose)
+	require.Equal(t, "john@example.com", token.Email)
+	require.WithinDuration(t, time.Now().Add(24*time.Hour), token.ExpiresAt, time.Minute)
+
+	messages := mailer.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, []string{"john@example.com"}, messages[0].To)
+	_, link, found := strings.Cut(messages[0].Body, "http://localhost:3001/verify_email?token=")
+	require.True(t, found, messages[0].Body)
+	secret, _, _ := strings.Cut(link, "\n")
+	require.Equal(t, token.TokenHash, util.HashToken(secret))
+
+	// A verified email is not verified again.
+	store.user.IsEmailVerified = true
+	err = processor.ProcessTaskSendVerifyEmail(ctx, newTask(t, TaskSendVerifyEmail, PayloadSendVerifyEmail{Username: "john"}))
+	require.NoError(t, err)
+	require.Len(t, mailer.Messages(), 1)
+
+	// A new email is verified before it replaces the current one.
+	err = processor.ProcessTaskSendVerifyEmail(ctx, newTask(t, TaskSendVerifyEmail, PayloadSendVerifyEmail{Username: "john", Email: "johnny@example.com"}))
+	require.NoError(t, err)
+	require.Len(t, store.tokens, 2)
+	require.Equal(t, "johnny@example.com", store.tokens[1].Email)
+	require.Equal(t, []string{"johnny@example.com"}, mailer.Messages()[1].To)
+
+	// Unknown users are retried, invalid payloads are not.
+	err = processor.ProcessTaskSendVerifyEmail(ctx, newTask(t, TaskSendVerifyEmail, PayloadSendVerifyEmail{Username: "jane"}))
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NotErrorIs(t, err, asynq.SkipRetry)
+	err = processor.ProcessTaskSendVerifyEmail(ctx, asynq.NewTask(TaskSendVerifyEmail, []byte("{")))
+	require.ErrorIs(t, err, asynq.SkipRetry)
+}
+
+func TestProcessTaskSendResetPasswordEmail(t *testing.T) {
+	store := &stubStore{user: db.User{Username: "john", Email: "john@example.com", IsEmailVerified: true}}
+	mailer := &mail.MemorySender{}
+	processor := newTestProcessor(store, mailer)
+
+	err := processor.ProcessTaskSendResetPasswordEmail(context.Background(), newTask(t, TaskSendResetPasswordEmail, PayloadSendResetPasswordEmail{Username: "john"}))
+	require.NoError(t, err)
+	require.Len(t, store.tokens, 1)
+	require.Equal(t, db.TokenPurposeResetPassword, store.tokens[0].Purpose)
+	messages := mailer.Messages()
+	require.Len(t, messages, 1)
+	require.Equal(t, "Reset your password", messages[0].Subject)
+	require.Contains(t, messages[0].Body, "http://localhost:3001/reset_password?token=")
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authsdk "sdk/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newAuthServer fakes the key verification of auth_svc, which only knows
+// the keys of john and of the client "sync".
+func newAuthServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api_keys/verify", r.URL.Path)
+		var req authsdk.VerifyAPIKeyRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Header().Set("Content-Type", "application/json")
+		switch req.Key {
+		case "lms_john":
+			w.Write([]byte(`{"key_id":1,"username":"john","student_id":7,"tenant_id":2,"scopes":["students:read"]}`))
+		case "lms_sync":
+			w.Write([]byte(`{"key_id":2,"client_id":"sync","tenant_id":1,"scopes":["courses:read"],"expires_at":"2100-01-01T00:00:00Z"}`))
+		case "lms_down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"unavailable"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"API key is invalid, expired or revoked"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSDKAPIKeyVerifier(t *testing.T) {
+	client, err := authsdk.NewClientWithResponses(newAuthServer(t).URL)
+	require.NoError(t, err)
+	verifier := NewSDKAPIKeyVerifier(client)
+	ctx := context.Background()
+
+	payload, err := verifier.VerifyAPIKey(ctx, "lms_john")
+	require.NoError(t, err)
+	require.Equal(t, "john", payload.Username)
+	require.Equal(t, int64(7), payload.StudentID)
+	require.Equal(t, int64(1), payload.APIKeyID)
+	require.Equal(t, int64(2), payload.TenantID)
+	require.True(t, payload.HasScope("students:read"))
+	require.False(t, payload.HasScope("students:write"))
+
+	payload, err = verifier.VerifyAPIKey(ctx, "lms_sync")
+	require.NoError(t, err)
+	require.Equal(t, "client:sync", Actor(NewContext(ctx, payload)))
+	require.Equal(t, 2100, payload.ExpiredAt.Year())
+
+	_, err = verifier.VerifyAPIKey(ctx, "lms_revoked")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = verifier.VerifyAPIKey(ctx, "lms_down")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestHTTPToContextAPIKey(t *testing.T) {
+	client, err := authsdk.NewClientWithResponses(newAuthServer(t).URL)
+	require.NoError(t, err)
+	verifier, err := NewJWTVerifier("12345678901234567890123456789012")
+	require.NoError(t, err)
+
+	actor := func(apiKeys APIKeyVerifier, key string) string {
+		r := httptest.NewRequest(http.MethodGet, "/courses", nil)
+		r.Header.Set("X-API-Key", key)
+		return Actor(HTTPToContext(verifier, nil, apiKeys)(context.Background(), r))
+	}
+	apiKeys := NewSDKAPIKeyVerifier(client)
+	require.Equal(t, "john", actor(apiKeys, "lms_john"))
+	require.Equal(t, "anonymous", actor(apiKeys, "lms_revoked"))
+	require.Equal(t, "anonymous", actor(apiKeys, "lms_down"))
+	require.Equal(t, "anonymous", actor(nil, "lms_john"))
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist reports the tokens revoked by auth_svc before they expire
+type Denylist interface {
+	// IsRevoked reports whether the token of the payload was revoked
+	IsRevoked(ctx context.Context, payload *Payload) (bool, error)
+}
+
+// The keys are written by the denylist of auth_svc.
+func revokedTokenKey(id string) string {
+	return "auth:revoked_token:" + id
+}
+
+func revokedUserKey(username string) string {
+	return "auth:revoked_user:" + username
+}
+
+// RedisDenylist reads the denylist that auth_svc keeps in Redis
+type RedisDenylist struct {
+	client *redis.Client
+}
+
+// NewRedisDenylist creates a new RedisDenylist
+func NewRedisDenylist(client *redis.Client) *RedisDenylist {
+	return &RedisDenylist{client}
+}
+
+func (d *RedisDenylist) IsRevoked(ctx context.Context, payload *Payload) (bool, error) {
+	values, err := d.client.MGet(ctx, revokedTokenKey(payload.ID), revokedUserKey(payload.Username)).Result()
+	if err != nil {
+		return false, err
+	}
+	if values[0] != nil {
+		return true, nil
+	}
+	if values[1] == nil {
+		return false, nil
+	}
+	revokedAt, err := strconv.ParseInt(values[1].(string), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return !payload.IssuedAt.After(time.Unix(0, revokedAt)), nil
+}
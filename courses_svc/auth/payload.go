@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// Different types of error returned by the Verifier
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+	// ErrRevokedToken is returned for the tokens on the denylist.
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// Payload mirrors the token payload issued by auth_svc
+type Payload struct {
+	ID        string   `json:"id"`
+	Username  string   `json:"username"`
+	StudentID int64    `json:"student_id,omitempty"`
+	TenantID  int64    `json:"tenant_id,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// APIKeyID is set for the requests authenticated with an API key, which
+	// only grants its scopes.
+	APIKeyID  int64     `json:"api_key_id,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// HasScope reports whether the token or API key grants scope. Every token
+// grants its scopes only, including the tokens of the LMS apps, which carry
+// the USER_TOKEN_SCOPES of auth_svc.
+func (payload *Payload) HasScope(scope string) bool {
+	for _, s := range payload.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid checks if the token payload is valid or not
+func (payload *Payload) Valid() error {
+	if time.Now().After(payload.ExpiredAt) {
+		return ErrExpiredToken
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireScope(t *testing.T) {
+	next := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	read := RequireScope(ScopeStudentsRead)(next)
+	write := RequireScope(ScopeStudentsWrite)(next)
+
+	testCases := []struct {
+		name    string
+		payload *Payload
+		read    error
+		write   error
+	}{
+		{name: "anonymous", read: ErrUnauthenticated, write: ErrUnauthenticated},
+		{name: "token without tenant", payload: &Payload{Username: "john"}, read: ErrUnauthenticated, write: ErrUnauthenticated},
+		{name: "token without scopes", payload: &Payload{Username: "john", TenantID: 1}, read: ErrInsufficientScope, write: ErrInsufficientScope},
+		{name: "read-only app token", payload: &Payload{Username: "john", TenantID: 1, Scopes: []string{"profile", ScopeStudentsRead, ScopeCoursesRead}}, write: ErrInsufficientScope},
+		{name: "read-only client", payload: &Payload{ClientID: "grading", TenantID: 1, Scopes: []string{ScopeStudentsRead}}, write: ErrInsufficientScope},
+		{name: "read-only API key", payload: &Payload{Username: "john", APIKeyID: 1, TenantID: 1, Scopes: []string{ScopeStudentsRead}}, write: ErrInsufficientScope},
+		{name: "other scope", payload: &Payload{ClientID: "sync", TenantID: 1, Scopes: []string{ScopeCoursesWrite}}, read: ErrInsufficientScope, write: ErrInsufficientScope},
+		{name: "read-write client", payload: &Payload{ClientID: "grading", TenantID: 1, Scopes: []string{ScopeStudentsRead, ScopeStudentsWrite}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.payload != nil {
+				ctx = NewContext(ctx, tc.payload)
+			}
+			_, err := read(ctx, nil)
+			require.Equal(t, tc.read, err)
+			_, err = write(ctx, nil)
+			require.Equal(t, tc.write, err)
+		})
+	}
+}
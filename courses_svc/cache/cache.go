@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCacheMiss is returned by Get when the key is not cached.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache is a key-value store with per-key expiry.
+type Cache interface {
+	// Get returns the value stored for key, or ErrCacheMiss
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores value for key during ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the keys from the cache
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// New returns a Redis backed cache. When Redis is not configured or can not
+// be reached, an in-process LRU cache holding up to size entries is used
+// instead.
+func New(redisAddress string, size int, logger log.Logger) Cache {
+	if redisAddress != "" {
+		client := redis.NewClient(&redis.Options{Addr: redisAddress})
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		err := client.Ping(ctx).Err()
+		if err == nil {
+			logger.Log("cache", "redis", "addr", redisAddress)
+			return NewRedisCache(client)
+		}
+		logger.Log("cache", "redis", "addr", redisAddress, "err", err)
+		client.Close()
+	}
+	logger.Log("cache", "lru", "size", size)
+	return NewLRUCache(size)
+}
+
+// NewInstrumentedCache counts the hits and misses of c, labelled by name.
+func NewInstrumentedCache(name string, requests metrics.Counter, c Cache) Cache {
+	return &instrumentedCache{name, requests, c}
+}
+
+type instrumentedCache struct {
+	name     string
+	requests metrics.Counter
+	next     Cache
+}
+
+func (c *instrumentedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.next.Get(ctx, key)
+	result := "hit"
+	switch {
+	case err == ErrCacheMiss:
+		result = "miss"
+	case err != nil:
+		result = "error"
+	}
+	c.requests.With("cache", c.name, "result", result).Add(1)
+	return value, err
+}
+
+func (c *instrumentedCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.next.Set(ctx, key, value, ttl)
+}
+
+func (c *instrumentedCache) Delete(ctx context.Context, keys ...string) error {
+	return c.next.Delete(ctx, keys...)
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRUCache is an in-process cache that evicts the least recently used entry
+// once it holds size entries.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCache creates a new LRUCache
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 1024
+	}
+	return &LRUCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(el)
+		return nil, ErrCacheMiss
+	}
+	c.ll.MoveToFront(el)
+	return entry.value, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.ll.PushFront(&lruEntry{key, value, expiresAt})
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *LRUCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+	return nil
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
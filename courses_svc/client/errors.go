@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"courses/auth"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+var (
+	// ErrTimeout is returned when the students service did not answer
+	// before the deadline of the call.
+	ErrTimeout = errors.New("students service timed out")
+	// ErrNotFound is matched by a StatusError with status 404.
+	ErrNotFound = errors.New("not found")
+)
+
+// StatusError is returned when the students service answers with an error
+// status code.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("students service: %d %s", e.StatusCode, e.Message)
+}
+
+// Is reports 404 responses as ErrNotFound, and the refused credentials of
+// the caller, forwarded to the students service, as auth.ErrUnauthenticated
+// and auth.ErrInsufficientScope.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case auth.ErrUnauthenticated:
+		return e.StatusCode == http.StatusUnauthorized
+	case auth.ErrInsufficientScope:
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed when retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// statusError reads the error of a response with an error status code.
+// Client errors are returned as the response's Err so that they don't trip
+// the circuit breaker or get retried; the others are returned as errors.
+func statusError(statusCode int, body []byte) *StatusError {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) != nil || e.Error == "" {
+		e.Error = http.StatusText(statusCode)
+	}
+	return &StatusError{StatusCode: statusCode, Message: e.Error}
+}
+
+// timeoutErrors reports deadline and network timeouts of next as ErrTimeout.
+func timeoutErrors(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := next(ctx, request)
+		if err == nil {
+			return response, nil
+		}
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return nil, err
+	}
+}
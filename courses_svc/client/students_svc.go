@@ -2,60 +2,87 @@ package client
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"path"
 	"strings"
-	"time"
 
-	"github.com/go-kit/kit/circuitbreaker"
+	"courses/auth"
+	"courses/logging"
+	"courses/resilience"
+	"courses/tracing"
+
+	"sdk/students"
+
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/ratelimit"
-	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
 	"github.com/go-kit/log"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Student struct {
-	ID          int64     `json:"id,omitempty"`
-	Fullname    string    `json:"fullname"`
-	DateOfBirth time.Time `json:"date_of_birth"`
-	Grade       int       `json:"grade,omitempty"`
-	Phone       int64     `json:"phone"`
-}
+// Student is a student of students_svc.
+type Student = students.Student
 
 type StudentServiceClient struct {
 	GetCourseStudentsEndpoint endpoint.Endpoint
 }
 
-func NewHTTPClient(instance string, logger log.Logger) (StudentServiceClient, error) {
-	if !strings.HasPrefix(instance, "http") {
-		instance = "http://" + instance
-	}
-	u, err := url.Parse(instance)
-	if err != nil {
-		return StudentServiceClient{}, err
-	}
+// NewHTTPClient returns a client of the students service. Requests are
+// balanced round-robin over the instances of instancer. The endpoints are
+// wrapped according to the "StudentClient/<method>" policies, with a circuit
+// breaker per instance.
+func NewHTTPClient(instancer sd.Instancer, logger log.Logger, policies resilience.Config, m Metrics) StudentServiceClient {
+	httpClient := tracing.NewClient()
 
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
 	var getCourseStudentsEndpoint endpoint.Endpoint
 	{
-		getCourseStudentsEndpoint = httptransport.NewClient(
-			"GET",
-			copyURL(u, "/"),
-			encodeGetCourseStudentsRequest,
-			decodeGetCourseStudentsResponse,
-		).Endpoint()
-		getCourseStudentsEndpoint = limiter(getCourseStudentsEndpoint)
-		getCourseStudentsEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(getCourseStudentsEndpoint)
+		getCourseStudentsEndpoint = balance(instancer, httpClient, "StudentClient/GetCourseStudents", policies, m, logger, makeGetCourseStudentsEndpoint)
 	}
 
 	return StudentServiceClient{
 		GetCourseStudentsEndpoint: getCourseStudentsEndpoint,
-	}, nil
+	}
+}
+
+// balance returns an endpoint that round-robins over the instances of
+// instancer, guarded by the policy of name, instrumented and traced in a
+// span of that name. makeEndpoint builds the endpoint of a single instance
+// from its sdk client, which gets its own circuit breaker.
+func balance(instancer sd.Instancer, httpClient *http.Client, name string, policies resilience.Config, m Metrics, logger log.Logger, makeEndpoint func(c *students.ClientWithResponses) endpoint.Endpoint) endpoint.Endpoint {
+	policy := policies.Policy(name)
+	factory := func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		if !strings.HasPrefix(instance, "http") {
+			instance = "http://" + instance
+		}
+		u, err := url.Parse(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := students.NewClientWithResponses(u.String(),
+			students.WithHTTPClient(httpClient),
+			students.WithRequestEditorFn(logging.PropagateRequestID),
+			students.WithRequestEditorFn(auth.ForwardCredentials),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		e := timeoutErrors(makeEndpoint(c))
+		e = resilience.Breaker(name+"@"+u.Host, policy.Breaker, m.BreakerState, nil)(e)
+		return e, nil, nil
+	}
+
+	balancer := lb.NewRoundRobin(sd.NewEndpointer(instancer, factory, logger))
+	balanced := func(ctx context.Context, request interface{}) (interface{}, error) {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return e(ctx, request)
+	}
+	e := resilience.Guard(policy)(balanced)
+	e = instrumenting(name, m.RequestDuration)(e)
+	return tracing.EndpointMiddleware(name, trace.SpanKindClient)(e)
 }
 
 func (c *StudentServiceClient) GetCourseStudents(ctx context.Context, id string) ([]Student, error) {
@@ -76,25 +103,25 @@ type getCourseStudentsRequest struct {
 
 type getCourseStudentsResponse struct {
 	Students []Student
-	Err      error `json:"error,omitempty"`
-}
-
-func decodeGetCourseStudentsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
-	var response getCourseStudentsResponse
-	fmt.Println(resp.Body)
-	err := json.NewDecoder(resp.Body).Decode(&response)
-	return response, err
+	Err      error `json:"-"`
 }
 
-func encodeGetCourseStudentsRequest(_ context.Context, req *http.Request, request interface{}) error {
-	r := request.(getCourseStudentsRequest)
-
-	req.URL.Path = path.Join(req.URL.Path, "courses", url.PathEscape(r.CourseID), "students")
-	return nil
-}
+func (r getCourseStudentsResponse) Failed() error { return r.Err }
 
-func copyURL(base *url.URL, path string) *url.URL {
-	next := *base
-	next.Path = path
-	return &next
+func makeGetCourseStudentsEndpoint(c *students.ClientWithResponses) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getCourseStudentsRequest)
+		resp, err := c.GetCourseStudentsWithResponse(ctx, req.CourseID)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			err := statusError(resp.StatusCode(), resp.Body)
+			if err.Temporary() {
+				return nil, err
+			}
+			return getCourseStudentsResponse{Err: err}, nil
+		}
+		return getCourseStudentsResponse{Students: resp.JSON200.Students}, nil
+	}
 }
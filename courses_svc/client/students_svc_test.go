@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"courses/auth"
+	"courses/resilience"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) StudentServiceClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	policy := resilience.DefaultPolicy
+	policy.Timeout = 100 * time.Millisecond
+	policy.Retries = 2
+	policy.RetryBackoff = time.Millisecond
+	policies := resilience.Config{Default: policy}
+
+	return NewHTTPClient(sd.FixedInstancer{server.URL}, log.NewNopLogger(), policies, Metrics{BreakerState: discard.NewGauge(), RequestDuration: discard.NewHistogram()})
+}
+
+func TestGetCourseStudentsNotFound(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+
+	_, err := c.GetCourseStudents(context.Background(), "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, "not found", statusErr.Message)
+	// Client errors are not retried.
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetCourseStudentsRefused(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+	}{
+		{http.StatusUnauthorized, auth.ErrUnauthenticated},
+		{http.StatusForbidden, auth.ErrInsufficientScope},
+	}
+	for _, tt := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+
+		_, err := c.GetCourseStudents(context.Background(), "1")
+		require.ErrorIs(t, err, tt.err)
+	}
+}
+
+func TestGetCourseStudentsRetry(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Students":[{"id":1,"fullname":"John Doe"}]}`))
+	})
+
+	students, err := c.GetCourseStudents(context.Background(), "1")
+	require.NoError(t, err)
+	require.Len(t, students, 1)
+	require.Equal(t, "John Doe", students[0].Fullname)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestGetCourseStudentsTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	_, err := c.GetCourseStudents(context.Background(), "1")
+	require.ErrorIs(t, err, ErrTimeout)
+}
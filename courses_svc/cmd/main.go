@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
@@ -9,26 +10,44 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"courses/auth"
+	"courses/cache"
 	"courses/client"
-	db "courses/db/sqlc"
+	"courses/discovery"
+	"courses/health"
+	"courses/logging"
+	"courses/resilience"
 	"courses/service"
+	"courses/tracing"
 	"courses/utils"
 
+	authsdk "sdk/auth"
+
 	"github.com/oklog/oklog/pkg/group"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/metrics/prometheus"
+	consulsd "github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
+	config, err := utils.LoadConfig(".")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot load config:", err)
+		os.Exit(1)
+	}
+
 	fs := flag.NewFlagSet("courses_svc", flag.ExitOnError)
 	var (
 		debugAddr = fs.String("debug.addr", ":7070", "Debug and metrics listen address")
@@ -36,12 +55,16 @@ func main() {
 	)
 	flag.Parse()
 
-	var logger log.Logger
-	{
-		logger = log.NewLogfmtLogger(os.Stderr)
-		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
-		logger = log.With(logger, "caller", log.DefaultCaller)
+	logLevel, err := logging.NewLevel(config.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot parse LOG_LEVEL:", err)
+		os.Exit(1)
 	}
+	logger := logging.New(os.Stderr, logLevel)
+
+	// The deferred cleanups run before the process exits with exitCode.
+	exitCode := 0
+	defer func() { os.Exit(exitCode) }()
 
 	var count metrics.Counter
 	{
@@ -50,70 +73,250 @@ func main() {
 			Subsystem: "courses_service",
 			Name:      "request_count",
 			Help:      "Number of requests received.",
-		}, []string{"method"})
+		}, []string{"method", "error", "code"})
 	}
 	var duration metrics.Histogram
 	{
-		// Endpoint-level metrics.
-		duration = prometheus.NewSummaryFrom(stdprometheus.SummaryOpts{
+		// Request metrics, recorded by service.InstrumentingMiddleware.
+		duration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
 			Namespace: "api",
 			Subsystem: "courses_service",
 			Name:      "request_duration_seconds",
 			Help:      "Request duration in seconds.",
-		}, []string{"method"})
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"method", "error", "code"})
+	}
+	var dbDuration metrics.Histogram
+	{
+		dbDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "api",
+			Subsystem: "courses_service",
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query duration in seconds.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"query", "error"})
+	}
+	var clientDuration metrics.Histogram
+	{
+		clientDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "api",
+			Subsystem: "courses_service",
+			Name:      "client_request_duration_seconds",
+			Help:      "Duration of the calls to other services in seconds.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"endpoint", "result"})
+	}
+	var cacheCount metrics.Counter
+	{
+		cacheCount = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "api",
+			Subsystem: "courses_service",
+			Name:      "cache_count",
+			Help:      "Number of cache lookups by result.",
+		}, []string{"cache", "result"})
+	}
+	var breakerState metrics.Gauge
+	{
+		breakerState = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "api",
+			Subsystem: "courses_service",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breakers: 0 closed, 1 half-open, 2 open.",
+		}, []string{"endpoint"})
 	}
 	http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
+	http.DefaultServeMux.Handle("/admin/log-level", logging.LevelHandler(logLevel, logger))
 
-	config, err := utils.LoadConfig(".")
+	policies, err := resilience.LoadConfig(config.ResilienceConfigFile)
+	if err != nil {
+		level.Error(logger).Log("during", "LoadResilienceConfig", "err", err)
+		os.Exit(1)
+	}
+	// The client address limited by the policies is only read from the
+	// X-Forwarded-For header of the trusted proxies.
+	trustedProxies, err := resilience.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		level.Error(logger).Log("during", "ParseTrustedProxies", "err", err)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), "courses_svc", config.TracingExporter, config.TracingOTLPEndpoint)
 	if err != nil {
-		logger.Log("config", err)
+		level.Error(logger).Log("during", "InitTracing", "err", err)
+		os.Exit(1)
 	}
-	conn, err := sql.Open(config.DBDriver, config.DBSource)
+	defer shutdownTracing(context.Background())
+	openDB := sql.Open
+	if config.DBRowLevelSecurity {
+		// The connections forget the tenant of a query before they are
+		// reused.
+		openDB = service.OpenTenantDB
+	}
+	conn, err := openDB(config.DBDriver, config.DBSource)
 	if err != nil {
-		logger.Log("db conn error", err)
+		level.Error(logger).Log("during", "OpenDB", "err", err)
+		os.Exit(1)
+	}
+	if err = health.WaitFor(context.Background(), health.DBCheck(conn), time.Second, 30*time.Second); err != nil {
+		level.Error(logger).Log("during", "PingDB", "err", err)
+		os.Exit(1)
+	}
+	// The migrations run as the owner of the tables, whom the row-level
+	// security policies do not apply to, so with them the service connects
+	// as another role.
+	migrationSource := config.MigrationDBSource
+	if migrationSource == "" {
+		migrationSource = config.DBSource
+	}
+	if err = runDBMigration(config.MigrationURL, migrationSource, logger); err != nil {
+		level.Error(logger).Log("during", "MigrateDB", "err", err)
+		os.Exit(1)
+	}
+	if config.DBRowLevelSecurity {
+		if err = service.CheckRowLevelSecurity(context.Background(), conn); err != nil {
+			level.Error(logger).Log("during", "CheckRowLevelSecurity", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// With row-level security, every query is also limited to the tenant
+	// of the caller by the database.
+	store := service.NewStore(conn, config.DBRowLevelSecurity, dbDuration)
+
+	var consulClient consulsd.Client
+	if config.ConsulAddress != "" {
+		consulClient, err = discovery.NewConsulClient(config.ConsulAddress)
+		if err != nil {
+			level.Error(logger).Log("during", "NewConsulClient", "err", err)
+			os.Exit(1)
+		}
 	}
 
-	runDBMigration(config.MigrationURL, config.DBSource, logger)
+	studentInstancer := discovery.NewInstancer(consulClient, "students", config.StudentsHTTPServerAddress, logger)
+	defer studentInstancer.Stop()
+	studentsSvc := client.NewHTTPClient(studentInstancer, logger, policies, client.Metrics{
+		BreakerState:    breakerState,
+		RequestDuration: clientDuration,
+	})
 
-	store := db.New(conn)
+	courseCache := cache.NewInstrumentedCache("course", cacheCount, cache.New(config.RedisAddress, config.CacheSize, logger))
 
-	studentsSvc, err := client.NewHTTPClient(config.StudentsHTTPServerAddress, logger)
+	verifier, err := auth.NewJWTVerifier(config.TokenSymmetricKey)
 	if err != nil {
-		logger.Log("cannot connect to students client", err)
+		level.Error(logger).Log("during", "NewJWTVerifier", "err", err)
+		os.Exit(1)
+	}
+	// Tokens revoked by auth_svc are on a denylist in Redis.
+	var denylist auth.Denylist
+	if config.RedisAddress != "" {
+		redisClient := redis.NewClient(&redis.Options{Addr: config.RedisAddress})
+		defer redisClient.Close()
+		denylist = auth.NewRedisDenylist(redisClient)
+	}
+	// API keys are verified by auth_svc.
+	var apiKeys auth.APIKeyVerifier
+	if config.AuthHTTPServerAddress != "" {
+		authClient, err := authsdk.NewClientWithResponses("http://"+config.AuthHTTPServerAddress,
+			authsdk.WithHTTPClient(tracing.NewClient()),
+			authsdk.WithRequestEditorFn(logging.PropagateRequestID),
+		)
+		if err != nil {
+			level.Error(logger).Log("during", "NewAuthClient", "err", err)
+			os.Exit(1)
+		}
+		apiKeys = auth.NewSDKAPIKeyVerifier(authClient)
 	}
 
 	var (
-		crs_service = service.New(store, studentsSvc, logger, count, duration)
-		endpoints   = service.MakeServerEndpoints(crs_service, logger, duration)
-		httpHandler = service.MakeHTTPHandler(endpoints, logger)
+		crs_service = service.New(store, studentsSvc, courseCache, config.CourseCacheTTL, logger)
+		endpoints   = service.MakeServerEndpoints(crs_service, logger, duration, policies, breakerState)
+		routes      = service.MakeHTTPHandler(endpoints, logger)
 	)
+	var httpHandler http.Handler = routes
+	httpHandler = service.IdempotencyMiddleware(store.Queries, logger)(httpHandler)
+	httpHandler = auth.HTTPMiddleware(verifier, denylist, apiKeys)(httpHandler)
+	httpHandler = resilience.ClientAddressMiddleware(trustedProxies)(httpHandler)
+	httpHandler = service.InstrumentingMiddleware(routes, count, duration)(httpHandler)
+	httpHandler = logging.RequestIDMiddleware(httpHandler)
+	httpHandler = tracing.NewHandler(httpHandler, "courses_svc")
+
+	checks := health.New()
+	checks.Add("db", health.DBCheck(conn))
+	migrationCheck, err := health.MigrationCheck(conn, config.MigrationURL)
+	if err != nil {
+		level.Error(logger).Log("during", "MigrationCheck", "err", err)
+		os.Exit(1)
+	}
+	checks.Add("migrations", migrationCheck)
+	checks.Add("students", health.DownstreamCheck(studentInstancer, &http.Client{Timeout: health.CheckTimeout}))
+	httpHandler = checks.Handler(httpHandler)
 
 	var g group.Group
 	{
 		debugListener, err := net.Listen("tcp", *debugAddr)
 		if err != nil {
-			logger.Log("transport", "debug/HTTP", "during", "Listen", "err", err)
+			level.Error(logger).Log("transport", "debug/HTTP", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
+		debugServer := &http.Server{Handler: http.DefaultServeMux}
 		g.Add(func() error {
 			logger.Log("transport", "debug/HTTP", "addr", *debugAddr)
-			return http.Serve(debugListener, http.DefaultServeMux)
+			return serve(debugServer, debugListener)
+		}, func(error) {
+			shutdown(debugServer, logger)
+		})
+	}
+	if config.AdminServerAddress != "" {
+		// The audit records hold personal data, so they are served on their
+		// own listener, apart from the metrics scraped on the debug one.
+		adminListener, err := net.Listen("tcp", config.AdminServerAddress)
+		if err != nil {
+			level.Error(logger).Log("transport", "admin/HTTP", "during", "Listen", "err", err)
+			os.Exit(1)
+		}
+		adminServer := &http.Server{Handler: service.MakeAdminHTTPHandler(endpoints, logger)}
+		g.Add(func() error {
+			logger.Log("transport", "admin/HTTP", "addr", config.AdminServerAddress)
+			return serve(adminServer, adminListener)
 		}, func(error) {
-			debugListener.Close()
+			shutdown(adminServer, logger)
 		})
 	}
 	{
 		// The HTTP listener mounts the Go kit HTTP handler we created.
 		httpListener, err := net.Listen("tcp", *httpAddr)
 		if err != nil {
-			logger.Log("transport", "HTTP", "during", "Listen", "err", err)
+			level.Error(logger).Log("transport", "HTTP", "during", "Listen", "err", err)
 			os.Exit(1)
 		}
+		httpServer := &http.Server{Handler: httpHandler}
 		g.Add(func() error {
 			logger.Log("transport", "HTTP", "addr", *httpAddr)
-			return http.Serve(httpListener, httpHandler)
+			return serve(httpServer, httpListener)
+		}, func(error) {
+			// Stop getting new requests, then drain the in-flight ones.
+			checks.Drain()
+			shutdown(httpServer, logger)
+		})
+	}
+	{
+		// Expired idempotency keys are purged once an hour.
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := service.PurgeIdempotencyKeys(ctx, store.Queries); err != nil {
+						level.Error(logger).Log("during", "PurgeIdempotencyKeys", "err", err)
+					}
+				case <-ctx.Done():
+					return nil
+				}
+			}
 		}, func(error) {
-			httpListener.Close()
+			cancel()
 		})
 	}
 	{
@@ -124,7 +327,8 @@ func main() {
 			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 			select {
 			case sig := <-c:
-				return fmt.Errorf("received signal %s", sig)
+				logger.Log("signal", sig)
+				return nil
 			case <-cancelInterrupt:
 				return nil
 			}
@@ -132,18 +336,57 @@ func main() {
 			close(cancelInterrupt)
 		})
 	}
-	logger.Log("exit", g.Run())
+	if consulClient != nil {
+		address, err := discovery.AdvertiseAddress(config.AdvertiseAddress, *httpAddr)
+		if err != nil {
+			level.Error(logger).Log("during", "AdvertiseAddress", "err", err)
+			os.Exit(1)
+		}
+		registrar, err := discovery.NewRegistrar(consulClient, "courses", address, logger)
+		if err != nil {
+			level.Error(logger).Log("during", "NewRegistrar", "err", err)
+			os.Exit(1)
+		}
+		registrar.Register()
+		defer registrar.Deregister()
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("exit", err)
+		exitCode = 1
+		return
+	}
+	logger.Log("exit", "shutdown")
+}
+
+// shutdownTimeout bounds how long in-flight requests are drained.
+const shutdownTimeout = 15 * time.Second
+
+// serve serves on listener until server is shut down.
+func serve(server *http.Server, listener net.Listener) error {
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func shutdown(server *http.Server, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		level.Error(logger).Log("during", "Shutdown", "err", err)
+	}
 }
 
-func runDBMigration(migrationURL string, dbSource string, logger log.Logger) {
+func runDBMigration(migrationURL string, dbSource string, logger log.Logger) error {
 	migration, err := migrate.New(migrationURL, dbSource)
 	if err != nil {
-		logger.Log("cannot create new migrate instance", err)
+		return fmt.Errorf("cannot create new migrate instance: %w", err)
 	}
 
 	if err = migration.Up(); err != nil && err != migrate.ErrNoChange {
-		logger.Log("failed to run migrate up", err)
+		return fmt.Errorf("failed to run migrate up: %w", err)
 	}
 
-	logger.Log("db migrated successfully")
+	logger.Log("msg", "db migrated successfully")
+	return nil
 }
@@ -0,0 +1,32 @@
+CREATE TABLE "audit_log" (
+  "id" bigserial PRIMARY KEY,
+  "actor" varchar NOT NULL,
+  "action" varchar NOT NULL,
+  "entity" varchar NOT NULL,
+  "entity_id" varchar NOT NULL,
+  "before" jsonb NOT NULL DEFAULT 'null',
+  "after" jsonb NOT NULL DEFAULT 'null',
+  "diff" jsonb NOT NULL DEFAULT '{}',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "audit_log" ("entity", "entity_id");
+
+CREATE INDEX ON "audit_log" ("actor");
+
+CREATE INDEX ON "audit_log" ("created_at");
+
+-- audit_log is append-only: rows can not be updated, deleted or truncated.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_delete
+BEFORE UPDATE OR DELETE ON "audit_log"
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON "audit_log"
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1 @@
+ALTER TABLE "courses" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,19 @@
+-- name: CreateAuditRecord :one
+INSERT INTO audit_log (
+  actor, action, entity, entity_id, before, after, diff, tenant_id
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING *;
+
+-- name: ListAuditRecords :many
+SELECT * FROM audit_log
+WHERE tenant_id = sqlc.arg(tenant_id)
+  AND (sqlc.narg(entity)::varchar IS NULL OR entity = sqlc.narg(entity))
+  AND (sqlc.narg(entity_id)::varchar IS NULL OR entity_id = sqlc.narg(entity_id))
+  AND (sqlc.narg(actor)::varchar IS NULL OR actor = sqlc.narg(actor))
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR created_at < sqlc.narg(to_time))
+ORDER BY id
+LIMIT sqlc.arg(row_limit)
+OFFSET sqlc.arg(row_offset);
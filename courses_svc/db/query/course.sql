@@ -1,27 +1,39 @@
 -- name: GetCourse :one
 SELECT * FROM Courses
-WHERE id = $1 LIMIT 1;
+WHERE tenant_id = $1 AND id = $2 LIMIT 1;
+
+-- name: GetCourseForUpdate :one
+SELECT * FROM Courses
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
+FOR UPDATE;
 
 -- name: ListCourses :many
 SELECT * FROM Courses
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2;
+LIMIT $2
+OFFSET $3;
 
 -- name: CreateCourse :one
 INSERT INTO Courses (
-  name
+  name, tenant_id
 ) VALUES (
-  $1
+  $1, $2
 )
 RETURNING *;
 
 -- name: DeleteCourse :exec
 DELETE FROM Courses
-WHERE id = $1;
+WHERE tenant_id = $1 AND id = $2;
 
 -- name: UpdateCourse :one
 UPDATE Courses
-  set name = $2
-WHERE id = $1
+  set name = $2,
+  version = version + 1
+WHERE id = $1 AND version = $3 AND tenant_id = $4
 RETURNING *;
+
+-- name: GetCoursesByIDs :many
+SELECT * FROM Courses
+WHERE tenant_id = sqlc.arg(tenant_id) AND id = ANY(sqlc.arg(ids)::bigint[])
+ORDER BY id;
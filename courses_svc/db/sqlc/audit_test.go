@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"courses/utils"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAuditRecord(t *testing.T) AuditLog {
+	arg := CreateAuditRecordParams{
+		Actor:    utils.RandomName(),
+		Action:   "update",
+		Entity:   "course",
+		EntityID: utils.RandomString(6),
+		Before:   json.RawMessage(`{"name":"a"}`),
+		After:    json.RawMessage(`{"name":"b"}`),
+		Diff:     json.RawMessage(`{"name":{"from":"a","to":"b"}}`),
+		TenantID: 1,
+	}
+
+	record, err := testQueries.CreateAuditRecord(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, record)
+	require.Equal(t, record.Actor, arg.Actor)
+	require.Equal(t, record.EntityID, arg.EntityID)
+	require.NotZero(t, record.ID)
+	require.NotZero(t, record.CreatedAt)
+	return record
+}
+
+func TestCreateAuditRecord(t *testing.T) {
+	createRandomAuditRecord(t)
+}
+
+func TestListAuditRecords(t *testing.T) {
+	record := createRandomAuditRecord(t)
+	arg := ListAuditRecordsParams{
+		TenantID:  record.TenantID,
+		Entity:    sql.NullString{String: record.Entity, Valid: true},
+		EntityID:  sql.NullString{String: record.EntityID, Valid: true},
+		Actor:     sql.NullString{String: record.Actor, Valid: true},
+		FromTime:  sql.NullTime{Time: record.CreatedAt.Add(-time.Minute), Valid: true},
+		RowLimit:  10,
+		RowOffset: 0,
+	}
+	records, err := testQueries.ListAuditRecords(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, records[0].ID, record.ID)
+}
+
+func TestAuditRecordIsAppendOnly(t *testing.T) {
+	record := createRandomAuditRecord(t)
+	_, err := testDB.Exec("DELETE FROM audit_log WHERE id = $1", record.ID)
+	require.Error(t, err)
+}
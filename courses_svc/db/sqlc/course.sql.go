@@ -7,60 +7,155 @@ package db
 
 import (
 	"context"
+
+	"github.com/lib/pq"
 )
 
 const createCourse = `-- name: CreateCourse :one
 INSERT INTO Courses (
-  name
+  name, tenant_id
 ) VALUES (
-  $1
+  $1, $2
 )
-RETURNING id, name, created_at
+RETURNING id, name, created_at, version, tenant_id
 `
 
-func (q *Queries) CreateCourse(ctx context.Context, name string) (Course, error) {
-	row := q.db.QueryRowContext(ctx, createCourse, name)
+type CreateCourseParams struct {
+	Name     string
+	TenantID int64
+}
+
+func (q *Queries) CreateCourse(ctx context.Context, arg CreateCourseParams) (Course, error) {
+	row := q.db.QueryRowContext(ctx, createCourse, arg.Name, arg.TenantID)
 	var i Course
-	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
+	)
 	return i, err
 }
 
 const deleteCourse = `-- name: DeleteCourse :exec
 DELETE FROM Courses
-WHERE id = $1
+WHERE tenant_id = $1 AND id = $2
 `
 
-func (q *Queries) DeleteCourse(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteCourse, id)
+type DeleteCourseParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) DeleteCourse(ctx context.Context, arg DeleteCourseParams) error {
+	_, err := q.db.ExecContext(ctx, deleteCourse, arg.TenantID, arg.ID)
 	return err
 }
 
 const getCourse = `-- name: GetCourse :one
-SELECT id, name, created_at FROM Courses
-WHERE id = $1 LIMIT 1
+SELECT id, name, created_at, version, tenant_id FROM Courses
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
+`
+
+type GetCourseParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) GetCourse(ctx context.Context, arg GetCourseParams) (Course, error) {
+	row := q.db.QueryRowContext(ctx, getCourse, arg.TenantID, arg.ID)
+	var i Course
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getCourseForUpdate = `-- name: GetCourseForUpdate :one
+SELECT id, name, created_at, version, tenant_id FROM Courses
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
+FOR UPDATE
 `
 
-func (q *Queries) GetCourse(ctx context.Context, id int64) (Course, error) {
-	row := q.db.QueryRowContext(ctx, getCourse, id)
+type GetCourseForUpdateParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) GetCourseForUpdate(ctx context.Context, arg GetCourseForUpdateParams) (Course, error) {
+	row := q.db.QueryRowContext(ctx, getCourseForUpdate, arg.TenantID, arg.ID)
 	var i Course
-	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
+	)
 	return i, err
 }
 
+const getCoursesByIDs = `-- name: GetCoursesByIDs :many
+SELECT id, name, created_at, version, tenant_id FROM Courses
+WHERE tenant_id = $1 AND id = ANY($2::bigint[])
+ORDER BY id
+`
+
+type GetCoursesByIDsParams struct {
+	TenantID int64
+	Ids      []int64
+}
+
+func (q *Queries) GetCoursesByIDs(ctx context.Context, arg GetCoursesByIDsParams) ([]Course, error) {
+	rows, err := q.db.QueryContext(ctx, getCoursesByIDs, arg.TenantID, pq.Array(arg.Ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Course
+	for rows.Next() {
+		var i Course
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Version,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listCourses = `-- name: ListCourses :many
-SELECT id, name, created_at FROM Courses
+SELECT id, name, created_at, version, tenant_id FROM Courses
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2
+LIMIT $2
+OFFSET $3
 `
 
 type ListCoursesParams struct {
-	Limit  int32
-	Offset int32
+	TenantID int64
+	Limit    int32
+	Offset   int32
 }
 
 func (q *Queries) ListCourses(ctx context.Context, arg ListCoursesParams) ([]Course, error) {
-	rows, err := q.db.QueryContext(ctx, listCourses, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listCourses, arg.TenantID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +163,13 @@ func (q *Queries) ListCourses(ctx context.Context, arg ListCoursesParams) ([]Cou
 	var items []Course
 	for rows.Next() {
 		var i Course
-		if err := rows.Scan(&i.ID, &i.Name, &i.CreatedAt); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Version,
+			&i.TenantID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -84,19 +185,33 @@ func (q *Queries) ListCourses(ctx context.Context, arg ListCoursesParams) ([]Cou
 
 const updateCourse = `-- name: UpdateCourse :one
 UPDATE Courses
-  set name = $2
-WHERE id = $1
-RETURNING id, name, created_at
+  set name = $2,
+  version = version + 1
+WHERE id = $1 AND version = $3 AND tenant_id = $4
+RETURNING id, name, created_at, version, tenant_id
 `
 
 type UpdateCourseParams struct {
-	ID   int64
-	Name string
+	ID       int64
+	Name     string
+	Version  int64
+	TenantID int64
 }
 
 func (q *Queries) UpdateCourse(ctx context.Context, arg UpdateCourseParams) (Course, error) {
-	row := q.db.QueryRowContext(ctx, updateCourse, arg.ID, arg.Name)
+	row := q.db.QueryRowContext(ctx, updateCourse,
+		arg.ID,
+		arg.Name,
+		arg.Version,
+		arg.TenantID,
+	)
 	var i Course
-	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
+	)
 	return i, err
 }
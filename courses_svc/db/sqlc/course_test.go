@@ -3,15 +3,22 @@ package db
 import (
 	"context"
 	"courses/utils"
+	"database/sql"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func createRandomCourse(t *testing.T) Course {
-	Course, err := testQueries.CreateCourse(context.Background(), utils.RandomName())
+	arg := CreateCourseParams{
+		Name:     utils.RandomName(),
+		TenantID: 1,
+	}
+
+	Course, err := testQueries.CreateCourse(context.Background(), arg)
 	require.NoError(t, err)
 	require.NotEmpty(t, Course)
+	require.Equal(t, Course.TenantID, arg.TenantID)
 	require.NotZero(t, Course.ID)
 	require.NotZero(t, Course.CreatedAt)
 	return Course
@@ -25,25 +32,29 @@ func TestGetCourse(t *testing.T) {
 	Course := createRandomCourse(t)
 	id := Course.ID
 
-	Course, err := testQueries.GetCourse(context.Background(), id)
+	Course, err := testQueries.GetCourse(context.Background(), GetCourseParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 	require.NotEmpty(t, Course)
 	require.Equal(t, Course.ID, id)
 
+	_, err = testQueries.GetCourse(context.Background(), GetCourseParams{TenantID: 2, ID: id})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
 }
 
 func TestDeleteCourse(t *testing.T) {
 	Course := createRandomCourse(t)
 	id := Course.ID
 
-	err := testQueries.DeleteCourse(context.Background(), id)
+	err := testQueries.DeleteCourse(context.Background(), DeleteCourseParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 }
 
 func TestListCourses(t *testing.T) {
 	arg := ListCoursesParams{
-		Limit:  0,
-		Offset: 100,
+		TenantID: 1,
+		Limit:    0,
+		Offset:   100,
 	}
 	_, err := testQueries.ListCourses(context.Background(), arg)
 	require.NoError(t, err)
@@ -53,8 +64,10 @@ func TestListCourses(t *testing.T) {
 func TestUpdateCourse(t *testing.T) {
 	Course := createRandomCourse(t)
 	arg := UpdateCourseParams{
-		ID:   Course.ID,
-		Name: Course.Name,
+		ID:       Course.ID,
+		Name:     Course.Name,
+		Version:  Course.Version,
+		TenantID: Course.TenantID,
 	}
 
 	CourseResult, err := testQueries.UpdateCourse(context.Background(), arg)
@@ -62,4 +75,33 @@ func TestUpdateCourse(t *testing.T) {
 	require.NotEmpty(t, Course)
 	require.Equal(t, CourseResult.Name, arg.Name)
 	require.Equal(t, CourseResult.CreatedAt, Course.CreatedAt)
+	require.Equal(t, CourseResult.Version, Course.Version+1)
+}
+
+func TestUpdateCourseVersionMismatch(t *testing.T) {
+	Course := createRandomCourse(t)
+	arg := UpdateCourseParams{
+		ID:       Course.ID,
+		Name:     utils.RandomName(),
+		Version:  Course.Version + 1,
+		TenantID: Course.TenantID,
+	}
+
+	_, err := testQueries.UpdateCourse(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestGetCoursesByIDs(t *testing.T) {
+	course1 := createRandomCourse(t)
+	course2 := createRandomCourse(t)
+
+	arg := GetCoursesByIDsParams{
+		TenantID: 1,
+		Ids:      []int64{course2.ID, course1.ID, -1},
+	}
+	courses, err := testQueries.GetCoursesByIDs(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, courses, 2)
+	require.Equal(t, courses[0].ID, course1.ID)
+	require.Equal(t, courses[1].ID, course2.ID)
 }
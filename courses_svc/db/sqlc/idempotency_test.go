@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"courses/utils"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomIdempotencyKey(t *testing.T) IdempotencyKey {
+	arg := CreateIdempotencyKeyParams{
+		TenantID:    1,
+		Actor:       utils.RandomName(),
+		Key:         utils.RandomString(32),
+		RequestHash: utils.RandomString(64),
+	}
+
+	key, err := testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, key.Key, arg.Key)
+	require.Equal(t, key.Actor, arg.Actor)
+	require.Equal(t, key.RequestHash, arg.RequestHash)
+	require.Zero(t, key.StatusCode)
+	require.NotZero(t, key.CreatedAt)
+	return key
+}
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	createRandomIdempotencyKey(t)
+}
+
+func TestCreateIdempotencyKeyConflict(t *testing.T) {
+	key := createRandomIdempotencyKey(t)
+	arg := CreateIdempotencyKeyParams{
+		TenantID:    key.TenantID,
+		Actor:       key.Actor,
+		Key:         key.Key,
+		RequestHash: key.RequestHash,
+	}
+
+	_, err := testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Keys are unique per tenant and actor.
+	arg.TenantID = 2
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+
+	arg.TenantID = key.TenantID
+	arg.Actor = key.Actor + "2"
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), arg)
+	require.NoError(t, err)
+}
+
+func TestSaveIdempotentResponse(t *testing.T) {
+	key := createRandomIdempotencyKey(t)
+	arg := SaveIdempotentResponseParams{
+		TenantID:        key.TenantID,
+		Actor:           key.Actor,
+		Key:             key.Key,
+		StatusCode:      200,
+		ResponseHeaders: json.RawMessage(`{"Content-Type":"application/json"}`),
+		ResponseBody:    []byte(`{"id":1}`),
+	}
+
+	err := testQueries.SaveIdempotentResponse(context.Background(), arg)
+	require.NoError(t, err)
+
+	stored, err := testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{TenantID: key.TenantID, Actor: key.Actor, Key: key.Key})
+	require.NoError(t, err)
+	require.Equal(t, stored.StatusCode, arg.StatusCode)
+	require.Equal(t, stored.ResponseBody, arg.ResponseBody)
+}
+
+func TestDeleteExpiredIdempotencyKeys(t *testing.T) {
+	key := createRandomIdempotencyKey(t)
+
+	err := testQueries.DeleteExpiredIdempotencyKeys(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = testQueries.GetIdempotencyKey(context.Background(), GetIdempotencyKeyParams{TenantID: key.TenantID, Actor: key.Actor, Key: key.Key})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
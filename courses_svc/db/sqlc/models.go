@@ -5,11 +5,39 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 )
 
+type AuditLog struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    json.RawMessage
+	After     json.RawMessage
+	Diff      json.RawMessage
+	CreatedAt time.Time
+	TenantID  int64
+}
+
 type Course struct {
 	ID        int64
 	Name      string
 	CreatedAt time.Time
+	Version   int64
+	TenantID  int64
+}
+
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string
+	// 0 while the original request is in progress
+	StatusCode      int32
+	ResponseHeaders json.RawMessage
+	ResponseBody    []byte
+	CreatedAt       time.Time
+	TenantID        int64
+	Actor           string
 }
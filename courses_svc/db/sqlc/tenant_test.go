@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRowLevelSecurity checks that a role that does not own the tables only
+// reads the rows of the tenant set in app.tenant_id, and none without one.
+func TestRowLevelSecurity(t *testing.T) {
+	course := createRandomCourse(t)
+
+	tx, err := testDB.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.Exec("createRandomCourse(t) ROLE lms_tenant_test NOLOGIN")
+	require.NoError(t, err)
+	_, err = tx.Exec("GRANT SELECT ON courses TO lms_tenant_test")
+	require.NoError(t, err)
+	_, err = tx.Exec("SET LOCAL ROLE lms_tenant_test")
+	require.NoError(t, err)
+	q := New(tx)
+	arg := GetCourseParams{
+		TenantID: course.TenantID,
+		ID:       course.ID,
+	}
+
+	_, err = q.GetCourse(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = tx.Exec("SELECT set_config('app.tenant_id', '2', true)")
+	require.NoError(t, err)
+	_, err = q.GetCourse(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = tx.Exec("SELECT set_config('app.tenant_id', $1, true)", strconv.FormatInt(course.TenantID, 10))
+	require.NoError(t, err)
+	got, err := q.GetCourse(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, course.ID, got.ID)
+}
@@ -0,0 +1,100 @@
+// Package discovery finds the instances of the other services and
+// registers this one.
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
+	"github.com/go-kit/kit/sd/dnssrv"
+	"github.com/go-kit/log"
+	"github.com/hashicorp/consul/api"
+)
+
+// dnsSRVScheme prefixes addresses that are resolved by DNS SRV lookups,
+// e.g. dnssrv://_students._tcp.service.consul.
+const dnsSRVScheme = "dnssrv://"
+
+// dnsSRVTTL is how often DNS SRV records are resolved again.
+const dnsSRVTTL = 30 * time.Second
+
+// NewConsulClient connects to the Consul agent at address.
+func NewConsulClient(address string) (consulsd.Client, error) {
+	config := api.DefaultConfig()
+	config.Address = address
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return consulsd.NewClient(client), nil
+}
+
+// NewInstancer returns the instances of service. They are watched in Consul
+// when client is not nil. Otherwise addresses is either a DNS SRV name
+// prefixed with dnssrv:// or a comma separated list of host:port.
+func NewInstancer(client consulsd.Client, service, addresses string, logger log.Logger) sd.Instancer {
+	if client != nil {
+		return consulsd.NewInstancer(client, logger, service, nil, true)
+	}
+	if strings.HasPrefix(addresses, dnsSRVScheme) {
+		return dnssrv.NewInstancer(strings.TrimPrefix(addresses, dnsSRVScheme), dnsSRVTTL, logger)
+	}
+
+	var instances []string
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			instances = append(instances, address)
+		}
+	}
+	return sd.FixedInstancer(instances)
+}
+
+// NewRegistrar returns a registrar of this instance of service, reachable at
+// address (host:port). Consul only passes on the instance while its /readyz
+// succeeds and removes it when it stays unhealthy.
+func NewRegistrar(client consulsd.Client, service, address string, logger log.Logger) (sd.Registrar, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+
+	return consulsd.NewRegistrar(client, &api.AgentServiceRegistration{
+		ID:      service + "-" + strings.ReplaceAll(address, ":", "-"),
+		Name:    service,
+		Address: host,
+		Port:    port,
+		Check: &api.AgentServiceCheck{
+			HTTP:                           "http://" + address + "/readyz",
+			Interval:                       "10s",
+			Timeout:                        "2s",
+			DeregisterCriticalServiceAfter: "1m",
+		},
+	}, logger), nil
+}
+
+// AdvertiseAddress returns address, or the hostname with the port of
+// listenAddr when address is empty.
+func AdvertiseAddress(address, listenAddr string) (string, error) {
+	if address != "" {
+		return address, nil
+	}
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "", err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,123 @@
+// Package health serves the liveness and readiness endpoints of the
+// service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout bounds every readiness check.
+const CheckTimeout = 2 * time.Second
+
+// Check reports whether a dependency of the service is usable.
+type Check func(ctx context.Context) error
+
+// Health holds the readiness checks of the service.
+type Health struct {
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]Check
+	draining int32
+}
+
+// New returns a Health without checks.
+func New() *Health {
+	return &Health{checks: make(map[string]Check)}
+}
+
+// Add registers the readiness check name.
+func (h *Health) Add(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Drain makes the service report not ready, so that it gets no new
+// requests while shutting down.
+func (h *Health) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Status runs all checks and returns their results by name, "ok" or the
+// error, and whether the service is ready.
+func (h *Health) Status(ctx context.Context) (map[string]string, bool) {
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.RUnlock()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			results[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	status := make(map[string]string, len(names))
+	ready := atomic.LoadInt32(&h.draining) == 0
+	if !ready {
+		status["shutdown"] = "draining"
+	}
+	for i, name := range names {
+		if results[i] != nil {
+			status[name] = results[i].Error()
+			ready = false
+			continue
+		}
+		status[name] = "ok"
+	}
+	return status, ready
+}
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Liveness answers 200 as long as the process serves requests.
+func (h *Health) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, response{Status: "ok"})
+}
+
+// Readiness answers 200 when all checks pass and 503 otherwise.
+func (h *Health) Readiness(w http.ResponseWriter, r *http.Request) {
+	checks, ready := h.Status(r.Context())
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, response{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeJSON(w, http.StatusOK, response{Status: "ok", Checks: checks})
+}
+
+// Handler serves /healthz and /readyz, and passes the other requests to
+// next.
+func (h *Health) Handler(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.Liveness)
+	mux.HandleFunc("/readyz", h.Readiness)
+	mux.Handle("/", next)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
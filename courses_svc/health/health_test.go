@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/stretchr/testify/require"
+)
+
+func readiness(t *testing.T, h *Health) int {
+	rec := httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestReadiness(t *testing.T) {
+	h := New()
+	var failing error
+	h.Add("db", func(context.Context) error { return failing })
+	require.Equal(t, http.StatusOK, readiness(t, h))
+
+	failing = errors.New("connection refused")
+	require.Equal(t, http.StatusServiceUnavailable, readiness(t, h))
+	checks, ready := h.Status(context.Background())
+	require.False(t, ready)
+	require.Equal(t, "connection refused", checks["db"])
+
+	failing = nil
+	h.Drain()
+	require.Equal(t, http.StatusServiceUnavailable, readiness(t, h))
+}
+
+func TestDownstreamCheck(t *testing.T) {
+	alive := httptest.NewServer(New().Handler(http.NotFoundHandler()))
+	defer alive.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	defer dead.Close()
+
+	// The instances are received in the background.
+	check := DownstreamCheck(sd.FixedInstancer{dead.URL, alive.URL}, http.DefaultClient)
+	require.Eventually(t, func() bool {
+		return check(context.Background()) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	check = DownstreamCheck(sd.FixedInstancer{dead.URL}, http.DefaultClient)
+	require.Error(t, check(context.Background()))
+
+	check = DownstreamCheck(sd.FixedInstancer{}, http.DefaultClient)
+	require.Error(t, check(context.Background()))
+}
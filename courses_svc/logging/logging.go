@@ -0,0 +1,125 @@
+// Package logging builds the structured JSON logger of the service and
+// correlates log lines with requests and traces.
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// levels ranks the level names, lines without a level are logged at info.
+var levels = map[string]int32{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+// ErrInvalidLevel is returned for unknown level names.
+var ErrInvalidLevel = errors.New("invalid log level, want debug, info, warn or error")
+
+// Level is the minimum level of the logged lines. It can be changed while
+// the service runs.
+type Level struct {
+	rank int32
+}
+
+// NewLevel returns the level called name, info when name is empty.
+func NewLevel(name string) (*Level, error) {
+	l := &Level{rank: levels["info"]}
+	if name == "" {
+		return l, nil
+	}
+	return l, l.Set(name)
+}
+
+// Set changes the level to name.
+func (l *Level) Set(name string) error {
+	rank, ok := levels[strings.ToLower(name)]
+	if !ok {
+		return ErrInvalidLevel
+	}
+	atomic.StoreInt32(&l.rank, rank)
+	return nil
+}
+
+func (l *Level) String() string {
+	rank := atomic.LoadInt32(&l.rank)
+	for name, r := range levels {
+		if r == rank {
+			return name
+		}
+	}
+	return "info"
+}
+
+func (l *Level) allows(keyvals []interface{}) bool {
+	rank := levels["info"]
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == level.Key() {
+			if v, ok := keyvals[i+1].(level.Value); ok {
+				rank = levels[v.String()]
+			}
+			break
+		}
+	}
+	return rank >= atomic.LoadInt32(&l.rank)
+}
+
+// New returns a JSON logger writing to w. Lines below lvl are dropped.
+func New(w io.Writer, lvl *Level) log.Logger {
+	var logger log.Logger
+	logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	logger = &filter{next: logger, level: lvl}
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller)
+	return logger
+}
+
+type filter struct {
+	next  log.Logger
+	level *Level
+}
+
+func (f *filter) Log(keyvals ...interface{}) error {
+	if !f.level.allows(keyvals) {
+		return nil
+	}
+	return f.next.Log(keyvals...)
+}
+
+// LevelHandler serves the level: GET returns it, PUT changes it from a
+// body like {"level":"debug"}.
+func LevelHandler(lvl *Level, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := lvl.Set(body.Level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			level.Warn(logger).Log("msg", "log level changed", "level", lvl.String())
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]string{"level": lvl.String()})
+	})
+}
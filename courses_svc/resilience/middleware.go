@@ -0,0 +1,229 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"courses/auth"
+
+	"github.com/go-kit/kit/circuitbreaker"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/sony/gobreaker"
+	"golang.org/x/time/rate"
+)
+
+// Middleware wraps an endpoint with the rate limiters, retries, timeout and
+// circuit breaker configured by policy. The state of the breaker is
+// reported to breakerState, and the failed responses counted by it are
+// chosen by failure, see Breaker.
+func Middleware(name string, policy Policy, breakerState metrics.Gauge, failure func(error) bool) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		// Requests rejected by the limiters don't count as failures of the
+		// breaker, so the breaker sits below them.
+		next = Breaker(name, policy.Breaker, breakerState, failure)(next)
+		return Guard(policy)(next)
+	}
+}
+
+// Guard wraps an endpoint with the rate limiters, retries and timeout
+// configured by policy, but no circuit breaker. It is used above a load
+// balancer whose instances have their own breakers. The timeout applies to
+// every attempt and is bounded by the deadline of the incoming context.
+func Guard(policy Policy) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if policy.Timeout > 0 {
+			next = timeout(policy.Timeout)(next)
+		}
+		if policy.Retries > 0 {
+			next = retry(policy.Retries, policy.RetryBackoff, policy.RetryMaxBackoff)(next)
+		}
+		if policy.TokenRateLimit > 0 {
+			next = keyedLimiter(rate.Limit(policy.TokenRateLimit), policy.TokenBurst, tokenKey)(next)
+		}
+		if policy.ClientRateLimit > 0 {
+			next = keyedLimiter(rate.Limit(policy.ClientRateLimit), policy.ClientBurst, clientKey)(next)
+		}
+		if policy.RateLimit > 0 {
+			next = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(policy.RateLimit), policy.Burst))(next)
+		}
+		return next
+	}
+}
+
+// Breaker wraps an endpoint with a circuit breaker. Its state is reported to
+// breakerState, labelled by name: 0 closed, 1 half-open, 2 open. Besides the
+// errors of the endpoint, the breaker counts the responses that failed
+// (endpoint.Failer) with an error for which failure returns true, such as a
+// database error; with a nil failure, only the errors are counted.
+func Breaker(name string, policy BreakerPolicy, breakerState metrics.Gauge, failure func(error) bool) endpoint.Middleware {
+	gauge := breakerState.With("endpoint", name)
+	gauge.Set(float64(gobreaker.StateClosed))
+	breaker := circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: policy.MaxRequests,
+		Interval:    policy.Interval,
+		Timeout:     policy.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return policy.ConsecutiveFailures > 0 && counts.ConsecutiveFailures >= policy.ConsecutiveFailures
+		},
+		OnStateChange: func(_ string, _ gobreaker.State, to gobreaker.State) {
+			gauge.Set(float64(to))
+		},
+	}))
+	if failure == nil {
+		return breaker
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		// The failed response is reported to the breaker as an error, and
+		// passed on as the response it is.
+		counted := breaker(func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if f, ok := response.(endpoint.Failer); ok && err == nil && f.Failed() != nil && failure(f.Failed()) {
+				return response, failedResponse{f.Failed()}
+			}
+			return response, err
+		})
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := counted(ctx, request)
+			if _, ok := err.(failedResponse); ok {
+				return response, nil
+			}
+			return response, err
+		}
+	}
+}
+
+// failedResponse is the error a failed response is counted with by the
+// breaker.
+type failedResponse struct {
+	error
+}
+
+func timeout(d time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
+
+// retry calls next again when it fails with a transport error, as long as
+// the context is not done. Behind a load balancer, the next attempt goes to
+// the next instance. Attempts are spaced
+// by an exponential backoff with full jitter: the n-th retry waits a random
+// duration up to min(maxBackoff, backoff*2^n).
+func retry(retries int, backoff, maxBackoff time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			for attempt := 0; ; attempt++ {
+				response, err = next(ctx, request)
+				if err == nil || attempt == retries || !retryable(err) {
+					return
+				}
+
+				wait := backoff << attempt
+				if maxBackoff > 0 && (wait > maxBackoff || wait < backoff) {
+					wait = maxBackoff
+				}
+				if wait <= 0 {
+					continue
+				}
+				timer := time.NewTimer(time.Duration(rand.Int63n(int64(wait) + 1)))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// retryable reports whether a request that failed with err may succeed when
+// sent again.
+func retryable(err error) bool {
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+	return true
+}
+
+// limiterIdleTimeout is how long the limiter of an idle caller is kept.
+const limiterIdleTimeout = 10 * time.Minute
+
+type keyedLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// keyedLimiter limits the requests of every caller, as identified by
+// keyFunc, separately.
+func keyedLimiter(limit rate.Limit, burst int, keyFunc func(context.Context) string) endpoint.Middleware {
+	var (
+		mu        sync.Mutex
+		limiters  = make(map[string]*keyedLimiterEntry)
+		lastSweep = time.Now()
+	)
+	allow := func(key string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		if now.Sub(lastSweep) > limiterIdleTimeout {
+			for k, e := range limiters {
+				if now.Sub(e.lastSeen) > limiterIdleTimeout {
+					delete(limiters, k)
+				}
+			}
+			lastSweep = now
+		}
+		e, ok := limiters[key]
+		if !ok {
+			e = &keyedLimiterEntry{limiter: rate.NewLimiter(limit, burst)}
+			limiters[key] = e
+		}
+		e.lastSeen = now
+		return e.limiter.Allow()
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !allow(keyFunc(ctx)) {
+				return nil, ratelimit.ErrLimited
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// clientKey identifies the caller by IP address, as resolved by
+// ClientAddressMiddleware. Without it, the address the request comes from is
+// used; it relies on httptransport.PopulateRequestContext.
+func clientKey(ctx context.Context) string {
+	if addr, ok := ctx.Value(clientAddressKey).(string); ok {
+		return addr
+	}
+	addr, _ := ctx.Value(httptransport.ContextKeyRequestRemoteAddr).(string)
+	return remoteHost(addr)
+}
+
+// tokenKey identifies the caller by username or OAuth2 client, falling
+// back to the IP address for anonymous requests.
+func tokenKey(ctx context.Context) string {
+	if payload, ok := auth.FromContext(ctx); ok {
+		if payload.Username == "" {
+			return "client:" + payload.ClientID
+		}
+		return "user:" + payload.Username
+	}
+	return "ip:" + clientKey(ctx)
+}
@@ -0,0 +1,102 @@
+package resilience
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Policy configures the middlewares wrapped around a single endpoint.
+// A zero rate limit disables the corresponding limiter.
+type Policy struct {
+	// RateLimit is the number of requests per second allowed over all callers
+	RateLimit float64 `mapstructure:"rate_limit"`
+	Burst     int     `mapstructure:"burst"`
+	// ClientRateLimit is the number of requests per second allowed per client IP
+	ClientRateLimit float64 `mapstructure:"client_rate_limit"`
+	ClientBurst     int     `mapstructure:"client_burst"`
+	// TokenRateLimit is the number of requests per second allowed per
+	// authenticated user; anonymous requests are limited per client IP
+	TokenRateLimit float64       `mapstructure:"token_rate_limit"`
+	TokenBurst     int           `mapstructure:"token_burst"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	// Retries must only be set for idempotent endpoints
+	Retries         int           `mapstructure:"retries"`
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+	RetryMaxBackoff time.Duration `mapstructure:"retry_max_backoff"`
+	Breaker         BreakerPolicy `mapstructure:"breaker"`
+}
+
+// BreakerPolicy configures the circuit breaker of an endpoint, see
+// gobreaker.Settings.
+type BreakerPolicy struct {
+	MaxRequests uint32        `mapstructure:"max_requests"`
+	Interval    time.Duration `mapstructure:"interval"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	// ConsecutiveFailures trips the breaker after that many failures in a row
+	ConsecutiveFailures uint32 `mapstructure:"consecutive_failures"`
+}
+
+// Config holds the policies of all endpoints. Endpoints without their own
+// policy use Default; the fields of an endpoint policy override the default.
+type Config struct {
+	Default   Policy
+	Endpoints map[string]Policy
+}
+
+// DefaultPolicy is used when no resilience config file is provided.
+var DefaultPolicy = Policy{
+	RateLimit:       100,
+	Burst:           100,
+	ClientRateLimit: 10,
+	ClientBurst:     20,
+	Timeout:         5 * time.Second,
+	RetryBackoff:    100 * time.Millisecond,
+	RetryMaxBackoff: 2 * time.Second,
+	Breaker: BreakerPolicy{
+		MaxRequests:         1,
+		Timeout:             60 * time.Second,
+		ConsecutiveFailures: 5,
+	},
+}
+
+// Policy returns the policy of the endpoint name.
+func (c Config) Policy(name string) Policy {
+	if p, ok := c.Endpoints[strings.ToLower(name)]; ok {
+		return p
+	}
+	return c.Default
+}
+
+// LoadConfig reads the resilience policies from a YAML file. When path is
+// empty, DefaultPolicy is used for every endpoint.
+func LoadConfig(path string) (config Config, err error) {
+	config = Config{Default: DefaultPolicy, Endpoints: map[string]Policy{}}
+	if path == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err = v.ReadInConfig(); err != nil {
+		return
+	}
+
+	if err = v.UnmarshalKey("default", &config.Default); err != nil {
+		return
+	}
+	for name := range v.GetStringMap("endpoints") {
+		p := config.Default
+		if err = v.UnmarshalKey("endpoints."+name, &p); err != nil {
+			return
+		}
+		config.Endpoints[strings.ToLower(name)] = p
+	}
+	if config.Default.Breaker.ConsecutiveFailures == 0 {
+		err = errors.New("default breaker consecutive_failures must be greater than 0")
+	}
+	return
+}
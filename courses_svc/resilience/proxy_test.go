@@ -0,0 +1,73 @@
+package resilience
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.168.1.1 ,,::1")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+	require.Equal(t, "10.0.0.0/8", proxies[0].String())
+	require.Equal(t, "192.168.1.1/32", proxies[1].String())
+	require.Equal(t, "::1/128", proxies[2].String())
+
+	proxies, err = ParseTrustedProxies("")
+	require.NoError(t, err)
+	require.Empty(t, proxies)
+
+	_, err = ParseTrustedProxies("proxy.local")
+	require.Error(t, err)
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	require.Error(t, err)
+}
+
+func TestClientAddressMiddleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		client     string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", client: "203.0.113.7"},
+		{name: "forged header", remoteAddr: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, client: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.1"}, client: "198.51.100.1"},
+		{name: "forged through proxy", remoteAddr: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, 198.51.100.1"}, client: "198.51.100.1"},
+		{name: "chain of proxies", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.1, 10.0.0.3", "10.0.0.4"}, client: "198.51.100.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.2:5000", forwarded: []string{"10.0.0.3"}, client: "10.0.0.3"},
+		{name: "proxy without header", remoteAddr: "10.0.0.2:5000", client: "10.0.0.2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var client string
+			handler := ClientAddressMiddleware(proxies)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				client = clientKey(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, forwarded := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", forwarded)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			require.Equal(t, tc.client, client)
+		})
+	}
+}
+
+func TestClientKeyIgnoresForwardedFor(t *testing.T) {
+	// Without ClientAddressMiddleware, the header is never trusted.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	ctx := httptransport.PopulateRequestContext(context.Background(), req)
+	require.Equal(t, "203.0.113.7", clientKey(ctx))
+}
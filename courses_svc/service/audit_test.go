@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"courses/auth"
+	"courses/resilience"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONDiff(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before string
+		after  string
+		diff   string
+	}{
+		{
+			name:   "create",
+			before: `null`,
+			after:  `{"id":1,"name":"Math"}`,
+			diff:   `{"id":{"from":null,"to":1},"name":{"from":null,"to":"Math"}}`,
+		},
+		{
+			name:   "delete",
+			before: `{"id":1,"name":"Math"}`,
+			after:  `null`,
+			diff:   `{"id":{"from":1,"to":null},"name":{"from":"Math","to":null}}`,
+		},
+		{
+			name:   "changed field",
+			before: `{"id":1,"name":"Algebra","version":1}`,
+			after:  `{"id":1,"name":"Math","version":2}`,
+			diff:   `{"name":{"from":"Algebra","to":"Math"},"version":{"from":1,"to":2}}`,
+		},
+		{
+			name:   "nested object",
+			before: `{"schedule":{"day":"mon","room":"101"}}`,
+			after:  `{"schedule":{"day":"tue","room":"101"}}`,
+			diff:   `{"schedule":{"from":{"day":"mon","room":"101"},"to":{"day":"tue","room":"101"}}}`,
+		},
+		{
+			name:   "unchanged",
+			before: `{"id":1,"name":"Math"}`,
+			after:  `{"name":"Math","id":1}`,
+			diff:   `{}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := jsonDiff([]byte(tc.before), []byte(tc.after))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.diff, string(diff))
+		})
+	}
+}
+
+// tenantAuditService returns the audit records of the tenant of the caller
+// only.
+type tenantAuditService struct {
+	stubService
+}
+
+func (tenantAuditService) ListAuditRecords(ctx context.Context, _ AuditFilter) ([]AuditRecord, error) {
+	if tenantID, _ := auth.TenantID(ctx); tenantID != 2 || auth.Actor(ctx) != adminActor {
+		return []AuditRecord{}, nil
+	}
+	return stubService{}.ListAuditRecords(ctx, AuditFilter{})
+}
+
+func TestAdminAudit(t *testing.T) {
+	logger := log.NewNopLogger()
+	endpoints := MakeServerEndpoints(tenantAuditService{}, logger, discard.NewHistogram(), resilience.Config{}, discard.NewGauge())
+	public := MakeHTTPHandler(endpoints, logger)
+	admin := MakeAdminHTTPHandler(endpoints, logger)
+
+	testCases := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		status  int
+		records int
+	}{
+		{name: "public", handler: public, path: "/audit", status: http.StatusNotFound},
+		{name: "tenant", handler: admin, path: "/admin/audit?tenant_id=2&entity=course", status: http.StatusOK, records: 1},
+		{name: "other tenant", handler: admin, path: "/admin/audit?tenant_id=3", status: http.StatusOK},
+		{name: "no tenant", handler: admin, path: "/admin/audit", status: http.StatusBadRequest},
+		{name: "invalid tenant", handler: admin, path: "/admin/audit?tenant_id=0", status: http.StatusBadRequest},
+		{name: "invalid filter", handler: admin, path: "/admin/audit?tenant_id=2&from=yesterday", status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+			if tc.status != http.StatusOK {
+				return
+			}
+			var res listAuditRecordsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			require.Len(t, res.Records, tc.records)
+		})
+	}
+}
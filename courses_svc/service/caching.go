@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"courses/auth"
+	"courses/cache"
+	"courses/client"
+)
+
+// CachingMiddleware answers GetCourse from the cache while the entry is
+// fresh, and invalidates the entry whenever the course is updated or
+// deleted. The entries are kept per tenant and per numeric id, so that "01"
+// and "1" share an entry.
+func CachingMiddleware(courseCache cache.Cache, ttl time.Duration) Middleware {
+	return func(next Service) Service {
+		return cachingMiddleware{courseCache, ttl, next}
+	}
+}
+
+type cachingMiddleware struct {
+	cache cache.Cache
+	ttl   time.Duration
+	next  Service
+}
+
+func (mw cachingMiddleware) GetCourse(ctx context.Context, id string) (Course, error) {
+	key, ok := courseKey(ctx, id)
+	if !ok {
+		return mw.next.GetCourse(ctx, id)
+	}
+	if value, err := mw.cache.Get(ctx, key); err == nil {
+		var course Course
+		if err := json.Unmarshal(value, &course); err == nil {
+			return course, nil
+		}
+	}
+
+	course, err := mw.next.GetCourse(ctx, id)
+	if err != nil {
+		return course, err
+	}
+	if value, err := json.Marshal(course); err == nil {
+		mw.cache.Set(ctx, key, value, mw.ttl)
+	}
+	return course, nil
+}
+
+// GetCoursesByIDs answers the cached courses from the cache and asks the
+// service for the others only. The missing IDs are returned as numbers.
+// Without a tenant, the service is asked for every course, and refuses them.
+func (mw cachingMiddleware) GetCoursesByIDs(ctx context.Context, ids []string) ([]Course, []string, error) {
+	tenantID, ok := auth.TenantID(ctx)
+	if !ok {
+		return mw.next.GetCoursesByIDs(ctx, ids)
+	}
+	normalized := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		ID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return mw.next.GetCoursesByIDs(ctx, ids)
+		}
+		normalized = append(normalized, strconv.FormatInt(ID, 10))
+	}
+	ids = uniqueIDs(normalized)
+	if len(ids) > maxBatchSize {
+		return nil, nil, ErrTooManyIDs
+	}
+	cached := make(map[string]Course, len(ids))
+	misses := make([]string, 0, len(ids))
+	for _, id := range ids {
+		key, _ := courseKey(ctx, id)
+		if value, err := mw.cache.Get(ctx, key); err == nil {
+			var course Course
+			if err := json.Unmarshal(value, &course); err == nil {
+				cached[id] = course
+				continue
+			}
+		}
+		misses = append(misses, id)
+	}
+	if len(misses) == 0 {
+		return orderCourses(ids, cached), []string{}, nil
+	}
+
+	fetched, missing, err := mw.next.GetCoursesByIDs(ctx, misses)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, course := range fetched {
+		id := strconv.FormatInt(course.ID, 10)
+		cached[id] = course
+		if value, err := json.Marshal(course); err == nil {
+			mw.cache.Set(ctx, cache.CourseKey(tenantID, course.ID), value, mw.ttl)
+		}
+	}
+	return orderCourses(ids, cached), missing, nil
+}
+func (mw cachingMiddleware) GetCourseList(ctx context.Context, limit int, offset int) ([]Course, error) {
+	return mw.next.GetCourseList(ctx, limit, offset)
+}
+func (mw cachingMiddleware) CreateCourse(ctx context.Context, name string) (Course, error) {
+	return mw.next.CreateCourse(ctx, name)
+}
+func (mw cachingMiddleware) UpdateCourse(ctx context.Context, id string, course Course) (Course, error) {
+	mw.invalidate(ctx, id)
+	defer mw.invalidate(ctx, id)
+	return mw.next.UpdateCourse(ctx, id, course)
+}
+func (mw cachingMiddleware) PatchCourse(ctx context.Context, id string, patch []byte, version int64) (Course, error) {
+	mw.invalidate(ctx, id)
+	defer mw.invalidate(ctx, id)
+	return mw.next.PatchCourse(ctx, id, patch, version)
+}
+func (mw cachingMiddleware) DeleteCourse(ctx context.Context, id string) error {
+	mw.invalidate(ctx, id)
+	defer mw.invalidate(ctx, id)
+	return mw.next.DeleteCourse(ctx, id)
+}
+func (mw cachingMiddleware) GetCourseStudents(ctx context.Context, id string) ([]client.Student, error) {
+	return mw.next.GetCourseStudents(ctx, id)
+}
+func (mw cachingMiddleware) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	return mw.next.ListAuditRecords(ctx, filter)
+}
+
+// orderCourses returns the courses found in the order of ids.
+func orderCourses(ids []string, found map[string]Course) []Course {
+	list := make([]Course, 0, len(found))
+	for _, id := range ids {
+		if course, ok := found[id]; ok {
+			list = append(list, course)
+		}
+	}
+	return list
+}
+
+// invalidate deletes the entry of the course. It is called before the write,
+// so that the old course is not served while it runs, and after it, so that
+// the old course cached by a read racing with the write is dropped.
+func (mw cachingMiddleware) invalidate(ctx context.Context, id string) {
+	if key, ok := courseKey(ctx, id); ok {
+		mw.cache.Delete(ctx, key)
+	}
+}
+
+// courseKey returns the cache key of the course of the tenant of the caller,
+// or false when id is not a number or the caller has no tenant.
+func courseKey(ctx context.Context, id string) (string, bool) {
+	tenantID, ok := auth.TenantID(ctx)
+	if !ok {
+		return "", false
+	}
+	ID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return cache.CourseKey(tenantID, ID), true
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"courses/auth"
+	"courses/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingService serves the courses of a map and counts the reads. It
+// records whether the course was cached when its write started, and caches
+// the old course during the write, as a read racing with it would.
+type countingService struct {
+	stubService
+	cache         cache.Cache
+	courses       map[int64]Course
+	reads         int
+	cachedOnWrite bool
+}
+
+func newCountingService(courseCache cache.Cache) *countingService {
+	return &countingService{
+		cache: courseCache,
+		courses: map[int64]Course{
+			1: {ID: 1, Name: "Math", Version: 1},
+			2: {ID: 2, Name: "Physics", Version: 1},
+		},
+	}
+}
+
+func (s *countingService) GetCourse(_ context.Context, id string) (Course, error) {
+	s.reads++
+	ID, _ := strconv.ParseInt(id, 10, 64)
+	course, ok := s.courses[ID]
+	if !ok {
+		return Course{}, ErrNotFound
+	}
+	return course, nil
+}
+
+func (s *countingService) GetCoursesByIDs(_ context.Context, ids []string) ([]Course, []string, error) {
+	s.reads++
+	list := []Course{}
+	missing := []string{}
+	for _, id := range ids {
+		ID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInconsistentIDs
+		}
+		if course, ok := s.courses[ID]; ok {
+			list = append(list, course)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return list, missing, nil
+}
+
+func (s *countingService) write(ctx context.Context, id string) {
+	key, _ := courseKey(ctx, id)
+	_, err := s.cache.Get(ctx, key)
+	s.cachedOnWrite = err == nil
+	ID, _ := strconv.ParseInt(id, 10, 64)
+	course := s.courses[ID]
+	if value, err := json.Marshal(course); err == nil {
+		s.cache.Set(ctx, key, value, time.Minute)
+	}
+	course.Version++
+	s.courses[ID] = course
+}
+
+func (s *countingService) UpdateCourse(ctx context.Context, id string, _ Course) (Course, error) {
+	s.write(ctx, id)
+	return s.GetCourse(ctx, id)
+}
+
+func (s *countingService) PatchCourse(ctx context.Context, id string, _ []byte, _ int64) (Course, error) {
+	s.write(ctx, id)
+	return s.GetCourse(ctx, id)
+}
+
+func (s *countingService) DeleteCourse(ctx context.Context, id string) error {
+	s.write(ctx, id)
+	ID, _ := strconv.ParseInt(id, 10, 64)
+	delete(s.courses, ID)
+	return nil
+}
+
+func tenantContext(tenantID int64) context.Context {
+	return auth.NewContext(context.Background(), &auth.Payload{Username: "john", TenantID: tenantID})
+}
+
+func TestCachingGetCourse(t *testing.T) {
+	courseCache := cache.NewLRUCache(10)
+	next := newCountingService(courseCache)
+	svc := CachingMiddleware(courseCache, time.Minute)(next)
+	ctx := tenantContext(1)
+
+	course, err := svc.GetCourse(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Math", course.Name)
+	require.Equal(t, 1, next.reads)
+
+	// A hit, whatever the spelling of the id.
+	for _, id := range []string{"1", "01", "+1"} {
+		course, err = svc.GetCourse(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, "Math", course.Name)
+	}
+	require.Equal(t, 1, next.reads)
+
+	// Errors are not cached.
+	for i := 0; i < 2; i++ {
+		_, err = svc.GetCourse(ctx, "3")
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+	require.Equal(t, 3, next.reads)
+
+	// IDs that are not numbers are left to the service.
+	_, err = svc.GetCourse(ctx, "abc")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Equal(t, 4, next.reads)
+}
+
+func TestCachingPerTenant(t *testing.T) {
+	courseCache := cache.NewLRUCache(10)
+	next := newCountingService(courseCache)
+	svc := CachingMiddleware(courseCache, time.Minute)(next)
+
+	_, err := svc.GetCourse(tenantContext(1), "1")
+	require.NoError(t, err)
+	_, err = svc.GetCourse(tenantContext(2), "1")
+	require.NoError(t, err)
+	require.Equal(t, 2, next.reads)
+
+	// Callers without a tenant are never served from the cache.
+	_, err = svc.GetCourse(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, 3, next.reads)
+}
+
+func TestCachingGetCoursesByIDs(t *testing.T) {
+	courseCache := cache.NewLRUCache(10)
+	next := newCountingService(courseCache)
+	svc := CachingMiddleware(courseCache, time.Minute)(next)
+	ctx := tenantContext(1)
+
+	_, err := svc.GetCourse(ctx, "1")
+	require.NoError(t, err)
+
+	// Only the course that is not cached is read.
+	courses, missing, err := svc.GetCoursesByIDs(ctx, []string{"2", "01", "3", "1"})
+	require.NoError(t, err)
+	require.Equal(t, []Course{next.courses[2], next.courses[1]}, courses)
+	require.Equal(t, []string{"3"}, missing)
+	require.Equal(t, 2, next.reads)
+
+	courses, missing, err = svc.GetCoursesByIDs(ctx, []string{"1", "02"})
+	require.NoError(t, err)
+	require.Len(t, courses, 2)
+	require.Empty(t, missing)
+	require.Equal(t, 2, next.reads)
+
+	_, _, err = svc.GetCoursesByIDs(ctx, []string{"1", "abc"})
+	require.ErrorIs(t, err, ErrInconsistentIDs)
+}
+
+func TestCachingInvalidation(t *testing.T) {
+	testCases := []struct {
+		name  string
+		write func(svc Service, ctx context.Context, id string) error
+	}{
+		{
+			name: "update",
+			write: func(svc Service, ctx context.Context, id string) error {
+				_, err := svc.UpdateCourse(ctx, id, Course{Name: "Algebra", Version: anyVersion})
+				return err
+			},
+		},
+		{
+			name: "patch",
+			write: func(svc Service, ctx context.Context, id string) error {
+				_, err := svc.PatchCourse(ctx, id, []byte(`{"name":"Algebra"}`), anyVersion)
+				return err
+			},
+		},
+		{
+			name: "delete",
+			write: func(svc Service, ctx context.Context, id string) error {
+				return svc.DeleteCourse(ctx, id)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			courseCache := cache.NewLRUCache(10)
+			next := newCountingService(courseCache)
+			svc := CachingMiddleware(courseCache, time.Minute)(next)
+			ctx := tenantContext(1)
+
+			_, err := svc.GetCourse(ctx, "1")
+			require.NoError(t, err)
+
+			// The entry is deleted before and after the write, whatever
+			// the spelling of the id.
+			require.NoError(t, tc.write(svc, ctx, "01"))
+			require.False(t, next.cachedOnWrite)
+
+			key, _ := courseKey(ctx, "1")
+			_, err = courseCache.Get(ctx, key)
+			require.ErrorIs(t, err, cache.ErrCacheMiss)
+		})
+	}
+}
@@ -2,25 +2,27 @@ package service
 
 import (
 	"context"
-	"time"
 
+	"courses/auth"
 	"courses/client"
+	"courses/resilience"
+	"courses/tracing"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/log"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	_ endpoint.Failer = getCourseResponse{}
 	_ endpoint.Failer = getCourseListResponse{}
+	_ endpoint.Failer = getCoursesByIDsResponse{}
 	_ endpoint.Failer = createCourseResponse{}
 	_ endpoint.Failer = updateCourseResponse{}
+	_ endpoint.Failer = patchCourseResponse{}
 	_ endpoint.Failer = deleteCourseResponse{}
+	_ endpoint.Failer = listAuditRecordsResponse{}
 )
 
 type getCourseRequest struct {
@@ -32,6 +34,18 @@ type getCourseResponse struct {
 }
 
 func (r getCourseResponse) Failed() error { return r.Err }
+func (r getCourseResponse) ETag() string  { return formatETag(r.Course.Version) }
+
+type getCoursesByIDsRequest struct {
+	IDs []string
+}
+type getCoursesByIDsResponse struct {
+	Courses []Course `json:"courses"`
+	Missing []string `json:"missing"`
+	Err     error    `json:"error,omitempty"`
+}
+
+func (r getCoursesByIDsResponse) Failed() error { return r.Err }
 
 type getCourseListRequest struct {
 	Limit  int
@@ -54,6 +68,7 @@ type createCourseResponse struct {
 }
 
 func (r createCourseResponse) Failed() error { return r.Err }
+func (r createCourseResponse) ETag() string  { return formatETag(r.Course.Version) }
 
 type updateCourseRequest struct {
 	ID     string
@@ -65,6 +80,20 @@ type updateCourseResponse struct {
 }
 
 func (r updateCourseResponse) Failed() error { return r.Err }
+func (r updateCourseResponse) ETag() string  { return formatETag(r.Course.Version) }
+
+type patchCourseRequest struct {
+	ID      string
+	Patch   []byte
+	Version int64
+}
+type patchCourseResponse struct {
+	Course Course `json:"course,omitempty"`
+	Err    error  `json:"error,omitempty"`
+}
+
+func (r patchCourseResponse) Failed() error { return r.Err }
+func (r patchCourseResponse) ETag() string  { return formatETag(r.Course.Version) }
 
 type deleteCourseRequest struct {
 	ID string
@@ -85,62 +114,106 @@ type getCourseStudentsResponse struct {
 
 func (r deleteCourseResponse) Failed() error { return r.Err }
 
+type listAuditRecordsRequest struct {
+	Filter AuditFilter
+}
+type listAuditRecordsResponse struct {
+	Records []AuditRecord `json:"records"`
+	Err     error         `json:"error,omitempty"`
+}
+
+func (r listAuditRecordsResponse) Failed() error { return r.Err }
+
 type Endpoints struct {
 	GetCourseEndpoint         endpoint.Endpoint
+	GetCoursesByIDsEndpoint   endpoint.Endpoint
 	GetCourseListEndpoint     endpoint.Endpoint
 	CreateCourseEndpoint      endpoint.Endpoint
 	UpdateCourseEndpoint      endpoint.Endpoint
+	PatchCourseEndpoint       endpoint.Endpoint
 	DeleteCourseEndpoint      endpoint.Endpoint
 	GetCourseStudentsEndpoint endpoint.Endpoint
+	ListAuditRecordsEndpoint  endpoint.Endpoint
 }
 
-func MakeServerEndpoints(svc Service, logger log.Logger, duration metrics.Histogram) Endpoints {
-	var rateLimitSeconds int = 1
+// MakeServerEndpoints wraps every endpoint with the middlewares configured by
+// its resilience policy, looked up by the endpoint's method name, and traces
+// it in a span of that name. The endpoints refuse the callers whose token
+// does not grant their read or write scope, before the resilience
+// middlewares count them.
+func MakeServerEndpoints(svc Service, logger log.Logger, duration metrics.Histogram, policies resilience.Config, breakerState metrics.Gauge) Endpoints {
 	var GetCourseEndpoint endpoint.Endpoint
 	{
 		GetCourseEndpoint = MakeGetCourseEndpoint(svc)
-		// Reqests are limited to 1 request per second with burst of 1 request.
-		// Note, rate is defined as a time interval between requests.
-		GetCourseEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetCourseEndpoint)
-		GetCourseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetCourseEndpoint)
+		GetCourseEndpoint = resilience.Middleware("GetCourse", policies.Policy("GetCourse"), breakerState, serverFailure)(GetCourseEndpoint)
+		GetCourseEndpoint = auth.RequireScope(auth.ScopeCoursesRead)(GetCourseEndpoint)
+		GetCourseEndpoint = tracing.EndpointMiddleware("GetCourse", trace.SpanKindInternal)(GetCourseEndpoint)
+	}
+	var GetCoursesByIDsEndpoint endpoint.Endpoint
+	{
+		GetCoursesByIDsEndpoint = MakeGetCoursesByIDsEndpoint(svc)
+		GetCoursesByIDsEndpoint = resilience.Middleware("GetCoursesByIDs", policies.Policy("GetCoursesByIDs"), breakerState, serverFailure)(GetCoursesByIDsEndpoint)
+		GetCoursesByIDsEndpoint = auth.RequireScope(auth.ScopeCoursesRead)(GetCoursesByIDsEndpoint)
+		GetCoursesByIDsEndpoint = tracing.EndpointMiddleware("GetCoursesByIDs", trace.SpanKindInternal)(GetCoursesByIDsEndpoint)
 	}
 	var GetCourseListEndpoint endpoint.Endpoint
 	{
 		GetCourseListEndpoint = MakeGetCourseListEndpoint(svc)
-		GetCourseListEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetCourseListEndpoint)
-		GetCourseListEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetCourseListEndpoint)
+		GetCourseListEndpoint = resilience.Middleware("GetCourseList", policies.Policy("GetCourseList"), breakerState, serverFailure)(GetCourseListEndpoint)
+		GetCourseListEndpoint = auth.RequireScope(auth.ScopeCoursesRead)(GetCourseListEndpoint)
+		GetCourseListEndpoint = tracing.EndpointMiddleware("GetCourseList", trace.SpanKindInternal)(GetCourseListEndpoint)
 	}
 	var CreateCourseEndpoint endpoint.Endpoint
 	{
 		CreateCourseEndpoint = MakeCreateCourseEndpoint(svc)
-		CreateCourseEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(CreateCourseEndpoint)
-		CreateCourseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(CreateCourseEndpoint)
+		CreateCourseEndpoint = resilience.Middleware("CreateCourse", policies.Policy("CreateCourse"), breakerState, serverFailure)(CreateCourseEndpoint)
+		CreateCourseEndpoint = auth.RequireScope(auth.ScopeCoursesWrite)(CreateCourseEndpoint)
+		CreateCourseEndpoint = tracing.EndpointMiddleware("CreateCourse", trace.SpanKindInternal)(CreateCourseEndpoint)
 	}
 	var UpdateCourseEndpoint endpoint.Endpoint
 	{
 		UpdateCourseEndpoint = MakeUpdateCourseEndpoint(svc)
-		UpdateCourseEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(UpdateCourseEndpoint)
-		UpdateCourseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(UpdateCourseEndpoint)
+		UpdateCourseEndpoint = resilience.Middleware("UpdateCourse", policies.Policy("UpdateCourse"), breakerState, serverFailure)(UpdateCourseEndpoint)
+		UpdateCourseEndpoint = auth.RequireScope(auth.ScopeCoursesWrite)(UpdateCourseEndpoint)
+		UpdateCourseEndpoint = tracing.EndpointMiddleware("UpdateCourse", trace.SpanKindInternal)(UpdateCourseEndpoint)
+	}
+	var PatchCourseEndpoint endpoint.Endpoint
+	{
+		PatchCourseEndpoint = MakePatchCourseEndpoint(svc)
+		PatchCourseEndpoint = resilience.Middleware("PatchCourse", policies.Policy("PatchCourse"), breakerState, serverFailure)(PatchCourseEndpoint)
+		PatchCourseEndpoint = auth.RequireScope(auth.ScopeCoursesWrite)(PatchCourseEndpoint)
+		PatchCourseEndpoint = tracing.EndpointMiddleware("PatchCourse", trace.SpanKindInternal)(PatchCourseEndpoint)
 	}
 	var DeleteCourseEndpoint endpoint.Endpoint
 	{
 		DeleteCourseEndpoint = MakeDeleteCourseEndpoint(svc)
-		DeleteCourseEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(DeleteCourseEndpoint)
-		DeleteCourseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(DeleteCourseEndpoint)
+		DeleteCourseEndpoint = resilience.Middleware("DeleteCourse", policies.Policy("DeleteCourse"), breakerState, serverFailure)(DeleteCourseEndpoint)
+		DeleteCourseEndpoint = auth.RequireScope(auth.ScopeCoursesWrite)(DeleteCourseEndpoint)
+		DeleteCourseEndpoint = tracing.EndpointMiddleware("DeleteCourse", trace.SpanKindInternal)(DeleteCourseEndpoint)
 	}
 	var GetCourseStudentsEndpoint endpoint.Endpoint
 	{
 		GetCourseStudentsEndpoint = MakeGetCourseStudentsEndpoint(svc)
-		GetCourseStudentsEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetCourseStudentsEndpoint)
-		GetCourseStudentsEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = resilience.Middleware("GetCourseStudents", policies.Policy("GetCourseStudents"), breakerState, serverFailure)(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = auth.RequireScope(auth.ScopeCoursesRead)(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = tracing.EndpointMiddleware("GetCourseStudents", trace.SpanKindInternal)(GetCourseStudentsEndpoint)
+	}
+	var ListAuditRecordsEndpoint endpoint.Endpoint
+	{
+		ListAuditRecordsEndpoint = MakeListAuditRecordsEndpoint(svc)
+		ListAuditRecordsEndpoint = resilience.Middleware("ListAuditRecords", policies.Policy("ListAuditRecords"), breakerState, serverFailure)(ListAuditRecordsEndpoint)
+		ListAuditRecordsEndpoint = tracing.EndpointMiddleware("ListAuditRecords", trace.SpanKindInternal)(ListAuditRecordsEndpoint)
 	}
 	return Endpoints{
 		GetCourseEndpoint:         GetCourseEndpoint,
+		GetCoursesByIDsEndpoint:   GetCoursesByIDsEndpoint,
 		GetCourseListEndpoint:     GetCourseListEndpoint,
 		CreateCourseEndpoint:      CreateCourseEndpoint,
 		UpdateCourseEndpoint:      UpdateCourseEndpoint,
+		PatchCourseEndpoint:       PatchCourseEndpoint,
 		DeleteCourseEndpoint:      DeleteCourseEndpoint,
 		GetCourseStudentsEndpoint: GetCourseStudentsEndpoint,
+		ListAuditRecordsEndpoint:  ListAuditRecordsEndpoint,
 	}
 }
 
@@ -151,6 +224,13 @@ func MakeGetCourseEndpoint(s Service) endpoint.Endpoint {
 		return getCourseResponse{Course: res, Err: e}, nil
 	}
 }
+func MakeGetCoursesByIDsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getCoursesByIDsRequest)
+		res, missing, e := s.GetCoursesByIDs(ctx, req.IDs)
+		return getCoursesByIDsResponse{Courses: res, Missing: missing, Err: e}, nil
+	}
+}
 func MakeGetCourseListEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(getCourseListRequest)
@@ -175,6 +255,14 @@ func MakeUpdateCourseEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func MakePatchCourseEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(patchCourseRequest)
+		res, e := s.PatchCourse(ctx, req.ID, req.Patch, req.Version)
+		return patchCourseResponse{Course: res, Err: e}, nil
+	}
+}
+
 func MakeDeleteCourseEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(deleteCourseRequest)
@@ -190,3 +278,11 @@ func MakeGetCourseStudentsEndpoint(s Service) endpoint.Endpoint {
 		return getCourseStudentsResponse{Students: res, Err: e}, nil
 	}
 }
+
+func MakeListAuditRecordsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listAuditRecordsRequest)
+		res, e := s.ListAuditRecords(ctx, req.Filter)
+		return listAuditRecordsResponse{Records: res, Err: e}, nil
+	}
+}
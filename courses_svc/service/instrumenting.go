@@ -1,73 +1,66 @@
 package service
 
 import (
-	"context"
+	"net/http"
+	"strconv"
 	"time"
 
-	"courses/client"
-
 	"github.com/go-kit/kit/metrics"
+	"github.com/gorilla/mux"
 )
 
-func NewInstrumentingService(counter metrics.Counter, latency metrics.Histogram, s Service) Service {
-	return &instrumentingService{
-		requestCount:   counter,
-		requestLatency: latency,
-		next:           s,
-	}
-}
+// InstrumentingMiddleware records every request, whatever answered it: the
+// service, the decoders, the resilience middlewares or the middlewares in
+// front of the routes, such as authentication and idempotency. The method
+// label is the HTTP method and the route of routes the request matches, e.g.
+// "GET /courses/{id}", as in auth_svc.
+func InstrumentingMiddleware(routes *mux.Router, counter metrics.Counter, latency metrics.Histogram) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			begin := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
 
-type instrumentingService struct {
-	requestCount   metrics.Counter
-	requestLatency metrics.Histogram
-	next           Service
-}
-
-func (s *instrumentingService) GetCourse(ctx context.Context, id string) (Course, error) {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "get").Add(1)
-		s.requestLatency.With("method", "get").Observe(time.Since(begin).Seconds())
-	}(time.Now())
-
-	return s.next.GetCourse(ctx, id)
-}
-func (s *instrumentingService) GetCourseList(ctx context.Context, limit int, offset int) ([]Course, error) {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "list").Add(1)
-		s.requestLatency.With("method", "list").Observe(time.Since(begin).Seconds())
-	}(time.Now())
-
-	return s.next.GetCourseList(ctx, limit, offset)
+			code := rec.status
+			if code == 0 {
+				code = http.StatusOK
+			}
+			lvs := []string{"method", routeName(routes, r), "error", strconv.FormatBool(code >= 400), "code", strconv.Itoa(code)}
+			counter.With(lvs...).Add(1)
+			latency.With(lvs...).Observe(time.Since(begin).Seconds())
+		})
+	}
 }
-func (s *instrumentingService) CreateCourse(ctx context.Context, name string) (Course, error) {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "create").Add(1)
-		s.requestLatency.With("method", "create").Observe(time.Since(begin).Seconds())
-	}(time.Now())
 
-	return s.next.CreateCourse(ctx, name)
+// routeName returns the HTTP method and path template of the route of r.
+func routeName(routes *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !routes.Match(r, &match) || match.Route == nil {
+		return "unmatched"
+	}
+	path, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+	return r.Method + " " + path
 }
-func (s *instrumentingService) UpdateCourse(ctx context.Context, id string, course Course) (Course, error) {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "put").Add(1)
-		s.requestLatency.With("method", "put").Observe(time.Since(begin).Seconds())
-	}(time.Now())
 
-	return s.next.UpdateCourse(ctx, id, course)
+// statusRecorder keeps the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
 }
-func (s *instrumentingService) DeleteCourse(ctx context.Context, id string) error {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "delete").Add(1)
-		s.requestLatency.With("method", "delete").Observe(time.Since(begin).Seconds())
-	}(time.Now())
 
-	return s.next.DeleteCourse(ctx, id)
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
 }
-func (s *instrumentingService) GetCourseStudents(ctx context.Context, id string) ([]client.Student, error) {
-	defer func(begin time.Time) {
-		s.requestCount.With("method", "getStudents").Add(1)
-		s.requestLatency.With("method", "getStudents").Observe(time.Since(begin).Seconds())
-	}(time.Now())
 
-	return s.next.GetCourseStudents(ctx, id)
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
 }
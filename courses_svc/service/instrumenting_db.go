@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	db "courses/db/sqlc"
+	"courses/tracing"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// NewInstrumentingDB records the duration of the queries sent through d,
+// labelled by the sqlc query name and whether the query failed.
+func NewInstrumentingDB(d db.DBTX, duration metrics.Histogram) db.DBTX {
+	return &instrumentingDB{db: d, duration: duration}
+}
+
+type instrumentingDB struct {
+	db       db.DBTX
+	duration metrics.Histogram
+}
+
+func (d *instrumentingDB) observe(query string, begin time.Time, err error) {
+	failed := err != nil && err != sql.ErrNoRows
+	d.duration.With("query", tracing.QueryName(query), "error", strconv.FormatBool(failed)).Observe(time.Since(begin).Seconds())
+}
+
+func (d *instrumentingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	defer func(begin time.Time) {
+		d.observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.ExecContext(ctx, query, args...)
+}
+
+func (d *instrumentingDB) PrepareContext(ctx context.Context, query string) (stmt *sql.Stmt, err error) {
+	defer func(begin time.Time) {
+		d.observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.PrepareContext(ctx, query)
+}
+
+func (d *instrumentingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	defer func(begin time.Time) {
+		d.observe(query, begin, err)
+	}(time.Now())
+
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d *instrumentingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	begin := time.Now()
+	row := d.db.QueryRowContext(ctx, query, args...)
+	d.observe(query, begin, row.Err())
+	return row
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"courses/auth"
+	"courses/resilience"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// labelCounter counts the additions per label values.
+type labelCounter struct {
+	counts map[string]float64
+	lvs    []string
+}
+
+func (c *labelCounter) With(labelValues ...string) metrics.Counter {
+	return &labelCounter{counts: c.counts, lvs: append(append([]string{}, c.lvs...), labelValues...)}
+}
+
+func (c *labelCounter) Add(delta float64) {
+	c.counts[strings.Join(c.lvs, " ")] += delta
+}
+
+func TestInstrumentingMiddleware(t *testing.T) {
+	logger := log.NewNopLogger()
+	// Every endpoint serves two requests of a client, then answers 429.
+	policies := resilience.Config{Default: resilience.Policy{ClientRateLimit: 0.001, ClientBurst: 2}}
+	endpoints := MakeServerEndpoints(stubService{}, logger, discard.NewHistogram(), policies, discard.NewGauge())
+	routes := MakeHTTPHandler(endpoints, logger)
+	counter := &labelCounter{counts: map[string]float64{}}
+	// A middleware in front of the routes refuses some requests itself, and
+	// authenticates the others.
+	refusing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Refuse") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		payload := &auth.Payload{Username: "john", TenantID: 1, Scopes: []string{auth.ScopeCoursesRead, auth.ScopeCoursesWrite}}
+		routes.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), payload)))
+	})
+	handler := InstrumentingMiddleware(routes, counter, discard.NewHistogram())(refusing)
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		refuse bool
+	}{
+		{method: "GET", path: "/courses/1"},
+		{method: "GET", path: "/courses/2"},
+		{method: "GET", path: "/courses/3"},
+		{method: "PUT", path: "/courses/1", body: `{"name":"Math"}`},
+		{method: "GET", path: "/courses/1", refuse: true},
+		{method: "GET", path: "/unknown"},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		if r.refuse {
+			req.Header.Set("X-Refuse", "true")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	require.Equal(t, map[string]float64{
+		"method GET /courses/{id} error false code 200": 2,
+		"method GET /courses/{id} error true code 429":  1,
+		"method PUT /courses/{id} error true code 412":  1,
+		"method GET /courses/{id} error true code 401":  1,
+		"method unmatched error true code 404":          1,
+	}, counter.counts)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 
 	"courses/client"
+	"courses/logging"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 )
 
 type Middleware func(Service) Service
@@ -23,39 +25,68 @@ type loggingMiddleware struct {
 	next   Service
 }
 
+// log returns the logger of a call that ended with err, tagged with the
+// request and trace IDs of ctx.
+func (mw loggingMiddleware) log(ctx context.Context, err error) log.Logger {
+	logger := logging.WithContext(ctx, mw.logger)
+	if err != nil {
+		return level.Error(logger)
+	}
+	return level.Info(logger)
+}
+
 func (mw loggingMiddleware) GetCourse(ctx context.Context, id string) (course Course, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetCourse", "id", id, "course", course.Name, "err", err)
+		mw.log(ctx, err).Log("method", "GetCourse", "id", id, "course", course.Name, "err", err)
 	}()
 	return mw.next.GetCourse(ctx, id)
 }
+func (mw loggingMiddleware) GetCoursesByIDs(ctx context.Context, ids []string) (courses []Course, missing []string, err error) {
+	defer func() {
+		mw.log(ctx, err).Log("method", "GetCoursesByIDs", "ids", len(ids), "len", len(courses), "missing", len(missing), "err", err)
+	}()
+	return mw.next.GetCoursesByIDs(ctx, ids)
+}
 func (mw loggingMiddleware) GetCourseList(ctx context.Context, limit int, offset int) (courses []Course, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetCourseList", "limit", limit, "offset", offset, "courses length", len(courses), "err", err)
+		mw.log(ctx, err).Log("method", "GetCourseList", "limit", limit, "offset", offset, "courses length", len(courses), "err", err)
 	}()
 	return mw.next.GetCourseList(ctx, limit, offset)
 }
 func (mw loggingMiddleware) CreateCourse(ctx context.Context, name string) (course Course, err error) {
 	defer func() {
-		mw.logger.Log("method", "CreateCourse", "course", course.Name, "err", err)
+		mw.log(ctx, err).Log("method", "CreateCourse", "course", course.Name, "err", err)
 	}()
 	return mw.next.CreateCourse(ctx, name)
 }
 func (mw loggingMiddleware) UpdateCourse(ctx context.Context, id string, course Course) (courseR Course, err error) {
 	defer func() {
-		mw.logger.Log("method", "UpdateCourse", "id", id, "course", courseR.Name, "err", err)
+		mw.log(ctx, err).Log("method", "UpdateCourse", "id", id, "course", courseR.Name, "err", err)
 	}()
 	return mw.next.UpdateCourse(ctx, id, course)
 }
+func (mw loggingMiddleware) PatchCourse(ctx context.Context, id string, patch []byte, version int64) (course Course, err error) {
+	defer func() {
+		mw.log(ctx, err).Log("method", "PatchCourse", "id", id, "version", version, "course", course.Name, "err", err)
+	}()
+	return mw.next.PatchCourse(ctx, id, patch, version)
+}
 func (mw loggingMiddleware) DeleteCourse(ctx context.Context, id string) (err error) {
 	defer func() {
-		mw.logger.Log("method", "DeleteCourse", "id", id, "err", err)
+		mw.log(ctx, err).Log("method", "DeleteCourse", "id", id, "err", err)
 	}()
 	return mw.next.DeleteCourse(ctx, id)
 }
 func (mw loggingMiddleware) GetCourseStudents(ctx context.Context, id string) (students []client.Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetCourseStudents", "id", id, "len", len(students), "err", err)
+		mw.log(ctx, err).Log("method", "GetCourseStudents", "id", id, "len", len(students), "err", err)
 	}()
 	return mw.next.GetCourseStudents(ctx, id)
 }
+
+func (mw loggingMiddleware) ListAuditRecords(ctx context.Context, filter AuditFilter) (records []AuditRecord, err error) {
+	defer func() {
+		mw.log(ctx, err).Log("method", "ListAuditRecords", "entity", filter.Entity, "entity_id", filter.EntityID, "actor", filter.Actor, "len", len(records), "err", err)
+	}()
+	return mw.next.ListAuditRecords(ctx, filter)
+}
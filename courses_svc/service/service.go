@@ -2,32 +2,40 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
+	"courses/auth"
+	"courses/cache"
 	"courses/client"
 	db "courses/db/sqlc"
 
-	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/log"
 )
 
 type Service interface {
 	GetCourse(ctx context.Context, id string) (Course, error)
+	GetCoursesByIDs(ctx context.Context, ids []string) (courses []Course, missing []string, err error)
 	GetCourseList(ctx context.Context, limit int, offset int) ([]Course, error)
 	CreateCourse(ctx context.Context, name string) (Course, error)
 	UpdateCourse(ctx context.Context, id string, Course Course) (Course, error)
+	PatchCourse(ctx context.Context, id string, patch []byte, version int64) (Course, error)
 	DeleteCourse(ctx context.Context, id string) error
 	GetCourseStudents(ctx context.Context, id string) ([]client.Student, error)
+	ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error)
 }
 
-func New(r *db.Queries, studentsSvc client.StudentServiceClient, logger log.Logger, counter metrics.Counter, latency metrics.Histogram) Service {
+func New(r *Store, studentsSvc client.StudentServiceClient, courseCache cache.Cache, cacheTTL time.Duration, logger log.Logger) Service {
 	var svc Service
 	{
 		svc = NewCourseService(r, studentsSvc)
+		svc = AuditMiddleware(r)(svc)
+		svc = CachingMiddleware(courseCache, cacheTTL)(svc)
 		svc = LoggingMiddleware(logger)(svc)
-		svc = NewInstrumentingService(counter, latency, svc)
 	}
 	return svc
 }
@@ -37,9 +45,22 @@ var (
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
 	ErrDB              = errors.New("db error")
+	ErrInvalidFilter   = errors.New("invalid filter")
+	ErrInvalidPatch    = errors.New("invalid merge patch")
+	ErrTooManyIDs      = errors.New("too many IDs")
+	// ErrVersionMismatch is returned when the If-Match version of an update
+	// does not match the stored one, i.e. someone else changed the entity.
+	ErrVersionMismatch      = errors.New("version mismatch")
+	ErrPreconditionRequired = errors.New("If-Match header is required")
+	// ErrUpstreamTimeout and ErrUpstreamUnavailable are returned when
+	// students_svc did not answer in time or failed.
+	ErrUpstreamTimeout     = errors.New("students service timed out")
+	ErrUpstreamUnavailable = errors.New("students service unavailable")
 )
 
-func NewCourseService(r *db.Queries, studentsSvc client.StudentServiceClient) Service {
+// NewCourseService returns the service. Its mutations join the transaction
+// of the audit middleware, see AuditMiddleware.
+func NewCourseService(r *Store, studentsSvc client.StudentServiceClient) Service {
 	return &CourseService{
 		r:           r,
 		studentsSvc: studentsSvc,
@@ -47,13 +68,22 @@ func NewCourseService(r *db.Queries, studentsSvc client.StudentServiceClient) Se
 }
 
 type CourseService struct {
-	r           *db.Queries
+	r           *Store
 	studentsSvc client.StudentServiceClient
 }
 
 type Course struct {
-	ID   int64  `json:"id,omitempty"`
-	Name string `json:"name"`
+	ID      int64  `json:"id,omitempty"`
+	Name    string `json:"name"`
+	Version int64  `json:"version,omitempty"`
+}
+
+func newCourse(result db.Course) Course {
+	return Course{
+		ID:      result.ID,
+		Name:    result.Name,
+		Version: result.Version,
+	}
 }
 
 func (s *CourseService) GetCourse(ctx context.Context, id string) (Course, error) {
@@ -61,23 +91,101 @@ func (s *CourseService) GetCourse(ctx context.Context, id string) (Course, error
 	if err != nil {
 		return Course{}, ErrInconsistentIDs
 	}
-	result, err := s.r.GetCourse(ctx, int64(ID))
+	tenantID, err := callerTenant(ctx)
 	if err != nil {
+		return Course{}, err
+	}
+	result, err := s.r.GetCourse(ctx, db.GetCourseParams{
+		TenantID: tenantID,
+		ID:       int64(ID),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Course{}, ErrNotFound
+		}
 		return Course{}, ErrDB
 	}
 	return Course{
-		ID:   result.ID,
-		Name: result.Name,
+		ID:      result.ID,
+		Name:    result.Name,
+		Version: result.Version,
 	}, nil
 }
 
+// maxBatchSize is the maximum number of IDs accepted by GetCoursesByIDs.
+const maxBatchSize = 100
+
+// GetCoursesByIDs returns the courses in the order of ids, skipping
+// duplicates. IDs of courses that do not exist are returned in missing.
+func (s *CourseService) GetCoursesByIDs(ctx context.Context, ids []string) ([]Course, []string, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) > maxBatchSize {
+		return nil, nil, ErrTooManyIDs
+	}
+	IDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		ID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, nil, ErrInconsistentIDs
+		}
+		IDs = append(IDs, ID)
+	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.r.GetCoursesByIDs(ctx, db.GetCoursesByIDsParams{
+		TenantID: tenantID,
+		Ids:      IDs,
+	})
+	if err != nil {
+		return nil, nil, ErrDB
+	}
+	found := make(map[int64]Course, len(res))
+	for _, result := range res {
+		found[result.ID] = Course{
+			ID:      result.ID,
+			Name:    result.Name,
+			Version: result.Version,
+		}
+	}
+	list := make([]Course, 0, len(res))
+	missing := make([]string, 0)
+	for i, ID := range IDs {
+		if course, ok := found[ID]; ok {
+			list = append(list, course)
+		} else {
+			missing = append(missing, ids[i])
+		}
+	}
+	return list, missing, nil
+}
+
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
 func (s *CourseService) GetCourseList(ctx context.Context, limit int, offset int) ([]Course, error) {
 	if limit == 0 {
 		limit = 100
 	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return []Course{}, err
+	}
 	p, err := s.r.ListCourses(ctx, db.ListCoursesParams{
-		Limit:  int32(limit),
-		Offset: int32(offset),
+		TenantID: tenantID,
+		Limit:    int32(limit),
+		Offset:   int32(offset),
 	})
 	if err != nil {
 		fmt.Print(err)
@@ -86,48 +194,152 @@ func (s *CourseService) GetCourseList(ctx context.Context, limit int, offset int
 	var list []Course
 	for _, result := range p {
 		list = append(list, Course{
-			ID:   result.ID,
-			Name: result.Name,
+			ID:      result.ID,
+			Name:    result.Name,
+			Version: result.Version,
 		})
 	}
 	return list, nil
 }
 
 func (s *CourseService) CreateCourse(ctx context.Context, name string) (Course, error) {
-	result, err := s.r.CreateCourse(ctx, name)
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Course{}, err
+	}
+	var result db.Course
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		var err error
+		result, err = q.CreateCourse(ctx, db.CreateCourseParams{
+			Name:     name,
+			TenantID: tenantID,
+		})
+		return err
+	})
 	if err != nil {
 		return Course{}, ErrDB
 	}
-	return Course{
-		ID:   result.ID,
-		Name: result.Name,
-	}, nil
+	return newCourse(result), nil
 }
 
+// UpdateCourse overwrites the course, provided that course.Version
+// still matches the stored version, or is anyVersion. The course is
+// locked while it is compared and updated.
 func (s *CourseService) UpdateCourse(ctx context.Context, id string, course Course) (Course, error) {
 	ID, err := strconv.Atoi(id)
 	if err != nil {
 		return Course{}, ErrInconsistentIDs
 	}
-	result, err := s.r.UpdateCourse(ctx, db.UpdateCourseParams{
-		ID:   int64(ID),
-		Name: course.Name,
+	if course.Version == 0 {
+		return Course{}, ErrPreconditionRequired
+	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Course{}, err
+	}
+	var result db.Course
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		before, err := q.GetCourseForUpdate(ctx, db.GetCourseForUpdateParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+		if err != nil {
+			return err
+		}
+		if course.Version != anyVersion && before.Version != course.Version {
+			return ErrVersionMismatch
+		}
+		result, err = q.UpdateCourse(ctx, db.UpdateCourseParams{
+			ID:       int64(ID),
+			Name:     course.Name,
+			Version:  before.Version,
+			TenantID: tenantID,
+		})
+		return err
 	})
+	switch {
+	case err == nil:
+		return newCourse(result), nil
+	case errors.Is(err, sql.ErrNoRows):
+		return Course{}, ErrNotFound
+	case errors.Is(err, ErrVersionMismatch):
+		return Course{}, ErrVersionMismatch
+	}
+	return Course{}, ErrDB
+}
+
+// PatchCourse applies a JSON Merge Patch to the course. The course is read
+// and updated in one transaction, so that "If-Match: *" patches the latest
+// version even when it changes concurrently.
+func (s *CourseService) PatchCourse(ctx context.Context, id string, patch []byte, version int64) (Course, error) {
+	if version == 0 {
+		return Course{}, ErrPreconditionRequired
+	}
+	ID, err := strconv.Atoi(id)
 	if err != nil {
-		return Course{}, ErrDB
+		return Course{}, ErrInconsistentIDs
 	}
-	return Course{
-		ID:   result.ID,
-		Name: result.Name,
-	}, nil
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Course{}, err
+	}
+	var result Course
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		current, err := q.GetCourseForUpdate(ctx, db.GetCourseForUpdateParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+		if err != nil {
+			return err
+		}
+		if version != anyVersion && current.Version != version {
+			return ErrVersionMismatch
+		}
+		doc, err := json.Marshal(newCourse(current))
+		if err != nil {
+			return err
+		}
+		patched, err := mergePatch(doc, patch)
+		if err != nil {
+			return ErrInvalidPatch
+		}
+		var course Course
+		if err := json.Unmarshal(patched, &course); err != nil {
+			return ErrInvalidPatch
+		}
+		// The course is locked, UpdateCourse joins the transaction and
+		// finds it unchanged.
+		course.Version = current.Version
+		result, err = s.UpdateCourse(ctx, id, course)
+		return err
+	})
+	switch {
+	case err == nil:
+		return result, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return Course{}, ErrNotFound
+	case errors.Is(err, ErrVersionMismatch), errors.Is(err, ErrInvalidPatch), errors.Is(err, ErrNotFound):
+		return Course{}, err
+	}
+	return Course{}, ErrDB
 }
 
+// DeleteCourse deletes the course, if it exists.
 func (s *CourseService) DeleteCourse(ctx context.Context, id string) error {
 	ID, err := strconv.Atoi(id)
 	if err != nil {
 		return ErrInconsistentIDs
 	}
-	err = s.r.DeleteCourse(ctx, int64(ID))
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		return q.DeleteCourse(ctx, db.DeleteCourseParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+	})
 	if err != nil {
 		return ErrDB
 	}
@@ -138,8 +350,41 @@ func (s *CourseService) GetCourseStudents(ctx context.Context, id string) ([]cli
 	res, err := s.studentsSvc.GetCourseStudents(ctx, id)
 
 	if err != nil {
-		return []client.Student{}, err
+		return []client.Student{}, studentClientError(err)
 	}
 
 	return res, nil
 }
+
+// studentClientError maps an error of the students client to a service error.
+// The students service refusing the credentials of the caller refuses the
+// request, rather than failing it.
+func studentClientError(err error) error {
+	switch {
+	case errors.Is(err, client.ErrTimeout):
+		return ErrUpstreamTimeout
+	case errors.Is(err, client.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return auth.ErrUnauthenticated
+	case errors.Is(err, auth.ErrInsufficientScope):
+		return auth.ErrInsufficientScope
+	}
+	return ErrUpstreamUnavailable
+}
+
+func (s *CourseService) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.r.ListAuditRecords(ctx, newAuditRecordsParams(tenantID, filter))
+	if err != nil {
+		return nil, ErrDB
+	}
+	list := make([]AuditRecord, 0, len(res))
+	for _, result := range res {
+		list = append(list, newAuditRecord(result))
+	}
+	return list, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"courses/auth"
+	db "courses/db/sqlc"
+	"courses/tracing"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// Store runs the queries of the service, one at a time or within a
+// transaction. Its queries are traced and instrumented.
+type Store struct {
+	*db.Queries
+	conn             *sql.DB
+	rowLevelSecurity bool
+	duration         metrics.Histogram
+}
+
+// NewStore returns a store of conn. With rowLevelSecurity, every query is
+// also limited to the tenant of the caller by the database.
+func NewStore(conn *sql.DB, rowLevelSecurity bool, duration metrics.Histogram) *Store {
+	var base db.DBTX = conn
+	if rowLevelSecurity {
+		base = NewTenantDB(conn)
+	}
+	return &Store{
+		Queries:          db.New(NewInstrumentingDB(tracing.WrapDB(base), duration)),
+		conn:             conn,
+		rowLevelSecurity: rowLevelSecurity,
+		duration:         duration,
+	}
+}
+
+type contextKey int
+
+const txContextKey contextKey = iota
+
+// execTx executes fn within a database transaction, which is committed
+// when fn succeeds and rolled back otherwise. The context passed to fn
+// carries the transaction, and the calls of execTx with it join the
+// transaction rather than begin another one, so that the audit middleware
+// and the service commit or roll back together.
+func (s *Store) execTx(ctx context.Context, fn func(context.Context, *db.Queries) error) error {
+	if q, ok := ctx.Value(txContextKey).(*db.Queries); ok {
+		return fn(ctx, q)
+	}
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if s.rowLevelSecurity {
+		tenantID, err := callerTenant(ctx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, setLocalTenantQuery, strconv.FormatInt(tenantID, 10)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	q := db.New(NewInstrumentingDB(tracing.WrapDB(tx), s.duration))
+	err = fn(context.WithValue(ctx, txContextKey, q), q)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// callerTenant returns the tenant of the caller, or auth.ErrUnauthenticated
+// when there is none. The queries are never sent for another tenant.
+func callerTenant(ctx context.Context) (int64, error) {
+	tenantID, ok := auth.TenantID(ctx)
+	if !ok {
+		return 0, auth.ErrUnauthenticated
+	}
+	return tenantID, nil
+}
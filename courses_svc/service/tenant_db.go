@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+
+	db "courses/db/sqlc"
+)
+
+const (
+	setTenantQuery = "SELECT set_config('app.tenant_id', $1, false)"
+	// setLocalTenantQuery sets the tenant until the end of the transaction.
+	setLocalTenantQuery = "SELECT set_config('app.tenant_id', $1, true)"
+	// resetTenantQuery clears the tenant of a connection of the pool.
+	resetTenantQuery = "SELECT set_config('app.tenant_id', '', false)"
+	// rowSecurityBypassQuery reports whether the role of the connection is
+	// exempt from the row-level security policies: a superuser, a role with
+	// BYPASSRLS or the owner of a table with row-level security.
+	rowSecurityBypassQuery = `SELECT rolsuper OR rolbypassrls OR EXISTS (
+	SELECT 1 FROM pg_class WHERE relowner = pg_roles.oid AND relrowsecurity
+) FROM pg_roles WHERE rolname = current_user`
+)
+
+var (
+	// ErrPrepareUnsupported is returned by the tenant database for prepared
+	// statements, which would outlive the connection their tenant is set on.
+	ErrPrepareUnsupported = errors.New("statements can not be prepared with row-level security")
+	// ErrRowSecurityBypassed is returned by CheckRowLevelSecurity for a
+	// database role that the policies do not apply to.
+	ErrRowSecurityBypassed = errors.New("the database role bypasses row-level security, run the migrations as another role with MIGRATION_DB_SOURCE")
+)
+
+// CheckRowLevelSecurity fails with ErrRowSecurityBypassed when the role of
+// conn is exempt from the row-level security policies, which would then
+// never limit a query to the tenant of the caller.
+func CheckRowLevelSecurity(ctx context.Context, conn *sql.DB) error {
+	var bypassed bool
+	if err := conn.QueryRowContext(ctx, rowSecurityBypassQuery).Scan(&bypassed); err != nil {
+		return err
+	}
+	if bypassed {
+		return ErrRowSecurityBypassed
+	}
+	return nil
+}
+
+// NewTenantDB sends every query on a connection whose app.tenant_id setting
+// is the tenant of the caller, for the row-level security policies of the
+// tables. The database role of the service must not own the tables, or the
+// policies do not apply to it. conn must be opened with OpenTenantDB, so
+// that the tenant is reset before a connection is reused.
+func NewTenantDB(conn *sql.DB) db.DBTX {
+	return &tenantDB{conn: conn}
+}
+
+type tenantDB struct {
+	conn *sql.DB
+}
+
+// acquire returns a connection of the pool set to the tenant of ctx.
+func (d *tenantDB) acquire(ctx context.Context) (*sql.Conn, error) {
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := d.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.ExecContext(ctx, setTenantQuery, strconv.FormatInt(tenantID, 10)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *tenantDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c, err := d.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext fails with ErrPrepareUnsupported: the statement would be
+// bound to a connection that is back in the pool once it is returned, and
+// used by other tenants. The queries of sqlc are not prepared.
+func (d *tenantDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, ErrPrepareUnsupported
+}
+
+func (d *tenantDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c, err := d.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.QueryContext(ctx, query, args...)
+	// Close waits for the rows to be closed before returning the connection
+	// to the pool.
+	go c.Close()
+	return rows, err
+}
+
+func (d *tenantDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c, err := d.acquire(ctx)
+	if err != nil {
+		// A sql.Row can not be built with an error, so the query is sent
+		// with a canceled context instead, and Scan returns its error.
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		return d.conn.QueryRowContext(canceled, query, args...)
+	}
+	row := c.QueryRowContext(ctx, query, args...)
+	go c.Close()
+	return row
+}
+
+// OpenTenantDB opens a database like sql.Open, whose connections reset
+// app.tenant_id before they are reused, so that the tenant set for a query
+// by the tenant database never leaks to the next user of the connection.
+// A connection whose reset fails is discarded.
+func OpenTenantDB(driverName string, dataSourceName string) (*sql.DB, error) {
+	d, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	drv := d.Driver()
+	d.Close()
+	return sql.OpenDB(&tenantConnector{driver: drv, dsn: dataSourceName}), nil
+}
+
+type tenantConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *tenantConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &tenantConn{conn}, nil
+}
+
+func (c *tenantConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// tenantConn is a connection of the driver that resets its tenant in
+// ResetSession. The optional interfaces of the driver connection are passed
+// through, as database/sql only finds the ones of tenantConn.
+type tenantConn struct {
+	driver.Conn
+}
+
+func (c *tenantConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		if err := r.ResetSession(ctx); err != nil {
+			return err
+		}
+	}
+	if err := c.resetTenant(ctx); err != nil {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *tenantConn) resetTenant(ctx context.Context) error {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(ctx, resetTenantQuery, nil)
+		return err
+	}
+	stmt, err := c.PrepareContext(ctx, resetTenantQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+func (c *tenantConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tenantConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tenantConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *tenantConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *tenantConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tenantConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *tenantConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
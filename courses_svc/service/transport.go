@@ -4,33 +4,57 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"courses/auth"
 
 	"github.com/gorilla/mux"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/go-kit/log"
+	"github.com/sony/gobreaker"
 )
 
 var (
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+	// ErrTenantRequired is returned by the admin endpoints without a valid
+	// tenant_id query parameter.
+	ErrTenantRequired = errors.New("tenant_id is required")
 )
 
-func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
+// adminActor is the actor of the requests of the admin listener.
+const adminActor = "admin"
+
+func MakeHTTPHandler(e Endpoints, logger log.Logger) *mux.Router {
 	r := mux.NewRouter()
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
 	}
 	// GET     /courses/                          retrieve courses list
+	// GET     /courses?ids=1,2,3                 retrieve courses by ids, in the given order, and the missing ids
 	// GET     /courses/:id                       retrieve course by id
-	// POST    /courses/                          adds another course
-	// PUT     /courses/:id                       post updated course information about the course
+	// POST    /courses/                          adds another course, retries are deduplicated by the Idempotency-Key header
+	// PUT     /courses/:id                       post updated course information about the course, requires If-Match
+	// PATCH   /courses/:id                       partially update the course with a JSON Merge Patch, requires If-Match
 	// DELETE  /courses/:id                       remove the given course
 	// GET     /courses/:id/students               retrieve course students by course id
+	// GET     /openapi.yaml                       the OpenAPI spec of this API
+	// GET     /docs                               Swagger UI
+	r.Methods("GET").Path("/courses").Queries("ids", "{ids}").Handler(httptransport.NewServer(
+		e.GetCoursesByIDsEndpoint,
+		decodeGetCoursesByIDsRequest,
+		encodeResponse,
+		options...,
+	))
 	r.Methods("GET").Path("/courses").Handler(httptransport.NewServer(
 		e.GetCourseListEndpoint,
 		decodeGetCourseListRequest,
@@ -55,6 +79,12 @@ func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	r.Methods("PATCH").Path("/courses/{id}").Handler(httptransport.NewServer(
+		e.PatchCourseEndpoint,
+		decodePatchCourseRequest,
+		encodeResponse,
+		options...,
+	))
 	r.Methods("DELETE").Path("/courses/{id}").Handler(httptransport.NewServer(
 		e.DeleteCourseEndpoint,
 		decodeDeleteCourseRequest,
@@ -68,9 +98,43 @@ func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+
+	r.Methods("GET").Path("/openapi.yaml").HandlerFunc(serveOpenAPISpec)
+	r.Methods("GET").Path("/docs").HandlerFunc(serveSwaggerUI)
 	return r
 }
 
+// MakeAdminHTTPHandler serves the admin endpoints, which are served on the
+// admin listener, ADMIN_SERVER_ADDRESS, rather than exposed with the public
+// API or the metrics of the debug listener. The audit records
+// are only read there, for the tenant of the tenant_id query parameter.
+func MakeAdminHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerBefore(adminTenantToContext),
+	}
+	// GET     /admin/audit?tenant_id=             retrieve audit records filtered by entity, actor and time range
+	r.Methods("GET").Path("/admin/audit").Handler(httptransport.NewServer(
+		e.ListAuditRecordsEndpoint,
+		decodeListAuditRecordsRequest,
+		encodeResponse,
+		options...,
+	))
+	return r
+}
+
+// adminTenantToContext acts for the tenant of the tenant_id query parameter
+// of an admin request, if it is valid.
+func adminTenantToContext(ctx context.Context, r *http.Request) context.Context {
+	tenantID, err := strconv.ParseInt(r.URL.Query().Get("tenant_id"), 10, 64)
+	if err != nil || tenantID < 1 {
+		return ctx
+	}
+	return auth.NewContext(ctx, &auth.Payload{Username: adminActor, TenantID: tenantID})
+}
+
 func decodeGetCourseListRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	limitstr := r.URL.Query().Get("Limit")
 	offsetstr := r.URL.Query().Get("Offset")
@@ -79,6 +143,14 @@ func decodeGetCourseListRequest(_ context.Context, r *http.Request) (request int
 	return getCourseListRequest{Limit: limit, Offset: offset}, nil
 }
 
+func decodeGetCoursesByIDsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	for i := range ids {
+		ids[i] = strings.TrimSpace(ids[i])
+	}
+	return getCoursesByIDsRequest{IDs: ids}, nil
+}
+
 func decodeGetCourseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -106,12 +178,37 @@ func decodeUpdateCourseRequest(_ context.Context, r *http.Request) (request inte
 	if err := json.NewDecoder(r.Body).Decode(&course); err != nil {
 		return nil, err
 	}
+	course.Version, err = parseETag(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
 	return updateCourseRequest{
 		ID:     id,
 		Course: course,
 	}, nil
 }
 
+func decodePatchCourseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	version, err := parseETag(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
+	return patchCourseRequest{
+		ID:      id,
+		Patch:   patch,
+		Version: version,
+	}, nil
+}
+
 func decodeDeleteCourseRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -130,6 +227,31 @@ func decodeGetCourseStudentsRequest(_ context.Context, r *http.Request) (request
 	return getCourseStudentsRequest{ID: id}, nil
 }
 
+func decodeListAuditRecordsRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return nil, ErrTenantRequired
+	}
+	q := r.URL.Query()
+	filter := AuditFilter{
+		Entity:   q.Get("entity"),
+		EntityID: q.Get("entity_id"),
+		Actor:    q.Get("actor"),
+	}
+	filter.Limit, _ = strconv.Atoi(q.Get("Limit"))
+	filter.Offset, _ = strconv.Atoi(q.Get("Offset"))
+	if from := q.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, ErrInvalidFilter
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, ErrInvalidFilter
+		}
+	}
+	return listAuditRecordsRequest{Filter: filter}, nil
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(endpoint.Failer); ok && e.Failed() != nil {
 		// Not a Go kit transport error, but a business-logic error.
@@ -137,25 +259,57 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 		errorEncoder(ctx, e.Failed(), w)
 		return nil
 	}
+	if e, ok := response.(etagger); ok && e.ETag() != "" {
+		w.Header().Set("ETag", e.ETag())
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
 }
 
 func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(err2code(err))
 	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
 }
 
 func err2code(err error) int {
 	switch err {
-	case ErrBadRouting, ErrInconsistentIDs:
+	case ErrBadRouting, ErrInconsistentIDs, ErrInvalidFilter, ErrInvalidPatch, ErrTooManyIDs, ErrTenantRequired:
 		return http.StatusBadRequest
+	case auth.ErrUnauthenticated:
+		return http.StatusUnauthorized
+	case auth.ErrInsufficientScope:
+		return http.StatusForbidden
 	case ErrNotFound:
 		return http.StatusNotFound
+	case ErrVersionMismatch:
+		return http.StatusPreconditionFailed
+	case ErrIdempotencyKeyReused:
+		return http.StatusUnprocessableEntity
+	case ErrIdempotencyKeyInProgress:
+		return http.StatusConflict
+	case ErrRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case ratelimit.ErrLimited:
+		return http.StatusTooManyRequests
+	case gobreaker.ErrOpenState, gobreaker.ErrTooManyRequests:
+		return http.StatusServiceUnavailable
+	case context.DeadlineExceeded, ErrUpstreamTimeout:
+		return http.StatusGatewayTimeout
+	case ErrUpstreamUnavailable:
+		return http.StatusBadGateway
 	}
 	return http.StatusInternalServerError
 }
 
+// serverFailure reports whether err is answered with a server error, which
+// the circuit breaker of the endpoint counts as a failure.
+func serverFailure(err error) bool {
+	return err2code(err) >= http.StatusInternalServerError
+}
+
 type errorWrapper struct {
 	Error string `json:"error"`
 }
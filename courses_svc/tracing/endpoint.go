@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EndpointMiddleware traces every call of an endpoint in a span named name.
+// Errors, including business errors reported by an endpoint.Failer
+// response, are recorded on the span.
+func EndpointMiddleware(name string, kind trace.SpanKind) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind))
+			defer span.End()
+
+			response, err = next(ctx, request)
+			if err == nil {
+				if f, ok := response.(endpoint.Failer); ok {
+					err = f.Failed()
+				}
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider("test", sdktrace.NewSimpleSpanProcessor(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return exporter
+}
+
+type failedResponse struct{ err error }
+
+func (r failedResponse) Failed() error { return r.err }
+
+func TestPropagation(t *testing.T) {
+	exporter := setupTracing(t)
+
+	errFailed := errors.New("failed")
+	endpoint := EndpointMiddleware("GetCourse", trace.SpanKindInternal)(func(context.Context, interface{}) (interface{}, error) {
+		return failedResponse{err: errFailed}, nil
+	})
+	server := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint(r.Context(), nil)
+	}), "courses_svc"))
+	defer server.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GetStudentCourses")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := NewClient().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		require.Equal(t, parent.SpanContext().TraceID(), span.SpanContext.TraceID())
+		byName[span.Name] = span
+	}
+
+	// The server span continues the trace of the client span.
+	client := byName["HTTP GET"]
+	require.Equal(t, parent.SpanContext().SpanID(), client.Parent.SpanID())
+	serverSpan := byName["courses_svc GET"]
+	require.Equal(t, client.SpanContext.SpanID(), serverSpan.Parent.SpanID())
+
+	endpointSpan := byName["GetCourse"]
+	require.Equal(t, serverSpan.SpanContext.SpanID(), endpointSpan.Parent.SpanID())
+	require.Equal(t, codes.Error, endpointSpan.Status.Code)
+	require.Equal(t, errFailed.Error(), endpointSpan.Status.Description)
+}
+
+func TestQueryName(t *testing.T) {
+	require.Equal(t, "GetCourse", QueryName("-- name: GetCourse :one\nSELECT 1"))
+	require.Equal(t, "query", QueryName("SELECT 1"))
+}
@@ -12,7 +12,9 @@ type Config struct {
 	Environment               string        `mapstructure:"ENVIRONMENT"`
 	DBDriver                  string        `mapstructure:"DB_DRIVER"`
 	DBSource                  string        `mapstructure:"DB_SOURCE"`
+	DBRowLevelSecurity        bool          `mapstructure:"DB_ROW_LEVEL_SECURITY"`
 	MigrationURL              string        `mapstructure:"MIGRATION_URL"`
+	MigrationDBSource         string        `mapstructure:"MIGRATION_DB_SOURCE"`
 	RedisAddress              string        `mapstructure:"REDIS_ADDRESS"`
 	HTTPServerAddress         string        `mapstructure:"HTTP_SERVER_ADDRESS"`
 	GRPCServerAddress         string        `mapstructure:"GRPC_SERVER_ADDRESS"`
@@ -20,6 +22,17 @@ type Config struct {
 	AccessTokenDuration       time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
 	RefreshTokenDuration      time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
 	StudentsHTTPServerAddress string        `mapstructure:"STUDENTS_HTTP_SERVER_ADDRESS"`
+	AuthHTTPServerAddress     string        `mapstructure:"AUTH_HTTP_SERVER_ADDRESS"`
+	AdminServerAddress        string        `mapstructure:"ADMIN_SERVER_ADDRESS"`
+	ConsulAddress             string        `mapstructure:"CONSUL_ADDRESS"`
+	AdvertiseAddress          string        `mapstructure:"ADVERTISE_ADDRESS"`
+	CourseCacheTTL            time.Duration `mapstructure:"COURSE_CACHE_TTL"`
+	CacheSize                 int           `mapstructure:"CACHE_SIZE"`
+	ResilienceConfigFile      string        `mapstructure:"RESILIENCE_CONFIG_FILE"`
+	TrustedProxies            string        `mapstructure:"TRUSTED_PROXIES"`
+	TracingExporter           string        `mapstructure:"TRACING_EXPORTER"`
+	TracingOTLPEndpoint       string        `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	LogLevel                  string        `mapstructure:"LOG_LEVEL"`
 }
 
 // LoadConfig reads configuration from file or environment variables.
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gateway/graph"
+	"gateway/logging"
+	"gateway/utils"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/oklog/pkg/group"
+)
+
+func main() {
+	config, err := utils.LoadConfig(".")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot load config:", err)
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("gateway", flag.ExitOnError)
+	var (
+		debugAddr = fs.String("debug.addr", ":9092", "Debug listen address")
+		httpAddr  = fs.String("http-addr", ":9091", "HTTP listen address")
+	)
+	fs.Parse(os.Args[1:])
+
+	logLevel, err := logging.NewLevel(config.LogLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot parse LOG_LEVEL:", err)
+		os.Exit(1)
+	}
+	logger := logging.New(os.Stderr, logLevel)
+	http.DefaultServeMux.Handle("/admin/log-level", logging.LevelHandler(logLevel, logger))
+
+	clients, err := graph.NewClients(config.StudentsHTTPServerAddress, config.CoursesHTTPServerAddress, &http.Client{Timeout: config.UpstreamTimeout})
+	if err != nil {
+		level.Error(logger).Log("during", "NewClients", "err", err)
+		os.Exit(1)
+	}
+	schema, err := graph.NewSchema()
+	if err != nil {
+		level.Error(logger).Log("during", "NewSchema", "err", err)
+		os.Exit(1)
+	}
+	limits := graph.Limits{MaxDepth: config.GraphQLMaxDepth, MaxComplexity: config.GraphQLMaxComplexity}
+
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", graph.NewHandler(schema, clients, limits, logger))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	httpHandler := logging.RequestIDMiddleware(mux)
+
+	var g group.Group
+	{
+		debugListener, err := net.Listen("tcp", *debugAddr)
+		if err != nil {
+			level.Error(logger).Log("transport", "debug/HTTP", "during", "Listen", "err", err)
+			os.Exit(1)
+		}
+		debugServer := &http.Server{Handler: http.DefaultServeMux}
+		g.Add(func() error {
+			logger.Log("transport", "debug/HTTP", "addr", *debugAddr)
+			return serve(debugServer, debugListener)
+		}, func(error) {
+			shutdown(debugServer, logger)
+		})
+	}
+	{
+		httpListener, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			level.Error(logger).Log("transport", "HTTP", "during", "Listen", "err", err)
+			os.Exit(1)
+		}
+		httpServer := &http.Server{Handler: httpHandler}
+		g.Add(func() error {
+			logger.Log("transport", "HTTP", "addr", *httpAddr)
+			return serve(httpServer, httpListener)
+		}, func(error) {
+			shutdown(httpServer, logger)
+		})
+	}
+	{
+		// This function just sits and waits for ctrl-C.
+		cancelInterrupt := make(chan struct{})
+		g.Add(func() error {
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+			select {
+			case sig := <-c:
+				logger.Log("signal", sig)
+				return nil
+			case <-cancelInterrupt:
+				return nil
+			}
+		}, func(error) {
+			close(cancelInterrupt)
+		})
+	}
+	if err := g.Run(); err != nil {
+		level.Error(logger).Log("exit", err)
+		os.Exit(1)
+	}
+	logger.Log("exit", "shutdown")
+}
+
+// shutdownTimeout bounds how long in-flight requests are drained.
+const shutdownTimeout = 15 * time.Second
+
+// serve serves on listener until server is shut down.
+func serve(server *http.Server, listener net.Listener) error {
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func shutdown(server *http.Server, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		level.Error(logger).Log("during", "Shutdown", "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gateway/logging"
+
+	"sdk/courses"
+	"sdk/students"
+)
+
+// Clients are the clients of the services the graph is resolved from.
+type Clients struct {
+	Students students.ClientWithResponsesInterface
+	Courses  courses.ClientWithResponsesInterface
+}
+
+// NewClients returns the clients of students_svc and courses_svc at the
+// given addresses. The Authorization, X-API-Key and X-Request-ID headers of
+// the GraphQL request are forwarded to the services.
+func NewClients(studentsAddress, coursesAddress string, httpClient *http.Client) (Clients, error) {
+	studentsClient, err := students.NewClientWithResponses(baseURL(studentsAddress),
+		students.WithHTTPClient(httpClient),
+		students.WithRequestEditorFn(forwardHeaders),
+	)
+	if err != nil {
+		return Clients{}, fmt.Errorf("cannot create students client: %w", err)
+	}
+	coursesClient, err := courses.NewClientWithResponses(baseURL(coursesAddress),
+		courses.WithHTTPClient(httpClient),
+		courses.WithRequestEditorFn(forwardHeaders),
+	)
+	if err != nil {
+		return Clients{}, fmt.Errorf("cannot create courses client: %w", err)
+	}
+	return Clients{Students: studentsClient, Courses: coursesClient}, nil
+}
+
+func baseURL(address string) string {
+	if !strings.HasPrefix(address, "http") {
+		return "http://" + address
+	}
+	return address
+}
+
+type credentialsKey struct{}
+
+// credentialHeaders authenticate the GraphQL request to the services.
+var credentialHeaders = []string{"Authorization", "X-API-Key"}
+
+// withCredentials returns a copy of ctx carrying the credential headers of
+// the GraphQL request.
+func withCredentials(ctx context.Context, header http.Header) context.Context {
+	credentials := http.Header{}
+	for _, key := range credentialHeaders {
+		if value := header.Get(key); value != "" {
+			credentials.Set(key, value)
+		}
+	}
+	return context.WithValue(ctx, credentialsKey{}, credentials)
+}
+
+func forwardHeaders(ctx context.Context, req *http.Request) error {
+	if credentials, ok := ctx.Value(credentialsKey{}).(http.Header); ok {
+		for key := range credentials {
+			req.Header.Set(key, credentials.Get(key))
+		}
+	}
+	return logging.PropagateRequestID(ctx, req)
+}
+
+// UpstreamError is returned when a service answers with an unexpected
+// status code.
+type UpstreamError struct {
+	Service    string
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s service: %d %s", e.Service, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+func upstreamError(service string, statusCode int, body []byte) error {
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	return &UpstreamError{Service: service, StatusCode: statusCode, Body: string(body)}
+}
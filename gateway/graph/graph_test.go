@@ -0,0 +1,215 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServices serve the students 1 and 2, enrolled in the courses 1 and 2,
+// and count the requests by path.
+type fakeServices struct {
+	mu       sync.Mutex
+	requests map[string]int
+	ids      []string
+	apiKeys  []string
+}
+
+func (f *fakeServices) count(r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.URL.Path]++
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		f.ids = append(f.ids, ids)
+	}
+	f.apiKeys = append(f.apiKeys, r.Header.Get("X-API-Key"))
+}
+
+func student(id string) string {
+	return fmt.Sprintf(`{"id":%s,"fullname":"Student %s","date_of_birth":"2008-05-01T00:00:00Z","grade":9,"phone":77011234567,"version":1}`, id, id)
+}
+
+func course(id string) string {
+	return fmt.Sprintf(`{"id":%s,"name":"Course %s","version":1}`, id, id)
+}
+
+func (f *fakeServices) students(w http.ResponseWriter, r *http.Request) {
+	f.count(r)
+	w.Header().Set("Content-Type", "application/json")
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1:
+		fmt.Fprintf(w, `{"students":[%s,%s]}`, student("1"), student("2"))
+	case len(parts) == 2 && parts[1] == "404":
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	case len(parts) == 2:
+		fmt.Fprintf(w, `{"student":%s}`, student(parts[1]))
+	case parts[0] == "students":
+		fmt.Fprintf(w, `{"Courses":[%s,%s]}`, course("1"), course("2"))
+	default:
+		fmt.Fprintf(w, `{"Students":[%s,%s]}`, student("1"), student("2"))
+	}
+}
+
+func (f *fakeServices) courses(w http.ResponseWriter, r *http.Request) {
+	f.count(r)
+	w.Header().Set("Content-Type", "application/json")
+	var list []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id != "404" {
+			list = append(list, course(id))
+		}
+	}
+	fmt.Fprintf(w, `{"courses":[%s],"missing":[]}`, strings.Join(list, ","))
+}
+
+func newTestHandler(t *testing.T, limits Limits) (http.Handler, *fakeServices) {
+	t.Helper()
+	fake := &fakeServices{requests: make(map[string]int)}
+	studentsServer := httptest.NewServer(http.HandlerFunc(fake.students))
+	t.Cleanup(studentsServer.Close)
+	coursesServer := httptest.NewServer(http.HandlerFunc(fake.courses))
+	t.Cleanup(coursesServer.Close)
+
+	clients, err := NewClients(studentsServer.URL, coursesServer.URL, http.DefaultClient)
+	require.NoError(t, err)
+	schema, err := NewSchema()
+	require.NoError(t, err)
+	return NewHandler(schema, clients, limits, log.NewNopLogger()), fake
+}
+
+func query(t *testing.T, h http.Handler, q string) (int, map[string]interface{}) {
+	t.Helper()
+	body, err := json.Marshal(request{Query: q})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result), w.Body.String())
+	return w.Code, result
+}
+
+func TestCoursesAreBatched(t *testing.T) {
+	h, fake := newTestHandler(t, Limits{})
+	code, result := query(t, h, `{
+		a: course(id: "1") { id name }
+		b: course(id: "2") { id name }
+		c: course(id: "1") { name }
+		missing: course(id: "404") { name }
+	}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, result["errors"])
+	require.Equal(t, map[string]interface{}{
+		"a":       map[string]interface{}{"id": "1", "name": "Course 1"},
+		"b":       map[string]interface{}{"id": "2", "name": "Course 2"},
+		"c":       map[string]interface{}{"name": "Course 1"},
+		"missing": nil,
+	}, result["data"])
+	require.Equal(t, 1, fake.requests["/courses"])
+	require.Len(t, fake.ids, 1)
+	require.ElementsMatch(t, []string{"1", "2", "404"}, strings.Split(fake.ids[0], ","))
+}
+
+func TestAPIKeyIsForwarded(t *testing.T) {
+	h, fake := newTestHandler(t, Limits{})
+	body, err := json.Marshal(request{Query: `{ student(id: "1") { courses { name } } }`})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "lms_key")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotEmpty(t, fake.apiKeys)
+	for _, key := range fake.apiKeys {
+		require.Equal(t, "lms_key", key)
+	}
+}
+
+func TestNestedResolution(t *testing.T) {
+	h, fake := newTestHandler(t, Limits{})
+	code, result := query(t, h, `{
+		students(limit: 2) {
+			id
+			phone
+			enrollments { course { name students { fullname } } }
+		}
+	}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, result["errors"])
+
+	list := result["data"].(map[string]interface{})["students"].([]interface{})
+	require.Len(t, list, 2)
+	first := list[0].(map[string]interface{})
+	require.Equal(t, "1", first["id"])
+	require.Equal(t, "77011234567", first["phone"])
+	enrollments := first["enrollments"].([]interface{})
+	require.Len(t, enrollments, 2)
+	enrolled := enrollments[0].(map[string]interface{})["course"].(map[string]interface{})
+	require.Equal(t, "Course 1", enrolled["name"])
+	require.Len(t, enrolled["students"], 2)
+
+	// Every student and course is fetched once; the courses come with the
+	// enrollments and are not looked up again.
+	require.Equal(t, 1, fake.requests["/students"])
+	require.Equal(t, 1, fake.requests["/students/1/courses"])
+	require.Equal(t, 1, fake.requests["/students/2/courses"])
+	require.Equal(t, 1, fake.requests["/courses/1/students"])
+	require.Equal(t, 1, fake.requests["/courses/2/students"])
+	require.Zero(t, fake.requests["/courses"])
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxDepth: 4, MaxComplexity: 100}
+	h, fake := newTestHandler(t, limits)
+
+	testCases := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{
+			name:  "deep",
+			query: `{ student(id: "1") { courses { students { courses { name } } } } }`,
+			err:   ErrQueryTooDeep.Error(),
+		},
+		{
+			name:  "deep fragment",
+			query: `{ student(id: "1") { ...c } } fragment c on Student { courses { students { courses { name } } } }`,
+			err:   ErrQueryTooDeep.Error(),
+		},
+		{
+			name:  "complex",
+			query: `{ students(limit: 50) { courses { name } } }`,
+			err:   ErrQueryTooComplex.Error(),
+		},
+		{
+			name:  "complex default",
+			query: `{ students { courses { name } } }`,
+			err:   ErrQueryTooComplex.Error(),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, result := query(t, h, tc.query)
+			require.Equal(t, http.StatusBadRequest, code)
+			require.Nil(t, result["data"])
+			errs := result["errors"].([]interface{})
+			require.Contains(t, errs[0].(map[string]interface{})["message"], tc.err)
+		})
+	}
+	require.Empty(t, fake.requests)
+
+	code, result := query(t, h, `{ students(limit: 5) { courses { name } } }`)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, result["errors"])
+}
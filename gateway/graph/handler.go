@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gateway/logging"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// maxRequestSize bounds the size of a POSTed query.
+const maxRequestSize = 1 << 20
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type handler struct {
+	schema  graphql.Schema
+	clients Clients
+	limits  Limits
+	logger  log.Logger
+}
+
+// NewHandler returns the GraphQL endpoint. Queries are accepted as a JSON
+// body of POST requests, or as the query, operationName and variables
+// parameters of GET requests.
+func NewHandler(schema graphql.Schema, clients Clients, limits Limits, logger log.Logger) http.Handler {
+	return &handler{schema: schema, clients: clients, limits: limits, logger: logger}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if variables := q.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeErrors(w, http.StatusBadRequest, errors.New("variables must be a JSON object"))
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeErrors(w, http.StatusBadRequest, errors.New("body must be a JSON object with a query"))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeErrors(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if req.Query == "" {
+		writeErrors(w, http.StatusBadRequest, errors.New("query is required"))
+		return
+	}
+
+	// Syntax errors are reported by graphql.Do.
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query)})})
+	if err == nil {
+		if err := h.limits.Check(h.schema, doc, req.OperationName, req.Variables); err != nil {
+			logger := logging.WithContext(r.Context(), h.logger)
+			level.Info(logger).Log("msg", "query rejected", "err", err)
+			writeErrors(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := withCredentials(r.Context(), r.Header)
+	ctx = WithLoaders(ctx, NewLoaders(h.clients))
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	})
+	if result.HasErrors() {
+		logger := logging.WithContext(r.Context(), h.logger)
+		level.Warn(logger).Log("msg", "query failed", "operation", req.OperationName, "errors", len(result.Errors), "err", result.Errors[0].Message)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeErrors(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(graphql.Result{Errors: []gqlerrors.FormattedError{{Message: err.Error()}}})
+}
@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+var (
+	ErrQueryTooDeep    = errors.New("query is too deep")
+	ErrQueryTooComplex = errors.New("query is too complex")
+)
+
+// defaultListSize is the assumed length of a list field without a limit
+// argument.
+const defaultListSize = 10
+
+// Limits bound the cost of a query before it is executed.
+//
+// The depth is the deepest level of nested fields. The complexity counts
+// every field once, multiplied by the length of the lists it is nested in:
+// the limit argument of the list, its default, or defaultListSize.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// Check returns ErrQueryTooDeep or ErrQueryTooComplex when the operation of
+// doc exceeds the limits. Zero limits are not checked. Introspection fields
+// are not counted.
+func (l Limits) Check(schema graphql.Schema, doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	w := walker{
+		schema:    schema,
+		variables: variables,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		visiting:  make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			w.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		// Left to graphql.Do to report.
+		return nil
+	}
+
+	complexity, depth := w.selectionSet(operation.SelectionSet, schema.QueryType(), 1)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("%w: depth %d exceeds %d", ErrQueryTooDeep, depth, l.MaxDepth)
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return fmt.Errorf("%w: complexity %d exceeds %d", ErrQueryTooComplex, complexity, l.MaxComplexity)
+	}
+	return nil
+}
+
+type walker struct {
+	schema    graphql.Schema
+	variables map[string]interface{}
+	fragments map[string]*ast.FragmentDefinition
+	// visiting guards against fragments that spread themselves, which the
+	// validation of graphql.Do rejects later.
+	visiting map[string]bool
+}
+
+// selectionSet returns the complexity of set and the depth of its deepest
+// field; the fields of set are at depth.
+func (w *walker) selectionSet(set *ast.SelectionSet, parent graphql.Type, depth int) (complexity, maxDepth int) {
+	if set == nil {
+		return 0, depth - 1
+	}
+	maxDepth = depth - 1
+	for _, selection := range set.Selections {
+		var c, d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			c, d = w.field(selection, parent, depth)
+		case *ast.InlineFragment:
+			typ := parent
+			if selection.TypeCondition != nil {
+				if t := w.schema.Type(selection.TypeCondition.Name.Value); t != nil {
+					typ = t
+				}
+			}
+			c, d = w.selectionSet(selection.SelectionSet, typ, depth)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := w.fragments[name]
+			if !ok || w.visiting[name] {
+				continue
+			}
+			typ := parent
+			if t := w.schema.Type(fragment.TypeCondition.Name.Value); t != nil {
+				typ = t
+			}
+			w.visiting[name] = true
+			c, d = w.selectionSet(fragment.SelectionSet, typ, depth)
+			delete(w.visiting, name)
+		}
+		complexity += c
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+	return complexity, maxDepth
+}
+
+func (w *walker) field(field *ast.Field, parent graphql.Type, depth int) (complexity, maxDepth int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+	object, ok := graphql.GetNamed(parent).(*graphql.Object)
+	if !ok {
+		return 1, depth
+	}
+	def, ok := object.Fields()[field.Name.Value]
+	if !ok {
+		return 1, depth
+	}
+
+	multiplier := 1
+	if isList(def.Type) {
+		multiplier = w.listSize(field, def)
+	}
+	childComplexity, childDepth := w.selectionSet(field.SelectionSet, def.Type, depth+1)
+	if childDepth < depth {
+		childDepth = depth
+	}
+	return 1 + multiplier*childComplexity, childDepth
+}
+
+// listSize returns the limit argument of a list field, or its default.
+func (w *walker) listSize(field *ast.Field, def *graphql.FieldDefinition) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n >= 0 {
+				return n
+			}
+		case *ast.Variable:
+			// Variables are decoded from JSON.
+			if n, ok := w.variables[value.Name.Value].(float64); ok && n >= 0 {
+				return int(n)
+			}
+		}
+	}
+	for _, arg := range def.Args {
+		if n, ok := arg.DefaultValue.(int); ok && arg.Name() == "limit" {
+			return n
+		}
+	}
+	return defaultListSize
+}
+
+func isList(t graphql.Type) bool {
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	_, ok := t.(*graphql.List)
+	return ok
+}
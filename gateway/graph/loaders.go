@@ -0,0 +1,149 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sdk/courses"
+	"sdk/students"
+
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+const (
+	// loaderWait is how long a loader collects keys before it calls the
+	// service.
+	loaderWait = 2 * time.Millisecond
+	// courseBatchSize is the maximum number of courses fetched per request,
+	// courses_svc accepts up to 100 IDs.
+	courseBatchSize = 100
+)
+
+// Loaders batch and cache the calls to the services made while resolving a
+// single GraphQL request.
+type Loaders struct {
+	clients        Clients
+	students       *dataloader.Loader[string, *students.Student]
+	courses        *dataloader.Loader[string, *courses.Course]
+	studentCourses *dataloader.Loader[string, []courses.Course]
+	courseStudents *dataloader.Loader[string, []students.Student]
+}
+
+// NewLoaders returns the loaders of a request.
+func NewLoaders(c Clients) *Loaders {
+	l := &Loaders{clients: c}
+	l.students = dataloader.NewBatchedLoader(fanOut(func(ctx context.Context, id string) (*students.Student, error) {
+		resp, err := c.Students.GetStudentWithResponse(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.JSON200 != nil:
+			return &resp.JSON200.Student, nil
+		case resp.StatusCode() == http.StatusNotFound:
+			return nil, nil
+		}
+		return nil, upstreamError("students", resp.StatusCode(), resp.Body)
+	}), dataloader.WithWait[string, *students.Student](loaderWait))
+
+	// courses_svc answers many IDs at once, so the courses are really
+	// batched.
+	l.courses = dataloader.NewBatchedLoader(l.batchCourses(c), dataloader.WithWait[string, *courses.Course](loaderWait), dataloader.WithBatchCapacity[string, *courses.Course](courseBatchSize))
+
+	l.studentCourses = dataloader.NewBatchedLoader(fanOut(func(ctx context.Context, id string) ([]courses.Course, error) {
+		resp, err := c.Students.GetStudentCoursesWithResponse(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			return nil, upstreamError("students", resp.StatusCode(), resp.Body)
+		}
+		list := make([]courses.Course, 0, len(resp.JSON200.Courses))
+		for _, course := range resp.JSON200.Courses {
+			list = append(list, courses.Course{ID: course.ID, Name: course.Name, Version: course.Version})
+		}
+		for i := range list {
+			l.courses.Prime(ctx, strconv.FormatInt(list[i].ID, 10), &list[i])
+		}
+		return list, nil
+	}), dataloader.WithWait[string, []courses.Course](loaderWait))
+
+	l.courseStudents = dataloader.NewBatchedLoader(fanOut(func(ctx context.Context, id string) ([]students.Student, error) {
+		resp, err := c.Students.GetCourseStudentsWithResponse(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			return nil, upstreamError("students", resp.StatusCode(), resp.Body)
+		}
+		list := resp.JSON200.Students
+		for i := range list {
+			l.students.Prime(ctx, strconv.FormatInt(list[i].ID, 10), &list[i])
+		}
+		return list, nil
+	}), dataloader.WithWait[string, []students.Student](loaderWait))
+	return l
+}
+
+// batchCourses fetches the courses of a batch with a single request to
+// courses_svc. Courses that do not exist resolve to nil.
+func (l *Loaders) batchCourses(c Clients) dataloader.BatchFunc[string, *courses.Course] {
+	return func(ctx context.Context, ids []string) []*dataloader.Result[*courses.Course] {
+		results := make([]*dataloader.Result[*courses.Course], len(ids))
+		resp, err := c.Courses.ListCoursesWithResponse(ctx, &courses.ListCoursesParams{Ids: &ids})
+		if err == nil && resp.JSON200 == nil {
+			err = upstreamError("courses", resp.StatusCode(), resp.Body)
+		}
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[*courses.Course]{Error: err}
+			}
+			return results
+		}
+
+		found := make(map[string]*courses.Course)
+		if resp.JSON200.Courses != nil {
+			for i, course := range *resp.JSON200.Courses {
+				found[strconv.FormatInt(course.ID, 10)] = &(*resp.JSON200.Courses)[i]
+			}
+		}
+		for i, id := range ids {
+			results[i] = &dataloader.Result[*courses.Course]{Data: found[id]}
+		}
+		return results
+	}
+}
+
+// fanOut turns a call for a single key into a batch function that makes the
+// calls of a batch concurrently. It is used for the services that have no
+// batch endpoint; the loader still deduplicates and caches the keys.
+func fanOut[V any](load func(ctx context.Context, key string) (V, error)) dataloader.BatchFunc[string, V] {
+	return func(ctx context.Context, keys []string) []*dataloader.Result[V] {
+		results := make([]*dataloader.Result[V], len(keys))
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			wg.Add(1)
+			go func(i int, key string) {
+				defer wg.Done()
+				v, err := load(ctx, key)
+				results[i] = &dataloader.Result[V]{Data: v, Error: err}
+			}(i, key)
+		}
+		wg.Wait()
+		return results
+	}
+}
+
+type loadersKey struct{}
+
+// WithLoaders returns a copy of ctx carrying loaders.
+func WithLoaders(ctx context.Context, loaders *Loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, loaders)
+}
+
+func loadersFrom(ctx context.Context) *Loaders {
+	return ctx.Value(loadersKey{}).(*Loaders)
+}
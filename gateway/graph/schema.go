@@ -0,0 +1,299 @@
+// Package graph serves a GraphQL API over students_svc and courses_svc.
+// Students, courses and enrollments are resolved through the sdk clients,
+// batched per request by dataloaders.
+package graph
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"sdk/courses"
+	"sdk/students"
+
+	"github.com/graphql-go/graphql"
+)
+
+// enrollment is a student enrolled in a course.
+type enrollment struct {
+	student *students.Student
+	course  *courses.Course
+}
+
+// defaultPageSize is the page size of the root lists without a limit.
+const defaultPageSize = 20
+
+// NewSchema returns the GraphQL schema:
+//
+//	type Query {
+//	  student(id: ID!): Student
+//	  students(limit: Int = 20, offset: Int = 0): [Student!]!
+//	  course(id: ID!): Course
+//	  courses(limit: Int = 20, offset: Int = 0): [Course!]!
+//	}
+func NewSchema() (graphql.Schema, error) {
+	var studentType, courseType, enrollmentType *graphql.Object
+
+	studentType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Student",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.ID),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return strconv.FormatInt(p.Source.(*students.Student).ID, 10), nil
+					},
+				},
+				"fullname": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*students.Student).Fullname, nil
+					},
+				},
+				"dateOfBirth": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "RFC 3339 date and time.",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*students.Student).DateOfBirth.Format(time.RFC3339), nil
+					},
+				},
+				"grade": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Int),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*students.Student).Grade, nil
+					},
+				},
+				"phone": &graphql.Field{
+					// Phone numbers don't fit the 32 bits of Int.
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return strconv.FormatInt(p.Source.(*students.Student).Phone, 10), nil
+					},
+				},
+				"version": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Int),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return int(p.Source.(*students.Student).Version), nil
+					},
+				},
+				"courses": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(courseType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						student := p.Source.(*students.Student)
+						thunk := loadersFrom(p.Context).studentCourses.Load(p.Context, strconv.FormatInt(student.ID, 10))
+						return func() (interface{}, error) {
+							list, err := thunk()
+							if err != nil {
+								return nil, err
+							}
+							result := make([]*courses.Course, len(list))
+							for i := range list {
+								result[i] = &list[i]
+							}
+							return result, nil
+						}, nil
+					},
+				},
+				"enrollments": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(enrollmentType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						student := p.Source.(*students.Student)
+						thunk := loadersFrom(p.Context).studentCourses.Load(p.Context, strconv.FormatInt(student.ID, 10))
+						return func() (interface{}, error) {
+							list, err := thunk()
+							if err != nil {
+								return nil, err
+							}
+							result := make([]enrollment, len(list))
+							for i := range list {
+								result[i] = enrollment{student: student, course: &list[i]}
+							}
+							return result, nil
+						}, nil
+					},
+				},
+			}
+		}),
+	})
+
+	courseType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Course",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.ID),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return strconv.FormatInt(p.Source.(*courses.Course).ID, 10), nil
+					},
+				},
+				"name": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*courses.Course).Name, nil
+					},
+				},
+				"version": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Int),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return int(p.Source.(*courses.Course).Version), nil
+					},
+				},
+				"students": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(studentType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						course := p.Source.(*courses.Course)
+						thunk := loadersFrom(p.Context).courseStudents.Load(p.Context, strconv.FormatInt(course.ID, 10))
+						return func() (interface{}, error) {
+							list, err := thunk()
+							if err != nil {
+								return nil, err
+							}
+							result := make([]*students.Student, len(list))
+							for i := range list {
+								result[i] = &list[i]
+							}
+							return result, nil
+						}, nil
+					},
+				},
+				"enrollments": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(enrollmentType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						course := p.Source.(*courses.Course)
+						thunk := loadersFrom(p.Context).courseStudents.Load(p.Context, strconv.FormatInt(course.ID, 10))
+						return func() (interface{}, error) {
+							list, err := thunk()
+							if err != nil {
+								return nil, err
+							}
+							result := make([]enrollment, len(list))
+							for i := range list {
+								result[i] = enrollment{student: &list[i], course: course}
+							}
+							return result, nil
+						}, nil
+					},
+				},
+			}
+		}),
+	})
+
+	enrollmentType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Enrollment",
+		Description: "A student enrolled in a course.",
+		Fields: graphql.Fields{
+			"student": &graphql.Field{
+				Type: graphql.NewNonNull(studentType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(enrollment).student, nil
+				},
+			},
+			"course": &graphql.Field{
+				Type: graphql.NewNonNull(courseType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(enrollment).course, nil
+				},
+			},
+		},
+	})
+
+	pageArgs := graphql.FieldConfigArgument{
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	}
+	idArgs := graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"student": &graphql.Field{
+				Type: studentType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thunk := loadersFrom(p.Context).students.Load(p.Context, p.Args["id"].(string))
+					return func() (interface{}, error) {
+						student, err := thunk()
+						if err != nil || student == nil {
+							return nil, err
+						}
+						return student, nil
+					}, nil
+				},
+			},
+			"students": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(studentType))),
+				Args: pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return listStudents(p.Context, p.Args["limit"].(int), p.Args["offset"].(int))
+				},
+			},
+			"course": &graphql.Field{
+				Type: courseType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					thunk := loadersFrom(p.Context).courses.Load(p.Context, p.Args["id"].(string))
+					return func() (interface{}, error) {
+						course, err := thunk()
+						if err != nil || course == nil {
+							return nil, err
+						}
+						return course, nil
+					}, nil
+				},
+			},
+			"courses": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(courseType))),
+				Args: pageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return listCourses(p.Context, p.Args["limit"].(int), p.Args["offset"].(int))
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+func listStudents(ctx context.Context, limit, offset int) ([]*students.Student, error) {
+	l := loadersFrom(ctx)
+	resp, err := l.clients.Students.ListStudentsWithResponse(ctx, &students.ListStudentsParams{Limit: &limit, Offset: &offset})
+	if err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, upstreamError("students", resp.StatusCode(), resp.Body)
+	}
+	var result []*students.Student
+	if resp.JSON200.Students != nil {
+		list := *resp.JSON200.Students
+		result = make([]*students.Student, len(list))
+		for i := range list {
+			result[i] = &list[i]
+			l.students.Prime(ctx, strconv.FormatInt(list[i].ID, 10), &list[i])
+		}
+	}
+	return result, nil
+}
+
+func listCourses(ctx context.Context, limit, offset int) ([]*courses.Course, error) {
+	l := loadersFrom(ctx)
+	resp, err := l.clients.Courses.ListCoursesWithResponse(ctx, &courses.ListCoursesParams{Limit: &limit, Offset: &offset})
+	if err != nil {
+		return nil, err
+	}
+	if resp.JSON200 == nil {
+		return nil, upstreamError("courses", resp.StatusCode(), resp.Body)
+	}
+	var result []*courses.Course
+	if resp.JSON200.Courses != nil {
+		list := *resp.JSON200.Courses
+		result = make([]*courses.Course, len(list))
+		for i := range list {
+			result[i] = &list[i]
+			l.courses.Prime(ctx, strconv.FormatInt(list[i].ID, 10), &list[i])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package logging
+
+import "encoding/json"
+
+// redacted replaces personal data in logged values.
+const redacted = "[REDACTED]"
+
+// PII are the JSON fields that are never logged.
+var PII = map[string]bool{
+	"phone":           true,
+	"email":           true,
+	"date_of_birth":   true,
+	"password":        true,
+	"hashed_password": true,
+}
+
+// Redact returns v, as it is encoded to JSON, with the PII fields replaced.
+func Redact(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	return redact(decoded)
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if PII[k] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redact(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return v
+}
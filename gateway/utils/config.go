@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Config stores all configuration of the application.
+// The values are read by viper from a config file or environment variable.
+type Config struct {
+	StudentsHTTPServerAddress string        `mapstructure:"STUDENTS_HTTP_SERVER_ADDRESS"`
+	CoursesHTTPServerAddress  string        `mapstructure:"COURSES_HTTP_SERVER_ADDRESS"`
+	UpstreamTimeout           time.Duration `mapstructure:"UPSTREAM_TIMEOUT"`
+	GraphQLMaxDepth           int           `mapstructure:"GRAPHQL_MAX_DEPTH"`
+	GraphQLMaxComplexity      int           `mapstructure:"GRAPHQL_MAX_COMPLEXITY"`
+	LogLevel                  string        `mapstructure:"LOG_LEVEL"`
+}
+
+// LoadConfig reads configuration from file or environment variables.
+func LoadConfig(path string) (config Config, err error) {
+	viper.AddConfigPath(path)
+	viper.SetConfigName("app")
+	viper.SetConfigType("env")
+
+	viper.AutomaticEnv()
+
+	err = viper.ReadInConfig()
+	if err != nil {
+		return
+	}
+
+	err = viper.Unmarshal(&config)
+	return
+}
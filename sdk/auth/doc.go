@@ -0,0 +1,4 @@
+// Package auth is the client of auth_svc, generated from its OpenAPI spec.
+package auth
+
+//go:generate oapi-codegen -package auth -generate types,client -o auth.gen.go ../../auth_svc/api/openapi.yaml
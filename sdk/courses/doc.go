@@ -0,0 +1,4 @@
+// Package courses is the client of courses_svc, generated from its OpenAPI spec.
+package courses
+
+//go:generate oapi-codegen -package courses -generate types,client -o courses.gen.go ../../courses_svc/service/openapi.yaml
@@ -0,0 +1,4 @@
+// Package students is the client of students_svc, generated from its OpenAPI spec.
+package students
+
+//go:generate oapi-codegen -package students -generate types,client -o students.gen.go ../../students_svc/service/openapi.yaml
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	authsdk "sdk/auth"
+)
+
+// APIKeyVerifier checks API keys issued by auth_svc
+type APIKeyVerifier interface {
+	// VerifyAPIKey returns the payload of what the key grants
+	VerifyAPIKey(ctx context.Context, key string) (*Payload, error)
+}
+
+// SDKAPIKeyVerifier asks auth_svc to verify the keys, so revoked keys are
+// refused right away and the last use of the keys is recorded
+type SDKAPIKeyVerifier struct {
+	client authsdk.ClientWithResponsesInterface
+}
+
+// NewSDKAPIKeyVerifier creates a new SDKAPIKeyVerifier
+func NewSDKAPIKeyVerifier(client authsdk.ClientWithResponsesInterface) *SDKAPIKeyVerifier {
+	return &SDKAPIKeyVerifier{client}
+}
+
+func (v *SDKAPIKeyVerifier) VerifyAPIKey(ctx context.Context, key string) (*Payload, error) {
+	rsp, err := v.client.VerifyAPIKeyWithResponse(ctx, authsdk.VerifyAPIKeyRequest{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	switch rsp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusUnauthorized:
+		return nil, ErrInvalidToken
+	default:
+		return nil, fmt.Errorf("auth_svc answered %s", rsp.Status())
+	}
+
+	verification := rsp.JSON200
+	payload := &Payload{
+		APIKeyID: verification.KeyID,
+		TenantID: verification.TenantID,
+		Scopes:   verification.Scopes,
+		IssuedAt: time.Now(),
+	}
+	if verification.Username != nil {
+		payload.Username = *verification.Username
+	}
+	if verification.StudentID != nil {
+		payload.StudentID = *verification.StudentID
+	}
+	if verification.ClientID != nil {
+		payload.ClientID = *verification.ClientID
+	}
+	if verification.ExpiresAt != nil {
+		payload.ExpiredAt = *verification.ExpiresAt
+	}
+	return payload, nil
+}
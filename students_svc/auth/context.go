@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+type contextKey int
+
+const (
+	payloadContextKey contextKey = iota
+	credentialsContextKey
+)
+
+const (
+	authorizationHeaderKey  = "Authorization"
+	apiKeyHeaderKey         = "X-API-Key"
+	authorizationTypeBearer = "bearer"
+	anonymousActor          = "anonymous"
+)
+
+// HTTPToContext returns a RequestFunc that verifies the bearer token or the
+// X-API-Key header of the request, if any, and stores its payload in the
+// context. Requests without valid credentials are passed through unchanged;
+// HTTPMiddleware refuses them instead. A nil denylist is not checked. API
+// keys are not accepted when apiKeys is nil.
+func HTTPToContext(verifier Verifier, denylist Denylist, apiKeys APIKeyVerifier) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		payload, err := authenticate(ctx, r, verifier, denylist, apiKeys)
+		if err != nil || payload == nil {
+			return ctx
+		}
+		return NewContext(ctx, payload)
+	}
+}
+
+// HTTPMiddleware authenticates the requests as HTTPToContext does, before
+// they reach the middlewares that need to know the caller, such as the
+// idempotency middleware, and the endpoints. Requests with a token or API
+// key that is invalid, expired or revoked are answered with 401, and the
+// ones whose credentials can not be verified, because the denylist can not
+// be read or auth_svc does not answer, with 503. The credentials of the
+// request are kept in the context for ForwardCredentials.
+func HTTPMiddleware(verifier Verifier, denylist Denylist, apiKeys APIKeyVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, err := authenticate(r.Context(), r, verifier, denylist, apiKeys)
+			if err != nil {
+				encodeError(w, err)
+				return
+			}
+			ctx := r.Context()
+			if payload != nil {
+				ctx = NewContext(ctx, payload)
+				ctx = context.WithValue(ctx, credentialsContextKey, http.Header{
+					authorizationHeaderKey: r.Header.Values(authorizationHeaderKey),
+					apiKeyHeaderKey:        r.Header.Values(apiKeyHeaderKey),
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ErrUnverifiable is returned when the credentials of a request can not be
+// verified, e.g. because Redis or auth_svc is down.
+var ErrUnverifiable = errors.New("credentials can not be verified")
+
+// authenticate returns the payload of the credentials of r, or nil when r
+// has none. It fails with ErrInvalidToken, ErrExpiredToken or
+// ErrRevokedToken when the credentials are not valid, including API keys
+// when apiKeys is nil, and with ErrUnverifiable when they can not be
+// verified.
+func authenticate(ctx context.Context, r *http.Request, verifier Verifier, denylist Denylist, apiKeys APIKeyVerifier) (*Payload, error) {
+	if key := r.Header.Get(apiKeyHeaderKey); key != "" {
+		if apiKeys == nil {
+			return nil, ErrInvalidToken
+		}
+		payload, err := apiKeys.VerifyAPIKey(ctx, key)
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnverifiable, err)
+		}
+		return payload, nil
+	}
+
+	fields := strings.Fields(r.Header.Get(authorizationHeaderKey))
+	if len(fields) < 2 || strings.ToLower(fields[0]) != authorizationTypeBearer {
+		return nil, nil
+	}
+	payload, err := verifier.VerifyToken(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	if denylist != nil {
+		revoked, err := denylist.IsRevoked(ctx, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnverifiable, err)
+		}
+		if revoked {
+			return nil, ErrRevokedToken
+		}
+	}
+	return payload, nil
+}
+
+// encodeError answers a request that failed authentication, in the format of
+// the errors of the services.
+func encodeError(w http.ResponseWriter, err error) {
+	code := http.StatusUnauthorized
+	if errors.Is(err, ErrUnverifiable) {
+		code = http.StatusServiceUnavailable
+		err = ErrUnverifiable
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// ForwardCredentials is a request editor of the sdk clients. It sends the
+// credentials of the request being served along, so that the other service
+// acts for the same caller, in the same tenant.
+func ForwardCredentials(ctx context.Context, req *http.Request) error {
+	credentials, ok := ctx.Value(credentialsContextKey).(http.Header)
+	if !ok {
+		return nil
+	}
+	for key, values := range credentials {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return nil
+}
+
+// NewContext returns a copy of ctx carrying the token payload.
+func NewContext(ctx context.Context, payload *Payload) context.Context {
+	return context.WithValue(ctx, payloadContextKey, payload)
+}
+
+// FromContext returns the token payload stored in ctx, if any.
+func FromContext(ctx context.Context) (*Payload, bool) {
+	payload, ok := ctx.Value(payloadContextKey).(*Payload)
+	return payload, ok
+}
+
+// TenantID returns the tenant of the caller. It is not ok for anonymous
+// requests and for tokens issued before there were tenants, which must not
+// be served.
+func TenantID(ctx context.Context) (int64, bool) {
+	payload, ok := FromContext(ctx)
+	if !ok || payload.TenantID == 0 {
+		return 0, false
+	}
+	return payload.TenantID, true
+}
+
+// Actor returns the username of the caller, "client:<id>" for an OAuth2
+// client or its API key acting on its own behalf, or "anonymous" when the request was not
+// authenticated.
+func Actor(ctx context.Context) string {
+	if payload, ok := FromContext(ctx); ok {
+		if payload.Username == "" {
+			return "client:" + payload.ClientID
+		}
+		return payload.Username
+	}
+	return anonymousActor
+}
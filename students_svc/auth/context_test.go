@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// stubAPIKeys knows the keys of its map. It can not verify "lms_down".
+type stubAPIKeys map[string]*Payload
+
+func (keys stubAPIKeys) VerifyAPIKey(_ context.Context, key string) (*Payload, error) {
+	if payload, ok := keys[key]; ok {
+		return payload, nil
+	}
+	if key == "lms_down" {
+		return nil, errors.New("connection refused")
+	}
+	return nil, ErrInvalidToken
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	verifier, err := NewJWTVerifier("12345678901234567890123456789012")
+	require.NoError(t, err)
+	apiKeys := stubAPIKeys{
+		"lms_north": {Username: "john", TenantID: 2, APIKeyID: 1},
+		"lms_old":   {Username: "jane", APIKeyID: 2},
+	}
+
+	// The handler calls another service with the credentials of the caller.
+	var tenantID int64
+	var hasTenant bool
+	var forwarded http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, hasTenant = TenantID(r.Context())
+		req := httptest.NewRequest(http.MethodGet, "http://other/", nil)
+		require.NoError(t, ForwardCredentials(r.Context(), req))
+		forwarded = req.Header
+	})
+	handler := HTTPMiddleware(verifier, nil, apiKeys)(next)
+	serve := func(handler http.Handler, key string) int {
+		tenantID, hasTenant, forwarded = 0, false, nil
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve(handler, "lms_north"))
+	require.Equal(t, int64(2), tenantID)
+	require.True(t, hasTenant)
+	require.Equal(t, "lms_north", forwarded.Get("X-API-Key"))
+	require.Empty(t, forwarded.Get("Authorization"))
+
+	// Callers without a tenant do not fall back to any tenant, the
+	// endpoints refuse them.
+	require.Equal(t, http.StatusOK, serve(handler, "lms_old"))
+	require.False(t, hasTenant)
+
+	// Invalid keys are refused, and keys that can not be verified are not
+	// served anonymously either.
+	require.Equal(t, http.StatusUnauthorized, serve(handler, "lms_unknown"))
+	require.Equal(t, http.StatusServiceUnavailable, serve(handler, "lms_down"))
+	require.Nil(t, forwarded)
+
+	// Without a verifier, API keys are not accepted.
+	require.Equal(t, http.StatusUnauthorized, serve(HTTPMiddleware(verifier, nil, nil)(next), "lms_north"))
+}
+
+// stubDenylist revokes the tokens of its map and fails for the others when
+// down.
+type stubDenylist struct {
+	revoked map[string]bool
+	down    bool
+}
+
+func (d stubDenylist) IsRevoked(_ context.Context, payload *Payload) (bool, error) {
+	if d.down {
+		return false, errors.New("connection refused")
+	}
+	return d.revoked[payload.ID], nil
+}
+
+func TestHTTPMiddlewareBearerToken(t *testing.T) {
+	const secretKey = "12345678901234567890123456789012"
+	verifier, err := NewJWTVerifier(secretKey)
+	require.NoError(t, err)
+	token := func(id string, expiredAt time.Time) string {
+		payload := Payload{ID: id, Username: "john", TenantID: 2, IssuedAt: time.Now(), ExpiredAt: expiredAt}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &payload).SignedString([]byte(secretKey))
+		require.NoError(t, err)
+		return signed
+	}
+	valid := token("t1", time.Now().Add(time.Minute))
+	revoked := token("t2", time.Now().Add(time.Minute))
+	expired := token("t3", time.Now().Add(-time.Minute))
+	denylist := stubDenylist{revoked: map[string]bool{"t2": true}}
+
+	testCases := []struct {
+		name     string
+		denylist Denylist
+		header   string
+		status   int
+		actor    string
+	}{
+		{name: "valid", denylist: denylist, header: "Bearer " + valid, status: http.StatusOK, actor: "john"},
+		{name: "no denylist", header: "Bearer " + revoked, status: http.StatusOK, actor: "john"},
+		{name: "no credentials", denylist: denylist, status: http.StatusOK, actor: "anonymous"},
+		{name: "revoked", denylist: denylist, header: "Bearer " + revoked, status: http.StatusUnauthorized},
+		{name: "expired", denylist: denylist, header: "Bearer " + expired, status: http.StatusUnauthorized},
+		{name: "invalid", denylist: denylist, header: "Bearer " + valid + "x", status: http.StatusUnauthorized},
+		{name: "denylist down", denylist: stubDenylist{down: true}, header: "Bearer " + valid, status: http.StatusServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var actor string
+			handler := HTTPMiddleware(verifier, tc.denylist, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = Actor(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, tc.status, w.Code)
+			require.Equal(t, tc.actor, actor)
+			if tc.status == http.StatusUnauthorized {
+				require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+				require.Contains(t, w.Body.String(), `"error"`)
+			}
+		})
+	}
+}
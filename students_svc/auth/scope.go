@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+var (
+	// ErrUnauthenticated is returned when the request has no valid token or
+	// API key, or its token does not name a tenant.
+	ErrUnauthenticated = errors.New("authentication is required")
+	// ErrInsufficientScope is returned when the token or API key of the
+	// caller does not grant the scope of the endpoint.
+	ErrInsufficientScope = errors.New("token does not grant the required scope")
+)
+
+// The scopes of the endpoints of students_svc and courses_svc, as granted
+// by auth_svc.
+const (
+	ScopeStudentsRead  = "students:read"
+	ScopeStudentsWrite = "students:write"
+	ScopeCoursesRead   = "courses:read"
+	ScopeCoursesWrite  = "courses:write"
+)
+
+// RequireScope refuses anonymous requests, and the ones of tokens without a
+// tenant, with ErrUnauthenticated, and the requests whose token or API key
+// does not grant scope with ErrInsufficientScope, see HasScope.
+func RequireScope(scope string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if _, ok := TenantID(ctx); !ok {
+				return nil, ErrUnauthenticated
+			}
+			if payload, _ := FromContext(ctx); !payload.HasScope(scope) {
+				return nil, ErrInsufficientScope
+			}
+			return next(ctx, request)
+		}
+	}
+}
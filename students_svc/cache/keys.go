@@ -0,0 +1,11 @@
+package cache
+
+import "strconv"
+
+// CourseKey is the cache key of a course of a tenant. It is shared by
+// courses_svc and students_svc, so that courses_svc invalidates the entries
+// cached by students_svc when both use Redis. The id is a number, so that
+// every spelling of an id, such as "01" and "1", has the same key.
+func CourseKey(tenantID int64, id int64) string {
+	return "course:" + strconv.FormatInt(tenantID, 10) + ":" + strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+	_, err = c.Get(ctx, "b")
+	require.ErrorIs(t, err, ErrCacheMiss)
+	value, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), value)
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), -time.Second))
+	_, err := c.Get(ctx, "a")
+	require.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, c.Delete(ctx, "a"))
+	_, err := c.Get(ctx, "a")
+	require.ErrorIs(t, err, ErrCacheMiss)
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache stores values in Redis, so that they are shared between
+// instances and services.
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache creates a new RedisCache
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	return c.client.Del(ctx, keys...).Err()
+}
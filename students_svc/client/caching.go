@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"students/auth"
+	"students/cache"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// NewCachingClient decorates c so that GetCourse and GetCourses are answered
+// from the cache while the entries are fresh. courses_svc deletes the entry
+// when the course is updated or deleted. The entries are kept per tenant,
+// the tenant of the caller whose credentials are forwarded, and only served
+// to the callers that courses_svc would serve, see cachingTenant.
+func NewCachingClient(c CourseServiceClient, courseCache cache.Cache, ttl time.Duration) CourseServiceClient {
+	c.GetCourseEndpoint = cachingGetCourse(courseCache, ttl)(c.GetCourseEndpoint)
+	c.GetCoursesEndpoint = cachingGetCourses(courseCache, ttl)(c.GetCoursesEndpoint)
+	return c
+}
+
+func cachingGetCourse(courseCache cache.Cache, ttl time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key, ok := courseKey(ctx, request.(getCourseRequest).ID)
+			if !ok {
+				return next(ctx, request)
+			}
+			if value, err := courseCache.Get(ctx, key); err == nil {
+				var course Course
+				if err := json.Unmarshal(value, &course); err == nil {
+					return getCourseResponse{Course: course}, nil
+				}
+			}
+
+			response, err := next(ctx, request)
+			if err != nil {
+				return response, err
+			}
+			if resp := response.(getCourseResponse); resp.Err == nil {
+				if value, err := json.Marshal(resp.Course); err == nil {
+					courseCache.Set(ctx, key, value, ttl)
+				}
+			}
+			return response, nil
+		}
+	}
+}
+
+// cachingGetCourses only asks courses_svc for the courses that are not cached.
+// The IDs that are not numbers, and the requests that can not be served from
+// the cache, are always sent to courses_svc, which rejects them.
+func cachingGetCourses(courseCache cache.Cache, ttl time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			tenantID, ok := cachingTenant(ctx)
+			if !ok {
+				return next(ctx, request)
+			}
+			requestIDs := request.(getCoursesRequest).IDs
+			ids := make([]string, 0, len(requestIDs))
+			for _, id := range requestIDs {
+				ID, err := strconv.ParseInt(id, 10, 64)
+				if err != nil {
+					return next(ctx, request)
+				}
+				ids = append(ids, strconv.FormatInt(ID, 10))
+			}
+			found := make(map[string]Course, len(ids))
+			misses := make([]string, 0, len(ids))
+			for _, id := range ids {
+				key, _ := courseKey(ctx, id)
+				if value, err := courseCache.Get(ctx, key); err == nil {
+					var course Course
+					if err := json.Unmarshal(value, &course); err == nil {
+						found[id] = course
+						continue
+					}
+				}
+				misses = append(misses, id)
+			}
+
+			missing := []string{}
+			if len(misses) > 0 {
+				response, err := next(ctx, getCoursesRequest{IDs: misses})
+				if err != nil {
+					return response, err
+				}
+				resp := response.(getCoursesResponse)
+				if resp.Err != nil {
+					return resp, nil
+				}
+				for _, course := range resp.Courses {
+					id := strconv.FormatInt(course.ID, 10)
+					found[id] = course
+					if value, err := json.Marshal(course); err == nil {
+						courseCache.Set(ctx, cache.CourseKey(tenantID, course.ID), value, ttl)
+					}
+				}
+				missing = resp.Missing
+			}
+
+			courses := make([]Course, 0, len(found))
+			seen := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				if course, ok := found[id]; ok && !seen[id] {
+					seen[id] = true
+					courses = append(courses, course)
+				}
+			}
+			return getCoursesResponse{Courses: courses, Missing: missing}, nil
+		}
+	}
+}
+
+// courseKey returns the cache key of the course of the tenant of the caller,
+// or false when id is not a number or the caller is not served from the
+// cache. "01" and "1" share a key.
+func courseKey(ctx context.Context, id string) (string, bool) {
+	tenantID, ok := cachingTenant(ctx)
+	if !ok {
+		return "", false
+	}
+	ID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return cache.CourseKey(tenantID, ID), true
+}
+
+// cachingTenant returns the tenant of the cache entries of the caller, or
+// false when the caller has no tenant or lacks the courses:read scope that
+// courses_svc checks, so that a cache hit never serves a course courses_svc
+// would refuse.
+func cachingTenant(ctx context.Context) (int64, bool) {
+	payload, ok := auth.FromContext(ctx)
+	if !ok || !payload.HasScope(auth.ScopeCoursesRead) {
+		return 0, false
+	}
+	return auth.TenantID(ctx)
+}
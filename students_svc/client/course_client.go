@@ -2,56 +2,94 @@ package client
 
 import (
 	"context"
-	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
-	"path"
 	"strings"
-	"time"
 
-	"github.com/go-kit/kit/circuitbreaker"
+	"students/auth"
+	"students/logging"
+	"students/resilience"
+	"students/tracing"
+
+	"sdk/courses"
+
 	"github.com/go-kit/kit/endpoint"
-	"github.com/go-kit/kit/ratelimit"
-	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
 	"github.com/go-kit/log"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Course struct {
-	ID   int64  `json:"id,omitempty"`
-	Name string `json:"name"`
-}
+// Course is a course of courses_svc.
+type Course = courses.Course
 
 type CourseServiceClient struct {
-	GetCourseEndpoint endpoint.Endpoint
+	GetCourseEndpoint  endpoint.Endpoint
+	GetCoursesEndpoint endpoint.Endpoint
 }
 
-func NewHTTPClient(instance string, logger log.Logger) (CourseServiceClient, error) {
-	if !strings.HasPrefix(instance, "http") {
-		instance = "http://" + instance
-	}
-	u, err := url.Parse(instance)
-	if err != nil {
-		return CourseServiceClient{}, err
-	}
+// NewHTTPClient returns a client of the courses service. Requests are
+// balanced round-robin over the instances of instancer. The endpoints are
+// wrapped according to the "CourseClient/<method>" policies, with a circuit
+// breaker per instance.
+func NewHTTPClient(instancer sd.Instancer, logger log.Logger, policies resilience.Config, m Metrics) CourseServiceClient {
+	httpClient := tracing.NewClient()
 
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
 	var getCourseEndpoint endpoint.Endpoint
 	{
-		getCourseEndpoint = httptransport.NewClient(
-			"GET",
-			copyURL(u, "/courses"),
-			encodeGetCourseRequest,
-			decodeGetCourseResponse,
-		).Endpoint()
-		getCourseEndpoint = limiter(getCourseEndpoint)
-		getCourseEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(getCourseEndpoint)
+		getCourseEndpoint = balance(instancer, httpClient, "CourseClient/GetCourse", policies, m, logger, makeGetCourseEndpoint)
+	}
+
+	var getCoursesEndpoint endpoint.Endpoint
+	{
+		getCoursesEndpoint = balance(instancer, httpClient, "CourseClient/GetCourses", policies, m, logger, makeGetCoursesEndpoint)
 	}
 
 	return CourseServiceClient{
-		GetCourseEndpoint: getCourseEndpoint,
-	}, nil
+		GetCourseEndpoint:  getCourseEndpoint,
+		GetCoursesEndpoint: getCoursesEndpoint,
+	}
+}
+
+// balance returns an endpoint that round-robins over the instances of
+// instancer, guarded by the policy of name, instrumented and traced in a
+// span of that name. makeEndpoint builds the endpoint of a single instance
+// from its sdk client, which gets its own circuit breaker.
+func balance(instancer sd.Instancer, httpClient *http.Client, name string, policies resilience.Config, m Metrics, logger log.Logger, makeEndpoint func(c *courses.ClientWithResponses) endpoint.Endpoint) endpoint.Endpoint {
+	policy := policies.Policy(name)
+	factory := func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		if !strings.HasPrefix(instance, "http") {
+			instance = "http://" + instance
+		}
+		u, err := url.Parse(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := courses.NewClientWithResponses(u.String(),
+			courses.WithHTTPClient(httpClient),
+			courses.WithRequestEditorFn(logging.PropagateRequestID),
+			courses.WithRequestEditorFn(auth.ForwardCredentials),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		e := timeoutErrors(makeEndpoint(c))
+		e = resilience.Breaker(name+"@"+u.Host, policy.Breaker, m.BreakerState, nil)(e)
+		return e, nil, nil
+	}
+
+	balancer := lb.NewRoundRobin(sd.NewEndpointer(instancer, factory, logger))
+	balanced := func(ctx context.Context, request interface{}) (interface{}, error) {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return e(ctx, request)
+	}
+	e := resilience.Guard(policy)(balanced)
+	e = instrumenting(name, m.RequestDuration)(e)
+	return tracing.EndpointMiddleware(name, trace.SpanKindClient)(e)
 }
 
 func (c *CourseServiceClient) GetCourse(ctx context.Context, id string) (Course, error) {
@@ -66,31 +104,83 @@ func (c *CourseServiceClient) GetCourse(ctx context.Context, id string) (Course,
 	return resp.Course, nil
 }
 
+// GetCourses fetches the courses with the given IDs in a single round-trip.
+// Courses are returned in the order of ids; IDs of courses that do not exist
+// are returned in missing.
+func (c *CourseServiceClient) GetCourses(ctx context.Context, ids []string) (courses []Course, missing []string, err error) {
+	response, err := c.GetCoursesEndpoint(ctx, getCoursesRequest{IDs: ids})
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := response.(getCoursesResponse)
+	if resp.Err != nil {
+		return nil, nil, resp.Err
+	}
+	return resp.Courses, resp.Missing, nil
+}
+
 type getCourseRequest struct {
 	ID string
 }
 
 type getCourseResponse struct {
 	Course Course
-	Err    error `json:"error,omitempty"`
+	Err    error `json:"-"`
 }
 
-func decodeGetCourseResponse(_ context.Context, resp *http.Response) (interface{}, error) {
-	var response getCourseResponse
-	err := json.NewDecoder(resp.Body).Decode(&response)
-	return response, err
-}
+func (r getCourseResponse) Failed() error { return r.Err }
 
-func encodeGetCourseRequest(_ context.Context, req *http.Request, request interface{}) error {
-	r := request.(getCourseRequest)
+func makeGetCourseEndpoint(c *courses.ClientWithResponses) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getCourseRequest)
+		resp, err := c.GetCourseWithResponse(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			err := statusError(resp.StatusCode(), resp.Body)
+			if err.Temporary() {
+				return nil, err
+			}
+			return getCourseResponse{Err: err}, nil
+		}
+		return getCourseResponse{Course: resp.JSON200.Course}, nil
+	}
+}
 
-	req.URL.Path = path.Join(req.URL.Path, url.PathEscape(r.ID))
+type getCoursesRequest struct {
+	IDs []string
+}
 
-	return nil
+type getCoursesResponse struct {
+	Courses []Course
+	Missing []string
+	Err     error `json:"-"`
 }
 
-func copyURL(base *url.URL, path string) *url.URL {
-	next := *base
-	next.Path = path
-	return &next
+func (r getCoursesResponse) Failed() error { return r.Err }
+
+func makeGetCoursesEndpoint(c *courses.ClientWithResponses) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getCoursesRequest)
+		resp, err := c.ListCoursesWithResponse(ctx, &courses.ListCoursesParams{Ids: &req.IDs})
+		if err != nil {
+			return nil, err
+		}
+		if resp.JSON200 == nil {
+			err := statusError(resp.StatusCode(), resp.Body)
+			if err.Temporary() {
+				return nil, err
+			}
+			return getCoursesResponse{Err: err}, nil
+		}
+		var response getCoursesResponse
+		if resp.JSON200.Courses != nil {
+			response.Courses = *resp.JSON200.Courses
+		}
+		if resp.JSON200.Missing != nil {
+			response.Missing = *resp.JSON200.Missing
+		}
+		return response, nil
+	}
 }
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"students/auth"
+	"students/cache"
+	"students/resilience"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) CourseServiceClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	policy := resilience.DefaultPolicy
+	policy.Timeout = 100 * time.Millisecond
+	policy.Retries = 2
+	policy.RetryBackoff = time.Millisecond
+	policies := resilience.Config{Default: policy}
+
+	return NewHTTPClient(sd.FixedInstancer{server.URL}, log.NewNopLogger(), policies, Metrics{BreakerState: discard.NewGauge(), RequestDuration: discard.NewHistogram()})
+}
+
+func TestGetCourseNotFound(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	})
+
+	_, err := c.GetCourse(context.Background(), "1")
+	require.ErrorIs(t, err, ErrNotFound)
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, "not found", statusErr.Message)
+	// Client errors are not retried.
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetCourseRefused(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+	}{
+		{http.StatusUnauthorized, auth.ErrUnauthenticated},
+		{http.StatusForbidden, auth.ErrInsufficientScope},
+	}
+	for _, tt := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})
+
+		_, err := c.GetCourse(context.Background(), "1")
+		require.ErrorIs(t, err, tt.err)
+	}
+}
+
+func TestGetCourseRetry(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"course":{"id":1,"name":"Math"}}`))
+	})
+
+	course, err := c.GetCourse(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, "Math", course.Name)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestGetCourseTimeout(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	_, err := c.GetCourse(context.Background(), "1")
+	require.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestGetCourseRoundRobin(t *testing.T) {
+	var calls [2]int32
+	var instances sd.FixedInstancer
+	for i := range calls {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls[i], 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"course":{"id":1,"name":"Math"}}`))
+		}))
+		t.Cleanup(server.Close)
+		instances = append(instances, server.URL)
+	}
+	c := NewHTTPClient(instances, log.NewNopLogger(), resilience.Config{Default: resilience.DefaultPolicy}, Metrics{BreakerState: discard.NewGauge(), RequestDuration: discard.NewHistogram()})
+
+	for i := 0; i < 4; i++ {
+		_, err := c.GetCourse(context.Background(), "1")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls[0]))
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls[1]))
+}
+
+func TestCachingClientChecksScope(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"course":{"id":1,"name":"Math"}}`))
+	})
+	c = NewCachingClient(c, cache.NewLRUCache(10), time.Minute)
+
+	reader := auth.NewContext(context.Background(), &auth.Payload{TenantID: 1, ClientID: "app", Scopes: []string{auth.ScopeCoursesRead}})
+	_, err := c.GetCourse(reader, "1")
+	require.NoError(t, err)
+	_, err = c.GetCourse(reader, "1")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// The cached course is not served to a caller without courses:read,
+	// whose request is left to courses_svc to refuse.
+	unscoped := auth.NewContext(context.Background(), &auth.Payload{TenantID: 1, ClientID: "app", Scopes: []string{auth.ScopeStudentsRead}})
+	_, err = c.GetCourse(unscoped, "1")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+)
+
+// Metrics are recorded by the client.
+type Metrics struct {
+	// BreakerState is the state of the circuit breaker of every instance.
+	BreakerState metrics.Gauge
+	// RequestDuration is the duration of the calls, labelled by endpoint and
+	// result.
+	RequestDuration metrics.Histogram
+}
+
+// instrumenting records the duration of every call of endpoint name,
+// including retries.
+func instrumenting(name string, duration metrics.Histogram) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				duration.With("endpoint", name, "result", callResult(response, err)).Observe(time.Since(begin).Seconds())
+			}(time.Now())
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// callResult is the status code of a call, "timeout" or "error" when no
+// response was received.
+func callResult(response interface{}, err error) string {
+	if err == nil {
+		if f, ok := response.(endpoint.Failer); ok {
+			err = f.Failed()
+		}
+	}
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var statusErr *StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		return strconv.Itoa(statusErr.StatusCode)
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	}
+	return "error"
+}
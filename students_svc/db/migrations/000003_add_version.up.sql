@@ -0,0 +1 @@
+ALTER TABLE "students" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
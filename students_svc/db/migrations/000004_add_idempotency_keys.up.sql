@@ -0,0 +1,12 @@
+CREATE TABLE "idempotency_keys" (
+  "key" varchar PRIMARY KEY,
+  "request_hash" varchar NOT NULL,
+  "status_code" int NOT NULL DEFAULT 0,
+  "response_headers" jsonb NOT NULL DEFAULT '{}',
+  "response_body" bytea NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "idempotency_keys" ("created_at");
+
+COMMENT ON COLUMN "idempotency_keys"."status_code" IS '0 while the original request is in progress';
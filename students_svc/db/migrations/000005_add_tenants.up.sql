@@ -0,0 +1,53 @@
+-- Every row belongs to a tenant, a school of auth_svc. The existing rows
+-- belong to the default tenant.
+ALTER TABLE "students" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE "enrollments" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE "audit_log" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE "idempotency_keys" ADD COLUMN "tenant_id" bigint NOT NULL DEFAULT 1;
+
+CREATE INDEX ON "students" ("tenant_id", "id");
+
+CREATE INDEX ON "enrollments" ("tenant_id", "student_id");
+
+CREATE INDEX ON "enrollments" ("tenant_id", "course_id");
+
+CREATE INDEX ON "audit_log" ("tenant_id", "id");
+
+-- Idempotency keys are chosen by the clients, so they are only unique per
+-- tenant.
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT "idempotency_keys_pkey";
+
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("tenant_id", "key");
+
+-- The queries are scoped to the tenant of the caller. The policies enforce
+-- it for the roles that are subject to row-level security, i.e. not the
+-- owner of the tables, when DB_ROW_LEVEL_SECURITY sets app.tenant_id.
+ALTER TABLE "students" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "enrollments" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "audit_log" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "idempotency_keys" ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "tenant_isolation" ON "students"
+USING ("tenant_id" = NULLIF(current_setting('app.tenant_id', true), '')::bigint);
+
+CREATE POLICY "tenant_isolation" ON "enrollments"
+USING ("tenant_id" = NULLIF(current_setting('app.tenant_id', true), '')::bigint);
+
+CREATE POLICY "tenant_isolation" ON "audit_log"
+USING ("tenant_id" = NULLIF(current_setting('app.tenant_id', true), '')::bigint);
+
+CREATE POLICY "tenant_isolation" ON "idempotency_keys"
+USING ("tenant_id" = NULLIF(current_setting('app.tenant_id', true), '')::bigint);
+
+-- Expired idempotency keys are purged for all the tenants at once, as the
+-- owner of the table.
+CREATE FUNCTION purge_expired_idempotency_keys(created_before timestamptz) RETURNS void
+LANGUAGE sql SECURITY DEFINER AS $$
+  DELETE FROM idempotency_keys WHERE created_at < created_before;
+$$;
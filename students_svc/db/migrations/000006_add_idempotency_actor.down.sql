@@ -0,0 +1,10 @@
+-- Keys used by several actors of a tenant can not be kept.
+DELETE FROM "idempotency_keys" a
+USING "idempotency_keys" b
+WHERE a."tenant_id" = b."tenant_id" AND a."key" = b."key" AND a."actor" > b."actor";
+
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT "idempotency_keys_pkey";
+
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("tenant_id", "key");
+
+ALTER TABLE "idempotency_keys" DROP COLUMN IF EXISTS "actor";
@@ -0,0 +1,8 @@
+-- Idempotency keys are only unique per caller, so that a caller can not
+-- replay the stored response of another one by reusing their key. The
+-- existing keys expire within a day and are kept without an actor.
+ALTER TABLE "idempotency_keys" ADD COLUMN "actor" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT "idempotency_keys_pkey";
+
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("tenant_id", "actor", "key");
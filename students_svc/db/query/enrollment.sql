@@ -1,28 +1,29 @@
 -- name: GetEnrollment :one
 SELECT * FROM enrollments
-WHERE id = $1 LIMIT 1;
+WHERE tenant_id = $1 AND id = $2 LIMIT 1;
 
 -- name: ListEnrollments :many
 SELECT * FROM enrollments
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2;
+LIMIT $2
+OFFSET $3;
 
 -- name: GetEnrollmentsByStudentID :many
 SELECT * FROM enrollments
-WHERE student_id = $1 
+WHERE tenant_id = $1 AND student_id = $2
 ORDER BY id
-LIMIT $2
-OFFSET $3;
+LIMIT $3
+OFFSET $4;
 
 -- name: CreateEnrollment :one
 INSERT INTO enrollments (
-  student_id, course_id
+  student_id, course_id, tenant_id
 ) VALUES (
-  $1, $2
+  $1, $2, $3
 )
 RETURNING *;
 
 -- name: DeleteEnrollment :exec
 DELETE FROM enrollments
-WHERE id = $1;
+WHERE tenant_id = $1 AND id = $2;
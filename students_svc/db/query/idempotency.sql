@@ -0,0 +1,26 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  tenant_id, actor, key, request_hash
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (tenant_id, actor, key) DO NOTHING
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE tenant_id = $1 AND actor = $2 AND key = $3 LIMIT 1;
+
+-- name: SaveIdempotentResponse :exec
+UPDATE idempotency_keys
+  set status_code = $4,
+  response_headers = $5,
+  response_body = $6
+WHERE tenant_id = $1 AND actor = $2 AND key = $3;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE tenant_id = $1 AND actor = $2 AND key = $3;
+
+-- name: DeleteExpiredIdempotencyKeys :exec
+SELECT purge_expired_idempotency_keys(sqlc.arg(created_before)::timestamptz);
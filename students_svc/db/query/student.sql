@@ -1,39 +1,46 @@
 -- name: GetStudent :one
 SELECT * FROM students
-WHERE id = $1 LIMIT 1;
+WHERE tenant_id = $1 AND id = $2 LIMIT 1;
+
+-- name: GetStudentForUpdate :one
+SELECT * FROM students
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
+FOR UPDATE;
 
 -- name: ListStudents :many
 SELECT * FROM students
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2;
+LIMIT $2
+OFFSET $3;
 
 -- name: CreateStudent :one
 INSERT INTO students (
-  fullname, date_of_birth, grade, phone
+  fullname, date_of_birth, grade, phone, tenant_id
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
 )
 RETURNING *;
 
 -- name: DeleteStudent :exec
 DELETE FROM students
-WHERE id = $1;
+WHERE tenant_id = $1 AND id = $2;
 
 -- name: UpdateStudent :one
 UPDATE students
   set fullname = $2,
   date_of_birth = $3,
   grade = $4,
-  phone = $5
-WHERE id = $1
+  phone = $5,
+  version = version + 1
+WHERE id = $1 AND version = $6 AND tenant_id = $7
 RETURNING *;
 
 -- name: GetStudentsByCourseID :many
-SELECT S.id, S.fullname, S.date_of_birth, S.grade, S.phone, S.created_at 
+SELECT S.id, S.fullname, S.date_of_birth, S.grade, S.phone, S.created_at, S.version, S.tenant_id
 FROM enrollments as E
 JOIN students as S
 ON E.student_id = S.id
-WHERE E.course_id = $1
-LIMIT $2
-OFFSET $3;
\ No newline at end of file
+WHERE E.tenant_id = $1 AND E.course_id = $2
+LIMIT $3
+OFFSET $4;
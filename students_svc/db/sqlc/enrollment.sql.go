@@ -11,20 +11,21 @@ import (
 
 const createEnrollment = `-- name: CreateEnrollment :one
 INSERT INTO enrollments (
-  student_id, course_id
+  student_id, course_id, tenant_id
 ) VALUES (
-  $1, $2
+  $1, $2, $3
 )
-RETURNING id, student_id, course_id, enrollment_date, created_at
+RETURNING id, student_id, course_id, enrollment_date, created_at, tenant_id
 `
 
 type CreateEnrollmentParams struct {
 	StudentID int64
 	CourseID  int64
+	TenantID  int64
 }
 
 func (q *Queries) CreateEnrollment(ctx context.Context, arg CreateEnrollmentParams) (Enrollment, error) {
-	row := q.db.QueryRowContext(ctx, createEnrollment, arg.StudentID, arg.CourseID)
+	row := q.db.QueryRowContext(ctx, createEnrollment, arg.StudentID, arg.CourseID, arg.TenantID)
 	var i Enrollment
 	err := row.Scan(
 		&i.ID,
@@ -32,27 +33,38 @@ func (q *Queries) CreateEnrollment(ctx context.Context, arg CreateEnrollmentPara
 		&i.CourseID,
 		&i.EnrollmentDate,
 		&i.CreatedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
 const deleteEnrollment = `-- name: DeleteEnrollment :exec
 DELETE FROM enrollments
-WHERE id = $1
+WHERE tenant_id = $1 AND id = $2
 `
 
-func (q *Queries) DeleteEnrollment(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteEnrollment, id)
+type DeleteEnrollmentParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) DeleteEnrollment(ctx context.Context, arg DeleteEnrollmentParams) error {
+	_, err := q.db.ExecContext(ctx, deleteEnrollment, arg.TenantID, arg.ID)
 	return err
 }
 
 const getEnrollment = `-- name: GetEnrollment :one
-SELECT id, student_id, course_id, enrollment_date, created_at FROM enrollments
-WHERE id = $1 LIMIT 1
+SELECT id, student_id, course_id, enrollment_date, created_at, tenant_id FROM enrollments
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
 `
 
-func (q *Queries) GetEnrollment(ctx context.Context, id int64) (Enrollment, error) {
-	row := q.db.QueryRowContext(ctx, getEnrollment, id)
+type GetEnrollmentParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) GetEnrollment(ctx context.Context, arg GetEnrollmentParams) (Enrollment, error) {
+	row := q.db.QueryRowContext(ctx, getEnrollment, arg.TenantID, arg.ID)
 	var i Enrollment
 	err := row.Scan(
 		&i.ID,
@@ -60,26 +72,33 @@ func (q *Queries) GetEnrollment(ctx context.Context, id int64) (Enrollment, erro
 		&i.CourseID,
 		&i.EnrollmentDate,
 		&i.CreatedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
 const getEnrollmentsByStudentID = `-- name: GetEnrollmentsByStudentID :many
-SELECT id, student_id, course_id, enrollment_date, created_at FROM enrollments
-WHERE student_id = $1 
+SELECT id, student_id, course_id, enrollment_date, created_at, tenant_id FROM enrollments
+WHERE tenant_id = $1 AND student_id = $2
 ORDER BY id
-LIMIT $2
-OFFSET $3
+LIMIT $3
+OFFSET $4
 `
 
 type GetEnrollmentsByStudentIDParams struct {
+	TenantID  int64
 	StudentID int64
 	Limit     int32
 	Offset    int32
 }
 
 func (q *Queries) GetEnrollmentsByStudentID(ctx context.Context, arg GetEnrollmentsByStudentIDParams) ([]Enrollment, error) {
-	rows, err := q.db.QueryContext(ctx, getEnrollmentsByStudentID, arg.StudentID, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getEnrollmentsByStudentID,
+		arg.TenantID,
+		arg.StudentID,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +112,7 @@ func (q *Queries) GetEnrollmentsByStudentID(ctx context.Context, arg GetEnrollme
 			&i.CourseID,
 			&i.EnrollmentDate,
 			&i.CreatedAt,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -108,19 +128,21 @@ func (q *Queries) GetEnrollmentsByStudentID(ctx context.Context, arg GetEnrollme
 }
 
 const listEnrollments = `-- name: ListEnrollments :many
-SELECT id, student_id, course_id, enrollment_date, created_at FROM enrollments
+SELECT id, student_id, course_id, enrollment_date, created_at, tenant_id FROM enrollments
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2
+LIMIT $2
+OFFSET $3
 `
 
 type ListEnrollmentsParams struct {
-	Limit  int32
-	Offset int32
+	TenantID int64
+	Limit    int32
+	Offset   int32
 }
 
 func (q *Queries) ListEnrollments(ctx context.Context, arg ListEnrollmentsParams) ([]Enrollment, error) {
-	rows, err := q.db.QueryContext(ctx, listEnrollments, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listEnrollments, arg.TenantID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +156,7 @@ func (q *Queries) ListEnrollments(ctx context.Context, arg ListEnrollmentsParams
 			&i.CourseID,
 			&i.EnrollmentDate,
 			&i.CreatedAt,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -12,6 +12,7 @@ func createRandomEnrollment(t *testing.T) Enrollment {
 	arg := CreateEnrollmentParams{
 		StudentID: student.ID,
 		CourseID:  1,
+		TenantID:  student.TenantID,
 	}
 
 	Enrollment, err := testQueries.CreateEnrollment(context.Background(), arg)
@@ -31,7 +32,7 @@ func TestGetEnrollment(t *testing.T) {
 	Enrollment := createRandomEnrollment(t)
 	id := Enrollment.ID
 
-	Enrollment, err := testQueries.GetEnrollment(context.Background(), id)
+	Enrollment, err := testQueries.GetEnrollment(context.Background(), GetEnrollmentParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 	require.NotEmpty(t, Enrollment)
 	require.Equal(t, Enrollment.ID, id)
@@ -42,14 +43,15 @@ func TestDeleteEnrollment(t *testing.T) {
 	Enrollment := createRandomEnrollment(t)
 	id := Enrollment.ID
 
-	err := testQueries.DeleteEnrollment(context.Background(), id)
+	err := testQueries.DeleteEnrollment(context.Background(), DeleteEnrollmentParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 }
 
 func TestListEnrollments(t *testing.T) {
 	arg := ListEnrollmentsParams{
-		Limit:  0,
-		Offset: 100,
+		TenantID: 1,
+		Limit:    0,
+		Offset:   100,
 	}
 	_, err := testQueries.ListEnrollments(context.Background(), arg)
 	require.NoError(t, err)
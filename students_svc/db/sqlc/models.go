@@ -5,15 +5,42 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 )
 
+type AuditLog struct {
+	ID        int64
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	Before    json.RawMessage
+	After     json.RawMessage
+	Diff      json.RawMessage
+	CreatedAt time.Time
+	TenantID  int64
+}
+
 type Enrollment struct {
 	ID             int64
 	StudentID      int64
 	CourseID       int64
 	EnrollmentDate time.Time
 	CreatedAt      time.Time
+	TenantID       int64
+}
+
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string
+	// 0 while the original request is in progress
+	StatusCode      int32
+	ResponseHeaders json.RawMessage
+	ResponseBody    []byte
+	CreatedAt       time.Time
+	TenantID        int64
+	Actor           string
 }
 
 type Student struct {
@@ -24,4 +51,6 @@ type Student struct {
 	Grade     int32
 	Phone     int64
 	CreatedAt time.Time
+	Version   int64
+	TenantID  int64
 }
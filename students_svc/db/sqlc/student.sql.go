@@ -12,11 +12,11 @@ import (
 
 const createStudent = `-- name: CreateStudent :one
 INSERT INTO students (
-  fullname, date_of_birth, grade, phone
+  fullname, date_of_birth, grade, phone, tenant_id
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
 )
-RETURNING id, fullname, date_of_birth, grade, phone, created_at
+RETURNING id, fullname, date_of_birth, grade, phone, created_at, version, tenant_id
 `
 
 type CreateStudentParams struct {
@@ -24,6 +24,7 @@ type CreateStudentParams struct {
 	DateOfBirth time.Time
 	Grade       int32
 	Phone       int64
+	TenantID    int64
 }
 
 func (q *Queries) CreateStudent(ctx context.Context, arg CreateStudentParams) (Student, error) {
@@ -32,6 +33,7 @@ func (q *Queries) CreateStudent(ctx context.Context, arg CreateStudentParams) (S
 		arg.DateOfBirth,
 		arg.Grade,
 		arg.Phone,
+		arg.TenantID,
 	)
 	var i Student
 	err := row.Scan(
@@ -41,27 +43,39 @@ func (q *Queries) CreateStudent(ctx context.Context, arg CreateStudentParams) (S
 		&i.Grade,
 		&i.Phone,
 		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
 	)
 	return i, err
 }
 
 const deleteStudent = `-- name: DeleteStudent :exec
 DELETE FROM students
-WHERE id = $1
+WHERE tenant_id = $1 AND id = $2
 `
 
-func (q *Queries) DeleteStudent(ctx context.Context, id int64) error {
-	_, err := q.db.ExecContext(ctx, deleteStudent, id)
+type DeleteStudentParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) DeleteStudent(ctx context.Context, arg DeleteStudentParams) error {
+	_, err := q.db.ExecContext(ctx, deleteStudent, arg.TenantID, arg.ID)
 	return err
 }
 
 const getStudent = `-- name: GetStudent :one
-SELECT id, fullname, date_of_birth, grade, phone, created_at FROM students
-WHERE id = $1 LIMIT 1
+SELECT id, fullname, date_of_birth, grade, phone, created_at, version, tenant_id FROM students
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
 `
 
-func (q *Queries) GetStudent(ctx context.Context, id int64) (Student, error) {
-	row := q.db.QueryRowContext(ctx, getStudent, id)
+type GetStudentParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) GetStudent(ctx context.Context, arg GetStudentParams) (Student, error) {
+	row := q.db.QueryRowContext(ctx, getStudent, arg.TenantID, arg.ID)
 	var i Student
 	err := row.Scan(
 		&i.ID,
@@ -70,28 +84,63 @@ func (q *Queries) GetStudent(ctx context.Context, id int64) (Student, error) {
 		&i.Grade,
 		&i.Phone,
 		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getStudentForUpdate = `-- name: GetStudentForUpdate :one
+SELECT id, fullname, date_of_birth, grade, phone, created_at, version, tenant_id FROM students
+WHERE tenant_id = $1 AND id = $2 LIMIT 1
+FOR UPDATE
+`
+
+type GetStudentForUpdateParams struct {
+	TenantID int64
+	ID       int64
+}
+
+func (q *Queries) GetStudentForUpdate(ctx context.Context, arg GetStudentForUpdateParams) (Student, error) {
+	row := q.db.QueryRowContext(ctx, getStudentForUpdate, arg.TenantID, arg.ID)
+	var i Student
+	err := row.Scan(
+		&i.ID,
+		&i.Fullname,
+		&i.DateOfBirth,
+		&i.Grade,
+		&i.Phone,
+		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
 	)
 	return i, err
 }
 
 const getStudentsByCourseID = `-- name: GetStudentsByCourseID :many
-SELECT S.id, S.fullname, S.date_of_birth, S.grade, S.phone, S.created_at 
+SELECT S.id, S.fullname, S.date_of_birth, S.grade, S.phone, S.created_at, S.version, S.tenant_id
 FROM enrollments as E
 JOIN students as S
 ON E.student_id = S.id
-WHERE E.course_id = $1
-LIMIT $2
-OFFSET $3
+WHERE E.tenant_id = $1 AND E.course_id = $2
+LIMIT $3
+OFFSET $4
 `
 
 type GetStudentsByCourseIDParams struct {
+	TenantID int64
 	CourseID int64
 	Limit    int32
 	Offset   int32
 }
 
 func (q *Queries) GetStudentsByCourseID(ctx context.Context, arg GetStudentsByCourseIDParams) ([]Student, error) {
-	rows, err := q.db.QueryContext(ctx, getStudentsByCourseID, arg.CourseID, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getStudentsByCourseID,
+		arg.TenantID,
+		arg.CourseID,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +155,8 @@ func (q *Queries) GetStudentsByCourseID(ctx context.Context, arg GetStudentsByCo
 			&i.Grade,
 			&i.Phone,
 			&i.CreatedAt,
+			&i.Version,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -121,19 +172,21 @@ func (q *Queries) GetStudentsByCourseID(ctx context.Context, arg GetStudentsByCo
 }
 
 const listStudents = `-- name: ListStudents :many
-SELECT id, fullname, date_of_birth, grade, phone, created_at FROM students
+SELECT id, fullname, date_of_birth, grade, phone, created_at, version, tenant_id FROM students
+WHERE tenant_id = $1
 ORDER BY id
-LIMIT $1
-OFFSET $2
+LIMIT $2
+OFFSET $3
 `
 
 type ListStudentsParams struct {
-	Limit  int32
-	Offset int32
+	TenantID int64
+	Limit    int32
+	Offset   int32
 }
 
 func (q *Queries) ListStudents(ctx context.Context, arg ListStudentsParams) ([]Student, error) {
-	rows, err := q.db.QueryContext(ctx, listStudents, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, listStudents, arg.TenantID, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -148,6 +201,8 @@ func (q *Queries) ListStudents(ctx context.Context, arg ListStudentsParams) ([]S
 			&i.Grade,
 			&i.Phone,
 			&i.CreatedAt,
+			&i.Version,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -167,9 +222,10 @@ UPDATE students
   set fullname = $2,
   date_of_birth = $3,
   grade = $4,
-  phone = $5
-WHERE id = $1
-RETURNING id, fullname, date_of_birth, grade, phone, created_at
+  phone = $5,
+  version = version + 1
+WHERE id = $1 AND version = $6 AND tenant_id = $7
+RETURNING id, fullname, date_of_birth, grade, phone, created_at, version, tenant_id
 `
 
 type UpdateStudentParams struct {
@@ -178,6 +234,8 @@ type UpdateStudentParams struct {
 	DateOfBirth time.Time
 	Grade       int32
 	Phone       int64
+	Version     int64
+	TenantID    int64
 }
 
 func (q *Queries) UpdateStudent(ctx context.Context, arg UpdateStudentParams) (Student, error) {
@@ -187,6 +245,8 @@ func (q *Queries) UpdateStudent(ctx context.Context, arg UpdateStudentParams) (S
 		arg.DateOfBirth,
 		arg.Grade,
 		arg.Phone,
+		arg.Version,
+		arg.TenantID,
 	)
 	var i Student
 	err := row.Scan(
@@ -196,6 +256,8 @@ func (q *Queries) UpdateStudent(ctx context.Context, arg UpdateStudentParams) (S
 		&i.Grade,
 		&i.Phone,
 		&i.CreatedAt,
+		&i.Version,
+		&i.TenantID,
 	)
 	return i, err
 }
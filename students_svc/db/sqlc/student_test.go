@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"students/utils"
 	"testing"
 
@@ -14,6 +15,7 @@ func CreateRandomStudent(t *testing.T) Student {
 		DateOfBirth: utils.RandomBirthDate(),
 		Grade:       utils.RandomGrade(),
 		Phone:       utils.RandomPhone(),
+		TenantID:    1,
 	}
 
 	Student, err := testQueries.CreateStudent(context.Background(), arg)
@@ -24,6 +26,7 @@ func CreateRandomStudent(t *testing.T) Student {
 	require.Equal(t, Student.Grade, arg.Grade)
 	require.Equal(t, Student.Phone, arg.Phone)
 	require.NotZero(t, Student.ID)
+	require.Equal(t, Student.TenantID, arg.TenantID)
 	require.NotZero(t, Student.CreatedAt)
 	return Student
 }
@@ -36,25 +39,29 @@ func TestGetStudent(t *testing.T) {
 	Student := CreateRandomStudent(t)
 	id := Student.ID
 
-	Student, err := testQueries.GetStudent(context.Background(), id)
+	Student, err := testQueries.GetStudent(context.Background(), GetStudentParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 	require.NotEmpty(t, Student)
 	require.Equal(t, Student.ID, id)
 
+	_, err = testQueries.GetStudent(context.Background(), GetStudentParams{TenantID: 2, ID: id})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
 }
 
 func TestDeleteStudent(t *testing.T) {
 	Student := CreateRandomStudent(t)
 	id := Student.ID
 
-	err := testQueries.DeleteStudent(context.Background(), id)
+	err := testQueries.DeleteStudent(context.Background(), DeleteStudentParams{TenantID: 1, ID: id})
 	require.NoError(t, err)
 }
 
 func TestListStudents(t *testing.T) {
 	arg := ListStudentsParams{
-		Limit:  0,
-		Offset: 100,
+		TenantID: 1,
+		Limit:    0,
+		Offset:   100,
 	}
 	_, err := testQueries.ListStudents(context.Background(), arg)
 	require.NoError(t, err)
@@ -69,6 +76,8 @@ func TestUpdateStudent(t *testing.T) {
 		DateOfBirth: Student.DateOfBirth,
 		Grade:       utils.RandomGrade(),
 		Phone:       utils.RandomPhone(),
+		Version:     Student.Version,
+		TenantID:    Student.TenantID,
 	}
 
 	StudentResult, err := testQueries.UpdateStudent(context.Background(), arg)
@@ -79,4 +88,21 @@ func TestUpdateStudent(t *testing.T) {
 	require.Equal(t, StudentResult.Grade, arg.Grade)
 	require.Equal(t, StudentResult.Phone, arg.Phone)
 	require.Equal(t, StudentResult.CreatedAt, Student.CreatedAt)
+	require.Equal(t, StudentResult.Version, Student.Version+1)
+}
+
+func TestUpdateStudentVersionMismatch(t *testing.T) {
+	Student := CreateRandomStudent(t)
+	arg := UpdateStudentParams{
+		ID:          Student.ID,
+		Fullname:    Student.Fullname,
+		DateOfBirth: Student.DateOfBirth,
+		Grade:       Student.Grade,
+		Phone:       Student.Phone,
+		Version:     Student.Version + 1,
+		TenantID:    Student.TenantID,
+	}
+
+	_, err := testQueries.UpdateStudent(context.Background(), arg)
+	require.ErrorIs(t, err, sql.ErrNoRows)
 }
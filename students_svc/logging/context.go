@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request between services.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware puts the X-Request-ID of the request, or a new ID, in
+// the request context and echoes it in the response.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithContext tags the lines of logger with the request and trace IDs of
+// ctx.
+func WithContext(ctx context.Context, logger log.Logger) log.Logger {
+	if id := RequestID(ctx); id != "" {
+		logger = log.With(logger, "request_id", id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = log.With(logger, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	return logger
+}
+
+// PropagateRequestID sets the X-Request-ID header of an outgoing request to
+// the request ID of ctx. It is a request editor of the sdk clients.
+func PropagateRequestID(ctx context.Context, r *http.Request) error {
+	if id := RequestID(ctx); id != "" {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	lvl, err := NewLevel("warn")
+	require.NoError(t, err)
+	logger := New(&buf, lvl)
+
+	level.Info(logger).Log("msg", "dropped")
+	logger.Log("msg", "dropped too")
+	level.Error(logger).Log("msg", "kept")
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "kept", line["msg"])
+	require.Equal(t, "error", line["level"])
+	require.Contains(t, line["caller"], "logging_test.go")
+
+	require.ErrorIs(t, lvl.Set("verbose"), ErrInvalidLevel)
+	require.NoError(t, lvl.Set("DEBUG"))
+	require.Equal(t, "debug", lvl.String())
+}
+
+func TestLevelHandler(t *testing.T) {
+	lvl, err := NewLevel("")
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	handler := LevelHandler(lvl, New(&buf, lvl))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"error"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"level":"error"}`, w.Body.String())
+	require.Equal(t, "error", lvl.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(`{"level":"loud"}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "error", lvl.String())
+}
+
+func TestWithContext(t *testing.T) {
+	var buf bytes.Buffer
+	lvl, _ := NewLevel("info")
+	logger := New(&buf, lvl)
+
+	var ctx context.Context
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, "abc", w.Header().Get(RequestIDHeader))
+
+	WithContext(ctx, logger).Log("msg", "hello")
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "abc", line["request_id"])
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Len(t, w.Header().Get(RequestIDHeader), 32)
+}
+
+func TestRedact(t *testing.T) {
+	type student struct {
+		Fullname    string    `json:"fullname"`
+		DateOfBirth time.Time `json:"date_of_birth"`
+		Phone       int64     `json:"phone"`
+	}
+	redacted := Redact([]student{{Fullname: "Ali", DateOfBirth: time.Now(), Phone: 7701}})
+	require.Equal(t, []interface{}{map[string]interface{}{
+		"fullname":      "Ali",
+		"date_of_birth": "[REDACTED]",
+		"phone":         "[REDACTED]",
+	}}, redacted)
+}
@@ -0,0 +1,106 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/ratelimit"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resilience.yaml")
+	err := os.WriteFile(path, []byte(`
+default:
+  rate_limit: 50
+  burst: 50
+  timeout: 3s
+  breaker:
+    consecutive_failures: 3
+endpoints:
+  CreateStudent:
+    token_rate_limit: 5
+    token_burst: 10
+`), 0o600)
+	require.NoError(t, err)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	p := config.Policy("GetStudent")
+	require.Equal(t, 50.0, p.RateLimit)
+	require.Equal(t, 3*time.Second, p.Timeout)
+	require.Zero(t, p.TokenRateLimit)
+
+	p = config.Policy("CreateStudent")
+	require.Equal(t, 50.0, p.RateLimit)
+	require.Equal(t, 5.0, p.TokenRateLimit)
+	require.Equal(t, 10, p.TokenBurst)
+	require.Equal(t, uint32(3), p.Breaker.ConsecutiveFailures)
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	config, err := LoadConfig("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultPolicy, config.Policy("GetStudent"))
+}
+
+func TestClientRateLimit(t *testing.T) {
+	policy := Policy{ClientRateLimit: 1, ClientBurst: 2}
+	ep := Middleware("GetStudent", policy, discard.NewGauge(), nil)(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+
+	clientCtx := func(addr string) context.Context {
+		return context.WithValue(context.Background(), httptransport.ContextKeyRequestRemoteAddr, addr)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := ep(clientCtx("10.0.0.1:5000"), nil)
+		require.NoError(t, err)
+	}
+	_, err := ep(clientCtx("10.0.0.1:5001"), nil)
+	require.ErrorIs(t, err, ratelimit.ErrLimited)
+
+	// Other clients have their own limit.
+	_, err = ep(clientCtx("10.0.0.2:5000"), nil)
+	require.NoError(t, err)
+}
+
+type testResponse struct{ err error }
+
+func (r testResponse) Failed() error { return r.err }
+
+func TestBreakerCountsFailedResponses(t *testing.T) {
+	errServer := errors.New("server error")
+	errClient := errors.New("client error")
+	var calls int
+	ep := Breaker("GetStudent", BreakerPolicy{ConsecutiveFailures: 2, Timeout: time.Minute}, discard.NewGauge(), func(err error) bool {
+		return err == errServer
+	})(func(_ context.Context, request interface{}) (interface{}, error) {
+		calls++
+		return testResponse{request.(error)}, nil
+	})
+
+	// Client errors don't trip the breaker.
+	for i := 0; i < 3; i++ {
+		response, err := ep(context.Background(), errClient)
+		require.NoError(t, err)
+		require.Equal(t, errClient, response.(testResponse).err)
+	}
+	for i := 0; i < 2; i++ {
+		response, err := ep(context.Background(), errServer)
+		require.NoError(t, err)
+		require.Equal(t, errServer, response.(testResponse).err)
+	}
+	_, err := ep(context.Background(), errClient)
+	require.ErrorIs(t, err, gobreaker.ErrOpenState)
+	require.Equal(t, 5, calls)
+}
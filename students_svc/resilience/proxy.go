@@ -0,0 +1,96 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const clientAddressKey contextKey = iota
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses or
+// CIDRs.
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(list, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %q: %w", proxy, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// ClientAddressMiddleware resolves the IP address of the client of every
+// request for the limiters per client. The X-Forwarded-For header is only
+// read when the request comes from one of trustedProxies, and then the
+// address is the last one it lists that is not a trusted proxy, as the
+// addresses in front of it may be forged by the client.
+func ClientAddressMiddleware(trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := clientAddress(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientAddressKey, addr)))
+		})
+	}
+}
+
+func clientAddress(r *http.Request, trustedProxies []*net.IPNet) string {
+	addr := remoteHost(r.RemoteAddr)
+	if !trusted(addr, trustedProxies) {
+		return addr
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		addr = hop
+		if !trusted(hop, trustedProxies) {
+			break
+		}
+	}
+	return addr
+}
+
+func trusted(addr string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
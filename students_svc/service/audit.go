@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"students/auth"
+	"students/client"
+	db "students/db/sqlc"
+)
+
+const (
+	auditEntityStudent = "student"
+
+	auditActionCreate = "create"
+	auditActionUpdate = "update"
+	auditActionDelete = "delete"
+)
+
+// AuditRecord is a single entry of the append-only audit trail.
+type AuditRecord struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Diff      json.RawMessage `json:"diff"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows down the audit records returned by ListAuditRecords.
+// Zero values are ignored.
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// AuditMiddleware records every mutation made through the service together
+// with the actor taken from the auth token. The mutation runs in a
+// transaction of the middleware, which the service joins, and the record is
+// written in it too, so a mutation is never left unaudited.
+func AuditMiddleware(r *Store) Middleware {
+	return func(next Service) Service {
+		return auditMiddleware{r, next}
+	}
+}
+
+type auditMiddleware struct {
+	r    *Store
+	next Service
+}
+
+func (mw auditMiddleware) GetStudent(ctx context.Context, id string) (Student, error) {
+	return mw.next.GetStudent(ctx, id)
+}
+func (mw auditMiddleware) GetStudentList(ctx context.Context, limit int, offset int) ([]Student, error) {
+	return mw.next.GetStudentList(ctx, limit, offset)
+}
+func (mw auditMiddleware) CreateStudent(ctx context.Context, fullname string, dateofbirth time.Time, grade int, phone int) (Student, error) {
+	var student Student
+	var serviceErr error
+	err := mw.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		student, serviceErr = mw.next.CreateStudent(ctx, fullname, dateofbirth, grade, phone)
+		if serviceErr != nil {
+			return serviceErr
+		}
+		return recordAudit(ctx, q, auditActionCreate, strconv.FormatInt(student.ID, 10), nil, student)
+	})
+	if err = auditError(err, serviceErr); err != nil {
+		return Student{}, err
+	}
+	return student, nil
+}
+func (mw auditMiddleware) UpdateStudent(ctx context.Context, id string, student Student) (Student, error) {
+	return mw.update(ctx, id, func(ctx context.Context) (Student, error) {
+		return mw.next.UpdateStudent(ctx, id, student)
+	})
+}
+func (mw auditMiddleware) PatchStudent(ctx context.Context, id string, patch []byte, version int64) (Student, error) {
+	return mw.update(ctx, id, func(ctx context.Context) (Student, error) {
+		return mw.next.PatchStudent(ctx, id, patch, version)
+	})
+}
+func (mw auditMiddleware) DeleteStudent(ctx context.Context, id string) error {
+	var serviceErr error
+	err := mw.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		before, err := lockStudent(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		serviceErr = mw.next.DeleteStudent(ctx, id)
+		if serviceErr != nil || before == nil {
+			return serviceErr
+		}
+		return recordAudit(ctx, q, auditActionDelete, strconv.FormatInt(before.ID, 10), before, nil)
+	})
+	return auditError(err, serviceErr)
+}
+func (mw auditMiddleware) GetStudentCourses(ctx context.Context, id string) ([]client.Course, []string, error) {
+	return mw.next.GetStudentCourses(ctx, id)
+}
+func (mw auditMiddleware) GetCourseStudents(ctx context.Context, id string) ([]Student, error) {
+	return mw.next.GetCourseStudents(ctx, id)
+}
+func (mw auditMiddleware) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	return mw.next.ListAuditRecords(ctx, filter)
+}
+
+// update audits an update of the student id by fn, along with the state of
+// the student before it.
+func (mw auditMiddleware) update(ctx context.Context, id string, fn func(context.Context) (Student, error)) (Student, error) {
+	var after Student
+	var serviceErr error
+	err := mw.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		before, err := lockStudent(ctx, q, id)
+		if err != nil {
+			return err
+		}
+		after, serviceErr = fn(ctx)
+		if serviceErr != nil {
+			return serviceErr
+		}
+		return recordAudit(ctx, q, auditActionUpdate, strconv.FormatInt(after.ID, 10), before, after)
+	})
+	if err = auditError(err, serviceErr); err != nil {
+		return Student{}, err
+	}
+	return after, nil
+}
+
+// lockStudent returns the student id, locked until the end of the
+// transaction of q. It returns nil when the student does not exist, or id
+// or the tenant of the caller are not valid, which the service refuses.
+func lockStudent(ctx context.Context, q *db.Queries, id string) (*Student, error) {
+	ID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	tenantID, ok := auth.TenantID(ctx)
+	if !ok {
+		return nil, nil
+	}
+	result, err := q.GetStudentForUpdate(ctx, db.GetStudentForUpdateParams{
+		TenantID: tenantID,
+		ID:       ID,
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	student := newStudent(result)
+	return &student, nil
+}
+
+// auditError returns the error of the service, or ErrDB when the mutation
+// could not be audited or committed.
+func auditError(err error, serviceErr error) error {
+	if serviceErr != nil {
+		return serviceErr
+	}
+	if err == auth.ErrUnauthenticated {
+		return err
+	}
+	if err != nil {
+		return ErrDB
+	}
+	return nil
+}
+
+// recordAudit stores a single audit entry with q, the transaction of the
+// mutation, so that the entry is written if and only if the mutation is.
+func recordAudit(ctx context.Context, q *db.Queries, action string, entityID string, before interface{}, after interface{}) error {
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	diff, err := jsonDiff(beforeJSON, afterJSON)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateAuditRecord(ctx, db.CreateAuditRecordParams{
+		Actor:    auth.Actor(ctx),
+		Action:   action,
+		Entity:   auditEntityStudent,
+		EntityID: entityID,
+		Before:   beforeJSON,
+		After:    afterJSON,
+		Diff:     diff,
+		TenantID: tenantID,
+	})
+	return err
+}
+
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// jsonDiff compares two JSON objects field by field and returns the fields
+// that differ along with their old and new values.
+func jsonDiff(before []byte, after []byte) (json.RawMessage, error) {
+	var b, a map[string]interface{}
+	if err := json.Unmarshal(before, &b); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &a); err != nil {
+		return nil, err
+	}
+	diff := make(map[string]auditChange)
+	for k, v := range a {
+		if old, ok := b[k]; !ok || !reflect.DeepEqual(old, v) {
+			diff[k] = auditChange{From: b[k], To: v}
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			diff[k] = auditChange{From: v, To: nil}
+		}
+	}
+	return json.Marshal(diff)
+}
+
+func newAuditRecord(result db.AuditLog) AuditRecord {
+	return AuditRecord{
+		ID:        result.ID,
+		Actor:     result.Actor,
+		Action:    result.Action,
+		Entity:    result.Entity,
+		EntityID:  result.EntityID,
+		Before:    result.Before,
+		After:     result.After,
+		Diff:      result.Diff,
+		CreatedAt: result.CreatedAt,
+	}
+}
+
+// newAuditRecordsParams returns the query of the audit records of the
+// tenant matching filter.
+func newAuditRecordsParams(tenantID int64, filter AuditFilter) db.ListAuditRecordsParams {
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+	return db.ListAuditRecordsParams{
+		TenantID:  tenantID,
+		Entity:    sql.NullString{String: filter.Entity, Valid: filter.Entity != ""},
+		EntityID:  sql.NullString{String: filter.EntityID, Valid: filter.EntityID != ""},
+		Actor:     sql.NullString{String: filter.Actor, Valid: filter.Actor != ""},
+		FromTime:  sql.NullTime{Time: filter.From, Valid: !filter.From.IsZero()},
+		ToTime:    sql.NullTime{Time: filter.To, Valid: !filter.To.IsZero()},
+		RowLimit:  int32(filter.Limit),
+		RowOffset: int32(filter.Offset),
+	}
+}
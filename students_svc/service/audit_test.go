@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"students/auth"
+	"students/resilience"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONDiff(t *testing.T) {
+	testCases := []struct {
+		name   string
+		before string
+		after  string
+		diff   string
+	}{
+		{
+			name:   "create",
+			before: `null`,
+			after:  `{"fullname":"John Doe","grade":9}`,
+			diff:   `{"fullname":{"from":null,"to":"John Doe"},"grade":{"from":null,"to":9}}`,
+		},
+		{
+			name:   "delete",
+			before: `{"fullname":"John Doe","grade":9}`,
+			after:  `null`,
+			diff:   `{"fullname":{"from":"John Doe","to":null},"grade":{"from":9,"to":null}}`,
+		},
+		{
+			name:   "changed field",
+			before: `{"fullname":"John Doe","grade":9}`,
+			after:  `{"fullname":"John Doe","grade":10}`,
+			diff:   `{"grade":{"from":9,"to":10}}`,
+		},
+		{
+			name:   "added and removed fields",
+			before: `{"fullname":"John Doe","phone":77011234567}`,
+			after:  `{"fullname":"John Doe","grade":9}`,
+			diff:   `{"grade":{"from":null,"to":9},"phone":{"from":77011234567,"to":null}}`,
+		},
+		{
+			name:   "nested object",
+			before: `{"address":{"city":"Almaty","zip":"050000"}}`,
+			after:  `{"address":{"city":"Astana","zip":"050000"}}`,
+			diff:   `{"address":{"from":{"city":"Almaty","zip":"050000"},"to":{"city":"Astana","zip":"050000"}}}`,
+		},
+		{
+			name:   "unchanged",
+			before: `{"fullname":"John Doe","grade":9}`,
+			after:  `{"grade":9,"fullname":"John Doe"}`,
+			diff:   `{}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := jsonDiff([]byte(tc.before), []byte(tc.after))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.diff, string(diff))
+		})
+	}
+}
+
+func TestJSONDiffNotAnObject(t *testing.T) {
+	_, err := jsonDiff([]byte(`[1]`), []byte(`{}`))
+	require.Error(t, err)
+	_, err = jsonDiff([]byte(`{}`), []byte(`{`))
+	require.Error(t, err)
+}
+
+// tenantAuditService returns the audit records of the tenant of the caller
+// only.
+type tenantAuditService struct {
+	stubService
+}
+
+func (tenantAuditService) ListAuditRecords(ctx context.Context, _ AuditFilter) ([]AuditRecord, error) {
+	if tenantID, _ := auth.TenantID(ctx); tenantID != 2 || auth.Actor(ctx) != adminActor {
+		return []AuditRecord{}, nil
+	}
+	return stubService{}.ListAuditRecords(ctx, AuditFilter{})
+}
+
+func TestAdminAudit(t *testing.T) {
+	logger := log.NewNopLogger()
+	endpoints := MakeServerEndpoints(tenantAuditService{}, logger, discard.NewHistogram(), resilience.Config{}, discard.NewGauge())
+	public := MakeHTTPHandler(endpoints, logger)
+	admin := MakeAdminHTTPHandler(endpoints, logger)
+
+	testCases := []struct {
+		name    string
+		handler http.Handler
+		path    string
+		status  int
+		records int
+	}{
+		{name: "public", handler: public, path: "/audit", status: http.StatusNotFound},
+		{name: "tenant", handler: admin, path: "/admin/audit?tenant_id=2&entity=student", status: http.StatusOK, records: 1},
+		{name: "other tenant", handler: admin, path: "/admin/audit?tenant_id=3", status: http.StatusOK},
+		{name: "no tenant", handler: admin, path: "/admin/audit", status: http.StatusBadRequest},
+		{name: "invalid tenant", handler: admin, path: "/admin/audit?tenant_id=0", status: http.StatusBadRequest},
+		{name: "invalid filter", handler: admin, path: "/admin/audit?tenant_id=2&from=yesterday", status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+			if tc.status != http.StatusOK {
+				return
+			}
+			var res listAuditRecordsResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			require.Len(t, res.Records, tc.records)
+		})
+	}
+}
@@ -4,15 +4,15 @@ import (
 	"context"
 	"time"
 
+	"students/auth"
 	"students/client"
+	"students/resilience"
+	"students/tracing"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/log"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -20,7 +20,9 @@ var (
 	_ endpoint.Failer = getStudentListResponse{}
 	_ endpoint.Failer = createStudentResponse{}
 	_ endpoint.Failer = updateStudentResponse{}
+	_ endpoint.Failer = patchStudentResponse{}
 	_ endpoint.Failer = deleteStudentResponse{}
+	_ endpoint.Failer = listAuditRecordsResponse{}
 )
 
 type getStudentRequest struct {
@@ -32,6 +34,7 @@ type getStudentResponse struct {
 }
 
 func (r getStudentResponse) Failed() error { return r.Err }
+func (r getStudentResponse) ETag() string  { return formatETag(r.Student.Version) }
 
 type getStudentListRequest struct {
 	Limit  int
@@ -57,6 +60,7 @@ type createStudentResponse struct {
 }
 
 func (r createStudentResponse) Failed() error { return r.Err }
+func (r createStudentResponse) ETag() string  { return formatETag(r.Student.Version) }
 
 type updateStudentRequest struct {
 	ID      string
@@ -68,6 +72,20 @@ type updateStudentResponse struct {
 }
 
 func (r updateStudentResponse) Failed() error { return r.Err }
+func (r updateStudentResponse) ETag() string  { return formatETag(r.Student.Version) }
+
+type patchStudentRequest struct {
+	ID      string
+	Patch   []byte
+	Version int64
+}
+type patchStudentResponse struct {
+	Student Student `json:"student,omitempty"`
+	Err     error   `json:"error,omitempty"`
+}
+
+func (r patchStudentResponse) Failed() error { return r.Err }
+func (r patchStudentResponse) ETag() string  { return formatETag(r.Student.Version) }
 
 type deleteStudentRequest struct {
 	ID string
@@ -82,8 +100,9 @@ type getStudentCoursesRequest struct {
 }
 
 type getStudentCoursesResponse struct {
-	Courses []client.Course
-	Err     error `json:"error,omitempty"`
+	Courses          []client.Course
+	MissingCourseIDs []string `json:"missing_course_ids,omitempty"`
+	Err              error    `json:"error,omitempty"`
 }
 
 type getCourseStudentsRequest struct {
@@ -96,71 +115,107 @@ type getCourseStudentsResponse struct {
 
 func (r deleteStudentResponse) Failed() error { return r.Err }
 
+type listAuditRecordsRequest struct {
+	Filter AuditFilter
+}
+type listAuditRecordsResponse struct {
+	Records []AuditRecord `json:"records"`
+	Err     error         `json:"error,omitempty"`
+}
+
+func (r listAuditRecordsResponse) Failed() error { return r.Err }
+
 type Endpoints struct {
 	GetStudentEndpoint        endpoint.Endpoint
 	GetStudentListEndpoint    endpoint.Endpoint
 	CreateStudentEndpoint     endpoint.Endpoint
 	UpdateStudentEndpoint     endpoint.Endpoint
+	PatchStudentEndpoint      endpoint.Endpoint
 	DeleteStudentEndpoint     endpoint.Endpoint
 	GetStudentCoursesEndpoint endpoint.Endpoint
 	GetCourseEndpoint         endpoint.Endpoint
 	GetCourseStudentsEndpoint endpoint.Endpoint
+	ListAuditRecordsEndpoint  endpoint.Endpoint
 }
 
-func MakeServerEndpoints(svc Service, logger log.Logger, duration metrics.Histogram) Endpoints {
-	var rateLimitSeconds int = 1
+// MakeServerEndpoints wraps every endpoint with the middlewares configured by
+// its resilience policy, looked up by the endpoint's method name, and traces
+// it in a span of that name. The endpoints refuse the callers whose token
+// does not grant their read or write scope, before the resilience
+// middlewares count them.
+func MakeServerEndpoints(svc Service, logger log.Logger, duration metrics.Histogram, policies resilience.Config, breakerState metrics.Gauge) Endpoints {
 	var GetStudentEndpoint endpoint.Endpoint
 	{
 		GetStudentEndpoint = MakeGetStudentEndpoint(svc)
-		// Reqests are limited to 1 request per second with burst of 1 request.
-		// Note, rate is defined as a time interval between requests.
-		GetStudentEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetStudentEndpoint)
-		GetStudentEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetStudentEndpoint)
+		GetStudentEndpoint = resilience.Middleware("GetStudent", policies.Policy("GetStudent"), breakerState, serverFailure)(GetStudentEndpoint)
+		GetStudentEndpoint = auth.RequireScope(auth.ScopeStudentsRead)(GetStudentEndpoint)
+		GetStudentEndpoint = tracing.EndpointMiddleware("GetStudent", trace.SpanKindInternal)(GetStudentEndpoint)
 	}
 	var GetStudentListEndpoint endpoint.Endpoint
 	{
 		GetStudentListEndpoint = MakeGetStudentListEndpoint(svc)
-		GetStudentListEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetStudentListEndpoint)
-		GetStudentListEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetStudentListEndpoint)
+		GetStudentListEndpoint = resilience.Middleware("GetStudentList", policies.Policy("GetStudentList"), breakerState, serverFailure)(GetStudentListEndpoint)
+		GetStudentListEndpoint = auth.RequireScope(auth.ScopeStudentsRead)(GetStudentListEndpoint)
+		GetStudentListEndpoint = tracing.EndpointMiddleware("GetStudentList", trace.SpanKindInternal)(GetStudentListEndpoint)
 	}
 	var CreateStudentEndpoint endpoint.Endpoint
 	{
 		CreateStudentEndpoint = MakeCreateStudentEndpoint(svc)
-		CreateStudentEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(CreateStudentEndpoint)
-		CreateStudentEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(CreateStudentEndpoint)
+		CreateStudentEndpoint = resilience.Middleware("CreateStudent", policies.Policy("CreateStudent"), breakerState, serverFailure)(CreateStudentEndpoint)
+		CreateStudentEndpoint = auth.RequireScope(auth.ScopeStudentsWrite)(CreateStudentEndpoint)
+		CreateStudentEndpoint = tracing.EndpointMiddleware("CreateStudent", trace.SpanKindInternal)(CreateStudentEndpoint)
 	}
 	var UpdateStudentEndpoint endpoint.Endpoint
 	{
 		UpdateStudentEndpoint = MakeUpdateStudentEndpoint(svc)
-		UpdateStudentEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(UpdateStudentEndpoint)
-		UpdateStudentEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(UpdateStudentEndpoint)
+		UpdateStudentEndpoint = resilience.Middleware("UpdateStudent", policies.Policy("UpdateStudent"), breakerState, serverFailure)(UpdateStudentEndpoint)
+		UpdateStudentEndpoint = auth.RequireScope(auth.ScopeStudentsWrite)(UpdateStudentEndpoint)
+		UpdateStudentEndpoint = tracing.EndpointMiddleware("UpdateStudent", trace.SpanKindInternal)(UpdateStudentEndpoint)
+	}
+	var PatchStudentEndpoint endpoint.Endpoint
+	{
+		PatchStudentEndpoint = MakePatchStudentEndpoint(svc)
+		PatchStudentEndpoint = resilience.Middleware("PatchStudent", policies.Policy("PatchStudent"), breakerState, serverFailure)(PatchStudentEndpoint)
+		PatchStudentEndpoint = auth.RequireScope(auth.ScopeStudentsWrite)(PatchStudentEndpoint)
+		PatchStudentEndpoint = tracing.EndpointMiddleware("PatchStudent", trace.SpanKindInternal)(PatchStudentEndpoint)
 	}
 	var DeleteStudentEndpoint endpoint.Endpoint
 	{
 		DeleteStudentEndpoint = MakeDeleteStudentEndpoint(svc)
-		DeleteStudentEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(DeleteStudentEndpoint)
-		DeleteStudentEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(DeleteStudentEndpoint)
+		DeleteStudentEndpoint = resilience.Middleware("DeleteStudent", policies.Policy("DeleteStudent"), breakerState, serverFailure)(DeleteStudentEndpoint)
+		DeleteStudentEndpoint = auth.RequireScope(auth.ScopeStudentsWrite)(DeleteStudentEndpoint)
+		DeleteStudentEndpoint = tracing.EndpointMiddleware("DeleteStudent", trace.SpanKindInternal)(DeleteStudentEndpoint)
 	}
 	var GetStudentCoursesEndpoint endpoint.Endpoint
 	{
 		GetStudentCoursesEndpoint = MakeGetStudentCoursesEndpoint(svc)
-		GetStudentCoursesEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetStudentCoursesEndpoint)
-		GetStudentCoursesEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetStudentCoursesEndpoint)
+		GetStudentCoursesEndpoint = resilience.Middleware("GetStudentCourses", policies.Policy("GetStudentCourses"), breakerState, serverFailure)(GetStudentCoursesEndpoint)
+		GetStudentCoursesEndpoint = auth.RequireScope(auth.ScopeStudentsRead)(GetStudentCoursesEndpoint)
+		GetStudentCoursesEndpoint = tracing.EndpointMiddleware("GetStudentCourses", trace.SpanKindInternal)(GetStudentCoursesEndpoint)
 	}
 	var GetCourseStudentsEndpoint endpoint.Endpoint
 	{
 		GetCourseStudentsEndpoint = MakeGetCourseStudentsEndpoint(svc)
-		GetCourseStudentsEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), rateLimitSeconds))(GetCourseStudentsEndpoint)
-		GetCourseStudentsEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = resilience.Middleware("GetCourseStudents", policies.Policy("GetCourseStudents"), breakerState, serverFailure)(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = auth.RequireScope(auth.ScopeStudentsRead)(GetCourseStudentsEndpoint)
+		GetCourseStudentsEndpoint = tracing.EndpointMiddleware("GetCourseStudents", trace.SpanKindInternal)(GetCourseStudentsEndpoint)
+	}
+	var ListAuditRecordsEndpoint endpoint.Endpoint
+	{
+		ListAuditRecordsEndpoint = MakeListAuditRecordsEndpoint(svc)
+		ListAuditRecordsEndpoint = resilience.Middleware("ListAuditRecords", policies.Policy("ListAuditRecords"), breakerState, serverFailure)(ListAuditRecordsEndpoint)
+		ListAuditRecordsEndpoint = tracing.EndpointMiddleware("ListAuditRecords", trace.SpanKindInternal)(ListAuditRecordsEndpoint)
 	}
 	return Endpoints{
 		GetStudentEndpoint:        GetStudentEndpoint,
 		GetStudentListEndpoint:    GetStudentListEndpoint,
 		CreateStudentEndpoint:     CreateStudentEndpoint,
 		UpdateStudentEndpoint:     UpdateStudentEndpoint,
+		PatchStudentEndpoint:      PatchStudentEndpoint,
 		DeleteStudentEndpoint:     DeleteStudentEndpoint,
 		GetStudentCoursesEndpoint: GetStudentCoursesEndpoint,
 		GetCourseStudentsEndpoint: GetCourseStudentsEndpoint,
+		ListAuditRecordsEndpoint:  ListAuditRecordsEndpoint,
 	}
 }
 
@@ -195,6 +250,14 @@ func MakeUpdateStudentEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func MakePatchStudentEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(patchStudentRequest)
+		res, e := s.PatchStudent(ctx, req.ID, req.Patch, req.Version)
+		return patchStudentResponse{Student: res, Err: e}, nil
+	}
+}
+
 func MakeDeleteStudentEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(deleteStudentRequest)
@@ -206,8 +269,8 @@ func MakeDeleteStudentEndpoint(s Service) endpoint.Endpoint {
 func MakeGetStudentCoursesEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(getStudentCoursesRequest)
-		res, e := s.GetStudentCourses(ctx, req.ID)
-		return getStudentCoursesResponse{Courses: res, Err: e}, nil
+		res, missing, e := s.GetStudentCourses(ctx, req.ID)
+		return getStudentCoursesResponse{Courses: res, MissingCourseIDs: missing, Err: e}, nil
 	}
 }
 func MakeGetCourseStudentsEndpoint(s Service) endpoint.Endpoint {
@@ -217,3 +280,11 @@ func MakeGetCourseStudentsEndpoint(s Service) endpoint.Endpoint {
 		return getCourseStudentsResponse{Students: res, Err: e}, nil
 	}
 }
+
+func MakeListAuditRecordsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listAuditRecordsRequest)
+		res, e := s.ListAuditRecords(ctx, req.Filter)
+		return listAuditRecordsResponse{Records: res, Err: e}, nil
+	}
+}
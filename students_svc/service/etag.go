@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// etagger is implemented by responses that carry an entity version,
+// which is sent back to the client in the ETag header.
+type etagger interface {
+	ETag() string
+}
+
+func formatETag(version int64) string {
+	if version == 0 {
+		return ""
+	}
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// anyVersion is the version of "If-Match: *", which matches every version
+// of an existing entity.
+const anyVersion int64 = -1
+
+// parseETag returns the version encoded in an If-Match header value.
+// An empty header yields version 0, which the service treats as missing.
+func parseETag(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+	if header == "*" {
+		return anyVersion, nil
+	}
+	header = strings.TrimPrefix(header, "W/")
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, ErrVersionMismatch
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return 0, ErrVersionMismatch
+	}
+	return version, nil
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to the JSON document doc.
+func mergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergeValue(targetObj[k], v)
+	}
+	return targetObj
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseETag(t *testing.T) {
+	testCases := []struct {
+		name    string
+		header  string
+		version int64
+		err     error
+	}{
+		{name: "missing", header: "", version: 0},
+		{name: "blank", header: "  ", version: 0},
+		{name: "strong", header: `"3"`, version: 3},
+		{name: "weak", header: `W/"3"`, version: 3},
+		{name: "surrounding spaces", header: ` "3" `, version: 3},
+		{name: "any", header: "*", version: anyVersion},
+		{name: "round trip", header: formatETag(42), version: 42},
+		{name: "unquoted", header: "3", err: ErrVersionMismatch},
+		{name: "unterminated quote", header: `"3`, err: ErrVersionMismatch},
+		{name: "not a number", header: `"abc"`, err: ErrVersionMismatch},
+		{name: "lowercase weak prefix", header: `w/"3"`, err: ErrVersionMismatch},
+		{name: "list", header: `"1", "2"`, err: ErrVersionMismatch},
+		{name: "quoted star", header: `"*"`, err: ErrVersionMismatch},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			version, err := parseETag(tc.header)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func TestFormatETag(t *testing.T) {
+	require.Equal(t, "", formatETag(0))
+	require.Equal(t, `"7"`, formatETag(7))
+}
+
+func TestMergePatch(t *testing.T) {
+	testCases := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "replace field",
+			doc:   `{"fullname":"John Doe","grade":9}`,
+			patch: `{"grade":10}`,
+			want:  `{"fullname":"John Doe","grade":10}`,
+		},
+		{
+			name:  "add field",
+			doc:   `{"fullname":"John Doe"}`,
+			patch: `{"grade":10}`,
+			want:  `{"fullname":"John Doe","grade":10}`,
+		},
+		{
+			name:  "null deletes field",
+			doc:   `{"fullname":"John Doe","phone":77011234567}`,
+			patch: `{"phone":null}`,
+			want:  `{"fullname":"John Doe"}`,
+		},
+		{
+			name:  "null for missing field",
+			doc:   `{"fullname":"John Doe"}`,
+			patch: `{"phone":null}`,
+			want:  `{"fullname":"John Doe"}`,
+		},
+		{
+			name:  "nested object is merged",
+			doc:   `{"address":{"city":"Almaty","zip":"050000"}}`,
+			patch: `{"address":{"city":"Astana"}}`,
+			want:  `{"address":{"city":"Astana","zip":"050000"}}`,
+		},
+		{
+			name:  "nested null deletes nested field",
+			doc:   `{"address":{"city":"Almaty","zip":"050000"}}`,
+			patch: `{"address":{"zip":null}}`,
+			want:  `{"address":{"city":"Almaty"}}`,
+		},
+		{
+			name:  "object replaces scalar",
+			doc:   `{"address":"Almaty"}`,
+			patch: `{"address":{"city":"Astana","zip":null}}`,
+			want:  `{"address":{"city":"Astana"}}`,
+		},
+		{
+			name:  "array is replaced",
+			doc:   `{"tags":["a","b"]}`,
+			patch: `{"tags":["c"]}`,
+			want:  `{"tags":["c"]}`,
+		},
+		{
+			name:  "empty patch",
+			doc:   `{"fullname":"John Doe"}`,
+			patch: `{}`,
+			want:  `{"fullname":"John Doe"}`,
+		},
+		{
+			name:  "non-object patch replaces document",
+			doc:   `{"fullname":"John Doe"}`,
+			patch: `"John"`,
+			want:  `"John"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergePatch([]byte(tc.doc), []byte(tc.patch))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestMergePatchMalformed(t *testing.T) {
+	_, err := mergePatch([]byte(`{"grade":9}`), []byte(`{"grade":`))
+	require.Error(t, err)
+	_, err = mergePatch([]byte(`{`), []byte(`{}`))
+	require.Error(t, err)
+}
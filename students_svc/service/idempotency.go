@@ -0,0 +1,271 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"students/auth"
+	db "students/db/sqlc"
+
+	"github.com/go-kit/log"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyTTL         = 24 * time.Hour
+	idempotencyMaxRequestBody = 1 << 20
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("Idempotency-Key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this Idempotency-Key is still in progress")
+	// ErrRequestTooLarge is returned for the requests with an
+	// Idempotency-Key whose body is too large to be hashed.
+	ErrRequestTooLarge = errors.New("request body is too large")
+)
+
+// replayedHeaders are the response headers stored along with the response
+// body and sent again when a request is replayed.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyStore stores the idempotency keys and their responses. It is
+// implemented by *db.Queries.
+type IdempotencyStore interface {
+	CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error)
+	SaveIdempotentResponse(ctx context.Context, arg db.SaveIdempotentResponseParams) error
+	DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error
+}
+
+// IdempotencyMiddleware makes POST requests carrying an Idempotency-Key
+// header safe to retry. The first response for a key is stored and replayed
+// for every repeated request of the same caller with the same key and body;
+// a reused key with a different body is rejected. Keys are scoped to the
+// tenant and the actor of the caller; the requests without a tenant are
+// passed on for the endpoints to refuse.
+func IdempotencyMiddleware(r IdempotencyStore, logger log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return &idempotencyHandler{r, logger, next}
+	}
+}
+
+type idempotencyHandler struct {
+	r      IdempotencyStore
+	logger log.Logger
+	next   http.Handler
+}
+
+func (h *idempotencyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := req.Header.Get(idempotencyKeyHeader)
+	tenantID, ok := auth.TenantID(req.Context())
+	if req.Method != http.MethodPost || key == "" || !ok {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+	ctx := req.Context()
+
+	// One byte more than the limit is read to tell a body of the maximum
+	// size from a larger one, which is refused rather than truncated.
+	body, err := io.ReadAll(io.LimitReader(req.Body, idempotencyMaxRequestBody+1))
+	if err != nil {
+		errorEncoder(ctx, err, w)
+		return
+	}
+	if len(body) > idempotencyMaxRequestBody {
+		errorEncoder(ctx, ErrRequestTooLarge, w)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	hash := requestHash(req, body)
+
+	_, err = h.r.CreateIdempotencyKey(ctx, db.CreateIdempotencyKeyParams{
+		TenantID:    tenantID,
+		Actor:       auth.Actor(ctx),
+		Key:         key,
+		RequestHash: hash,
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		h.replay(ctx, w, req, tenantID, key, hash)
+	case err != nil:
+		h.logger.Log("method", "Idempotency", "key", key, "err", err)
+		errorEncoder(ctx, ErrDB, w)
+	default:
+		h.serve(ctx, w, req, tenantID, key)
+	}
+}
+
+// serve handles the first request for key and stores its response, unless
+// it is one that a retry could change, see storedStatus.
+func (h *idempotencyHandler) serve(ctx context.Context, w http.ResponseWriter, req *http.Request, tenantID int64, key string) {
+	// A panic of the handler releases the key before it is passed on, or
+	// the key would be in progress until it expires.
+	defer func() {
+		if p := recover(); p != nil {
+			h.release(detachedContext{ctx}, tenantID, key)
+			panic(p)
+		}
+	}()
+	rec := &responseRecorder{ResponseWriter: w}
+	h.next.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	// The request may have been cancelled by now, but the outcome must
+	// still be recorded.
+	ctx = detachedContext{ctx}
+	if !storedStatus(rec.status) {
+		h.release(ctx, tenantID, key)
+		return
+	}
+	headers := make(map[string]string)
+	for _, name := range replayedHeaders {
+		if v := rec.Header().Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err == nil {
+		err = h.r.SaveIdempotentResponse(ctx, db.SaveIdempotentResponseParams{
+			TenantID:        tenantID,
+			Actor:           auth.Actor(ctx),
+			Key:             key,
+			StatusCode:      int32(rec.status),
+			ResponseHeaders: headersJSON,
+			ResponseBody:    rec.body.Bytes(),
+		})
+	}
+	if err != nil {
+		h.logger.Log("method", "Idempotency", "key", key, "err", err)
+	}
+}
+
+// storedStatus reports whether the response of status is stored for its
+// key. Only the successes and the client errors that the same request would
+// get again are; the others, such as 401, 403, 408, 429 and the server
+// errors, release the key so that the client can retry with it.
+func storedStatus(status int) bool {
+	if status >= 200 && status < 300 {
+		return true
+	}
+	switch status {
+	case http.StatusBadRequest,
+		http.StatusNotFound,
+		http.StatusConflict,
+		http.StatusPreconditionFailed,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnprocessableEntity,
+		http.StatusPreconditionRequired:
+		return true
+	}
+	return false
+}
+
+// release deletes key, so that the request can be retried with it.
+func (h *idempotencyHandler) release(ctx context.Context, tenantID int64, key string) {
+	err := h.r.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{
+		TenantID: tenantID,
+		Actor:    auth.Actor(ctx),
+		Key:      key,
+	})
+	if err != nil {
+		h.logger.Log("method", "Idempotency", "key", key, "err", err)
+	}
+}
+
+// replay answers a repeated request for key with the stored response.
+func (h *idempotencyHandler) replay(ctx context.Context, w http.ResponseWriter, req *http.Request, tenantID int64, key string, hash string) {
+	stored, err := h.r.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+		TenantID: tenantID,
+		Actor:    auth.Actor(ctx),
+		Key:      key,
+	})
+	if err != nil {
+		h.logger.Log("method", "Idempotency", "key", key, "err", err)
+		errorEncoder(ctx, ErrDB, w)
+		return
+	}
+	if time.Since(stored.CreatedAt) > idempotencyKeyTTL {
+		// The key has expired, handle the request as a new one.
+		h.release(ctx, tenantID, key)
+		h.ServeHTTP(w, req.WithContext(ctx))
+		return
+	}
+	if stored.RequestHash != hash {
+		errorEncoder(ctx, ErrIdempotencyKeyReused, w)
+		return
+	}
+	if stored.StatusCode == 0 {
+		errorEncoder(ctx, ErrIdempotencyKeyInProgress, w)
+		return
+	}
+
+	var headers map[string]string
+	if err := json.Unmarshal(stored.ResponseHeaders, &headers); err != nil {
+		h.logger.Log("method", "Idempotency", "key", key, "err", err)
+	}
+	for name, v := range headers {
+		w.Header().Set(name, v)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(int(stored.StatusCode))
+	w.Write(stored.ResponseBody)
+}
+
+// PurgeIdempotencyKeys deletes the expired idempotency keys of all the
+// tenants.
+func PurgeIdempotencyKeys(ctx context.Context, r *db.Queries) error {
+	return r.DeleteExpiredIdempotencyKeys(ctx, time.Now().Add(-idempotencyKeyTTL))
+}
+
+func requestHash(req *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes the response through to the client while keeping
+// a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// detachedContext keeps the values of a request context, such as its
+// tenant, without its cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
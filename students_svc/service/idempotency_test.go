@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"students/auth"
+	db "students/db/sqlc"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdempotencyStore keeps the idempotency keys in memory.
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[memoryIdempotencyKey]db.IdempotencyKey
+}
+
+type memoryIdempotencyKey struct {
+	tenantID int64
+	actor    string
+	key      string
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{keys: make(map[memoryIdempotencyKey]db.IdempotencyKey)}
+}
+
+func (s *memoryIdempotencyStore) CreateIdempotencyKey(_ context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := memoryIdempotencyKey{arg.TenantID, arg.Actor, arg.Key}
+	if _, ok := s.keys[k]; ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	s.keys[k] = db.IdempotencyKey{
+		TenantID:    arg.TenantID,
+		Actor:       arg.Actor,
+		Key:         arg.Key,
+		RequestHash: arg.RequestHash,
+		CreatedAt:   time.Now(),
+	}
+	return s.keys[k], nil
+}
+
+func (s *memoryIdempotencyStore) GetIdempotencyKey(_ context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.keys[memoryIdempotencyKey{arg.TenantID, arg.Actor, arg.Key}]
+	if !ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	return stored, nil
+}
+
+func (s *memoryIdempotencyStore) SaveIdempotentResponse(_ context.Context, arg db.SaveIdempotentResponseParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := memoryIdempotencyKey{arg.TenantID, arg.Actor, arg.Key}
+	stored := s.keys[k]
+	stored.StatusCode = arg.StatusCode
+	stored.ResponseHeaders = arg.ResponseHeaders
+	stored.ResponseBody = arg.ResponseBody
+	s.keys[k] = stored
+	return nil
+}
+
+func (s *memoryIdempotencyStore) DeleteIdempotencyKey(_ context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, memoryIdempotencyKey{arg.TenantID, arg.Actor, arg.Key})
+	return nil
+}
+
+// countingHandler answers every request with its number and the given
+// status, and panics when the body asks for it.
+type countingHandler struct {
+	calls  int
+	status int
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	var body bytes.Buffer
+	body.ReadFrom(r.Body)
+	if body.String() == "panic" {
+		panic("handler failed")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+	w.Write([]byte(`{"call":` + strconv.Itoa(h.calls) + `}`))
+}
+
+func idempotentRequest(username string, key string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/students", strings.NewReader(body))
+	req.Header.Set(idempotencyKeyHeader, key)
+	ctx := auth.NewContext(req.Context(), &auth.Payload{Username: username, TenantID: 1})
+	return req.WithContext(ctx)
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `{"call":1}`, w.Body.String())
+	require.Empty(t, w.Header().Get(idempotentReplayedHeader))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `{"call":1}`, w.Body.String())
+	require.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+	require.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, 1, next.calls)
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"Jane Doe"}`))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Equal(t, 1, next.calls)
+}
+
+func TestIdempotencyKeyInProgress(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(store, log.NewNopLogger())(next)
+
+	// The first request has created the key, but not answered yet.
+	req := idempotentRequest("john", "k1", `{"fullname":"John Doe"}`)
+	_, err := store.CreateIdempotencyKey(context.Background(), db.CreateIdempotencyKeyParams{
+		TenantID:    1,
+		Actor:       "john",
+		Key:         "k1",
+		RequestHash: requestHash(req, []byte(`{"fullname":"John Doe"}`)),
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Zero(t, next.calls)
+}
+
+func TestIdempotencyKeyPerActor(t *testing.T) {
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+	require.Equal(t, `{"call":1}`, w.Body.String())
+
+	// Another caller with the same key and body is not answered with the
+	// response of john.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("jane", "k1", `{"fullname":"John Doe"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `{"call":2}`, w.Body.String())
+	require.Empty(t, w.Header().Get(idempotentReplayedHeader))
+}
+
+func TestIdempotencyWithoutTenant(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	next := &countingHandler{status: http.StatusUnauthorized}
+	handler := IdempotencyMiddleware(store, log.NewNopLogger())(next)
+
+	// Anonymous requests are passed on, to be refused, and their key is not
+	// stored for any tenant.
+	req := httptest.NewRequest(http.MethodPost, "/students", strings.NewReader(`{"fullname":"John Doe"}`))
+	req.Header.Set(idempotencyKeyHeader, "k1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, 1, next.calls)
+	require.Empty(t, store.keys)
+}
+
+func TestIdempotencyRequestTooLarge(t *testing.T) {
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k1", strings.Repeat("a", idempotencyMaxRequestBody+1)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.Zero(t, next.calls)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("john", "k2", strings.Repeat("a", idempotencyMaxRequestBody)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, next.calls)
+}
+
+func TestIdempotencyServerErrorReleasesKey(t *testing.T) {
+	next := &countingHandler{status: http.StatusServiceUnavailable}
+	handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	}
+	require.Equal(t, 2, next.calls)
+}
+
+func TestIdempotencyStoredStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		calls  int
+	}{
+		{http.StatusCreated, 1},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusConflict, 1},
+		{http.StatusPreconditionFailed, 1},
+		{http.StatusUnauthorized, 2},
+		{http.StatusForbidden, 2},
+		{http.StatusRequestTimeout, 2},
+		{http.StatusTooManyRequests, 2},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			next := &countingHandler{status: tt.status}
+			handler := IdempotencyMiddleware(newMemoryIdempotencyStore(), log.NewNopLogger())(next)
+
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, idempotentRequest("john", "k1", `{"fullname":"John Doe"}`))
+				require.Equal(t, tt.status, w.Code)
+			}
+			require.Equal(t, tt.calls, next.calls)
+		})
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	next := &countingHandler{}
+	handler := IdempotencyMiddleware(store, log.NewNopLogger())(next)
+
+	require.PanicsWithValue(t, "handler failed", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest("john", "k1", "panic"))
+	})
+	_, err := store.GetIdempotencyKey(context.Background(), db.GetIdempotencyKeyParams{TenantID: 1, Actor: "john", Key: "k1"})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// The retry is served, not answered as in progress.
+	require.Panics(t, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest("john", "k1", "panic"))
+	})
+	require.Equal(t, 2, next.calls)
+}
@@ -2,11 +2,14 @@ package service
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"students/client"
+	"students/logging"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 )
 
 type Middleware func(Service) Service
@@ -24,46 +27,69 @@ type loggingMiddleware struct {
 	next   Service
 }
 
+// log returns the logger of a call that ended with err, tagged with the
+// request and trace IDs of ctx.
+func (mw loggingMiddleware) log(ctx context.Context, err error) log.Logger {
+	logger := logging.WithContext(ctx, mw.logger)
+	if err != nil {
+		return level.Error(logger)
+	}
+	return level.Info(logger)
+}
+
 func (mw loggingMiddleware) GetStudent(ctx context.Context, id string) (student Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetStudent", "id", id, "student", student, "err", err)
+		mw.log(ctx, err).Log("method", "GetStudent", "id", id, "student", logging.Redact(student), "err", err)
 	}()
 	return mw.next.GetStudent(ctx, id)
 }
 func (mw loggingMiddleware) GetStudentList(ctx context.Context, limit int, offset int) (students []Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetStudentList", "limit", limit, "offset", offset, "students length", len(students), "err", err)
+		mw.log(ctx, err).Log("method", "GetStudentList", "limit", limit, "offset", offset, "students length", len(students), "err", err)
 	}()
 	return mw.next.GetStudentList(ctx, limit, offset)
 }
 func (mw loggingMiddleware) CreateStudent(ctx context.Context, fullname string, dateofbirth time.Time, grade int, phone int) (student Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "CreateStudent", "student", student, "err", err)
+		mw.log(ctx, err).Log("method", "CreateStudent", "student", logging.Redact(student), "err", err)
 	}()
 	return mw.next.CreateStudent(ctx, fullname, dateofbirth, grade, phone)
 }
 func (mw loggingMiddleware) UpdateStudent(ctx context.Context, id string, student Student) (studentR Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "UpdateStudent", "id", id, "student", studentR, "err", err)
+		mw.log(ctx, err).Log("method", "UpdateStudent", "id", id, "student", logging.Redact(studentR), "err", err)
 	}()
 	return mw.next.UpdateStudent(ctx, id, student)
 }
+func (mw loggingMiddleware) PatchStudent(ctx context.Context, id string, patch []byte, version int64) (student Student, err error) {
+	defer func() {
+		mw.log(ctx, err).Log("method", "PatchStudent", "id", id, "version", version, "student", logging.Redact(student), "err", err)
+	}()
+	return mw.next.PatchStudent(ctx, id, patch, version)
+}
 func (mw loggingMiddleware) DeleteStudent(ctx context.Context, id string) (err error) {
 	defer func() {
-		mw.logger.Log("method", "DeleteStudent", "id", id, "err", err)
+		mw.log(ctx, err).Log("method", "DeleteStudent", "id", id, "err", err)
 	}()
 	return mw.next.DeleteStudent(ctx, id)
 }
-func (mw loggingMiddleware) GetStudentCourses(ctx context.Context, id string) (courses []client.Course, err error) {
+func (mw loggingMiddleware) GetStudentCourses(ctx context.Context, id string) (courses []client.Course, missing []string, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetCourses", "id", id, "len", len(courses), "err", err)
+		mw.log(ctx, err).Log("method", "GetCourses", "id", id, "len", len(courses), "missing", strings.Join(missing, ","), "err", err)
 	}()
 	return mw.next.GetStudentCourses(ctx, id)
 }
 
 func (mw loggingMiddleware) GetCourseStudents(ctx context.Context, id string) (students []Student, err error) {
 	defer func() {
-		mw.logger.Log("method", "GetCourseStudents", "id", id, "len", len(students), "err", err)
+		mw.log(ctx, err).Log("method", "GetCourseStudents", "id", id, "len", len(students), "err", err)
 	}()
 	return mw.next.GetCourseStudents(ctx, id)
 }
+
+func (mw loggingMiddleware) ListAuditRecords(ctx context.Context, filter AuditFilter) (records []AuditRecord, err error) {
+	defer func() {
+		mw.log(ctx, err).Log("method", "ListAuditRecords", "entity", filter.Entity, "entity_id", filter.EntityID, "actor", filter.Actor, "len", len(records), "err", err)
+	}()
+	return mw.next.ListAuditRecords(ctx, filter)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"students/auth"
+	"students/client"
+	"students/health"
+	"students/resilience"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/log"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// stubService answers every call with fixed data. The ID "404" is not
+// found.
+type stubService struct{}
+
+var stubStudent = Student{
+	ID:          1,
+	Fullname:    "John Doe",
+	DateOfBirth: time.Date(2008, 5, 1, 0, 0, 0, 0, time.UTC),
+	Grade:       9,
+	Phone:       77011234567,
+	Version:     2,
+}
+
+func (stubService) GetStudent(_ context.Context, id string) (Student, error) {
+	if id == "404" {
+		return Student{}, ErrNotFound
+	}
+	return stubStudent, nil
+}
+
+func (stubService) GetStudentList(context.Context, int, int) ([]Student, error) {
+	return []Student{stubStudent}, nil
+}
+
+func (stubService) CreateStudent(context.Context, string, time.Time, int, int) (Student, error) {
+	return stubStudent, nil
+}
+
+func (stubService) UpdateStudent(_ context.Context, _ string, student Student) (Student, error) {
+	if student.Version != anyVersion && student.Version != stubStudent.Version {
+		return Student{}, ErrVersionMismatch
+	}
+	return stubStudent, nil
+}
+
+func (stubService) PatchStudent(context.Context, string, []byte, int64) (Student, error) {
+	return stubStudent, nil
+}
+
+func (stubService) DeleteStudent(context.Context, string) error {
+	return nil
+}
+
+func (stubService) GetStudentCourses(context.Context, string) ([]client.Course, []string, error) {
+	return []client.Course{{ID: 1, Name: "Math", Version: 1}}, []string{"404"}, nil
+}
+
+func (stubService) GetCourseStudents(context.Context, string) ([]Student, error) {
+	return []Student{}, nil
+}
+
+func (stubService) ListAuditRecords(context.Context, AuditFilter) ([]AuditRecord, error) {
+	return []AuditRecord{{
+		ID:        1,
+		Actor:     "admin",
+		Action:    "update",
+		Entity:    "student",
+		EntityID:  "1",
+		Before:    json.RawMessage(`{"grade":8}`),
+		After:     json.RawMessage(`{"grade":9}`),
+		Diff:      json.RawMessage(`{"grade":{"from":8,"to":9}}`),
+		CreatedAt: time.Now().UTC(),
+	}}, nil
+}
+
+// stubAPIKeys only knows the key "lms_valid", of the user john, and can not
+// verify "lms_down".
+type stubAPIKeys struct{}
+
+func (stubAPIKeys) VerifyAPIKey(_ context.Context, key string) (*auth.Payload, error) {
+	switch key {
+	case "lms_valid":
+		return &auth.Payload{Username: "john", StudentID: 1, TenantID: 1, APIKeyID: 1, Scopes: []string{"students:read"}}, nil
+	case "lms_down":
+		return nil, errors.New("auth_svc answered 503 Service Unavailable")
+	}
+	return nil, auth.ErrInvalidToken
+}
+
+// TestOpenAPI sends requests that conform to openapi.yaml to the HTTP
+// handler and checks that the responses conform to it too.
+func TestOpenAPI(t *testing.T) {
+	spec, err := openapi3.NewLoader().LoadFromData(OpenAPISpec)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(context.Background()))
+	router, err := gorillamux.NewRouter(spec)
+	require.NoError(t, err)
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.RegisteredBodyDecoder("application/json"))
+
+	const secretKey = "12345678901234567890123456789012"
+	verifier, err := auth.NewJWTVerifier(secretKey)
+	require.NoError(t, err)
+	bearer := func(payload auth.Payload) http.Header {
+		payload.ExpiredAt = time.Now().Add(time.Minute)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &payload).SignedString([]byte(secretKey))
+		require.NoError(t, err)
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+	// The LMS apps act for a user of tenant 1, granted the read and write
+	// scopes with USER_TOKEN_SCOPES.
+	app := bearer(auth.Payload{Username: "admin", TenantID: 1, Scopes: []string{auth.ScopeStudentsRead, auth.ScopeStudentsWrite, auth.ScopeCoursesRead, auth.ScopeCoursesWrite}})
+	token := app.Get("Authorization")
+	readOnly := auth.Payload{ClientID: "grading", TenantID: 1, Scopes: []string{auth.ScopeStudentsRead}}
+	readWrite := auth.Payload{ClientID: "grading", TenantID: 1, Scopes: []string{auth.ScopeStudentsRead, auth.ScopeStudentsWrite}}
+	logger := log.NewNopLogger()
+	endpoints := MakeServerEndpoints(stubService{}, logger, discard.NewHistogram(), resilience.Config{}, discard.NewGauge())
+	handler := health.New().Handler(auth.HTTPMiddleware(verifier, nil, stubAPIKeys{})(MakeHTTPHandler(endpoints, logger)))
+
+	etag := formatETag(stubStudent.Version)
+	testCases := []struct {
+		method string
+		path   string
+		header http.Header
+		body   string
+		status int
+	}{
+		{method: "GET", path: "/students?Limit=10&Offset=0", header: app, status: http.StatusOK},
+		{method: "GET", path: "/students/1", header: app, status: http.StatusOK},
+		{method: "GET", path: "/students/404", header: app, status: http.StatusNotFound},
+		{method: "GET", path: "/students/1", status: http.StatusUnauthorized},
+		{method: "GET", path: "/students/1", header: bearer(auth.Payload{Username: "admin"}), status: http.StatusUnauthorized},
+		{method: "GET", path: "/students/1", header: bearer(readOnly), status: http.StatusOK},
+		{method: "DELETE", path: "/students/1", header: bearer(readOnly), status: http.StatusForbidden},
+		// The default USER_TOKEN_SCOPES are read-only.
+		{method: "DELETE", path: "/students/1", header: bearer(auth.Payload{Username: "john", TenantID: 1, Scopes: []string{"profile", auth.ScopeStudentsRead, auth.ScopeCoursesRead}}), status: http.StatusForbidden},
+		{method: "DELETE", path: "/students/1", header: bearer(readWrite), status: http.StatusOK},
+		{method: "GET", path: "/students/1", header: bearer(auth.Payload{ClientID: "sync", TenantID: 1, Scopes: []string{auth.ScopeCoursesRead}}), status: http.StatusForbidden},
+		{
+			method: "POST",
+			path:   "/students",
+			header: http.Header{"Authorization": {token}, "Content-Type": {"application/json"}, "Idempotency-Key": {"k1"}},
+			body:   `{"fullname":"John Doe","dateofbirth":"2008-05-01T00:00:00Z","grade":9,"phone":77011234567}`,
+			status: http.StatusOK,
+		},
+		{
+			method: "PUT",
+			path:   "/students/1",
+			header: http.Header{"Authorization": {token}, "Content-Type": {"application/json"}, "If-Match": {etag}},
+			body:   `{"fullname":"John Doe","date_of_birth":"2008-05-01T00:00:00Z","grade":10,"phone":77011234567}`,
+			status: http.StatusOK,
+		},
+		{
+			method: "PUT",
+			path:   "/students/1",
+			header: http.Header{"Authorization": {token}, "Content-Type": {"application/json"}, "If-Match": {`"1"`}},
+			body:   `{"fullname":"John Doe","date_of_birth":"2008-05-01T00:00:00Z","grade":10,"phone":77011234567}`,
+			status: http.StatusPreconditionFailed,
+		},
+		{
+			method: "PUT",
+			path:   "/students/1",
+			header: http.Header{"Authorization": {token}, "Content-Type": {"application/json"}, "If-Match": {"*"}},
+			body:   `{"fullname":"John Doe","date_of_birth":"2008-05-01T00:00:00Z","grade":10,"phone":77011234567}`,
+			status: http.StatusOK,
+		},
+		{
+			method: "PATCH",
+			path:   "/students/1",
+			header: http.Header{"Authorization": {token}, "Content-Type": {"application/merge-patch+json"}, "If-Match": {etag}},
+			body:   `{"grade":10}`,
+			status: http.StatusOK,
+		},
+		{method: "DELETE", path: "/students/1", header: app, status: http.StatusOK},
+		{method: "GET", path: "/students/1/courses", header: app, status: http.StatusOK},
+		{method: "GET", path: "/students/me/courses", header: bearer(auth.Payload{Username: "john", StudentID: 1, TenantID: 1, Scopes: []string{auth.ScopeStudentsRead, auth.ScopeCoursesRead}}), status: http.StatusOK},
+		{method: "GET", path: "/students/me/courses", header: app, status: http.StatusNotFound},
+		{method: "GET", path: "/students/me/courses", status: http.StatusUnauthorized},
+		{method: "GET", path: "/students/me/courses", header: http.Header{"X-Api-Key": {"lms_valid"}}, status: http.StatusOK},
+		{method: "GET", path: "/students/me/courses", header: http.Header{"X-Api-Key": {"lms_revoked"}}, status: http.StatusUnauthorized},
+		{method: "GET", path: "/students/me/courses", header: http.Header{"X-Api-Key": {"lms_down"}}, status: http.StatusServiceUnavailable},
+		{method: "GET", path: "/students/1", header: http.Header{"X-Api-Key": {"lms_valid"}}, status: http.StatusOK},
+		{method: "DELETE", path: "/students/1", header: http.Header{"X-Api-Key": {"lms_valid"}}, status: http.StatusForbidden},
+		{method: "GET", path: "/courses/1/students", header: app, status: http.StatusOK},
+		{method: "GET", path: "/healthz", status: http.StatusOK},
+		{method: "GET", path: "/readyz", status: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost:8081"+tc.path, bytes.NewBufferString(tc.body))
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			route, pathParams, err := router.FindRoute(req)
+			require.NoError(t, err)
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+			if tc.status != http.StatusBadRequest {
+				require.NoError(t, openapi3filter.ValidateRequest(context.Background(), requestInput))
+			}
+			req.Body = io.NopCloser(bytes.NewBufferString(tc.body))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+
+			responseInput := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 w.Code,
+				Header:                 w.Header(),
+				Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+			}
+			responseInput.SetBodyBytes(w.Body.Bytes())
+			require.NoError(t, openapi3filter.ValidateResponse(context.Background(), responseInput))
+		})
+	}
+}
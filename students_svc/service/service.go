@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -9,9 +11,9 @@ import (
 
 	db "students/db/sqlc"
 
+	"students/auth"
 	"students/client"
 
-	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/log"
 )
 
@@ -20,17 +22,19 @@ type Service interface {
 	GetStudentList(ctx context.Context, limit int, offset int) ([]Student, error)
 	CreateStudent(ctx context.Context, fullname string, dateofbirth time.Time, grade int, phone int) (Student, error)
 	UpdateStudent(ctx context.Context, id string, student Student) (Student, error)
+	PatchStudent(ctx context.Context, id string, patch []byte, version int64) (Student, error)
 	DeleteStudent(ctx context.Context, id string) error
-	GetStudentCourses(ctx context.Context, id string) ([]client.Course, error)
+	GetStudentCourses(ctx context.Context, id string) ([]client.Course, []string, error)
 	GetCourseStudents(ctx context.Context, id string) ([]Student, error)
+	ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error)
 }
 
-func New(r *db.Queries, courseSvc client.CourseServiceClient, logger log.Logger, counter metrics.Counter, latency metrics.Histogram) Service {
+func New(r *Store, courseSvc client.CourseServiceClient, logger log.Logger) Service {
 	var svc Service
 	{
 		svc = NewStudentService(r, courseSvc)
+		svc = AuditMiddleware(r)(svc)
 		svc = LoggingMiddleware(logger)(svc)
-		svc = NewInstrumentingService(counter, latency, svc)
 	}
 	return svc
 }
@@ -40,9 +44,24 @@ var (
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
 	ErrDB              = errors.New("db error")
+	ErrInvalidFilter   = errors.New("invalid filter")
+	ErrInvalidPatch    = errors.New("invalid merge patch")
+	// ErrVersionMismatch is returned when the If-Match version of an update
+	// does not match the stored one, i.e. someone else changed the entity.
+	ErrVersionMismatch      = errors.New("version mismatch")
+	ErrPreconditionRequired = errors.New("If-Match header is required")
+	// ErrUpstreamTimeout and ErrUpstreamUnavailable are returned when
+	// courses_svc did not answer in time or failed.
+	ErrUpstreamTimeout     = errors.New("courses service timed out")
+	ErrUpstreamUnavailable = errors.New("courses service unavailable")
+	// ErrNoStudent is returned for the courses of the caller when its user
+	// is not linked to a student.
+	ErrNoStudent = errors.New("user is not linked to a student")
 )
 
-func NewStudentService(r *db.Queries, courseSvc client.CourseServiceClient) Service {
+// NewStudentService returns the service. Its mutations join the transaction
+// of the audit middleware, see AuditMiddleware.
+func NewStudentService(r *Store, courseSvc client.CourseServiceClient) Service {
 	return &studentService{
 		r:         r,
 		CourseSvc: courseSvc,
@@ -50,7 +69,7 @@ func NewStudentService(r *db.Queries, courseSvc client.CourseServiceClient) Serv
 }
 
 type studentService struct {
-	r         *db.Queries
+	r         *Store
 	CourseSvc client.CourseServiceClient
 }
 
@@ -58,8 +77,20 @@ type Student struct {
 	ID          int64     `json:"id,omitempty"`
 	Fullname    string    `json:"fullname"`
 	DateOfBirth time.Time `json:"date_of_birth"`
-	Grade       int       `json:"grade,omitempty"`
+	Grade       int       `json:"grade"`
 	Phone       int64     `json:"phone"`
+	Version     int64     `json:"version,omitempty"`
+}
+
+func newStudent(result db.Student) Student {
+	return Student{
+		ID:          result.ID,
+		Fullname:    result.Fullname,
+		DateOfBirth: result.DateOfBirth,
+		Grade:       int(result.Grade),
+		Phone:       result.Phone,
+		Version:     result.Version,
+	}
 }
 
 func (s *studentService) GetStudent(ctx context.Context, id string) (Student, error) {
@@ -67,14 +98,27 @@ func (s *studentService) GetStudent(ctx context.Context, id string) (Student, er
 	if err != nil {
 		return Student{}, ErrInconsistentIDs
 	}
-	result, err := s.r.GetStudent(ctx, int64(ID))
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Student{}, err
+	}
+	result, err := s.r.GetStudent(ctx, db.GetStudentParams{
+		TenantID: tenantID,
+		ID:       int64(ID),
+	})
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return Student{}, ErrNotFound
+		}
 		return Student{}, ErrDB
 	}
 	return Student{
 		ID:          result.ID,
 		Fullname:    result.Fullname,
 		DateOfBirth: result.DateOfBirth,
+		Grade:       int(result.Grade),
+		Phone:       result.Phone,
+		Version:     result.Version,
 	}, nil
 }
 
@@ -82,9 +126,14 @@ func (s *studentService) GetStudentList(ctx context.Context, limit int, offset i
 	if limit == 0 {
 		limit = 100
 	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return []Student{}, err
+	}
 	p, err := s.r.ListStudents(ctx, db.ListStudentsParams{
-		Limit:  int32(limit),
-		Offset: int32(offset),
+		TenantID: tenantID,
+		Limit:    int32(limit),
+		Offset:   int32(offset),
 	})
 	if err != nil {
 		fmt.Print(err)
@@ -98,102 +147,226 @@ func (s *studentService) GetStudentList(ctx context.Context, limit int, offset i
 			DateOfBirth: result.DateOfBirth,
 			Grade:       int(result.Grade),
 			Phone:       result.Phone,
+			Version:     result.Version,
 		})
 	}
 	return list, nil
 }
 
 func (s *studentService) CreateStudent(ctx context.Context, fullname string, dateofbirth time.Time, grade int, phone int) (Student, error) {
-	result, err := s.r.CreateStudent(ctx, db.CreateStudentParams{
-		Fullname:    fullname,
-		DateOfBirth: dateofbirth,
-		Grade:       int32(grade),
-		Phone:       int64(phone),
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Student{}, err
+	}
+	var result db.Student
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		var err error
+		result, err = q.CreateStudent(ctx, db.CreateStudentParams{
+			Fullname:    fullname,
+			DateOfBirth: dateofbirth,
+			Grade:       int32(grade),
+			Phone:       int64(phone),
+			TenantID:    tenantID,
+		})
+		return err
 	})
 	if err != nil {
 		return Student{}, ErrDB
 	}
-	return Student{
-		ID:          result.ID,
-		Fullname:    result.Fullname,
-		DateOfBirth: result.DateOfBirth,
-		Grade:       int(result.Grade),
-		Phone:       result.Phone,
-	}, nil
+	return newStudent(result), nil
 }
 
+// UpdateStudent overwrites the student, provided that student.Version
+// still matches the stored version, or is anyVersion. The student is
+// locked while it is compared and updated.
 func (s *studentService) UpdateStudent(ctx context.Context, id string, student Student) (Student, error) {
 	ID, err := strconv.Atoi(id)
 	if err != nil {
 		return Student{}, ErrInconsistentIDs
 	}
-	result, err := s.r.UpdateStudent(ctx, db.UpdateStudentParams{
-		ID:          int64(ID),
-		Fullname:    student.Fullname,
-		DateOfBirth: student.DateOfBirth,
-		Grade:       int32(student.Grade),
-		Phone:       int64(student.Phone),
+	if student.Version == 0 {
+		return Student{}, ErrPreconditionRequired
+	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Student{}, err
+	}
+	var result db.Student
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		before, err := q.GetStudentForUpdate(ctx, db.GetStudentForUpdateParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+		if err != nil {
+			return err
+		}
+		if student.Version != anyVersion && before.Version != student.Version {
+			return ErrVersionMismatch
+		}
+		result, err = q.UpdateStudent(ctx, db.UpdateStudentParams{
+			ID:          int64(ID),
+			Fullname:    student.Fullname,
+			DateOfBirth: student.DateOfBirth,
+			Grade:       int32(student.Grade),
+			Phone:       int64(student.Phone),
+			Version:     before.Version,
+			TenantID:    tenantID,
+		})
+		return err
 	})
+	switch {
+	case err == nil:
+		return newStudent(result), nil
+	case errors.Is(err, sql.ErrNoRows):
+		return Student{}, ErrNotFound
+	case errors.Is(err, ErrVersionMismatch):
+		return Student{}, ErrVersionMismatch
+	}
+	return Student{}, ErrDB
+}
+
+// PatchStudent applies a JSON Merge Patch to the student. The student is read
+// and updated in one transaction, so that "If-Match: *" patches the latest
+// version even when it changes concurrently.
+func (s *studentService) PatchStudent(ctx context.Context, id string, patch []byte, version int64) (Student, error) {
+	if version == 0 {
+		return Student{}, ErrPreconditionRequired
+	}
+	ID, err := strconv.Atoi(id)
 	if err != nil {
-		return Student{}, ErrDB
+		return Student{}, ErrInconsistentIDs
 	}
-	return Student{
-		ID:          result.ID,
-		Fullname:    result.Fullname,
-		DateOfBirth: result.DateOfBirth,
-		Grade:       int(result.Grade),
-		Phone:       result.Phone,
-	}, nil
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return Student{}, err
+	}
+	var result Student
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		current, err := q.GetStudentForUpdate(ctx, db.GetStudentForUpdateParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+		if err != nil {
+			return err
+		}
+		if version != anyVersion && current.Version != version {
+			return ErrVersionMismatch
+		}
+		doc, err := json.Marshal(newStudent(current))
+		if err != nil {
+			return err
+		}
+		patched, err := mergePatch(doc, patch)
+		if err != nil {
+			return ErrInvalidPatch
+		}
+		var student Student
+		if err := json.Unmarshal(patched, &student); err != nil {
+			return ErrInvalidPatch
+		}
+		// The student is locked, UpdateStudent joins the transaction and
+		// finds it unchanged.
+		student.Version = current.Version
+		result, err = s.UpdateStudent(ctx, id, student)
+		return err
+	})
+	switch {
+	case err == nil:
+		return result, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return Student{}, ErrNotFound
+	case errors.Is(err, ErrVersionMismatch), errors.Is(err, ErrInvalidPatch), errors.Is(err, ErrNotFound):
+		return Student{}, err
+	}
+	return Student{}, ErrDB
 }
 
+// DeleteStudent deletes the student, if it exists.
 func (s *studentService) DeleteStudent(ctx context.Context, id string) error {
 	ID, err := strconv.Atoi(id)
 	if err != nil {
 		return ErrInconsistentIDs
 	}
-	err = s.r.DeleteStudent(ctx, int64(ID))
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.r.execTx(ctx, func(ctx context.Context, q *db.Queries) error {
+		return q.DeleteStudent(ctx, db.DeleteStudentParams{
+			TenantID: tenantID,
+			ID:       int64(ID),
+		})
+	})
 	if err != nil {
 		return ErrDB
 	}
 	return nil
 }
 
-func (s *studentService) GetStudentCourses(ctx context.Context, id string) ([]client.Course, error) {
+// courseBatchSize is the maximum number of courses fetched per request.
+const courseBatchSize = 100
+
+// GetStudentCourses returns the courses the student is enrolled in. The IDs
+// of enrolled courses that courses_svc no longer has are returned in missing.
+func (s *studentService) GetStudentCourses(ctx context.Context, id string) ([]client.Course, []string, error) {
 	ID, err := strconv.Atoi(id)
 	if err != nil {
-		return nil, ErrInconsistentIDs
+		return nil, nil, ErrInconsistentIDs
+	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 	enrollments, err := s.r.GetEnrollmentsByStudentID(ctx, db.GetEnrollmentsByStudentIDParams{
+		TenantID:  tenantID,
 		StudentID: int64(ID),
 		Offset:    0,
 		Limit:     1000,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	results := make(chan client.Course)
-	errs := make(chan error)
-
-	courseList := make([]client.Course, 0)
-
+	ids := make([]string, 0, len(enrollments))
 	for _, v := range enrollments {
-		go func(courseID int64) {
-			id := strconv.Itoa(int(courseID))
-			course, err := s.CourseSvc.GetCourse(ctx, id)
-			errs <- err
-			results <- course
-		}(v.CourseID)
-	}
-	for i := 0; i < len(enrollments); i++ {
-		err := <-errs
+		ids = append(ids, strconv.FormatInt(v.CourseID, 10))
+	}
+
+	// Courses are fetched in batches, courses_svc accepts up to 100 IDs
+	// per request. Courses that no longer exist are reported in missing.
+	courseList := make([]client.Course, 0, len(ids))
+	missing := make([]string, 0)
+	for start := 0; start < len(ids); start += courseBatchSize {
+		end := start + courseBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		courses, missingIDs, err := s.CourseSvc.GetCourses(ctx, ids[start:end])
 		if err != nil {
-			return nil, err
+			return nil, nil, courseClientError(err)
 		}
-		courseList = append(courseList, <-results)
+		courseList = append(courseList, courses...)
+		missing = append(missing, missingIDs...)
 	}
 
-	return courseList, nil
+	return courseList, missing, nil
+}
+
+// courseClientError maps an error of the courses client to a service error.
+// The courses service refusing the credentials of the caller refuses the
+// request, rather than failing it.
+func courseClientError(err error) error {
+	switch {
+	case errors.Is(err, client.ErrTimeout):
+		return ErrUpstreamTimeout
+	case errors.Is(err, client.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return auth.ErrUnauthenticated
+	case errors.Is(err, auth.ErrInsufficientScope):
+		return auth.ErrInsufficientScope
+	}
+	return ErrUpstreamUnavailable
 }
 
 func (s *studentService) GetCourseStudents(ctx context.Context, id string) ([]Student, error) {
@@ -201,7 +374,12 @@ func (s *studentService) GetCourseStudents(ctx context.Context, id string) ([]St
 	if err != nil {
 		return nil, ErrInconsistentIDs
 	}
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
 	res, err := s.r.GetStudentsByCourseID(ctx, db.GetStudentsByCourseIDParams{
+		TenantID: tenantID,
 		CourseID: int64(ID),
 		Offset:   0,
 		Limit:    1000,
@@ -209,7 +387,7 @@ func (s *studentService) GetCourseStudents(ctx context.Context, id string) ([]St
 	if err != nil {
 		return nil, err
 	}
-	list := make([]Student, len(res))
+	list := make([]Student, 0, len(res))
 	for _, result := range res {
 		list = append(list, Student{
 			ID:          result.ID,
@@ -217,7 +395,24 @@ func (s *studentService) GetCourseStudents(ctx context.Context, id string) ([]St
 			DateOfBirth: result.DateOfBirth,
 			Grade:       int(result.Grade),
 			Phone:       result.Phone,
+			Version:     result.Version,
 		})
 	}
 	return list, nil
 }
+
+func (s *studentService) ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error) {
+	tenantID, err := callerTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.r.ListAuditRecords(ctx, newAuditRecordsParams(tenantID, filter))
+	if err != nil {
+		return nil, ErrDB
+	}
+	list := make([]AuditRecord, 0, len(res))
+	for _, result := range res {
+		list = append(list, newAuditRecord(result))
+	}
+	return list, nil
+}
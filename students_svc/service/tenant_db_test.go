@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"students/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDriver records the statements sent on its connections. The
+// reset of the tenant fails when failReset is set.
+type recordingDriver struct {
+	mu        sync.Mutex
+	opened    int
+	queries   []string
+	failReset bool
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.opened++
+	return &recordingConn{d}, nil
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	if query == resetTenantQuery && c.d.failReset {
+		return nil, errors.New("connection reset by peer")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func TestTenantDBResetsConnections(t *testing.T) {
+	d := &recordingDriver{}
+	conn := sql.OpenDB(&tenantConnector{driver: d})
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	tenantDB := NewTenantDB(conn)
+	ctx := auth.NewContext(context.Background(), &auth.Payload{Username: "john", TenantID: 2})
+
+	_, err := tenantDB.ExecContext(ctx, "DELETE FROM students")
+	require.NoError(t, err)
+	// The next user of the connection does not act for tenant 2.
+	_, err = conn.ExecContext(context.Background(), "DELETE FROM enrollments")
+	require.NoError(t, err)
+	require.Equal(t, []string{setTenantQuery, "DELETE FROM students", resetTenantQuery, "DELETE FROM enrollments"}, d.queries)
+	require.Equal(t, 1, d.opened)
+
+	// A connection that can not be reset is replaced.
+	d.failReset = true
+	_, err = conn.ExecContext(context.Background(), "DELETE FROM enrollments")
+	require.NoError(t, err)
+	require.Equal(t, 2, d.opened)
+}
+
+func TestTenantDBWithoutTenant(t *testing.T) {
+	d := &recordingDriver{}
+	conn := sql.OpenDB(&tenantConnector{driver: d})
+	defer conn.Close()
+	tenantDB := NewTenantDB(conn)
+
+	_, err := tenantDB.ExecContext(context.Background(), "DELETE FROM students")
+	require.ErrorIs(t, err, auth.ErrUnauthenticated)
+	require.Empty(t, d.queries)
+}
+
+func TestTenantDBPrepare(t *testing.T) {
+	tenantDB := NewTenantDB(sql.OpenDB(&tenantConnector{driver: &recordingDriver{}}))
+	ctx := auth.NewContext(context.Background(), &auth.Payload{Username: "john", TenantID: 2})
+
+	_, err := tenantDB.PrepareContext(ctx, "SELECT 1")
+	require.ErrorIs(t, err, ErrPrepareUnsupported)
+}
@@ -4,34 +4,51 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
+
+	"students/auth"
 
 	"github.com/gorilla/mux"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/go-kit/log"
+	"github.com/sony/gobreaker"
 )
 
 var (
 	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+	// ErrTenantRequired is returned by the admin endpoints without a valid
+	// tenant_id query parameter.
+	ErrTenantRequired = errors.New("tenant_id is required")
 )
 
-func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
+// adminActor is the actor of the requests of the admin listener.
+const adminActor = "admin"
+
+func MakeHTTPHandler(e Endpoints, logger log.Logger) *mux.Router {
 	r := mux.NewRouter()
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
 	}
 	// GET     /students/                          retrieve students list
 	// GET     /students/:id                       retrieve student by id
-	// POST    /students/                          adds another student
-	// PUT     /students/:id                       post updated student information about the student
+	// POST    /students/                          adds another student, retries are deduplicated by the Idempotency-Key header
+	// PUT     /students/:id                       post updated student information about the student, requires If-Match
+	// PATCH   /students/:id                       partially update the student with a JSON Merge Patch, requires If-Match
 	// DELETE  /students/:id                       remove the given student
+	// GET     /students/me/courses                retrieve the courses of the student of the access token
 	// GET     /students/:id/courses               retrieve student courses by student id
 	// GET	   /courses/:id/students			   retrieve students by course id
+	// GET     /openapi.yaml                       the OpenAPI spec of this API
+	// GET     /docs                               Swagger UI
 	r.Methods("GET").Path("/students").Handler(httptransport.NewServer(
 		e.GetStudentListEndpoint,
 		decodeGetStudentListRequest,
@@ -56,6 +73,12 @@ func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+	r.Methods("PATCH").Path("/students/{id}").Handler(httptransport.NewServer(
+		e.PatchStudentEndpoint,
+		decodePatchStudentRequest,
+		encodeResponse,
+		options...,
+	))
 	r.Methods("DELETE").Path("/students/{id}").Handler(httptransport.NewServer(
 		e.DeleteStudentEndpoint,
 		decodeDeleteStudentRequest,
@@ -63,6 +86,12 @@ func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
 		options...,
 	))
 
+	r.Methods("GET").Path("/students/me/courses").Handler(httptransport.NewServer(
+		e.GetStudentCoursesEndpoint,
+		decodeGetMyCoursesRequest,
+		encodeResponse,
+		options...,
+	))
 	r.Methods("GET").Path("/students/{id}/courses").Handler(httptransport.NewServer(
 		e.GetStudentCoursesEndpoint,
 		decodeGetStudentCoursesRequest,
@@ -76,9 +105,44 @@ func MakeHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
 		encodeResponse,
 		options...,
 	))
+
+	r.Methods("GET").Path("/openapi.yaml").HandlerFunc(serveOpenAPISpec)
+	r.Methods("GET").Path("/docs").HandlerFunc(serveSwaggerUI)
 	return r
 }
 
+// MakeAdminHTTPHandler serves the admin endpoints, which are served on the
+// admin listener, ADMIN_SERVER_ADDRESS, rather than exposed with the public
+// API or the metrics of the debug listener. The audit records
+// hold the personal data of the students, so they are only read there, for
+// the tenant of the tenant_id query parameter.
+func MakeAdminHTTPHandler(e Endpoints, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerBefore(adminTenantToContext),
+	}
+	// GET     /admin/audit?tenant_id=             retrieve audit records filtered by entity, actor and time range
+	r.Methods("GET").Path("/admin/audit").Handler(httptransport.NewServer(
+		e.ListAuditRecordsEndpoint,
+		decodeListAuditRecordsRequest,
+		encodeResponse,
+		options...,
+	))
+	return r
+}
+
+// adminTenantToContext acts for the tenant of the tenant_id query parameter
+// of an admin request, if it is valid.
+func adminTenantToContext(ctx context.Context, r *http.Request) context.Context {
+	tenantID, err := strconv.ParseInt(r.URL.Query().Get("tenant_id"), 10, 64)
+	if err != nil || tenantID < 1 {
+		return ctx
+	}
+	return auth.NewContext(ctx, &auth.Payload{Username: adminActor, TenantID: tenantID})
+}
+
 func decodeGetStudentListRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	limitstr := r.URL.Query().Get("Limit")
 	offsetstr := r.URL.Query().Get("Offset")
@@ -114,12 +178,37 @@ func decodeUpdateStudentRequest(_ context.Context, r *http.Request) (request int
 	if err := json.NewDecoder(r.Body).Decode(&student); err != nil {
 		return nil, err
 	}
+	student.Version, err = parseETag(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
 	return updateStudentRequest{
 		ID:      id,
 		Student: student,
 	}, nil
 }
 
+func decodePatchStudentRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	version, err := parseETag(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
+	return patchStudentRequest{
+		ID:      id,
+		Patch:   patch,
+		Version: version,
+	}, nil
+}
+
 func decodeDeleteStudentRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -138,6 +227,19 @@ func decodeGetStudentCoursesRequest(_ context.Context, r *http.Request) (request
 	return getStudentCoursesRequest{ID: id}, nil
 }
 
+// decodeGetMyCoursesRequest reads the student from the access token, so that
+// students need not know their ID.
+func decodeGetMyCoursesRequest(ctx context.Context, _ *http.Request) (request interface{}, err error) {
+	payload, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	if payload.StudentID == 0 {
+		return nil, ErrNoStudent
+	}
+	return getStudentCoursesRequest{ID: strconv.FormatInt(payload.StudentID, 10)}, nil
+}
+
 func decodeGetCourseStudentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -146,6 +248,31 @@ func decodeGetCourseStudentsRequest(_ context.Context, r *http.Request) (request
 	}
 	return getCourseStudentsRequest{CourseID: id}, nil
 }
+func decodeListAuditRecordsRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return nil, ErrTenantRequired
+	}
+	q := r.URL.Query()
+	filter := AuditFilter{
+		Entity:   q.Get("entity"),
+		EntityID: q.Get("entity_id"),
+		Actor:    q.Get("actor"),
+	}
+	filter.Limit, _ = strconv.Atoi(q.Get("Limit"))
+	filter.Offset, _ = strconv.Atoi(q.Get("Offset"))
+	if from := q.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, ErrInvalidFilter
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, ErrInvalidFilter
+		}
+	}
+	return listAuditRecordsRequest{Filter: filter}, nil
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(endpoint.Failer); ok && e.Failed() != nil {
 		// Not a Go kit transport error, but a business-logic error.
@@ -153,25 +280,57 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 		errorEncoder(ctx, e.Failed(), w)
 		return nil
 	}
+	if e, ok := response.(etagger); ok && e.ETag() != "" {
+		w.Header().Set("ETag", e.ETag())
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
 }
 
 func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(err2code(err))
 	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
 }
 
 func err2code(err error) int {
 	switch err {
-	case ErrBadRouting, ErrInconsistentIDs:
+	case ErrBadRouting, ErrInconsistentIDs, ErrInvalidFilter, ErrInvalidPatch, ErrTenantRequired:
 		return http.StatusBadRequest
-	case ErrNotFound:
+	case auth.ErrUnauthenticated:
+		return http.StatusUnauthorized
+	case auth.ErrInsufficientScope:
+		return http.StatusForbidden
+	case ErrNotFound, ErrNoStudent:
 		return http.StatusNotFound
+	case ErrVersionMismatch:
+		return http.StatusPreconditionFailed
+	case ErrIdempotencyKeyReused:
+		return http.StatusUnprocessableEntity
+	case ErrIdempotencyKeyInProgress:
+		return http.StatusConflict
+	case ErrRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case ratelimit.ErrLimited:
+		return http.StatusTooManyRequests
+	case gobreaker.ErrOpenState, gobreaker.ErrTooManyRequests:
+		return http.StatusServiceUnavailable
+	case context.DeadlineExceeded, ErrUpstreamTimeout:
+		return http.StatusGatewayTimeout
+	case ErrUpstreamUnavailable:
+		return http.StatusBadGateway
 	}
 	return http.StatusInternalServerError
 }
 
+// serverFailure reports whether err is answered with a server error, which
+// the circuit breaker of the endpoint counts as a failure.
+func serverFailure(err error) bool {
+	return err2code(err) >= http.StatusInternalServerError
+}
+
 type errorWrapper struct {
 	Error string `json:"error"`
 }
@@ -0,0 +1,23 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// NewHandler traces the requests served by handler, continuing the trace of
+// the caller given in the traceparent header.
+func NewHandler(handler http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(handler, operation,
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return operation + " " + r.Method
+		}),
+	)
+}
+
+// NewClient returns an HTTP client that traces its requests and passes the
+// trace on in the traceparent header.
+func NewClient() *http.Client {
+	return &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+}
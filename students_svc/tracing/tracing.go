@@ -0,0 +1,61 @@
+// Package tracing sets up OpenTelemetry tracing and instruments endpoints,
+// HTTP servers and clients, and database calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// instrumentationName identifies the tracer of this service.
+const instrumentationName = "students"
+
+// Init installs the global tracer provider and the W3C trace context
+// propagator. exporter is "otlp", which sends spans over HTTP to
+// otlpEndpoint (host:port), "stdout", or "none". The returned function
+// flushes the remaining spans.
+func Init(ctx context.Context, serviceName, exporter, otlpEndpoint string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(otlpEndpoint),
+			otlptracehttp.WithInsecure(),
+		)
+	case "stdout":
+		spanExporter, err = stdouttrace.New()
+	case "none", "":
+		return func(context.Context) error { return nil }, nil
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewProvider(serviceName, sdktrace.NewBatchSpanProcessor(spanExporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider of serviceName that passes the
+// spans to processor. Tests use it with a tracetest.InMemoryExporter.
+func NewProvider(serviceName string, processor sdktrace.SpanProcessor) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
@@ -12,13 +12,26 @@ type Config struct {
 	Environment              string        `mapstructure:"ENVIRONMENT"`
 	DBDriver                 string        `mapstructure:"DB_DRIVER"`
 	DBSource                 string        `mapstructure:"DB_SOURCE"`
+	DBRowLevelSecurity       bool          `mapstructure:"DB_ROW_LEVEL_SECURITY"`
 	MigrationURL             string        `mapstructure:"MIGRATION_URL"`
+	MigrationDBSource        string        `mapstructure:"MIGRATION_DB_SOURCE"`
 	RedisAddress             string        `mapstructure:"REDIS_ADDRESS"`
 	HTTP_PORT                string        `mapstructure:"HTTP_PORT"`
 	TokenSymmetricKey        string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
 	AccessTokenDuration      time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
 	RefreshTokenDuration     time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
 	CoursesHTTPServerAddress string        `mapstructure:"COURSES_HTTP_SERVER_ADDRESS"`
+	AuthHTTPServerAddress    string        `mapstructure:"AUTH_HTTP_SERVER_ADDRESS"`
+	AdminServerAddress       string        `mapstructure:"ADMIN_SERVER_ADDRESS"`
+	ConsulAddress            string        `mapstructure:"CONSUL_ADDRESS"`
+	AdvertiseAddress         string        `mapstructure:"ADVERTISE_ADDRESS"`
+	CourseCacheTTL           time.Duration `mapstructure:"COURSE_CACHE_TTL"`
+	CacheSize                int           `mapstructure:"CACHE_SIZE"`
+	ResilienceConfigFile     string        `mapstructure:"RESILIENCE_CONFIG_FILE"`
+	TrustedProxies           string        `mapstructure:"TRUSTED_PROXIES"`
+	TracingExporter          string        `mapstructure:"TRACING_EXPORTER"`
+	TracingOTLPEndpoint      string        `mapstructure:"TRACING_OTLP_ENDPOINT"`
+	LogLevel                 string        `mapstructure:"LOG_LEVEL"`
 }
 
 // LoadConfig reads configuration from file or environment variables.